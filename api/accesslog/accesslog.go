@@ -0,0 +1,231 @@
+// Package accesslog writes one line per function call, either as JSON or in
+// the Apache combined log format, to stdout, a rotating file or syslog.
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidFormat = errors.New("Invalid access log format, expected json or combined")
+	ErrInvalidSink   = errors.New("Invalid access log sink")
+)
+
+// Entry is the record of a single function call.
+type Entry struct {
+	Time        time.Time
+	RemoteAddr  string
+	Method      string
+	URL         string
+	Proto       string
+	Referer     string
+	UserAgent   string
+	AppName     string
+	Route       string
+	Target      string
+	CallID      string
+	Status      int
+	BytesIn     int64
+	BytesOut    int64
+	WaitTime    time.Duration
+	ExecTime    time.Duration
+	Hot         bool
+	ContainerID string
+}
+
+// Logger writes Entries to a sink. A nil *Logger discards everything, so it
+// can be used unconditionally whether access logging is enabled or not.
+type Logger struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format func(*bytes.Buffer, *Entry)
+	buf    bytes.Buffer
+}
+
+// New creates a Logger writing in the given format ("json", the default, or
+// "combined") to sink, which is one of:
+//
+//	stdout
+//	stderr
+//	file:///var/log/functions/access.log?max_size=100&max_backups=5
+//	syslog://[host:port]?network=udp&tag=functions
+//
+// max_size is in megabytes; a file is rotated once it grows past it. An
+// empty sink disables access logging and returns a nil *Logger.
+func New(sink, format string) (*Logger, error) {
+	if sink == "" {
+		return nil, nil
+	}
+
+	l := &Logger{}
+	switch format {
+	case "", "json":
+		l.format = formatJSON
+	case "combined":
+		l.format = formatCombined
+	default:
+		return nil, ErrInvalidFormat
+	}
+
+	switch sink {
+	case "stdout":
+		l.w = os.Stdout
+		return l, nil
+	case "stderr":
+		l.w = os.Stderr
+		return l, nil
+	}
+
+	u, err := url.Parse(sink)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "file":
+		q := u.Query()
+		maxSize, err := queryInt(q, "max_size", 100)
+		if err != nil {
+			return nil, err
+		}
+		maxBackups, err := queryInt(q, "max_backups", 5)
+		if err != nil {
+			return nil, err
+		}
+		l.w, err = newRotatingFile(u.Path, int64(maxSize)*1024*1024, maxBackups)
+		if err != nil {
+			return nil, err
+		}
+	case "syslog":
+		q := u.Query()
+		tag := q.Get("tag")
+		if tag == "" {
+			tag = "functions"
+		}
+		l.w, err = newSyslog(q.Get("network"), u.Host, tag)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrInvalidSink
+	}
+	return l, nil
+}
+
+func queryInt(q url.Values, key string, def int) (int, error) {
+	v := q.Get(key)
+	if v == "" {
+		return def, nil
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid access log %s: %v", key, err)
+	}
+	return i, nil
+}
+
+// Log writes e to the sink.
+func (l *Logger) Log(e *Entry) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.buf.Reset()
+	l.format(&l.buf, e)
+	_, err := l.w.Write(l.buf.Bytes())
+	return err
+}
+
+// Close closes the underlying sink, if it needs closing.
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	if c, ok := l.w.(io.Closer); ok && l.w != os.Stdout && l.w != os.Stderr {
+		return c.Close()
+	}
+	return nil
+}
+
+type jsonEntry struct {
+	Time        string  `json:"time"`
+	RemoteAddr  string  `json:"remote_addr"`
+	Method      string  `json:"method"`
+	URL         string  `json:"url"`
+	AppName     string  `json:"app_name"`
+	Route       string  `json:"route"`
+	Target      string  `json:"target,omitempty"`
+	CallID      string  `json:"call_id"`
+	Status      int     `json:"status"`
+	BytesIn     int64   `json:"bytes_in"`
+	BytesOut    int64   `json:"bytes_out"`
+	WaitTime    float64 `json:"wait_time_ms"`
+	ExecTime    float64 `json:"exec_time_ms"`
+	Hot         bool    `json:"hot"`
+	ContainerID string  `json:"container_id,omitempty"`
+}
+
+func formatJSON(buf *bytes.Buffer, e *Entry) {
+	json.NewEncoder(buf).Encode(jsonEntry{
+		Time:        e.Time.UTC().Format(time.RFC3339Nano),
+		RemoteAddr:  e.RemoteAddr,
+		Method:      e.Method,
+		URL:         e.URL,
+		AppName:     e.AppName,
+		Route:       e.Route,
+		Target:      e.Target,
+		CallID:      e.CallID,
+		Status:      e.Status,
+		BytesIn:     e.BytesIn,
+		BytesOut:    e.BytesOut,
+		WaitTime:    milliseconds(e.WaitTime),
+		ExecTime:    milliseconds(e.ExecTime),
+		Hot:         e.Hot,
+		ContainerID: e.ContainerID,
+	})
+}
+
+// formatCombined writes the Apache combined log format, followed by the
+// function specific fields as key=value pairs.
+func formatCombined(buf *bytes.Buffer, e *Entry) {
+	fmt.Fprintf(buf, "%s - - [%s] %q %d %d %q %q app=%s route=%s target=%s call_id=%s bytes_in=%d wait_time_ms=%.3f exec_time_ms=%.3f hot=%t container_id=%s\n",
+		orDash(e.RemoteAddr),
+		e.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		e.Method+" "+e.URL+" "+e.Proto,
+		e.Status,
+		e.BytesOut,
+		orDash(e.Referer),
+		orDash(e.UserAgent),
+		orDash(e.AppName),
+		orDash(e.Route),
+		orDash(e.Target),
+		orDash(e.CallID),
+		e.BytesIn,
+		milliseconds(e.WaitTime),
+		milliseconds(e.ExecTime),
+		e.Hot,
+		orDash(e.ContainerID),
+	)
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,154 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testEntry() *Entry {
+	return &Entry{
+		Time:        time.Date(2017, 5, 1, 10, 0, 0, 0, time.UTC),
+		RemoteAddr:  "10.0.0.1",
+		Method:      "POST",
+		URL:         "/r/myapp/hello",
+		Proto:       "HTTP/1.1",
+		AppName:     "myapp",
+		Route:       "/hello",
+		CallID:      "abc",
+		Status:      200,
+		BytesIn:     12,
+		BytesOut:    34,
+		WaitTime:    2 * time.Millisecond,
+		ExecTime:    40 * time.Millisecond,
+		Hot:         true,
+		ContainerID: "def",
+	}
+}
+
+func TestFormats(t *testing.T) {
+	var buf bytes.Buffer
+	formatJSON(&buf, testEntry())
+
+	var got jsonEntry
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("json output is not valid: %v", err)
+	}
+	if got.AppName != "myapp" || got.Status != 200 || got.ExecTime != 40 || !got.Hot || got.ContainerID != "def" {
+		t.Errorf("unexpected json entry: %+v", got)
+	}
+
+	buf.Reset()
+	formatCombined(&buf, testEntry())
+	expected := `10.0.0.1 - - [01/May/2017:10:00:00 +0000] "POST /r/myapp/hello HTTP/1.1" 200 34 "-" "-" app=myapp route=/hello`
+	if !strings.HasPrefix(buf.String(), expected) {
+		t.Errorf("unexpected combined entry: %s", buf.String())
+	}
+}
+
+func TestNew(t *testing.T) {
+	if l, err := New("", "json"); l != nil || err != nil {
+		t.Errorf("expected access log to be disabled, got %v, %v", l, err)
+	}
+	if _, err := New("stdout", "xml"); err != ErrInvalidFormat {
+		t.Errorf("expected %v, got %v", ErrInvalidFormat, err)
+	}
+	if _, err := New("ftp://somewhere", ""); err != ErrInvalidSink {
+		t.Errorf("expected %v, got %v", ErrInvalidSink, err)
+	}
+
+	var l *Logger
+	if err := l.Log(testEntry()); err != nil {
+		t.Errorf("nil logger should discard entries, got %v", err)
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "accesslog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "access.log")
+	f, err := newRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, expected := range map[string]string{
+		path:        "fourth\n",
+		path + ".1": "third\n",
+		path + ".2": "second\n",
+	} {
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != expected {
+			t.Errorf("%s: expected %q, got %q", name, expected, b)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected at most 2 backups")
+	}
+}
+
+func TestRotatingFileRotateFails(t *testing.T) {
+	dir, err := ioutil.TempDir("", "accesslog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "access.log")
+	f, err := newRotatingFile(path, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// A non-empty directory in the way of the backup fails the rename.
+	if err := os.MkdirAll(filepath.Join(path+".1", "blocker"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.Write([]byte("first\n")); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := f.Write([]byte("second\n")); err == nil || n != len("second\n") {
+		t.Fatalf("expected the write to go through with the rotate error, got %d, %v", n, err)
+	}
+
+	if err := os.RemoveAll(path + ".1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("third\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, expected := range map[string]string{
+		path:        "third\n",
+		path + ".1": "first\nsecond\n",
+	} {
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != expected {
+			t.Errorf("%s: expected %q, got %q", name, expected, b)
+		}
+	}
+}
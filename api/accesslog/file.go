@@ -0,0 +1,92 @@
+package accesslog
+
+import (
+	"fmt"
+	"os"
+)
+
+// rotatingFile is an io.Writer to a file that is rotated once it grows past
+// maxSize: access.log becomes access.log.1, access.log.1 becomes
+// access.log.2 and so on, keeping at most maxBackups old files. It is not
+// safe for concurrent use, Logger serializes writes.
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	f    *os.File
+	size int64
+}
+
+func newRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f = f
+	r.size = fi.Size()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	var rerr error
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		// Entries keep going to the current file when it cannot be rotated,
+		// which the next write tries again.
+		rerr = r.rotate()
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	if err == nil {
+		err = rerr
+	}
+	return n, err
+}
+
+// rotate moves the current file aside and opens a new one at path. The
+// current file is only closed once the new one is open, for writes to go on
+// to it when rotating fails.
+func (r *rotatingFile) rotate() error {
+	if r.maxBackups <= 0 {
+		if err := os.Remove(r.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	} else {
+		for i := r.maxBackups - 1; i > 0; i-- {
+			err := os.Rename(backupName(r.path, i), backupName(r.path, i+1))
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		if err := os.Rename(r.path, backupName(r.path, 1)); err != nil {
+			return err
+		}
+	}
+
+	f := r.f
+	if err := r.open(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func (r *rotatingFile) Close() error {
+	return r.f.Close()
+}
+
+func backupName(path string, i int) string {
+	return fmt.Sprintf("%s.%d", path, i)
+}
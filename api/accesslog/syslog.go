@@ -0,0 +1,15 @@
+// +build !windows,!plan9,!nacl
+
+package accesslog
+
+import (
+	"io"
+	"log/syslog"
+)
+
+func newSyslog(network, addr, tag string) (io.Writer, error) {
+	if addr != "" && network == "" {
+		network = "udp"
+	}
+	return syslog.Dial(network, addr, syslog.LOG_INFO|syslog.LOG_DAEMON, tag)
+}
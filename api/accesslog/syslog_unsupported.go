@@ -0,0 +1,12 @@
+// +build windows plan9 nacl
+
+package accesslog
+
+import (
+	"errors"
+	"io"
+)
+
+func newSyslog(network, addr, tag string) (io.Writer, error) {
+	return nil, errors.New("syslog access log is not supported on this platform")
+}
@@ -0,0 +1,53 @@
+package cachebus
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	for _, u := range []string{"memory", "memory://?channel=other"} {
+		if b, err := New(u); err != nil || b == nil {
+			t.Errorf("Expected a bus for %q, got %v", u, err)
+		}
+	}
+	if b, err := New(""); err != nil || b != nil {
+		t.Errorf("Expected no bus for an empty URL, got %v, %v", b, err)
+	}
+	if _, err := New("kafka://localhost"); err == nil {
+		t.Error("Expected an error for an unsupported bus")
+	}
+}
+
+func TestMemoryBus(t *testing.T) {
+	b := NewMemoryBus()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	got := make(chan string, 10)
+	done := make(chan error)
+	go func() {
+		done <- b.Subscribe(ctx, func(appName string) { got <- appName })
+	}()
+
+	if appName := <-got; appName != "" {
+		t.Fatalf("Expected an empty app name on subscription, got %q", appName)
+	}
+
+	if err := b.Publish(ctx, "myapp"); err != nil {
+		t.Fatal(err)
+	}
+	if appName := <-got; appName != "myapp" {
+		t.Errorf("Expected myapp to be published, got %q", appName)
+	}
+
+	cancel()
+	<-done
+	if err := b.Publish(context.Background(), "other"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case appName := <-got:
+		t.Errorf("Expected no invalidations after unsubscribing, got %q", appName)
+	default:
+	}
+}
@@ -0,0 +1,67 @@
+package cachebus
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// PostgresBus relies on postgres LISTEN/NOTIFY.
+type PostgresBus struct {
+	url     string
+	db      *sql.DB
+	channel string
+}
+
+func NewPostgresBus(u *url.URL, channel string) (*PostgresBus, error) {
+	// the channel is not a connection parameter
+	q := u.Query()
+	q.Del("channel")
+	c := *u
+	c.RawQuery = q.Encode()
+
+	db, err := sql.Open("postgres", c.String())
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+	db.SetMaxIdleConns(2)
+
+	return &PostgresBus{url: c.String(), db: db, channel: channel}, nil
+}
+
+func (b *PostgresBus) Publish(ctx context.Context, appName string) error {
+	_, err := b.db.ExecContext(ctx, "SELECT pg_notify($1, $2)", b.channel, appName)
+	return err
+}
+
+func (b *PostgresBus) Subscribe(ctx context.Context, f func(appName string)) error {
+	l := pq.NewListener(b.url, time.Second, time.Minute, nil)
+	defer l.Close()
+
+	if err := l.Listen(b.channel); err != nil {
+		return err
+	}
+	f("")
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case n := <-l.Notify:
+			// the listener reconnected, notifications may have been lost
+			if n == nil {
+				f("")
+				continue
+			}
+			f(n.Extra)
+		case <-time.After(90 * time.Second):
+			go l.Ping()
+		}
+	}
+}
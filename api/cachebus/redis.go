@@ -0,0 +1,93 @@
+package cachebus
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// RedisBus relies on redis pub/sub.
+type RedisBus struct {
+	url     string
+	pool    *redis.Pool
+	channel string
+}
+
+func NewRedisBus(u *url.URL, channel string) (*RedisBus, error) {
+	// the channel is not part of the redis URL
+	q := u.Query()
+	q.Del("channel")
+	c := *u
+	c.RawQuery = q.Encode()
+
+	b := &RedisBus{url: c.String(), channel: channel}
+	b.pool = &redis.Pool{
+		MaxIdle:     2,
+		MaxActive:   8,
+		Wait:        true,
+		IdleTimeout: 300 * time.Second,
+		Dial: func() (redis.Conn, error) {
+			return redis.DialURL(b.url)
+		},
+		TestOnBorrow: func(c redis.Conn, t time.Time) error {
+			_, err := c.Do("PING")
+			return err
+		},
+	}
+
+	// Make sure we can connect to redis
+	conn := b.pool.Get()
+	defer conn.Close()
+	if _, err := conn.Do("PING"); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *RedisBus) Publish(ctx context.Context, appName string) error {
+	conn := b.pool.Get()
+	defer conn.Close()
+	_, err := conn.Do("PUBLISH", b.channel, appName)
+	return err
+}
+
+func (b *RedisBus) Subscribe(ctx context.Context, f func(appName string)) error {
+	conn, err := redis.DialURL(b.url)
+	if err != nil {
+		return err
+	}
+	psc := redis.PubSubConn{Conn: conn}
+	if err := psc.Subscribe(b.channel); err != nil {
+		conn.Close()
+		return err
+	}
+
+	// Receive blocks, closing the connection is the way to interrupt it.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		conn.Close()
+	}()
+
+	for {
+		switch v := psc.Receive().(type) {
+		case redis.Subscription:
+			if v.Kind == "subscribe" {
+				f("")
+			}
+		case redis.Message:
+			f(string(v.Data))
+		case error:
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return v
+		}
+	}
+}
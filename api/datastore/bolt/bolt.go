@@ -1,6 +1,8 @@
 package bolt
 
 import (
+	"bytes"
+	"encoding/binary"
 	"encoding/json"
 	"net/url"
 	"os"
@@ -9,12 +11,10 @@ import (
 
 	"context"
 
-	"regexp"
-	"strings"
-
 	"github.com/Sirupsen/logrus"
 	"github.com/boltdb/bolt"
 	"github.com/iron-io/functions/api/datastore/internal/datastoreutil"
+	"github.com/iron-io/functions/api/datastore/internal/migrate"
 	"github.com/iron-io/functions/api/models"
 )
 
@@ -23,10 +23,15 @@ type BoltDatastore struct {
 	appsBucket   []byte
 	logsBucket   []byte
 	extrasBucket []byte
+	auditBucket  []byte
+	revsBucket   []byte
+	schemaBucket []byte
 	db           *bolt.DB
 	log          logrus.FieldLogger
 }
 
+// New migrates the db up to the latest schema version, unless the URL asks
+// otherwise, see migrate.FromURL.
 func New(url *url.URL) (models.Datastore, error) {
 	dir := filepath.Dir(url.Path)
 	log := logrus.WithFields(logrus.Fields{"db": url.Scheme, "dir": dir})
@@ -50,29 +55,31 @@ func New(url *url.URL) (models.Datastore, error) {
 	appsBucketName := []byte(bucketPrefix + "apps")
 	logsBucketName := []byte(bucketPrefix + "logs")
 	extrasBucketName := []byte(bucketPrefix + "extras") // todo: think of a better name
-	err = db.Update(func(tx *bolt.Tx) error {
-		for _, name := range [][]byte{routesBucketName, appsBucketName, logsBucketName, extrasBucketName} {
-			_, err := tx.CreateBucketIfNotExists(name)
-			if err != nil {
-				log.WithError(err).WithFields(logrus.Fields{"name": name}).Error("create bucket")
-				return err
-			}
-		}
-		return nil
-	})
-	if err != nil {
-		log.WithError(err).Errorln("Error creating bolt buckets")
-		return nil, err
-	}
+	auditBucketName := []byte(bucketPrefix + "audit")
+	revsBucketName := []byte(bucketPrefix + "revisions")
+	schemaBucketName := []byte(bucketPrefix + "schema")
 
 	ds := &BoltDatastore{
 		routesBucket: routesBucketName,
 		appsBucket:   appsBucketName,
 		logsBucket:   logsBucketName,
 		extrasBucket: extrasBucketName,
+		auditBucket:  auditBucketName,
+		revsBucket:   revsBucketName,
+		schemaBucket: schemaBucketName,
 		db:           db,
 		log:          log,
 	}
+
+	schema, err := newBoltSchema(ds)
+	if err != nil {
+		log.WithError(err).Errorln("Error creating bolt schema bucket")
+		return nil, err
+	}
+	if err := migrate.FromURL(schema, url); err != nil {
+		log.WithError(err).Errorln("Error migrating bolt schema")
+		return nil, err
+	}
 	log.WithFields(logrus.Fields{"prefix": bucketPrefix, "file": url.Path}).Debug("BoltDB initialized")
 
 	return datastoreutil.NewValidator(ds), nil
@@ -148,40 +155,60 @@ func (ds *BoltDatastore) UpdateApp(ctx context.Context, newapp *models.App) (*mo
 	return app, err
 }
 
-func (ds *BoltDatastore) RemoveApp(ctx context.Context, appName string) error {
+func (ds *BoltDatastore) RemoveApp(ctx context.Context, appName string, cascade bool) error {
 	err := ds.db.Update(func(tx *bolt.Tx) error {
+		if rb := tx.Bucket(ds.routesBucket).Bucket([]byte(appName)); rb != nil && !cascade {
+			if k, _ := rb.Cursor().First(); k != nil {
+				return models.ErrDeleteAppsWithRoutes
+			}
+		}
+
 		bIm := tx.Bucket(ds.appsBucket)
 		err := bIm.Delete([]byte(appName))
 		if err != nil {
 			return err
 		}
-		bjParent := tx.Bucket(ds.routesBucket)
-		err = bjParent.DeleteBucket([]byte(appName))
-		if err != nil {
-			return err
+		for _, parent := range [][]byte{ds.routesBucket, ds.revsBucket} {
+			err = tx.Bucket(parent).DeleteBucket([]byte(appName))
+			if err != nil && err != bolt.ErrBucketNotFound {
+				return err
+			}
+		}
+
+		// deleting while iterating skips keys, collect them first
+		var keys [][]byte
+		prefix := models.AppExtrasPrefix(appName)
+		c := tx.Bucket(ds.extrasBucket).Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			keys = append(keys, append([]byte(nil), k...))
+		}
+		for _, k := range keys {
+			if err := tx.Bucket(ds.extrasBucket).Delete(k); err != nil {
+				return err
+			}
 		}
 		return nil
 	})
 	return err
 }
 
+// GetApps iterates the apps bucket, keyed by app name, from the cursor on.
 func (ds *BoltDatastore) GetApps(ctx context.Context, filter *models.AppFilter) ([]*models.App, error) {
 	res := []*models.App{}
 	err := ds.db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket(ds.appsBucket)
-		err2 := b.ForEach(func(key, v []byte) error {
+		c := tx.Bucket(ds.appsBucket).Cursor()
+		k, v := c.First()
+		if filter.Cursor != "" {
+			k, v = c.Seek([]byte(filter.Cursor))
+		}
+		for ; k != nil && (filter.PerPage == 0 || len(res) < filter.PerPage); k, v = c.Next() {
 			app := &models.App{}
-			err := json.Unmarshal(v, app)
-			if err != nil {
+			if err := json.Unmarshal(v, app); err != nil {
 				return err
 			}
-			if applyAppFilter(app, filter) {
+			if filter.Match(app) {
 				res = append(res, app)
 			}
-			return nil
-		})
-		if err2 != nil {
-			logrus.WithError(err2).Errorln("Couldn't get apps!")
 		}
 		return nil
 	})
@@ -224,8 +251,20 @@ func (ds *BoltDatastore) getRouteBucketForApp(tx *bolt.Tx, appName string) (*bol
 	return b, nil
 }
 
+// routeKey is the key of the route at path serving methods, a key as returned
+// by models.MethodsKey, in the routes and revisions buckets of its app. The
+// keys of routes serving every method are their path, the others follow it
+// with a NUL byte and their methods, so that routes are listed by path, then
+// methods.
+func routeKey(path, methods string) []byte {
+	if methods == "" {
+		return []byte(path)
+	}
+	return []byte(path + "\x00" + methods)
+}
+
 func (ds *BoltDatastore) InsertRoute(ctx context.Context, route *models.Route) (*models.Route, error) {
-	routePath := []byte(route.Path)
+	key := routeKey(route.Path, models.MethodsKey(route.Methods))
 
 	err := ds.db.Update(func(tx *bolt.Tx) error {
 		b, err := ds.getRouteBucketForApp(tx, route.AppName)
@@ -233,17 +272,20 @@ func (ds *BoltDatastore) InsertRoute(ctx context.Context, route *models.Route) (
 			return err
 		}
 
-		v := b.Get(routePath)
+		v := b.Get(key)
 		if v != nil {
 			return models.ErrRoutesAlreadyExists
 		}
+		if err := checkName(b, route.Name, key); err != nil {
+			return err
+		}
 
 		buf, err := json.Marshal(route)
 		if err != nil {
 			return err
 		}
 
-		err = b.Put(routePath, buf)
+		err = b.Put(key, buf)
 		if err != nil {
 			return err
 		}
@@ -256,7 +298,7 @@ func (ds *BoltDatastore) InsertRoute(ctx context.Context, route *models.Route) (
 }
 
 func (ds *BoltDatastore) UpdateRoute(ctx context.Context, newroute *models.Route) (*models.Route, error) {
-	routePath := []byte(newroute.Path)
+	key := routeKey(newroute.Path, models.MethodsKey(newroute.Methods))
 
 	var route *models.Route
 
@@ -266,7 +308,7 @@ func (ds *BoltDatastore) UpdateRoute(ctx context.Context, newroute *models.Route
 			return err
 		}
 
-		v := b.Get(routePath)
+		v := b.Get(key)
 		if v == nil {
 			return models.ErrRoutesNotFound
 		}
@@ -277,13 +319,16 @@ func (ds *BoltDatastore) UpdateRoute(ctx context.Context, newroute *models.Route
 		}
 
 		route.Update(newroute)
+		if err := checkName(b, route.Name, key); err != nil {
+			return err
+		}
 
 		buf, err := json.Marshal(route)
 		if err != nil {
 			return err
 		}
 
-		return b.Put(routePath, buf)
+		return b.Put(key, buf)
 	})
 	if err != nil {
 		return nil, err
@@ -291,26 +336,134 @@ func (ds *BoltDatastore) UpdateRoute(ctx context.Context, newroute *models.Route
 	return route, nil
 }
 
-func (ds *BoltDatastore) RemoveRoute(ctx context.Context, appName, routePath string) error {
+func (ds *BoltDatastore) MoveRoute(ctx context.Context, oldPath, oldMethods string, newroute *models.Route) (*models.Route, error) {
+	appName, newPath := newroute.AppName, newroute.Path
+	oldKey := routeKey(oldPath, oldMethods)
+	var route *models.Route
+
 	err := ds.db.Update(func(tx *bolt.Tx) error {
 		b, err := ds.getRouteBucketForApp(tx, appName)
 		if err != nil {
 			return err
 		}
 
-		err = b.Delete([]byte(routePath))
+		v := b.Get(oldKey)
+		if v == nil {
+			return models.ErrRoutesNotFound
+		}
+
+		if err := json.Unmarshal(v, &route); err != nil {
+			return err
+		}
+		route.Update(newroute)
+		newKey := routeKey(newPath, models.MethodsKey(route.Methods))
+		if b.Get(newKey) != nil {
+			return models.ErrRoutesAlreadyExists
+		}
+		if err := checkName(b, route.Name, oldKey); err != nil {
+			return err
+		}
+		route.Path = newPath
+
+		buf, err := json.Marshal(route)
 		if err != nil {
 			return err
 		}
+		if err := b.Put(newKey, buf); err != nil {
+			return err
+		}
+		if err := b.Delete(oldKey); err != nil {
+			return err
+		}
+
+		return ds.moveRevisions(tx, appName, oldKey, newKey)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return route, nil
+}
+
+// checkName returns ErrRoutesNameConflict if a route of the routes bucket b
+// other than the one at key is named name.
+func checkName(b *bolt.Bucket, name string, key []byte) error {
+	if name == "" {
+		return nil
+	}
+	return b.ForEach(func(k, v []byte) error {
+		if bytes.Equal(k, key) {
+			return nil
+		}
+		var r models.Route
+		if err := json.Unmarshal(v, &r); err != nil {
+			return err
+		}
+		if r.Name == name {
+			return models.ErrRoutesNameConflict
+		}
 		return nil
 	})
+}
+
+// moveRevisions moves the revisions bucket of a route to newKey, replacing
+// any revisions left there. Buckets cannot be renamed, so the revisions are
+// copied over.
+func (ds *BoltDatastore) moveRevisions(tx *bolt.Tx, appName string, oldKey, newKey []byte) error {
+	if err := ds.removeRevisions(tx, appName, newKey); err != nil {
+		return err
+	}
+	ab := tx.Bucket(ds.revsBucket).Bucket([]byte(appName))
+	if ab == nil {
+		return nil
+	}
+	old := ab.Bucket(oldKey)
+	if old == nil {
+		return nil
+	}
+
+	b, err := ab.CreateBucket(newKey)
+	if err != nil {
+		return err
+	}
+	err = old.ForEach(func(k, v []byte) error {
+		return b.Put(k, v)
+	})
+	if err != nil {
+		return err
+	}
+	return ab.DeleteBucket(oldKey)
+}
+
+// removeRevisions removes the revisions bucket of a route, if any.
+func (ds *BoltDatastore) removeRevisions(tx *bolt.Tx, appName string, key []byte) error {
+	ab := tx.Bucket(ds.revsBucket).Bucket([]byte(appName))
+	if ab == nil || ab.Bucket(key) == nil {
+		return nil
+	}
+	return ab.DeleteBucket(key)
+}
+
+func (ds *BoltDatastore) RemoveRoute(ctx context.Context, appName, routePath, methods string) error {
+	key := routeKey(routePath, methods)
+	err := ds.db.Update(func(tx *bolt.Tx) error {
+		b, err := ds.getRouteBucketForApp(tx, appName)
+		if err != nil {
+			return err
+		}
+
+		err = b.Delete(key)
+		if err != nil {
+			return err
+		}
+		return ds.removeRevisions(tx, appName, key)
+	})
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (ds *BoltDatastore) GetRoute(ctx context.Context, appName, routePath string) (*models.Route, error) {
+func (ds *BoltDatastore) GetRoute(ctx context.Context, appName, routePath, methods string) (*models.Route, error) {
 	var route *models.Route
 	err := ds.db.View(func(tx *bolt.Tx) error {
 		b, err := ds.getRouteBucketForApp(tx, appName)
@@ -318,7 +471,7 @@ func (ds *BoltDatastore) GetRoute(ctx context.Context, appName, routePath string
 			return err
 		}
 
-		v := b.Get([]byte(routePath))
+		v := b.Get(routeKey(routePath, methods))
 		if v == nil {
 			return models.ErrRoutesNotFound
 		}
@@ -338,23 +491,101 @@ func (ds *BoltDatastore) GetRoutesByApp(ctx context.Context, appName string, fil
 		if b == nil {
 			return nil
 		}
+		var err error
+		res, err = appendRoutes(res, b, appName, filter)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
 
-		i := 0
-		c := b.Cursor()
-
-		var k, v []byte
-		k, v = c.Last()
+// GetRoutes iterates the bucket of every app, keyed by app name, from the
+// cursor on.
+func (ds *BoltDatastore) GetRoutes(ctx context.Context, filter *models.RouteFilter) ([]*models.Route, error) {
+	res := []*models.Route{}
+	err := ds.db.View(func(tx *bolt.Tx) error {
+		rbucket := tx.Bucket(ds.routesBucket)
 
-		// Iterate backwards, newest first
-		for ; k != nil; k, v = c.Prev() {
-			var route models.Route
-			err := json.Unmarshal(v, &route)
+		c := rbucket.Cursor()
+		k, v := c.First()
+		if filter.CursorApp != "" {
+			k, v = c.Seek([]byte(filter.CursorApp))
+		}
+		for ; k != nil && (filter.PerPage == 0 || len(res) < filter.PerPage); k, v = c.Next() {
+			if v != nil {
+				continue
+			}
+			var err error
+			res, err = appendRoutes(res, rbucket.Bucket(k), string(k), filter)
 			if err != nil {
 				return err
 			}
-			if applyRouteFilter(&route, filter) {
-				i++
-				res = append(res, &route)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// appendRoutes appends the routes of appName selected by filter to res, up
+// to filter.PerPage, iterating its bucket, keyed by routeKey, from the cursor
+// on.
+func appendRoutes(res []*models.Route, b *bolt.Bucket, appName string, filter *models.RouteFilter) ([]*models.Route, error) {
+	c := b.Cursor()
+	k, v := c.First()
+	if filter.CursorApp == appName && filter.CursorPath != "" {
+		k, v = c.Seek(routeKey(filter.CursorPath, filter.CursorMethods))
+	}
+	for ; k != nil && (filter.PerPage == 0 || len(res) < filter.PerPage); k, v = c.Next() {
+		var route models.Route
+		if err := json.Unmarshal(v, &route); err != nil {
+			return res, err
+		}
+		if filter.Match(&route) {
+			res = append(res, &route)
+		}
+	}
+	return res, nil
+}
+
+// InsertAuditEvent stores events keyed by their timestamp, so that iterating
+// the bucket backwards yields the newest events first.
+func (ds *BoltDatastore) InsertAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	buf, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	key := make([]byte, 8, 8+len(event.ID))
+	binary.BigEndian.PutUint64(key, uint64(event.Timestamp.UnixNano()))
+	key = append(key, event.ID...)
+
+	return ds.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(ds.auditBucket).Put(key, buf)
+	})
+}
+
+func (ds *BoltDatastore) GetAuditEvents(ctx context.Context, filter *models.AuditFilter) ([]*models.AuditEvent, error) {
+	res := []*models.AuditEvent{}
+	err := ds.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(ds.auditBucket).Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			if filter.Limit > 0 && len(res) == filter.Limit {
+				return nil
+			}
+			var event models.AuditEvent
+			if err := json.Unmarshal(v, &event); err != nil {
+				return err
+			}
+			if !filter.Since.IsZero() && event.Timestamp.Before(filter.Since) {
+				return nil
+			}
+			if filter.Match(&event) {
+				res = append(res, &event)
 			}
 		}
 		return nil
@@ -365,34 +596,61 @@ func (ds *BoltDatastore) GetRoutesByApp(ctx context.Context, appName string, fil
 	return res, nil
 }
 
-func (ds *BoltDatastore) GetRoutes(ctx context.Context, filter *models.RouteFilter) ([]*models.Route, error) {
-	res := []*models.Route{}
+// InsertRouteRevision stores revisions in a bucket per app and route, named
+// by routeKey and keyed by the revision number, so the last key is the newest
+// revision.
+func (ds *BoltDatastore) InsertRouteRevision(ctx context.Context, rev *models.RouteRevision) (*models.RouteRevision, error) {
+	err := ds.db.Update(func(tx *bolt.Tx) error {
+		ab, err := tx.Bucket(ds.revsBucket).CreateBucketIfNotExists([]byte(rev.AppName))
+		if err != nil {
+			return err
+		}
+		b, err := ab.CreateBucketIfNotExists(routeKey(rev.Path, models.MethodsKey(rev.Methods)))
+		if err != nil {
+			return err
+		}
+
+		var n uint64 = 1
+		if k, _ := b.Cursor().Last(); k != nil {
+			n = binary.BigEndian.Uint64(k) + 1
+		}
+		rev.Revision = int64(n)
+
+		buf, err := json.Marshal(rev)
+		if err != nil {
+			return err
+		}
+
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, n)
+		return b.Put(key, buf)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rev, nil
+}
+
+func (ds *BoltDatastore) GetRouteRevisions(ctx context.Context, appName, routePath, methods string) ([]*models.RouteRevision, error) {
+	res := []*models.RouteRevision{}
 	err := ds.db.View(func(tx *bolt.Tx) error {
-		i := 0
-		rbucket := tx.Bucket(ds.routesBucket)
+		ab := tx.Bucket(ds.revsBucket).Bucket([]byte(appName))
+		if ab == nil {
+			return nil
+		}
+		b := ab.Bucket(routeKey(routePath, methods))
+		if b == nil {
+			return nil
+		}
 
-		b := rbucket.Cursor()
-		var k, v []byte
-		k, v = b.First()
-
-		// Iterates all buckets
-		for ; k != nil && v == nil; k, v = b.Next() {
-			bucket := rbucket.Bucket(k)
-			r := bucket.Cursor()
-			var k2, v2 []byte
-			k2, v2 = r.Last()
-			// Iterate all routes
-			for ; k2 != nil; k2, v2 = r.Prev() {
-				var route models.Route
-				err := json.Unmarshal(v2, &route)
-				if err != nil {
-					return err
-				}
-				if applyRouteFilter(&route, filter) {
-					i++
-					res = append(res, &route)
-				}
+		c := b.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var rev models.RouteRevision
+			if err := json.Unmarshal(v, &rev); err != nil {
+				return err
 			}
+			rev.AppName, rev.Path, rev.Methods = appName, routePath, models.ParseMethodsKey(methods)
+			res = append(res, &rev)
 		}
 		return nil
 	})
@@ -420,18 +678,3 @@ func (ds *BoltDatastore) Get(ctx context.Context, key []byte) ([]byte, error) {
 	})
 	return ret, nil
 }
-
-func applyAppFilter(app *models.App, filter *models.AppFilter) bool {
-	if filter != nil && filter.Name != "" {
-		nameLike, err := regexp.MatchString(strings.Replace(filter.Name, "%", ".*", -1), app.Name)
-		return err == nil && nameLike
-	}
-
-	return true
-}
-
-func applyRouteFilter(route *models.Route, filter *models.RouteFilter) bool {
-	return filter == nil || (filter.Path == "" || route.Path == filter.Path) &&
-		(filter.AppName == "" || route.AppName == filter.AppName) &&
-		(filter.Image == "" || route.Image == filter.Image)
-}
@@ -4,8 +4,11 @@ import (
 	"net/url"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/boltdb/bolt"
 	"github.com/iron-io/functions/api/datastore/internal/datastoretest"
+	"github.com/iron-io/functions/api/datastore/internal/migrate"
 )
 
 const tmpBolt = "/tmp/bolt_fn_test.db"
@@ -22,3 +25,106 @@ func TestDatastore(t *testing.T) {
 	datastoretest.Test(t, ds)
 	os.Remove(tmpBolt)
 }
+
+func TestSchema(t *testing.T) {
+	const tmpSchema = "/tmp/bolt_fn_schema_test.db"
+	os.Remove(tmpSchema)
+	defer os.Remove(tmpSchema)
+
+	db, err := bolt.Open(tmpSchema, 0655, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("failed to open bolt db: %v", err)
+	}
+	defer db.Close()
+	ds := &BoltDatastore{
+		routesBucket: []byte("routes"),
+		appsBucket:   []byte("apps"),
+		logsBucket:   []byte("logs"),
+		extrasBucket: []byte("extras"),
+		auditBucket:  []byte("audit"),
+		revsBucket:   []byte("revisions"),
+		schemaBucket: []byte("schema"),
+		db:           db,
+	}
+	schema, err := newBoltSchema(ds)
+	if err != nil {
+		t.Fatalf("failed to create schema bucket: %v", err)
+	}
+
+	buckets := func() (n int) {
+		db.View(func(tx *bolt.Tx) error {
+			for _, name := range ds.buckets() {
+				if tx.Bucket(name) != nil {
+					n++
+				}
+			}
+			return nil
+		})
+		return n
+	}
+
+	if err := migrate.To(schema, migrate.Latest(schema), true); err != migrate.ErrDryRun {
+		t.Fatalf("expected dry run to fail with `%v`, got `%v`", migrate.ErrDryRun, err)
+	}
+	if v, err := schema.Version(); err != nil || v != 0 || buckets() != 0 {
+		t.Fatalf("expected dry run to leave the db untouched, got version %d, %d buckets, %v", v, buckets(), err)
+	}
+
+	if err := migrate.To(schema, migrate.Latest(schema), false); err != nil {
+		t.Fatalf("failed to migrate up: %v", err)
+	}
+	if v, err := schema.Version(); err != nil || v != migrate.Latest(schema) || buckets() != len(ds.buckets()) {
+		t.Fatalf("expected version %d with every bucket, got version %d, %d buckets, %v", migrate.Latest(schema), v, buckets(), err)
+	}
+
+	// Routes with methods stored before they were keyed by them move, along
+	// with their revisions, and back.
+	if err := migrate.To(schema, 1, false); err != nil {
+		t.Fatalf("failed to migrate down to 1: %v", err)
+	}
+	keys := func() (route, revs []byte) {
+		db.View(func(tx *bolt.Tx) error {
+			route, _ = tx.Bucket(ds.routesBucket).Bucket([]byte("app")).Cursor().First()
+			revs, _ = tx.Bucket(ds.revsBucket).Bucket([]byte("app")).Cursor().First()
+			return nil
+		})
+		return route, revs
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(ds.routesBucket).CreateBucket([]byte("app"))
+		if err != nil {
+			return err
+		}
+		if err := b.Put([]byte("/users"), []byte(`{"path":"/users","methods":["POST","GET"]}`)); err != nil {
+			return err
+		}
+		b, err = tx.Bucket(ds.revsBucket).CreateBucket([]byte("app"))
+		if err != nil {
+			return err
+		}
+		_, err = b.CreateBucket([]byte("/users"))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("failed to store route: %v", err)
+	}
+	if err := migrate.To(schema, migrate.Latest(schema), false); err != nil {
+		t.Fatalf("failed to migrate up: %v", err)
+	}
+	if route, revs := keys(); string(route) != "/users\x00GET,POST" || string(revs) != "/users\x00GET,POST" {
+		t.Fatalf("expected route and revisions keyed by methods, got %q and %q", route, revs)
+	}
+	if err := migrate.To(schema, 1, false); err != nil {
+		t.Fatalf("failed to migrate down to 1: %v", err)
+	}
+	if route, revs := keys(); string(route) != "/users" || string(revs) != "/users" {
+		t.Fatalf("expected route and revisions keyed by path, got %q and %q", route, revs)
+	}
+
+	if err := migrate.To(schema, 0, false); err != nil {
+		t.Fatalf("failed to migrate down: %v", err)
+	}
+	if v, err := schema.Version(); err != nil || v != 0 || buckets() != 0 {
+		t.Fatalf("expected version 0 without buckets, got version %d, %d buckets, %v", v, buckets(), err)
+	}
+}
@@ -0,0 +1,169 @@
+package bolt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/boltdb/bolt"
+	"github.com/iron-io/functions/api/datastore/internal/migrate"
+	"github.com/iron-io/functions/api/models"
+)
+
+// boltMigration reshapes the buckets and documents of a db, in the
+// transaction which records its version.
+type boltMigration struct {
+	migrate.Migration
+	Up   func(ds *BoltDatastore, tx *bolt.Tx) error
+	Down func(ds *BoltDatastore, tx *bolt.Tx) error
+}
+
+// migrations upgrade the documents of existing dbs. The first one is written
+// to also upgrade dbs created before migrations existed.
+var migrations = []boltMigration{
+	{
+		Migration: migrate.Migration{Version: 1, Name: "create buckets"},
+		Up: func(ds *BoltDatastore, tx *bolt.Tx) error {
+			for _, name := range ds.buckets() {
+				if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(ds *BoltDatastore, tx *bolt.Tx) error {
+			for _, name := range ds.buckets() {
+				if err := tx.DeleteBucket(name); err != nil && err != bolt.ErrBucketNotFound {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Migration: migrate.Migration{Version: 2, Name: "key routes by methods"},
+		Up: func(ds *BoltDatastore, tx *bolt.Tx) error {
+			return ds.rekeyRoutes(tx, routeKey)
+		},
+		Down: func(ds *BoltDatastore, tx *bolt.Tx) error {
+			return ds.rekeyRoutes(tx, func(path, methods string) []byte {
+				return []byte(path)
+			})
+		},
+	},
+}
+
+// rekeyRoutes moves every route, and its revisions, to the key returned by
+// key for its path and methods.
+func (ds *BoltDatastore) rekeyRoutes(tx *bolt.Tx, key func(path, methods string) []byte) error {
+	rb := tx.Bucket(ds.routesBucket)
+	return rb.ForEach(func(appName, v []byte) error {
+		b := rb.Bucket(appName)
+		if v != nil || b == nil {
+			return nil
+		}
+
+		// Keys cannot be changed while iterating the bucket.
+		moves := map[string][]byte{}
+		err := b.ForEach(func(k, v []byte) error {
+			var route models.Route
+			if err := json.Unmarshal(v, &route); err != nil {
+				return err
+			}
+			if newKey := key(route.Path, models.MethodsKey(route.Methods)); !bytes.Equal(k, newKey) {
+				moves[string(k)] = newKey
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for oldKey, newKey := range moves {
+			if b.Get(newKey) != nil {
+				return fmt.Errorf("several routes of app %s are keyed %q", appName, newKey)
+			}
+			v := append([]byte(nil), b.Get([]byte(oldKey))...)
+			if err := b.Put(newKey, v); err != nil {
+				return err
+			}
+			if err := b.Delete([]byte(oldKey)); err != nil {
+				return err
+			}
+			if err := ds.moveRevisions(tx, string(appName), []byte(oldKey), newKey); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (ds *BoltDatastore) buckets() [][]byte {
+	return [][]byte{ds.routesBucket, ds.appsBucket, ds.logsBucket, ds.extrasBucket, ds.auditBucket, ds.revsBucket}
+}
+
+var schemaVersionKey = []byte("version")
+
+// boltSchema keeps the version of a db under the version key of its schema
+// bucket.
+type boltSchema struct {
+	ds         *BoltDatastore
+	migrations []boltMigration
+}
+
+func newBoltSchema(ds *BoltDatastore) (*boltSchema, error) {
+	err := ds.db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(ds.schemaBucket)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &boltSchema{ds: ds, migrations: migrations}, nil
+}
+
+func (s *boltSchema) Migrations() []migrate.Migration {
+	ms := make([]migrate.Migration, len(s.migrations))
+	for i, m := range s.migrations {
+		ms[i] = m.Migration
+	}
+	return ms
+}
+
+func (s *boltSchema) Version() (int, error) {
+	var version int
+	err := s.ds.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(s.ds.schemaBucket).Get(schemaVersionKey)
+		if v == nil {
+			return nil
+		}
+		var err error
+		version, err = strconv.Atoi(string(v))
+		return err
+	})
+	return version, err
+}
+
+func (s *boltSchema) Apply(m migrate.Migration, up bool) error {
+	var step func(ds *BoltDatastore, tx *bolt.Tx) error
+	version := m.Version
+	for _, bm := range s.migrations {
+		if bm.Version == m.Version {
+			step = bm.Up
+			if !up {
+				step, version = bm.Down, m.Version-1
+			}
+		}
+	}
+	if step == nil {
+		return fmt.Errorf("no step for schema migration %d", m.Version)
+	}
+
+	return s.ds.db.Update(func(tx *bolt.Tx) error {
+		if err := step(s.ds, tx); err != nil {
+			return err
+		}
+		return tx.Bucket(s.ds.schemaBucket).Put(schemaVersionKey, []byte(strconv.Itoa(version)))
+	})
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/iron-io/functions/api/datastore/mysql"
 	"github.com/iron-io/functions/api/datastore/postgres"
 	"github.com/iron-io/functions/api/datastore/redis"
+	"github.com/iron-io/functions/api/datastore/sqlite"
 	"github.com/iron-io/functions/api/models"
 )
 
@@ -27,6 +28,8 @@ func New(dbURL string) (models.Datastore, error) {
 		return mysql.New(u)
 	case "redis":
 		return redis.New(u)
+	case "sqlite":
+		return sqlite.New(u)
 	default:
 		return nil, fmt.Errorf("db type not supported %v", u.Scheme)
 	}
@@ -12,6 +12,7 @@ import (
 	"net/url"
 	"os"
 	"reflect"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/gin-gonic/gin"
@@ -143,7 +144,7 @@ func Test(t *testing.T, ds models.Datastore) {
 			t.Fatalf("Test GetApps: expected `app.Name` to be `%s` but it was `%s`", app.Name, testApp.Name)
 		}
 
-		apps, err = ds.GetApps(ctx, &models.AppFilter{Name: "Tes%"})
+		apps, err = ds.GetApps(ctx, &models.AppFilter{Name: "Tes*"})
 		if err != nil {
 			t.Log(buf.String())
 			t.Fatalf("Test GetApps(filter): unexpected error %v", err)
@@ -153,13 +154,13 @@ func Test(t *testing.T, ds models.Datastore) {
 		}
 
 		// Testing app delete
-		err = ds.RemoveApp(ctx, "")
+		err = ds.RemoveApp(ctx, "", false)
 		if err != models.ErrDatastoreEmptyAppName {
 			t.Log(buf.String())
 			t.Fatalf("Test RemoveApp: expected error `%v`, but it was `%v`", models.ErrDatastoreEmptyAppName, err)
 		}
 
-		err = ds.RemoveApp(ctx, testApp.Name)
+		err = ds.RemoveApp(ctx, testApp.Name, false)
 		if err != nil {
 			t.Log(buf.String())
 			t.Fatalf("Test RemoveApp: error: %s", err)
@@ -224,19 +225,19 @@ func Test(t *testing.T, ds models.Datastore) {
 
 		// Testing get
 		{
-			_, err = ds.GetRoute(ctx, "a", "")
+			_, err = ds.GetRoute(ctx, "a", "", "")
 			if err != models.ErrDatastoreEmptyRoutePath {
 				t.Log(buf.String())
 				t.Fatalf("Test GetRoute(empty route path): expected error `%v`, but it was `%v`", models.ErrDatastoreEmptyRoutePath, err)
 			}
 
-			_, err = ds.GetRoute(ctx, "", "a")
+			_, err = ds.GetRoute(ctx, "", "a", "")
 			if err != models.ErrDatastoreEmptyAppName {
 				t.Log(buf.String())
 				t.Fatalf("Test GetRoute(empty app name): expected error `%v`, but it was `%v`", models.ErrDatastoreEmptyAppName, err)
 			}
 
-			route, err := ds.GetRoute(ctx, testApp.Name, testRoute.Path)
+			route, err := ds.GetRoute(ctx, testApp.Name, testRoute.Path, "")
 			if err != nil {
 				t.Log(buf.String())
 				t.Fatalf("Test GetRoute: unexpected error %v", err)
@@ -277,6 +278,7 @@ func Test(t *testing.T, ds models.Datastore) {
 				Image:   "iron/hello",
 				Type:    "sync",
 				Format:  "http",
+				JwtKey:  "route_key",
 				// updated
 				Timeout: 100,
 				Config: map[string]string{
@@ -295,7 +297,7 @@ func Test(t *testing.T, ds models.Datastore) {
 				t.Fatalf("Test UpdateRoute: expected updated `%v` but got `%v`", expected, updated)
 			}
 
-			// Update a config var, remove another. Add one Header, remove another.
+			// Update a config var, remove another. Replace one Header, remove another.
 			updated, err = ds.UpdateRoute(ctx, &models.Route{
 				AppName: testRoute.AppName,
 				Path:    testRoute.Path,
@@ -320,6 +322,7 @@ func Test(t *testing.T, ds models.Datastore) {
 				Image:   "iron/hello",
 				Type:    "sync",
 				Format:  "http",
+				JwtKey:  "route_key",
 				Timeout: 100,
 				// updated
 				Config: map[string]string{
@@ -327,7 +330,7 @@ func Test(t *testing.T, ds models.Datastore) {
 					"THIRD": "3",
 				},
 				Headers: http.Header{
-					"First": []string{"test", "test2"},
+					"First": []string{"test2"},
 					"Third": []string{"test", "test2"},
 				},
 			}
@@ -394,25 +397,25 @@ func Test(t *testing.T, ds models.Datastore) {
 		}
 
 		// Testing route delete
-		err = ds.RemoveRoute(ctx, "", "")
+		err = ds.RemoveRoute(ctx, "", "", "")
 		if err != models.ErrDatastoreEmptyAppName {
 			t.Log(buf.String())
 			t.Fatalf("Test RemoveRoute(empty app name): expected error `%v`, but it was `%v`", models.ErrDatastoreEmptyAppName, err)
 		}
 
-		err = ds.RemoveRoute(ctx, "a", "")
+		err = ds.RemoveRoute(ctx, "a", "", "")
 		if err != models.ErrDatastoreEmptyRoutePath {
 			t.Log(buf.String())
 			t.Fatalf("Test RemoveRoute(empty route path): expected error `%v`, but it was `%v`", models.ErrDatastoreEmptyRoutePath, err)
 		}
 
-		err = ds.RemoveRoute(ctx, testRoute.AppName, testRoute.Path)
+		err = ds.RemoveRoute(ctx, testRoute.AppName, testRoute.Path, "")
 		if err != nil {
 			t.Log(buf.String())
 			t.Fatalf("Test RemoveApp: unexpected error: %v", err)
 		}
 
-		route, err := ds.GetRoute(ctx, testRoute.AppName, testRoute.Path)
+		route, err := ds.GetRoute(ctx, testRoute.AppName, testRoute.Path, "")
 		if err != nil && err != models.ErrRoutesNotFound {
 			t.Log(buf.String())
 			t.Fatalf("Test GetRoute: expected error `%v`, but it was `%v`", models.ErrRoutesNotFound, err)
@@ -433,6 +436,648 @@ func Test(t *testing.T, ds models.Datastore) {
 		}
 	})
 
+	t.Run("targets", func(t *testing.T) {
+		_, err := ds.InsertApp(ctx, testApp)
+		if err != nil && err != models.ErrAppsAlreadyExists {
+			t.Log(buf.String())
+			t.Fatalf("Test Targets Prep: failed to insert app: %v", err)
+		}
+
+		route := &models.Route{
+			AppName: testApp.Name,
+			Path:    "/targets",
+			Image:   "iron/hello",
+			Type:    "sync",
+			Format:  "default",
+			Targets: []*models.RouteTarget{
+				{Name: "stable", Weight: 9},
+				{Name: "canary", Image: "iron/hello:next", Weight: 1, Config: models.Config{"CANARY": "1"}},
+			},
+		}
+		if _, err := ds.InsertRoute(ctx, route); err != nil {
+			t.Log(buf.String())
+			t.Fatalf("Test InsertRoute(targets): unexpected error: %v", err)
+		}
+		got, err := ds.GetRoute(ctx, route.AppName, route.Path, "")
+		if err != nil {
+			t.Log(buf.String())
+			t.Fatalf("Test GetRoute(targets): unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(got.Targets, route.Targets) {
+			t.Log(buf.String())
+			t.Fatalf("Test GetRoute(targets): expected targets `%v` but got `%v`", route.Targets, got.Targets)
+		}
+
+		// Targets are replaced as a whole.
+		targets := []*models.RouteTarget{{Name: "next", Image: "iron/hello:next", Weight: 1}}
+		if _, err := ds.UpdateRoute(ctx, &models.Route{AppName: route.AppName, Path: route.Path, Targets: targets}); err != nil {
+			t.Log(buf.String())
+			t.Fatalf("Test UpdateRoute(targets): unexpected error: %v", err)
+		}
+		routes, err := ds.GetRoutesByApp(ctx, route.AppName, &models.RouteFilter{Image: route.Image})
+		if err != nil {
+			t.Log(buf.String())
+			t.Fatalf("Test GetRoutesByApp(targets): unexpected error: %v", err)
+		}
+		var listed *models.Route
+		for _, r := range routes {
+			if r.Path == route.Path {
+				listed = r
+			}
+		}
+		if listed == nil || !reflect.DeepEqual(listed.Targets, targets) {
+			t.Log(buf.String())
+			t.Fatalf("Test UpdateRoute(targets): expected targets `%v` but got `%v`", targets, listed)
+		}
+
+		// An empty list removes them.
+		if _, err := ds.UpdateRoute(ctx, &models.Route{AppName: route.AppName, Path: route.Path, Targets: []*models.RouteTarget{}}); err != nil {
+			t.Log(buf.String())
+			t.Fatalf("Test UpdateRoute(no targets): unexpected error: %v", err)
+		}
+		if got, err = ds.GetRoute(ctx, route.AppName, route.Path, ""); err != nil || len(got.Targets) != 0 {
+			t.Log(buf.String())
+			t.Fatalf("Test UpdateRoute(no targets): expected no targets but got `%v`, %v", got, err)
+		}
+
+		if err := ds.RemoveRoute(ctx, route.AppName, route.Path, ""); err != nil {
+			t.Log(buf.String())
+			t.Fatalf("Test RemoveRoute(targets): unexpected error: %v", err)
+		}
+	})
+
+	t.Run("audit", func(t *testing.T) {
+		err := ds.InsertAuditEvent(ctx, nil)
+		if err != models.ErrDatastoreEmptyAuditEvent {
+			t.Log(buf.String())
+			t.Fatalf("Test InsertAuditEvent(nil): expected error `%v`, but it was `%v`", models.ErrDatastoreEmptyAuditEvent, err)
+		}
+
+		start := time.Now().Add(-time.Hour).Truncate(time.Second)
+		for i, event := range []*models.AuditEvent{
+			{ID: "1", Timestamp: start, Actor: "alice", Action: models.AuditAppCreate, AppName: testApp.Name},
+			{ID: "2", Timestamp: start.Add(time.Minute), Actor: "bob", Action: models.AuditRouteCreate, AppName: testApp.Name, Path: testRoute.Path},
+			{ID: "3", Timestamp: start.Add(2 * time.Minute), Actor: "alice", Action: models.AuditAppCreate, AppName: "other"},
+		} {
+			if err := ds.InsertAuditEvent(ctx, event); err != nil {
+				t.Log(buf.String())
+				t.Fatalf("Test InsertAuditEvent %d: unexpected error: %v", i, err)
+			}
+		}
+
+		for i, test := range []struct {
+			filter   *models.AuditFilter
+			expected []string
+		}{
+			{nil, []string{"3", "2", "1"}},
+			{&models.AuditFilter{AppName: testApp.Name}, []string{"2", "1"}},
+			{&models.AuditFilter{AppName: testApp.Name, Path: testRoute.Path}, []string{"2"}},
+			{&models.AuditFilter{Actor: "alice"}, []string{"3", "1"}},
+			{&models.AuditFilter{Since: start.Add(time.Minute)}, []string{"3", "2"}},
+			{&models.AuditFilter{Limit: 1}, []string{"3"}},
+		} {
+			events, err := ds.GetAuditEvents(ctx, test.filter)
+			if err != nil {
+				t.Log(buf.String())
+				t.Fatalf("Test GetAuditEvents %d: unexpected error: %v", i, err)
+			}
+			var ids []string
+			for _, event := range events {
+				ids = append(ids, event.ID)
+			}
+			if !reflect.DeepEqual(ids, test.expected) {
+				t.Log(buf.String())
+				t.Errorf("Test GetAuditEvents %d: expected events %v, got %v", i, test.expected, ids)
+			}
+		}
+	})
+
+	t.Run("revisions", func(t *testing.T) {
+		_, err := ds.InsertRouteRevision(ctx, nil)
+		if err != models.ErrDatastoreEmptyRouteRevision {
+			t.Log(buf.String())
+			t.Fatalf("Test InsertRouteRevision(nil): expected error `%v`, but it was `%v`", models.ErrDatastoreEmptyRouteRevision, err)
+		}
+
+		_, err = ds.InsertRouteRevision(ctx, &models.RouteRevision{AppName: testApp.Name})
+		if err != models.ErrDatastoreEmptyRoutePath {
+			t.Log(buf.String())
+			t.Fatalf("Test InsertRouteRevision(empty route path): expected error `%v`, but it was `%v`", models.ErrDatastoreEmptyRoutePath, err)
+		}
+
+		_, err = ds.GetRouteRevisions(ctx, "", testRoute.Path, "")
+		if err != models.ErrDatastoreEmptyAppName {
+			t.Log(buf.String())
+			t.Fatalf("Test GetRouteRevisions(empty app name): expected error `%v`, but it was `%v`", models.ErrDatastoreEmptyAppName, err)
+		}
+
+		for i, image := range []string{"iron/hello:1", "iron/hello:2", "iron/hello:3"} {
+			rev := models.NewRouteRevision(&models.Route{AppName: testApp.Name, Path: testRoute.Path, Image: image})
+			rev, err := ds.InsertRouteRevision(ctx, rev)
+			if err != nil {
+				t.Log(buf.String())
+				t.Fatalf("Test InsertRouteRevision %d: unexpected error: %v", i, err)
+			}
+			if rev.Revision != int64(i+1) {
+				t.Log(buf.String())
+				t.Fatalf("Test InsertRouteRevision %d: expected revision %d, got %d", i, i+1, rev.Revision)
+			}
+		}
+
+		// Revisions of other routes are numbered on their own.
+		other, err := ds.InsertRouteRevision(ctx, models.NewRouteRevision(&models.Route{AppName: testApp.Name, Path: "/other", Image: "iron/other"}))
+		if err != nil {
+			t.Log(buf.String())
+			t.Fatalf("Test InsertRouteRevision: unexpected error: %v", err)
+		}
+		if other.Revision != 1 {
+			t.Log(buf.String())
+			t.Fatalf("Test InsertRouteRevision: expected revision 1 for another route, got %d", other.Revision)
+		}
+
+		revs, err := ds.GetRouteRevisions(ctx, testApp.Name, testRoute.Path, "")
+		if err != nil {
+			t.Log(buf.String())
+			t.Fatalf("Test GetRouteRevisions: unexpected error: %v", err)
+		}
+		var images []string
+		for _, rev := range revs {
+			images = append(images, rev.Image)
+		}
+		if expected := []string{"iron/hello:3", "iron/hello:2", "iron/hello:1"}; !reflect.DeepEqual(images, expected) {
+			t.Log(buf.String())
+			t.Fatalf("Test GetRouteRevisions: expected images %v, got %v", expected, images)
+		}
+		if revs[0].Revision != 3 {
+			t.Log(buf.String())
+			t.Fatalf("Test GetRouteRevisions: expected newest revision 3, got %d", revs[0].Revision)
+		}
+
+		revs, err = ds.GetRouteRevisions(ctx, testApp.Name, "/nonexistent", "")
+		if err != nil {
+			t.Log(buf.String())
+			t.Fatalf("Test GetRouteRevisions(nonexistent route): unexpected error: %v", err)
+		}
+		if len(revs) != 0 {
+			t.Log(buf.String())
+			t.Fatalf("Test GetRouteRevisions(nonexistent route): expected no revisions, got %d", len(revs))
+		}
+	})
+
+	t.Run("move", func(t *testing.T) {
+		_, err := ds.InsertApp(ctx, testApp)
+		if err != nil && err != models.ErrAppsAlreadyExists {
+			t.Log(buf.String())
+			t.Fatalf("Test MoveRoute Prep: failed to insert app: %v", err)
+		}
+
+		_, err = ds.MoveRoute(ctx, "/from", "", &models.Route{Path: "/to"})
+		if err != models.ErrDatastoreEmptyAppName {
+			t.Log(buf.String())
+			t.Fatalf("Test MoveRoute(empty app name): expected error `%v`, but it was `%v`", models.ErrDatastoreEmptyAppName, err)
+		}
+
+		_, err = ds.MoveRoute(ctx, "/from", "", &models.Route{AppName: testApp.Name})
+		if err != models.ErrDatastoreEmptyRoutePath {
+			t.Log(buf.String())
+			t.Fatalf("Test MoveRoute(empty route path): expected error `%v`, but it was `%v`", models.ErrDatastoreEmptyRoutePath, err)
+		}
+
+		_, err = ds.MoveRoute(ctx, "/nonexistent", "", &models.Route{AppName: testApp.Name, Path: "/to"})
+		if err != models.ErrRoutesNotFound {
+			t.Log(buf.String())
+			t.Fatalf("Test MoveRoute(nonexistent route): expected error `%v`, but it was `%v`", models.ErrRoutesNotFound, err)
+		}
+
+		from := &models.Route{AppName: testApp.Name, Path: "/from", Name: "mover", Image: "iron/hello", Type: "sync", Format: "default", Aliases: []string{"/alias"}}
+		for _, r := range []*models.Route{from, {AppName: testApp.Name, Path: "/taken", Image: "iron/hello", Type: "sync", Format: "default"}} {
+			if _, err := ds.InsertRoute(ctx, r); err != nil {
+				t.Log(buf.String())
+				t.Fatalf("Test MoveRoute Prep: failed to insert route: %v", err)
+			}
+		}
+		if _, err := ds.InsertRouteRevision(ctx, models.NewRouteRevision(from)); err != nil {
+			t.Log(buf.String())
+			t.Fatalf("Test MoveRoute Prep: failed to insert revision: %v", err)
+		}
+		// Revisions found at the new path are replaced by the ones moved.
+		if _, err := ds.InsertRouteRevision(ctx, models.NewRouteRevision(&models.Route{AppName: testApp.Name, Path: "/to", Image: "iron/stale"})); err != nil {
+			t.Log(buf.String())
+			t.Fatalf("Test MoveRoute Prep: failed to insert revision: %v", err)
+		}
+
+		_, err = ds.MoveRoute(ctx, "/from", "", &models.Route{AppName: testApp.Name, Path: "/taken"})
+		if err != models.ErrRoutesAlreadyExists {
+			t.Log(buf.String())
+			t.Fatalf("Test MoveRoute(existing route): expected error `%v`, but it was `%v`", models.ErrRoutesAlreadyExists, err)
+		}
+
+		_, err = ds.MoveRoute(ctx, "/taken", "", &models.Route{AppName: testApp.Name, Path: "/elsewhere", Name: "mover"})
+		if err != models.ErrRoutesNameConflict {
+			t.Log(buf.String())
+			t.Fatalf("Test MoveRoute(name taken): expected error `%v`, but it was `%v`", models.ErrRoutesNameConflict, err)
+		}
+
+		// The route is updated as it moves.
+		route, err := ds.MoveRoute(ctx, "/from", "", &models.Route{AppName: testApp.Name, Path: "/to", Image: "iron/moved"})
+		if err != nil {
+			t.Log(buf.String())
+			t.Fatalf("Test MoveRoute: unexpected error: %v", err)
+		}
+		if route.Path != "/to" || route.Name != "mover" || route.Image != "iron/moved" {
+			t.Log(buf.String())
+			t.Fatalf("Test MoveRoute: expected route `mover` at `/to` with image `iron/moved`, got `%s` at `%s` with image `%s`", route.Name, route.Path, route.Image)
+		}
+
+		_, err = ds.GetRoute(ctx, testApp.Name, "/from", "")
+		if err != models.ErrRoutesNotFound {
+			t.Log(buf.String())
+			t.Fatalf("Test MoveRoute: expected old path to be gone with error `%v`, but it was `%v`", models.ErrRoutesNotFound, err)
+		}
+
+		route, err = ds.GetRoute(ctx, testApp.Name, "/to", "")
+		if err != nil {
+			t.Log(buf.String())
+			t.Fatalf("Test MoveRoute: unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(route.Aliases, from.Aliases) || route.Image != "iron/moved" {
+			t.Log(buf.String())
+			t.Fatalf("Test MoveRoute: expected aliases %v and image `iron/moved`, got %v and `%s`", from.Aliases, route.Aliases, route.Image)
+		}
+
+		revs, err := ds.GetRouteRevisions(ctx, testApp.Name, "/to", "")
+		if err != nil {
+			t.Log(buf.String())
+			t.Fatalf("Test MoveRoute: unexpected error: %v", err)
+		}
+		if len(revs) != 1 || revs[0].Image != "iron/hello" || revs[0].Path != "/to" {
+			t.Log(buf.String())
+			t.Fatalf("Test MoveRoute: expected the revisions of the route to move along, got %v", revs)
+		}
+
+		revs, err = ds.GetRouteRevisions(ctx, testApp.Name, "/from", "")
+		if err != nil {
+			t.Log(buf.String())
+			t.Fatalf("Test MoveRoute: unexpected error: %v", err)
+		}
+		if len(revs) != 0 {
+			t.Log(buf.String())
+			t.Fatalf("Test MoveRoute: expected no revisions left at the old path, got %d", len(revs))
+		}
+
+		routes, err := ds.GetRoutesByApp(ctx, testApp.Name, &models.RouteFilter{Name: "mover"})
+		if err != nil {
+			t.Log(buf.String())
+			t.Fatalf("Test GetRoutesByApp(name): unexpected error: %v", err)
+		}
+		if len(routes) != 1 || routes[0].Path != "/to" {
+			t.Log(buf.String())
+			t.Fatalf("Test GetRoutesByApp(name): expected only the route at `/to`, got %v", routes)
+		}
+
+		// Stale revisions are replaced even by a route without revisions.
+		if _, err := ds.InsertRouteRevision(ctx, models.NewRouteRevision(&models.Route{AppName: testApp.Name, Path: "/moved", Image: "iron/stale"})); err != nil {
+			t.Log(buf.String())
+			t.Fatalf("Test MoveRoute Prep: failed to insert revision: %v", err)
+		}
+		if _, err := ds.MoveRoute(ctx, "/taken", "", &models.Route{AppName: testApp.Name, Path: "/moved"}); err != nil {
+			t.Log(buf.String())
+			t.Fatalf("Test MoveRoute: unexpected error: %v", err)
+		}
+		revs, err = ds.GetRouteRevisions(ctx, testApp.Name, "/moved", "")
+		if err != nil {
+			t.Log(buf.String())
+			t.Fatalf("Test MoveRoute: unexpected error: %v", err)
+		}
+		if len(revs) != 0 {
+			t.Log(buf.String())
+			t.Fatalf("Test MoveRoute: expected no revisions at the new path, got %v", revs)
+		}
+
+		// Routes are removed along with their revisions.
+		if err := ds.RemoveRoute(ctx, testApp.Name, "/to", ""); err != nil {
+			t.Log(buf.String())
+			t.Fatalf("Test RemoveRoute: unexpected error: %v", err)
+		}
+		revs, err = ds.GetRouteRevisions(ctx, testApp.Name, "/to", "")
+		if err != nil {
+			t.Log(buf.String())
+			t.Fatalf("Test RemoveRoute: unexpected error: %v", err)
+		}
+		if len(revs) != 0 {
+			t.Log(buf.String())
+			t.Fatalf("Test RemoveRoute: expected the revisions of the route to be removed, got %v", revs)
+		}
+
+		// Names are unique within an app, and freed along with their route.
+		named := &models.Route{AppName: testApp.Name, Path: "/named", Name: "mover", Image: "iron/hello", Type: "sync", Format: "default"}
+		if _, err := ds.InsertRoute(ctx, named); err != nil {
+			t.Log(buf.String())
+			t.Fatalf("Test InsertRoute(freed name): unexpected error: %v", err)
+		}
+		_, err = ds.InsertRoute(ctx, &models.Route{AppName: testApp.Name, Path: "/named2", Name: "mover", Image: "iron/hello", Type: "sync", Format: "default"})
+		if err != models.ErrRoutesNameConflict {
+			t.Log(buf.String())
+			t.Fatalf("Test InsertRoute(name taken): expected error `%v`, but it was `%v`", models.ErrRoutesNameConflict, err)
+		}
+		_, err = ds.UpdateRoute(ctx, &models.Route{AppName: testApp.Name, Path: "/moved", Name: "mover"})
+		if err != models.ErrRoutesNameConflict {
+			t.Log(buf.String())
+			t.Fatalf("Test UpdateRoute(name taken): expected error `%v`, but it was `%v`", models.ErrRoutesNameConflict, err)
+		}
+		if _, err := ds.UpdateRoute(ctx, &models.Route{AppName: testApp.Name, Path: "/named", Name: "renamed"}); err != nil {
+			t.Log(buf.String())
+			t.Fatalf("Test UpdateRoute(rename): unexpected error: %v", err)
+		}
+		if _, err := ds.UpdateRoute(ctx, &models.Route{AppName: testApp.Name, Path: "/moved", Name: "mover"}); err != nil {
+			t.Log(buf.String())
+			t.Fatalf("Test UpdateRoute(renamed name): unexpected error: %v", err)
+		}
+	})
+
+	t.Run("methods", func(t *testing.T) {
+		app := &models.App{Name: "Methods"}
+		if _, err := ds.InsertApp(ctx, app); err != nil {
+			t.Log(buf.String())
+			t.Fatalf("Test Methods Prep: failed to insert app: %v", err)
+		}
+
+		// Routes serving different methods share a path, and are told apart
+		// by the key of their methods.
+		get := &models.Route{AppName: app.Name, Path: "/users", Methods: []string{"HEAD", "GET"}, Image: "iron/list", Type: "sync", Format: "default"}
+		post := &models.Route{AppName: app.Name, Path: "/users", Methods: []string{"POST"}, Image: "iron/create", Type: "sync", Format: "default"}
+		for _, r := range []*models.Route{get, post} {
+			if _, err := ds.InsertRoute(ctx, r); err != nil {
+				t.Log(buf.String())
+				t.Fatalf("Test Methods Prep: failed to insert route: %v", err)
+			}
+			if _, err := ds.InsertRouteRevision(ctx, models.NewRouteRevision(r)); err != nil {
+				t.Log(buf.String())
+				t.Fatalf("Test Methods Prep: failed to insert revision: %v", err)
+			}
+		}
+
+		_, err := ds.InsertRoute(ctx, &models.Route{AppName: app.Name, Path: "/users", Methods: []string{"GET", "HEAD"}, Image: "iron/other", Type: "sync", Format: "default"})
+		if err != models.ErrRoutesAlreadyExists {
+			t.Log(buf.String())
+			t.Fatalf("Test InsertRoute(same methods): expected error `%v`, but it was `%v`", models.ErrRoutesAlreadyExists, err)
+		}
+
+		route, err := ds.GetRoute(ctx, app.Name, "/users", "GET,HEAD")
+		if err != nil || route.Image != "iron/list" {
+			t.Log(buf.String())
+			t.Fatalf("Test GetRoute(methods): expected the route with image `iron/list`, got %v, %v", route, err)
+		}
+		if _, err := ds.GetRoute(ctx, app.Name, "/users", ""); err != models.ErrRoutesNotFound {
+			t.Log(buf.String())
+			t.Fatalf("Test GetRoute(other methods): expected error `%v`, but it was `%v`", models.ErrRoutesNotFound, err)
+		}
+
+		// Updates leave the other routes of the path alone.
+		if _, err := ds.UpdateRoute(ctx, &models.Route{AppName: app.Name, Path: "/users", Methods: []string{"POST"}, Image: "iron/create:2"}); err != nil {
+			t.Log(buf.String())
+			t.Fatalf("Test UpdateRoute(methods): unexpected error: %v", err)
+		}
+		if route, err = ds.GetRoute(ctx, app.Name, "/users", "GET,HEAD"); err != nil || route.Image != "iron/list" {
+			t.Log(buf.String())
+			t.Fatalf("Test UpdateRoute(methods): expected the other route to keep image `iron/list`, got %v, %v", route, err)
+		}
+
+		// The routes of a path are listed by their methods.
+		var listed []string
+		filter := &models.RouteFilter{PerPage: 1}
+		for page := 0; page < 3; page++ {
+			routes, err := ds.GetRoutesByApp(ctx, app.Name, filter)
+			if err != nil {
+				t.Log(buf.String())
+				t.Fatalf("Test GetRoutesByApp(methods): unexpected error: %v", err)
+			}
+			if len(routes) == 0 {
+				break
+			}
+			last := routes[len(routes)-1]
+			listed = append(listed, last.Image)
+			filter.CursorApp, filter.CursorPath, filter.CursorMethods = last.AppName, last.Path, models.MethodsKey(last.Methods)
+		}
+		if expected := []string{"iron/list", "iron/create:2"}; !reflect.DeepEqual(listed, expected) {
+			t.Log(buf.String())
+			t.Fatalf("Test GetRoutesByApp(methods): expected routes %v, got %v", expected, listed)
+		}
+
+		// Routes move to other methods along with their revisions.
+		route, err = ds.MoveRoute(ctx, "/users", "POST", &models.Route{AppName: app.Name, Path: "/users", Methods: []string{"POST", "PUT"}})
+		if err != nil || route.Image != "iron/create:2" {
+			t.Log(buf.String())
+			t.Fatalf("Test MoveRoute(methods): expected the route with image `iron/create:2`, got %v, %v", route, err)
+		}
+		revs, err := ds.GetRouteRevisions(ctx, app.Name, "/users", "POST,PUT")
+		if err != nil {
+			t.Log(buf.String())
+			t.Fatalf("Test MoveRoute(methods): unexpected error: %v", err)
+		}
+		if len(revs) != 1 || revs[0].Image != "iron/create" || !reflect.DeepEqual(revs[0].Methods, []string{"POST", "PUT"}) {
+			t.Log(buf.String())
+			t.Fatalf("Test MoveRoute(methods): expected the revisions of the route to move along, got %v", revs)
+		}
+		_, err = ds.MoveRoute(ctx, "/users", "POST,PUT", &models.Route{AppName: app.Name, Path: "/users", Methods: []string{"GET", "HEAD"}})
+		if err != models.ErrRoutesAlreadyExists {
+			t.Log(buf.String())
+			t.Fatalf("Test MoveRoute(methods taken): expected error `%v`, but it was `%v`", models.ErrRoutesAlreadyExists, err)
+		}
+
+		// Removing a route leaves the other routes of the path, and their
+		// revisions.
+		if err := ds.RemoveRoute(ctx, app.Name, "/users", "POST,PUT"); err != nil {
+			t.Log(buf.String())
+			t.Fatalf("Test RemoveRoute(methods): unexpected error: %v", err)
+		}
+		if _, err := ds.GetRoute(ctx, app.Name, "/users", "GET,HEAD"); err != nil {
+			t.Log(buf.String())
+			t.Fatalf("Test RemoveRoute(methods): expected the other route to be kept, got error %v", err)
+		}
+		if revs, err := ds.GetRouteRevisions(ctx, app.Name, "/users", "GET,HEAD"); err != nil || len(revs) != 1 {
+			t.Log(buf.String())
+			t.Fatalf("Test RemoveRoute(methods): expected the revisions of the other route to be kept, got %v, %v", revs, err)
+		}
+	})
+
+	t.Run("remove-app", func(t *testing.T) {
+		app := &models.App{Name: "Cascade"}
+		other := &models.App{Name: "Cascade2"}
+		for _, a := range []*models.App{app, other} {
+			if _, err := ds.InsertApp(ctx, a); err != nil {
+				t.Log(buf.String())
+				t.Fatalf("Test RemoveApp Prep: failed to insert app: %v", err)
+			}
+			route := &models.Route{AppName: a.Name, Path: "/test", Image: "iron/hello", Type: "sync", Format: "default"}
+			if _, err := ds.InsertRoute(ctx, route); err != nil {
+				t.Log(buf.String())
+				t.Fatalf("Test RemoveApp Prep: failed to insert route: %v", err)
+			}
+			if _, err := ds.InsertRouteRevision(ctx, models.NewRouteRevision(route)); err != nil {
+				t.Log(buf.String())
+				t.Fatalf("Test RemoveApp Prep: failed to insert revision: %v", err)
+			}
+			if err := ds.Put(ctx, models.AppExtrasKey(a.Name, []byte("extra")), []byte("data")); err != nil {
+				t.Log(buf.String())
+				t.Fatalf("Test RemoveApp Prep: failed to put extra: %v", err)
+			}
+		}
+
+		if err := ds.RemoveApp(ctx, app.Name, false); err != models.ErrDeleteAppsWithRoutes {
+			t.Log(buf.String())
+			t.Fatalf("Test RemoveApp(no cascade): expected error `%v`, but it was `%v`", models.ErrDeleteAppsWithRoutes, err)
+		}
+		if routes, err := ds.GetRoutesByApp(ctx, app.Name, &models.RouteFilter{}); err != nil || len(routes) != 1 {
+			t.Log(buf.String())
+			t.Fatalf("Test RemoveApp(no cascade): expected the routes of the app to be kept, got %v, %v", routes, err)
+		}
+
+		if err := ds.RemoveApp(ctx, app.Name, true); err != nil {
+			t.Log(buf.String())
+			t.Fatalf("Test RemoveApp: unexpected error: %v", err)
+		}
+
+		if _, err := ds.GetApp(ctx, app.Name); err != models.ErrAppsNotFound {
+			t.Log(buf.String())
+			t.Fatalf("Test RemoveApp: expected error `%v`, but it was `%v`", models.ErrAppsNotFound, err)
+		}
+		if routes, err := ds.GetRoutesByApp(ctx, app.Name, &models.RouteFilter{}); err != nil || len(routes) != 0 {
+			t.Log(buf.String())
+			t.Fatalf("Test RemoveApp: expected the routes of the app to be removed, got %v, %v", routes, err)
+		}
+		if revs, err := ds.GetRouteRevisions(ctx, app.Name, "/test", ""); err != nil || len(revs) != 0 {
+			t.Log(buf.String())
+			t.Fatalf("Test RemoveApp: expected the revisions of the app to be removed, got %v, %v", revs, err)
+		}
+		if val, err := ds.Get(ctx, models.AppExtrasKey(app.Name, []byte("extra"))); err != nil || len(val) != 0 {
+			t.Log(buf.String())
+			t.Fatalf("Test RemoveApp: expected the extras of the app to be removed, got `%s`, %v", val, err)
+		}
+
+		// Apps whose name starts with the removed one's are left alone.
+		if routes, err := ds.GetRoutesByApp(ctx, other.Name, &models.RouteFilter{}); err != nil || len(routes) != 1 {
+			t.Log(buf.String())
+			t.Fatalf("Test RemoveApp: expected the routes of other apps to be kept, got %v, %v", routes, err)
+		}
+		if revs, err := ds.GetRouteRevisions(ctx, other.Name, "/test", ""); err != nil || len(revs) != 1 {
+			t.Log(buf.String())
+			t.Fatalf("Test RemoveApp: expected the revisions of other apps to be kept, got %v, %v", revs, err)
+		}
+		if val, err := ds.Get(ctx, models.AppExtrasKey(other.Name, []byte("extra"))); err != nil || string(val) != "data" {
+			t.Log(buf.String())
+			t.Fatalf("Test RemoveApp: expected the extras of other apps to be kept, got `%s`, %v", val, err)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		for _, name := range []string{"List-b", "List-a", "List-c", "Listing"} {
+			if _, err := ds.InsertApp(ctx, &models.App{Name: name}); err != nil {
+				t.Log(buf.String())
+				t.Fatalf("Test List Prep: failed to insert app: %v", err)
+			}
+		}
+		for _, route := range []*models.Route{
+			{AppName: "List-b", Path: "/a", Image: "iron/hello", Type: "sync", Format: "default"},
+			{AppName: "List-a", Path: "/c/d", Image: "iron/hello:0.0.2", Type: "async", Format: "default"},
+			{AppName: "List-a", Path: "/a", Image: "iron/hello", Type: "sync", Format: "http", Name: "hello-http"},
+			{AppName: "List-a", Path: "/c", Image: "iron/error", Type: "sync", Format: "default", Name: "error"},
+			{AppName: "List-a", Path: "/b", Image: "other/hello", Type: "async", Format: "default", Name: "hello-async"},
+		} {
+			if _, err := ds.InsertRoute(ctx, route); err != nil {
+				t.Log(buf.String())
+				t.Fatalf("Test List Prep: failed to insert route: %v", err)
+			}
+		}
+
+		for i, test := range []struct {
+			filter   *models.AppFilter
+			expected []string
+		}{
+			{&models.AppFilter{Name: "List-*"}, []string{"List-a", "List-b", "List-c"}},
+			{&models.AppFilter{Name: "List*"}, []string{"List-a", "List-b", "List-c", "Listing"}},
+			{&models.AppFilter{Name: "*-b"}, []string{"List-b"}},
+			{&models.AppFilter{Name: "List-*", PerPage: 2}, []string{"List-a", "List-b"}},
+			{&models.AppFilter{Name: "List-*", PerPage: 2, Cursor: "List-b"}, []string{"List-c"}},
+			{&models.AppFilter{Name: "List-*", Cursor: "List-c"}, nil},
+		} {
+			apps, err := ds.GetApps(ctx, test.filter)
+			if err != nil {
+				t.Log(buf.String())
+				t.Fatalf("Test GetApps %d: unexpected error: %v", i, err)
+			}
+			var names []string
+			for _, app := range apps {
+				names = append(names, app.Name)
+			}
+			if !reflect.DeepEqual(names, test.expected) {
+				t.Log(buf.String())
+				t.Errorf("Test GetApps %d: expected apps %v, got %v", i, test.expected, names)
+			}
+		}
+
+		if _, err := ds.GetApps(ctx, &models.AppFilter{PerPage: -1}); err != models.ErrInvalidPerPage {
+			t.Log(buf.String())
+			t.Fatalf("Test GetApps: expected error `%v`, but it was `%v`", models.ErrInvalidPerPage, err)
+		}
+
+		for i, test := range []struct {
+			filter   *models.RouteFilter
+			expected []string
+		}{
+			{&models.RouteFilter{AppName: "List-a"}, []string{"/a", "/b", "/c", "/c/d"}},
+			{&models.RouteFilter{AppName: "List-a", Image: "iron/hello"}, []string{"/a", "/c/d"}},
+			{&models.RouteFilter{AppName: "List-a", Type: "async"}, []string{"/b", "/c/d"}},
+			{&models.RouteFilter{AppName: "List-a", Format: "http"}, []string{"/a"}},
+			{&models.RouteFilter{AppName: "List-a", Name: "hello-*"}, []string{"/a", "/b"}},
+			{&models.RouteFilter{AppName: "List-a", PerPage: 3}, []string{"/a", "/b", "/c"}},
+			{&models.RouteFilter{AppName: "List-a", PerPage: 3, CursorApp: "List-a", CursorPath: "/c"}, []string{"/c/d"}},
+			{&models.RouteFilter{AppName: "List-a", CursorApp: "List-a", CursorPath: "/c/d"}, nil},
+		} {
+			routes, err := ds.GetRoutesByApp(ctx, test.filter.AppName, test.filter)
+			if err != nil {
+				t.Log(buf.String())
+				t.Fatalf("Test GetRoutesByApp %d: unexpected error: %v", i, err)
+			}
+			var paths []string
+			for _, route := range routes {
+				paths = append(paths, route.Path)
+			}
+			if !reflect.DeepEqual(paths, test.expected) {
+				t.Log(buf.String())
+				t.Errorf("Test GetRoutesByApp %d: expected routes %v, got %v", i, test.expected, paths)
+			}
+		}
+
+		// Listing every app pages across app boundaries.
+		var routes []string
+		filter := &models.RouteFilter{Image: "iron/hello", PerPage: 2}
+		for page := 0; ; page++ {
+			if page > 10 {
+				t.Fatalf("Test GetRoutes: expected the listing to end, got %v", routes)
+			}
+			res, err := ds.GetRoutes(ctx, filter)
+			if err != nil {
+				t.Log(buf.String())
+				t.Fatalf("Test GetRoutes: unexpected error: %v", err)
+			}
+			for _, route := range res {
+				if route.AppName == "List-a" || route.AppName == "List-b" {
+					routes = append(routes, route.AppName+route.Path)
+				}
+			}
+			if len(res) < filter.PerPage {
+				break
+			}
+			last := res[len(res)-1]
+			filter.CursorApp, filter.CursorPath = last.AppName, last.Path
+		}
+		if expected := []string{"List-a/a", "List-a/c/d", "List-b/a"}; !reflect.DeepEqual(routes, expected) {
+			t.Log(buf.String())
+			t.Errorf("Test GetRoutes: expected routes %v, got %v", expected, routes)
+		}
+	})
+
 	t.Run("put-get", func(t *testing.T) {
 		// Testing Put/Get
 		err := ds.Put(ctx, nil, nil)
@@ -485,4 +1130,5 @@ var testRoute = &models.Route{
 	Image:   "iron/hello",
 	Type:    "sync",
 	Format:  "http",
+	JwtKey:  "route_key",
 }
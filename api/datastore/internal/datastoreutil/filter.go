@@ -0,0 +1,74 @@
+package datastoreutil
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/iron-io/functions/api/models"
+)
+
+// FilterApps returns the page of apps selected by filter, for datastores
+// which cannot filter nor sort them.
+func FilterApps(apps []*models.App, filter *models.AppFilter) []*models.App {
+	res := []*models.App{}
+	for _, app := range apps {
+		if filter.Match(app) {
+			res = append(res, app)
+		}
+	}
+	sort.Sort(appsByName(res))
+	if filter != nil && filter.PerPage > 0 && len(res) > filter.PerPage {
+		res = res[:filter.PerPage]
+	}
+	return res
+}
+
+// FilterRoutes returns the page of routes selected by filter, for datastores
+// which cannot filter nor sort them.
+func FilterRoutes(routes []*models.Route, filter *models.RouteFilter) []*models.Route {
+	res := []*models.Route{}
+	for _, route := range routes {
+		if filter.Match(route) {
+			res = append(res, route)
+		}
+	}
+	sort.Sort(routesByAppAndPath(res))
+	if filter != nil && filter.PerPage > 0 && len(res) > filter.PerPage {
+		res = res[:filter.PerPage]
+	}
+	return res
+}
+
+type appsByName []*models.App
+
+func (a appsByName) Len() int           { return len(a) }
+func (a appsByName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a appsByName) Less(i, j int) bool { return a[i].Name < a[j].Name }
+
+type routesByAppAndPath []*models.Route
+
+func (r routesByAppAndPath) Len() int      { return len(r) }
+func (r routesByAppAndPath) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+func (r routesByAppAndPath) Less(i, j int) bool {
+	return models.RouteLess(r[i].AppName, r[i].Path, models.MethodsKey(r[i].Methods), r[j].AppName, r[j].Path, models.MethodsKey(r[j].Methods))
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// GlobToLike translates a filter glob to an SQL LIKE pattern, escaped with
+// backslashes.
+func GlobToLike(glob string) string {
+	if glob == "" {
+		return ""
+	}
+	return strings.Replace(likeEscaper.Replace(glob), "*", "%", -1)
+}
+
+// PrefixToLike translates a filter prefix to an SQL LIKE pattern, escaped
+// with backslashes.
+func PrefixToLike(prefix string) string {
+	if prefix == "" {
+		return ""
+	}
+	return likeEscaper.Replace(prefix) + "%"
+}
@@ -0,0 +1,57 @@
+package datastoreutil
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/iron-io/functions/api/models"
+)
+
+// FillMethodsKeys returns a migration step setting the methods_key column of
+// the routes of an SQL datastore from their methods column, see
+// models.MethodsKey, and the one of their revisions from their route. It runs
+// while routes are still keyed by app and path alone: update sets the
+// methods_key, its first argument, of the route at the app_name and path
+// following it, in the placeholder syntax of the database.
+func FillMethodsKeys(update string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		rows, err := tx.Query("SELECT app_name, path, methods FROM routes WHERE methods IS NOT NULL")
+		if err != nil {
+			return err
+		}
+		var keys [][3]string
+		for rows.Next() {
+			var appName, path, methodsStr string
+			if err := rows.Scan(&appName, &path, &methodsStr); err != nil {
+				rows.Close()
+				return err
+			}
+			var methods []string
+			if methodsStr != "" {
+				if err := json.Unmarshal([]byte(methodsStr), &methods); err != nil {
+					rows.Close()
+					return err
+				}
+			}
+			if key := models.MethodsKey(methods); key != "" {
+				keys = append(keys, [3]string{key, appName, path})
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		// The rows are all read before updating them, as some drivers cannot
+		// run a statement while a query of the same transaction is open.
+		for _, k := range keys {
+			if _, err := tx.Exec(update, k[0], k[1], k[2]); err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.Exec(`UPDATE revisions SET methods_key = COALESCE((SELECT methods_key FROM routes
+			WHERE routes.app_name = revisions.app_name AND routes.path = revisions.path), '')`)
+		return err
+	}
+}
@@ -11,6 +11,7 @@ type Datastore interface {
 	// name will never be empty.
 	GetApp(ctx context.Context, name string) (*models.App, error)
 
+	// appFilter will never be nil.
 	GetApps(ctx context.Context, appFilter *models.AppFilter) ([]*models.App, error)
 
 	// app and app.Name will never be nil/empty.
@@ -18,21 +19,39 @@ type Datastore interface {
 	UpdateApp(ctx context.Context, app *models.App) (*models.App, error)
 
 	// name will never be empty.
-	RemoveApp(ctx context.Context, name string) error
+	RemoveApp(ctx context.Context, name string, cascade bool) error
 
 	// appName and routePath will never be empty.
-	GetRoute(ctx context.Context, appName, routePath string) (*models.Route, error)
-	RemoveRoute(ctx context.Context, appName, routePath string) error
+	GetRoute(ctx context.Context, appName, routePath, methods string) (*models.Route, error)
+	RemoveRoute(ctx context.Context, appName, routePath, methods string) error
 
+	// filter will never be nil.
 	GetRoutes(ctx context.Context, filter *models.RouteFilter) (routes []*models.Route, err error)
 
-	// appName will never be empty
+	// appName will never be empty, filter will never be nil and is a copy
+	// with filter.AppName set to appName.
 	GetRoutesByApp(ctx context.Context, appName string, filter *models.RouteFilter) (routes []*models.Route, err error)
 
 	// route will never be nil and route's AppName and Path will never be empty.
 	InsertRoute(ctx context.Context, route *models.Route) (*models.Route, error)
 	UpdateRoute(ctx context.Context, route *models.Route) (*models.Route, error)
 
+	// oldPath will never be empty, route will never be nil and route's
+	// AppName and Path will never be empty.
+	MoveRoute(ctx context.Context, oldPath, oldMethods string, route *models.Route) (*models.Route, error)
+
+	// event will never be nil.
+	InsertAuditEvent(ctx context.Context, event *models.AuditEvent) error
+
+	// filter will never be nil.
+	GetAuditEvents(ctx context.Context, filter *models.AuditFilter) ([]*models.AuditEvent, error)
+
+	// rev will never be nil and rev's AppName and Path will never be empty.
+	InsertRouteRevision(ctx context.Context, rev *models.RouteRevision) (*models.RouteRevision, error)
+
+	// appName and routePath will never be empty.
+	GetRouteRevisions(ctx context.Context, appName, routePath, methods string) ([]*models.RouteRevision, error)
+
 	// key will never be nil/empty
 	Put(ctx context.Context, key, val []byte) error
 	Get(ctx context.Context, key []byte) ([]byte, error)
@@ -55,6 +74,12 @@ func (v *validator) GetApp(ctx context.Context, name string) (app *models.App, e
 }
 
 func (v *validator) GetApps(ctx context.Context, appFilter *models.AppFilter) ([]*models.App, error) {
+	if appFilter == nil {
+		appFilter = &models.AppFilter{}
+	}
+	if appFilter.PerPage < 0 {
+		return nil, models.ErrInvalidPerPage
+	}
 	return v.ds.GetApps(ctx, appFilter)
 }
 
@@ -79,15 +104,15 @@ func (v *validator) UpdateApp(ctx context.Context, app *models.App) (*models.App
 	return v.ds.UpdateApp(ctx, app)
 }
 
-func (v *validator) RemoveApp(ctx context.Context, name string) error {
+func (v *validator) RemoveApp(ctx context.Context, name string, cascade bool) error {
 	if name == "" {
 		return models.ErrDatastoreEmptyAppName
 	}
 
-	return v.ds.RemoveApp(ctx, name)
+	return v.ds.RemoveApp(ctx, name, cascade)
 }
 
-func (v *validator) GetRoute(ctx context.Context, appName, routePath string) (*models.Route, error) {
+func (v *validator) GetRoute(ctx context.Context, appName, routePath, methods string) (*models.Route, error) {
 	if appName == "" {
 		return nil, models.ErrDatastoreEmptyAppName
 	}
@@ -95,12 +120,18 @@ func (v *validator) GetRoute(ctx context.Context, appName, routePath string) (*m
 		return nil, models.ErrDatastoreEmptyRoutePath
 	}
 
-	return v.ds.GetRoute(ctx, appName, routePath)
+	return v.ds.GetRoute(ctx, appName, routePath, methods)
 }
 
 func (v *validator) GetRoutes(ctx context.Context, routeFilter *models.RouteFilter) (routes []*models.Route, err error) {
 	if routeFilter != nil && routeFilter.AppName != "" {
-		return v.ds.GetRoutesByApp(ctx, routeFilter.AppName, routeFilter)
+		return v.GetRoutesByApp(ctx, routeFilter.AppName, routeFilter)
+	}
+	if routeFilter == nil {
+		routeFilter = &models.RouteFilter{}
+	}
+	if routeFilter.PerPage < 0 {
+		return nil, models.ErrInvalidPerPage
 	}
 
 	return v.ds.GetRoutes(ctx, routeFilter)
@@ -110,7 +141,15 @@ func (v *validator) GetRoutesByApp(ctx context.Context, appName string, routeFil
 	if appName == "" {
 		return nil, models.ErrDatastoreEmptyAppName
 	}
-	return v.ds.GetRoutesByApp(ctx, appName, routeFilter)
+	var filter models.RouteFilter
+	if routeFilter != nil {
+		filter = *routeFilter
+	}
+	if filter.PerPage < 0 {
+		return nil, models.ErrInvalidPerPage
+	}
+	filter.AppName = appName
+	return v.ds.GetRoutesByApp(ctx, appName, &filter)
 }
 
 func (v *validator) InsertRoute(ctx context.Context, route *models.Route) (*models.Route, error) {
@@ -140,7 +179,20 @@ func (v *validator) UpdateRoute(ctx context.Context, newroute *models.Route) (*m
 	return v.ds.UpdateRoute(ctx, newroute)
 }
 
-func (v *validator) RemoveRoute(ctx context.Context, appName, routePath string) error {
+func (v *validator) MoveRoute(ctx context.Context, oldPath, oldMethods string, route *models.Route) (*models.Route, error) {
+	if route == nil {
+		return nil, models.ErrDatastoreEmptyRoute
+	}
+	if route.AppName == "" {
+		return nil, models.ErrDatastoreEmptyAppName
+	}
+	if oldPath == "" || route.Path == "" {
+		return nil, models.ErrDatastoreEmptyRoutePath
+	}
+	return v.ds.MoveRoute(ctx, oldPath, oldMethods, route)
+}
+
+func (v *validator) RemoveRoute(ctx context.Context, appName, routePath, methods string) error {
 	if appName == "" {
 		return models.ErrDatastoreEmptyAppName
 	}
@@ -148,7 +200,44 @@ func (v *validator) RemoveRoute(ctx context.Context, appName, routePath string)
 		return models.ErrDatastoreEmptyRoutePath
 	}
 
-	return v.ds.RemoveRoute(ctx, appName, routePath)
+	return v.ds.RemoveRoute(ctx, appName, routePath, methods)
+}
+
+func (v *validator) InsertAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	if event == nil {
+		return models.ErrDatastoreEmptyAuditEvent
+	}
+	return v.ds.InsertAuditEvent(ctx, event)
+}
+
+func (v *validator) GetAuditEvents(ctx context.Context, filter *models.AuditFilter) ([]*models.AuditEvent, error) {
+	if filter == nil {
+		filter = &models.AuditFilter{}
+	}
+	return v.ds.GetAuditEvents(ctx, filter)
+}
+
+func (v *validator) InsertRouteRevision(ctx context.Context, rev *models.RouteRevision) (*models.RouteRevision, error) {
+	if rev == nil {
+		return nil, models.ErrDatastoreEmptyRouteRevision
+	}
+	if rev.AppName == "" {
+		return nil, models.ErrDatastoreEmptyAppName
+	}
+	if rev.Path == "" {
+		return nil, models.ErrDatastoreEmptyRoutePath
+	}
+	return v.ds.InsertRouteRevision(ctx, rev)
+}
+
+func (v *validator) GetRouteRevisions(ctx context.Context, appName, routePath, methods string) ([]*models.RouteRevision, error) {
+	if appName == "" {
+		return nil, models.ErrDatastoreEmptyAppName
+	}
+	if routePath == "" {
+		return nil, models.ErrDatastoreEmptyRoutePath
+	}
+	return v.ds.GetRouteRevisions(ctx, appName, routePath, methods)
 }
 
 func (v *validator) Put(ctx context.Context, key, value []byte) error {
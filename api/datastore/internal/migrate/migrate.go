@@ -0,0 +1,134 @@
+// Package migrate moves the schema of a datastore between versions, so that
+// the tables or documents of an existing datastore are upgraded along with
+// the server.
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// Migration moves a datastore to its Version from the version before, and
+// back.
+type Migration struct {
+	Version int
+	Name    string
+}
+
+// Schema is a datastore whose layout is versioned.
+type Schema interface {
+	// Migrations lists every migration of the datastore by increasing
+	// version, starting at 1.
+	Migrations() []Migration
+
+	// Version returns the version the datastore is at, 0 when it was never
+	// migrated.
+	Version() (int, error)
+
+	// Apply runs m up, on a datastore at m.Version-1, or down, on a datastore
+	// at m.Version, and records the version it leaves the datastore at.
+	Apply(m Migration, up bool) error
+}
+
+var ErrDryRun = errors.New("migrations pending, not applied in a dry run")
+
+// Latest returns the version of the last migration of s.
+func Latest(s Schema) int {
+	ms := s.Migrations()
+	if len(ms) == 0 {
+		return 0
+	}
+	return ms[len(ms)-1].Version
+}
+
+// Plan returns the migrations which take s from its current version to
+// version, in the order to apply them, and whether they are applied up.
+func Plan(s Schema, version int) ([]Migration, bool, error) {
+	current, err := s.Version()
+	if err != nil {
+		return nil, false, err
+	}
+	latest := Latest(s)
+	if current > latest {
+		return nil, false, fmt.Errorf("schema version %d is newer than the latest known version %d", current, latest)
+	}
+	if version < 0 || version > latest {
+		return nil, false, fmt.Errorf("unknown schema version %d, the latest is %d", version, latest)
+	}
+
+	var plan []Migration
+	ms := s.Migrations()
+	if version >= current {
+		for _, m := range ms {
+			if m.Version > current && m.Version <= version {
+				plan = append(plan, m)
+			}
+		}
+		return plan, true, nil
+	}
+	for i := len(ms) - 1; i >= 0; i-- {
+		if ms[i].Version <= current && ms[i].Version > version {
+			plan = append(plan, ms[i])
+		}
+	}
+	return plan, false, nil
+}
+
+// To migrates s up or down to version. A dry run only logs the migrations it
+// would apply, failing with ErrDryRun if there are any.
+func To(s Schema, version int, dryRun bool) error {
+	plan, up, err := Plan(s, version)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range plan {
+		log := logrus.WithFields(logrus.Fields{"version": m.Version, "name": m.Name, "up": up})
+		if dryRun {
+			log.Info("Pending schema migration")
+			continue
+		}
+		log.Info("Applying schema migration")
+		if err := s.Apply(m, up); err != nil {
+			return fmt.Errorf("schema migration %d (%s): %v", m.Version, m.Name, err)
+		}
+	}
+	if dryRun && len(plan) > 0 {
+		return ErrDryRun
+	}
+	return nil
+}
+
+// FromURL migrates s as the migrate parameter of the datastore URL u asks:
+//
+//	absent, up to the latest version
+//	migrate=dry-run, only logging the migrations pending up to the latest version
+//	migrate=3, up or down to version 3
+func FromURL(s Schema, u *url.URL) error {
+	switch v := u.Query().Get("migrate"); v {
+	case "":
+		return To(s, Latest(s), false)
+	case "dry-run":
+		return To(s, Latest(s), true)
+	default:
+		version, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid migrate parameter %q, expected dry-run or a schema version", v)
+		}
+		return To(s, version, false)
+	}
+}
+
+// StripURL returns u without the parameters this package reads, for
+// datastores which pass their URL's parameters on to their driver.
+func StripURL(u *url.URL) *url.URL {
+	q := u.Query()
+	q.Del("migrate")
+	c := *u
+	c.RawQuery = q.Encode()
+	return &c
+}
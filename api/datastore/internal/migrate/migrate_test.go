@@ -0,0 +1,85 @@
+package migrate
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+type testSchema struct {
+	version int
+	applied []int // negative when applied down
+}
+
+func (s *testSchema) Migrations() []Migration {
+	return []Migration{{1, "one"}, {2, "two"}, {3, "three"}}
+}
+
+func (s *testSchema) Version() (int, error) { return s.version, nil }
+
+func (s *testSchema) Apply(m Migration, up bool) error {
+	if up {
+		s.applied = append(s.applied, m.Version)
+		s.version = m.Version
+	} else {
+		s.applied = append(s.applied, -m.Version)
+		s.version = m.Version - 1
+	}
+	return nil
+}
+
+func TestTo(t *testing.T) {
+	for i, test := range []struct {
+		from     int
+		to       int
+		dryRun   bool
+		expected []int
+		err      bool
+	}{
+		{0, 3, false, []int{1, 2, 3}, false},
+		{1, 3, false, []int{2, 3}, false},
+		{3, 3, false, nil, false},
+		{3, 1, false, []int{-3, -2}, false},
+		{2, 0, false, []int{-2, -1}, false},
+		{0, 3, true, nil, true},
+		{3, 3, true, nil, false},
+		{0, 4, false, nil, true},
+		{4, 3, false, nil, true},
+	} {
+		s := &testSchema{version: test.from}
+		err := To(s, test.to, test.dryRun)
+		if (err != nil) != test.err {
+			t.Errorf("Test %d: expected error %v, got %v", i, test.err, err)
+		}
+		if !reflect.DeepEqual(s.applied, test.expected) {
+			t.Errorf("Test %d: expected to apply %v, applied %v", i, test.expected, s.applied)
+		}
+	}
+}
+
+func TestFromURL(t *testing.T) {
+	for i, test := range []struct {
+		url      string
+		expected int
+		err      error
+	}{
+		{"bolt:///tmp/bolt.db", 3, nil},
+		{"postgres://localhost/functions?sslmode=disable&migrate=2", 2, nil},
+		{"postgres://localhost/functions?migrate=dry-run", 0, ErrDryRun},
+	} {
+		u, err := url.Parse(test.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := &testSchema{}
+		if err := FromURL(s, u); err != test.err {
+			t.Errorf("Test %d: expected error `%v`, got `%v`", i, test.err, err)
+		}
+		if s.version != test.expected {
+			t.Errorf("Test %d: expected version %d, got %d", i, test.expected, s.version)
+		}
+		if q := StripURL(u).Query(); q.Get("migrate") != "" || q.Get("sslmode") != u.Query().Get("sslmode") {
+			t.Errorf("Test %d: expected only the migrate parameter to be stripped, got %v", i, q)
+		}
+	}
+}
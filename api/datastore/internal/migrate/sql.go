@@ -0,0 +1,107 @@
+package migrate
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// SQLMigration is a migration of an SQL datastore, whose steps run in a
+// transaction along with the update of its schema_version table. Databases
+// which commit DDL statements implicitly, such as MySQL, cannot roll back a
+// step failing halfway, so steps should be safe to run again.
+type SQLMigration struct {
+	Migration
+	Up   func(tx *sql.Tx) error
+	Down func(tx *sql.Tx) error
+}
+
+// Exec returns a migration step running stmts in order.
+func Exec(stmts ...string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		for _, stmt := range stmts {
+			if _, err := tx.Exec(stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Steps returns a migration step running steps in order.
+func Steps(steps ...func(tx *sql.Tx) error) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		for _, step := range steps {
+			if err := step(tx); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+const schemaVersionTableCreate = `CREATE TABLE IF NOT EXISTS schema_version (
+	version integer NOT NULL
+);`
+
+// SQLSchema keeps the version of an SQL datastore in its single row
+// schema_version table.
+type SQLSchema struct {
+	db         *sql.DB
+	migrations []SQLMigration
+}
+
+func NewSQLSchema(db *sql.DB, migrations []SQLMigration) (*SQLSchema, error) {
+	if _, err := db.Exec(schemaVersionTableCreate); err != nil {
+		return nil, err
+	}
+	return &SQLSchema{db: db, migrations: migrations}, nil
+}
+
+func (s *SQLSchema) Migrations() []Migration {
+	ms := make([]Migration, len(s.migrations))
+	for i, m := range s.migrations {
+		ms[i] = m.Migration
+	}
+	return ms
+}
+
+func (s *SQLSchema) Version() (int, error) {
+	var version int
+	err := s.db.QueryRow("SELECT version FROM schema_version").Scan(&version)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return version, err
+}
+
+func (s *SQLSchema) Apply(m Migration, up bool) error {
+	var step func(tx *sql.Tx) error
+	version := m.Version
+	for _, sm := range s.migrations {
+		if sm.Version == m.Version {
+			step = sm.Up
+			if !up {
+				step, version = sm.Down, m.Version-1
+			}
+		}
+	}
+	if step == nil {
+		return fmt.Errorf("no step for schema migration %d", m.Version)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := step(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	// version is an integer, formatting it spares the placeholder syntax of
+	// each database.
+	if err := Exec("DELETE FROM schema_version", fmt.Sprintf("INSERT INTO schema_version (version) VALUES (%d)", version))(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
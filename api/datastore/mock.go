@@ -2,15 +2,18 @@ package datastore
 
 import (
 	"context"
+	"strings"
 
 	"github.com/iron-io/functions/api/datastore/internal/datastoreutil"
 	"github.com/iron-io/functions/api/models"
 )
 
 type mock struct {
-	Apps   []*models.App
-	Routes []*models.Route
-	data   map[string][]byte
+	Apps      []*models.App
+	Routes    []*models.Route
+	Audit     []*models.AuditEvent
+	Revisions []*models.RouteRevision
+	data      map[string][]byte
 }
 
 func NewMock() models.Datastore {
@@ -24,7 +27,7 @@ func NewMockInit(apps []*models.App, routes []*models.Route) models.Datastore {
 	if routes == nil {
 		routes = []*models.Route{}
 	}
-	return datastoreutil.NewValidator(&mock{apps, routes, make(map[string][]byte)})
+	return datastoreutil.NewValidator(&mock{apps, routes, nil, nil, make(map[string][]byte)})
 }
 
 func (m *mock) GetApp(ctx context.Context, appName string) (app *models.App, err error) {
@@ -38,7 +41,7 @@ func (m *mock) GetApp(ctx context.Context, appName string) (app *models.App, err
 }
 
 func (m *mock) GetApps(ctx context.Context, appFilter *models.AppFilter) ([]*models.App, error) {
-	return m.Apps, nil
+	return datastoreutil.FilterApps(m.Apps, appFilter), nil
 }
 
 func (m *mock) InsertApp(ctx context.Context, app *models.App) (*models.App, error) {
@@ -59,19 +62,49 @@ func (m *mock) UpdateApp(ctx context.Context, app *models.App) (*models.App, err
 	return a.Clone(), nil
 }
 
-func (m *mock) RemoveApp(ctx context.Context, appName string) error {
+func (m *mock) RemoveApp(ctx context.Context, appName string, cascade bool) error {
 	for i, a := range m.Apps {
 		if a.Name == appName {
+			if !cascade {
+				for _, r := range m.Routes {
+					if r.AppName == appName {
+						return models.ErrDeleteAppsWithRoutes
+					}
+				}
+			}
 			m.Apps = append(m.Apps[:i], m.Apps[i+1:]...)
+
+			routes := m.Routes[:0]
+			for _, r := range m.Routes {
+				if r.AppName != appName {
+					routes = append(routes, r)
+				}
+			}
+			m.Routes = routes
+
+			revs := m.Revisions[:0]
+			for _, rev := range m.Revisions {
+				if rev.AppName != appName {
+					revs = append(revs, rev)
+				}
+			}
+			m.Revisions = revs
+
+			prefix := string(models.AppExtrasPrefix(appName))
+			for k := range m.data {
+				if strings.HasPrefix(k, prefix) {
+					delete(m.data, k)
+				}
+			}
 			return nil
 		}
 	}
 	return models.ErrAppsNotFound
 }
 
-func (m *mock) GetRoute(ctx context.Context, appName, routePath string) (*models.Route, error) {
+func (m *mock) GetRoute(ctx context.Context, appName, routePath, methods string) (*models.Route, error) {
 	for _, r := range m.Routes {
-		if r.AppName == appName && r.Path == routePath {
+		if r.AppName == appName && r.Path == routePath && models.MethodsKey(r.Methods) == methods {
 			return r, nil
 		}
 	}
@@ -79,19 +112,11 @@ func (m *mock) GetRoute(ctx context.Context, appName, routePath string) (*models
 }
 
 func (m *mock) GetRoutes(ctx context.Context, routeFilter *models.RouteFilter) (routes []*models.Route, err error) {
-	for _, r := range m.Routes {
-		routes = append(routes, r)
-	}
-	return
+	return datastoreutil.FilterRoutes(m.Routes, routeFilter), nil
 }
 
 func (m *mock) GetRoutesByApp(ctx context.Context, appName string, routeFilter *models.RouteFilter) (routes []*models.Route, err error) {
-	for _, r := range m.Routes {
-		if r.AppName == appName && (routeFilter.Path == "" || r.Path == routeFilter.Path) && (routeFilter.AppName == "" || r.AppName == routeFilter.AppName) {
-			routes = append(routes, r)
-		}
-	}
-	return
+	return datastoreutil.FilterRoutes(m.Routes, routeFilter), nil
 }
 
 func (m *mock) InsertRoute(ctx context.Context, route *models.Route) (*models.Route, error) {
@@ -99,32 +124,134 @@ func (m *mock) InsertRoute(ctx context.Context, route *models.Route) (*models.Ro
 		return nil, err
 	}
 
-	if r, _ := m.GetRoute(ctx, route.AppName, route.Path); r != nil {
+	methods := models.MethodsKey(route.Methods)
+	if r, _ := m.GetRoute(ctx, route.AppName, route.Path, methods); r != nil {
 		return nil, models.ErrRoutesAlreadyExists
 	}
+	if m.nameTaken(route.AppName, route.Name, route.Path, methods) {
+		return nil, models.ErrRoutesNameConflict
+	}
 	m.Routes = append(m.Routes, route)
 	return route, nil
 }
 
 func (m *mock) UpdateRoute(ctx context.Context, route *models.Route) (*models.Route, error) {
-	r, err := m.GetRoute(ctx, route.AppName, route.Path)
+	methods := models.MethodsKey(route.Methods)
+	r, err := m.GetRoute(ctx, route.AppName, route.Path, methods)
 	if err != nil {
 		return nil, err
 	}
-	r.Update(route)
+	updated := r.Clone()
+	updated.Update(route)
+	if m.nameTaken(route.AppName, updated.Name, route.Path, methods) {
+		return nil, models.ErrRoutesNameConflict
+	}
+	*r = *updated
+	return r.Clone(), nil
+}
+
+func (m *mock) MoveRoute(ctx context.Context, oldPath, oldMethods string, route *models.Route) (*models.Route, error) {
+	appName, newPath := route.AppName, route.Path
+	r, err := m.GetRoute(ctx, appName, oldPath, oldMethods)
+	if err != nil {
+		return nil, err
+	}
+	updated := r.Clone()
+	updated.Update(route)
+	newMethods := models.MethodsKey(updated.Methods)
+	if other, _ := m.GetRoute(ctx, appName, newPath, newMethods); other != nil {
+		return nil, models.ErrRoutesAlreadyExists
+	}
+	if m.nameTaken(appName, updated.Name, oldPath, oldMethods) {
+		return nil, models.ErrRoutesNameConflict
+	}
+	*r = *updated
+	r.Path = newPath
+
+	revs := m.Revisions[:0]
+	for _, rev := range m.Revisions {
+		if rev.AppName == appName && rev.Path == newPath && models.MethodsKey(rev.Methods) == newMethods {
+			continue
+		}
+		if rev.AppName == appName && rev.Path == oldPath && models.MethodsKey(rev.Methods) == oldMethods {
+			rev.Path, rev.Methods = newPath, r.Methods
+		}
+		revs = append(revs, rev)
+	}
+	m.Revisions = revs
 	return r.Clone(), nil
 }
 
-func (m *mock) RemoveRoute(ctx context.Context, appName, routePath string) error {
+// nameTaken tells whether a route of appName other than the one at path
+// serving methods is named name.
+func (m *mock) nameTaken(appName, name, path, methods string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range m.Routes {
+		if r.AppName == appName && r.Name == name && (r.Path != path || models.MethodsKey(r.Methods) != methods) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *mock) RemoveRoute(ctx context.Context, appName, routePath, methods string) error {
 	for i, r := range m.Routes {
-		if r.AppName == appName && r.Path == routePath {
+		if r.AppName == appName && r.Path == routePath && models.MethodsKey(r.Methods) == methods {
 			m.Routes = append(m.Routes[:i], m.Routes[i+1:]...)
+
+			revs := m.Revisions[:0]
+			for _, rev := range m.Revisions {
+				if rev.AppName != appName || rev.Path != routePath || models.MethodsKey(rev.Methods) != methods {
+					revs = append(revs, rev)
+				}
+			}
+			m.Revisions = revs
 			return nil
 		}
 	}
 	return models.ErrRoutesNotFound
 }
 
+func (m *mock) InsertAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	m.Audit = append(m.Audit, event)
+	return nil
+}
+
+func (m *mock) GetAuditEvents(ctx context.Context, filter *models.AuditFilter) (events []*models.AuditEvent, err error) {
+	for i := len(m.Audit) - 1; i >= 0; i-- {
+		if filter.Limit > 0 && len(events) == filter.Limit {
+			break
+		}
+		if filter.Match(m.Audit[i]) {
+			events = append(events, m.Audit[i])
+		}
+	}
+	return
+}
+
+func (m *mock) InsertRouteRevision(ctx context.Context, rev *models.RouteRevision) (*models.RouteRevision, error) {
+	rev.Revision = 1
+	methods := models.MethodsKey(rev.Methods)
+	for _, r := range m.Revisions {
+		if r.AppName == rev.AppName && r.Path == rev.Path && models.MethodsKey(r.Methods) == methods && r.Revision >= rev.Revision {
+			rev.Revision = r.Revision + 1
+		}
+	}
+	m.Revisions = append(m.Revisions, rev)
+	return rev, nil
+}
+
+func (m *mock) GetRouteRevisions(ctx context.Context, appName, routePath, methods string) (revs []*models.RouteRevision, err error) {
+	for i := len(m.Revisions) - 1; i >= 0; i-- {
+		if rev := m.Revisions[i]; rev.AppName == appName && rev.Path == routePath && models.MethodsKey(rev.Methods) == methods {
+			revs = append(revs, rev)
+		}
+	}
+	return
+}
+
 func (m *mock) Put(ctx context.Context, key, value []byte) error {
 	if len(value) == 0 {
 		delete(m.data, string(key))
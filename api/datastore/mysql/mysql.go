@@ -7,11 +7,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/url"
+	"strings"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/go-sql-driver/mysql"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/iron-io/functions/api/datastore/internal/datastoreutil"
+	"github.com/iron-io/functions/api/datastore/internal/migrate"
 	"github.com/iron-io/functions/api/models"
 )
 
@@ -40,7 +42,87 @@ const extrasTableCreate = `CREATE TABLE IF NOT EXISTS extras (
 	value varchar(256) NOT NULL
 );`
 
-const routeSelector = `SELECT app_name, path, image, format, maxc, memory, type, timeout, idle_timeout, headers, config FROM routes`
+const auditTableCreate = `CREATE TABLE IF NOT EXISTS audit (
+	id varchar(64) NOT NULL PRIMARY KEY,
+	created_at bigint NOT NULL,
+	app_name varchar(256) NOT NULL,
+	path varchar(256) NOT NULL,
+	actor varchar(256) NOT NULL,
+	event text NOT NULL,
+	INDEX (created_at)
+);`
+
+const revisionsTableCreate = `CREATE TABLE IF NOT EXISTS revisions (
+	app_name varchar(256) NOT NULL,
+	path varchar(256) NOT NULL,
+	revision bigint NOT NULL,
+	revision_data text NOT NULL,
+	PRIMARY KEY (app_name, path, revision)
+);`
+
+/*
+migrations upgrade the schema of existing databases. They are written to also
+upgrade databases created before migrations existed, whose routes tables may
+already have some of the columns routes gained since.
+*/
+var migrations = []migrate.SQLMigration{
+	{
+		Migration: migrate.Migration{Version: 1, Name: "create tables"},
+		Up:        migrate.Exec(routesTableCreate, appsTableCreate, extrasTableCreate, auditTableCreate, revisionsTableCreate),
+		Down:      migrate.Exec("DROP TABLE routes", "DROP TABLE apps", "DROP TABLE extras", "DROP TABLE audit", "DROP TABLE revisions"),
+	},
+	{
+		Migration: migrate.Migration{Version: 2, Name: "add routes.targets"},
+		Up:        addColumns("routes", [2]string{"targets", "text"}),
+		Down:      migrate.Exec("ALTER TABLE routes DROP COLUMN targets"),
+	},
+	{
+		Migration: migrate.Migration{Version: 3, Name: "add routes.name and routes.aliases"},
+		Up:        addColumns("routes", [2]string{"name", "varchar(256)"}, [2]string{"aliases", "text"}),
+		Down:      migrate.Exec("ALTER TABLE routes DROP COLUMN name, DROP COLUMN aliases"),
+	},
+	{
+		Migration: migrate.Migration{Version: 4, Name: "add routes.methods"},
+		Up:        addColumns("routes", [2]string{"methods", "text"}),
+		Down:      migrate.Exec("ALTER TABLE routes DROP COLUMN methods"),
+	},
+	{
+		Migration: migrate.Migration{Version: 5, Name: "add routes.jwt_key"},
+		Up:        addColumns("routes", [2]string{"jwt_key", "text"}),
+		Down:      migrate.Exec("ALTER TABLE routes DROP COLUMN jwt_key"),
+	},
+	{
+		// Unnamed routes used to be stored with an empty name, which the
+		// index would take as a name shared by all of them.
+		Migration: migrate.Migration{Version: 6, Name: "add routes name index"},
+		Up: migrate.Exec(
+			"UPDATE routes SET name = NULL WHERE name = ''",
+			"CREATE UNIQUE INDEX routes_app_name_name ON routes (app_name, name)",
+		),
+		Down: migrate.Exec("DROP INDEX routes_app_name_name ON routes"),
+	},
+	{
+		// Routes serving different methods can share a path.
+		Migration: migrate.Migration{Version: 7, Name: "key routes and revisions by methods"},
+		Up: migrate.Steps(
+			addColumns("routes", [2]string{"methods_key", "varchar(64) NOT NULL DEFAULT ''"}),
+			addColumns("revisions", [2]string{"methods_key", "varchar(64) NOT NULL DEFAULT ''"}),
+			datastoreutil.FillMethodsKeys("UPDATE routes SET methods_key = ? WHERE app_name = ? AND path = ?"),
+			migrate.Exec(
+				"ALTER TABLE routes DROP PRIMARY KEY, ADD PRIMARY KEY (app_name, path, methods_key)",
+				"ALTER TABLE revisions DROP PRIMARY KEY, ADD PRIMARY KEY (app_name, path, methods_key, revision)",
+			),
+		),
+		Down: migrate.Exec(
+			"ALTER TABLE routes DROP PRIMARY KEY, ADD PRIMARY KEY (app_name, path)",
+			"ALTER TABLE revisions DROP PRIMARY KEY, ADD PRIMARY KEY (app_name, path, revision)",
+			"ALTER TABLE routes DROP COLUMN methods_key",
+			"ALTER TABLE revisions DROP COLUMN methods_key",
+		),
+	},
+}
+
+const routeSelector = `SELECT app_name, path, image, format, maxc, memory, type, timeout, idle_timeout, headers, config, COALESCE(targets, ''), COALESCE(name, ''), COALESCE(aliases, ''), COALESCE(methods, ''), COALESCE(jwt_key, '') FROM routes`
 
 type rowScanner interface {
 	Scan(dest ...interface{}) error
@@ -58,7 +140,8 @@ type MySQLDatastore struct {
 }
 
 /*
-New creates a new MySQL Datastore.
+New creates a new MySQL Datastore, migrating the database up to the latest
+schema version unless the URL asks otherwise, see migrate.FromURL.
 */
 func New(url *url.URL) (models.Datastore, error) {
 	u := fmt.Sprintf("%s@%s%s", url.User.String(), url.Host, url.Path)
@@ -80,11 +163,12 @@ func New(url *url.URL) (models.Datastore, error) {
 		db: db,
 	}
 
-	for _, v := range []string{routesTableCreate, appsTableCreate, extrasTableCreate} {
-		_, err = db.Exec(v)
-		if err != nil {
-			return nil, err
-		}
+	schema, err := migrate.NewSQLSchema(db, migrations)
+	if err != nil {
+		return nil, err
+	}
+	if err := migrate.FromURL(schema, url); err != nil {
+		return nil, err
 	}
 
 	return datastoreutil.NewValidator(pg), nil
@@ -180,19 +264,50 @@ func (ds *MySQLDatastore) UpdateApp(ctx context.Context, newapp *models.App) (*m
 }
 
 /*
-RemoveApp removes an existing app on MySQL.
+RemoveApp removes an existing app on MySQL, along with its routes, their
+revisions and its extras in a single transaction. The app is locked first, so
+that no route is inserted for it while its routes are checked.
 */
-func (ds *MySQLDatastore) RemoveApp(ctx context.Context, appName string) error {
-	_, err := ds.db.Exec(`
-	  DELETE FROM apps
-	  WHERE name = ?
-	`, appName)
+func (ds *MySQLDatastore) RemoveApp(ctx context.Context, appName string, cascade bool) error {
+	return ds.Tx(func(tx *sql.Tx) error {
+		if err := checkAppRoutes(tx, appName, cascade); err != nil {
+			return err
+		}
 
-	if err != nil {
+		for _, q := range []string{
+			"DELETE FROM routes WHERE app_name = ?",
+			"DELETE FROM revisions WHERE app_name = ?",
+			"DELETE FROM apps WHERE name = ?",
+		} {
+			if _, err := tx.Exec(q, appName); err != nil {
+				return err
+			}
+		}
+
+		prefix := string(models.AppExtrasPrefix(appName))
+		_, err := tx.Exec("DELETE FROM extras WHERE LEFT(id, CHAR_LENGTH(?)) = ?", prefix, prefix)
 		return err
-	}
+	})
+}
 
-	return nil
+/*
+checkAppRoutes locks the app and returns ErrDeleteAppsWithRoutes if it has
+routes, unless cascade is true.
+*/
+func checkAppRoutes(tx *sql.Tx, appName string, cascade bool) error {
+	if _, err := tx.Exec("SELECT 1 FROM apps WHERE name = ? FOR UPDATE", appName); err != nil {
+		return err
+	}
+	if cascade {
+		return nil
+	}
+	err := tx.QueryRow("SELECT 1 FROM routes WHERE app_name = ? LIMIT 1", appName).Scan(new(int))
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return models.ErrDeleteAppsWithRoutes
 }
 
 /*
@@ -240,7 +355,7 @@ GetApps retrieves an array of apps according to a specific filter.
 func (ds *MySQLDatastore) GetApps(ctx context.Context, filter *models.AppFilter) ([]*models.App, error) {
 	res := []*models.App{}
 	filterQuery, args := buildFilterAppQuery(filter)
-	rows, err := ds.db.Query(fmt.Sprintf("SELECT DISTINCT name, config FROM apps %s", filterQuery), args...)
+	rows, err := ds.db.Query(fmt.Sprintf("SELECT name, config FROM apps %s", filterQuery), args...)
 	if err != nil {
 		return nil, err
 	}
@@ -276,15 +391,31 @@ func (ds *MySQLDatastore) InsertRoute(ctx context.Context, route *models.Route)
 		return nil, err
 	}
 
+	tbyte, err := json.Marshal(route.Targets)
+	if err != nil {
+		return nil, err
+	}
+
+	abyte, err := json.Marshal(route.Aliases)
+	if err != nil {
+		return nil, err
+	}
+
+	mbyte, err := json.Marshal(route.Methods)
+	if err != nil {
+		return nil, err
+	}
+
 	err = ds.Tx(func(tx *sql.Tx) error {
-		r := tx.QueryRow(`SELECT 1 FROM apps WHERE name=?`, route.AppName)
+		r := tx.QueryRow(`SELECT 1 FROM apps WHERE name=? LOCK IN SHARE MODE`, route.AppName)
 		if err := r.Scan(new(int)); err != nil {
 			if err == sql.ErrNoRows {
 				return models.ErrAppsNotFound
 			}
 		}
-		same, err := tx.Query(`SELECT 1 FROM routes WHERE app_name=? AND path=?`,
-			route.AppName, route.Path)
+		methods := models.MethodsKey(route.Methods)
+		same, err := tx.Query(`SELECT 1 FROM routes WHERE app_name=? AND path=? AND methods_key=?`,
+			route.AppName, route.Path, methods)
 		if err != nil {
 			return err
 		}
@@ -293,10 +424,15 @@ func (ds *MySQLDatastore) InsertRoute(ctx context.Context, route *models.Route)
 			return models.ErrRoutesAlreadyExists
 		}
 
+		if err := checkName(tx, route.AppName, route.Name, route.Path, methods); err != nil {
+			return err
+		}
+
 		_, err = tx.Exec(`
 		INSERT INTO routes (
 			app_name,
 			path,
+			methods_key,
 			image,
 			format,
 			maxc,
@@ -305,11 +441,17 @@ func (ds *MySQLDatastore) InsertRoute(ctx context.Context, route *models.Route)
 			timeout,
 			idle_timeout,
 			headers,
-			config
+			config,
+			targets,
+			name,
+			aliases,
+			methods,
+			jwt_key
 		)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?, ?);`,
 			route.AppName,
 			route.Path,
+			methods,
 			route.Image,
 			route.Format,
 			route.MaxConcurrency,
@@ -319,8 +461,13 @@ func (ds *MySQLDatastore) InsertRoute(ctx context.Context, route *models.Route)
 			route.IdleTimeout,
 			string(hbyte),
 			string(cbyte),
+			string(tbyte),
+			route.Name,
+			string(abyte),
+			string(mbyte),
+			route.JwtKey,
 		)
-		return err
+		return nameConflict(err)
 	})
 
 	if err != nil {
@@ -335,63 +482,49 @@ UpdateRoute updates an existing route on MySQL.
 func (ds *MySQLDatastore) UpdateRoute(ctx context.Context, newroute *models.Route) (*models.Route, error) {
 	var route models.Route
 	err := ds.Tx(func(tx *sql.Tx) error {
-		row := ds.db.QueryRow(fmt.Sprintf("%s WHERE app_name=? AND path=?", routeSelector), newroute.AppName, newroute.Path)
-		if err := scanRoute(row, &route); err == sql.ErrNoRows {
-			return models.ErrRoutesNotFound
-		} else if err != nil {
-			return err
-		}
+		return updateRoute(tx, newroute.Path, models.MethodsKey(newroute.Methods), newroute, &route)
+	})
 
-		route.Update(newroute)
+	if err != nil {
+		return nil, err
+	}
+	return &route, nil
+}
 
-		hbyte, err := json.Marshal(route.Headers)
-		if err != nil {
-			return err
+/*
+MoveRoute updates a route on MySQL and changes its path and methods to the
+ones of newroute, along with those of its revisions, replacing any revisions
+left there.
+*/
+func (ds *MySQLDatastore) MoveRoute(ctx context.Context, oldPath, oldMethods string, newroute *models.Route) (*models.Route, error) {
+	var route models.Route
+	err := ds.Tx(func(tx *sql.Tx) error {
+		appName, newPath, newMethods := newroute.AppName, newroute.Path, oldMethods
+		if newroute.Methods != nil {
+			newMethods = models.MethodsKey(newroute.Methods)
 		}
 
-		cbyte, err := json.Marshal(route.Config)
+		var exists int
+		err := tx.QueryRow("SELECT COUNT(*) FROM routes WHERE app_name=? AND path=? AND methods_key=?", appName, newPath, newMethods).Scan(&exists)
 		if err != nil {
 			return err
 		}
+		if exists > 0 {
+			return models.ErrRoutesAlreadyExists
+		}
 
-		res, err := tx.Exec(`
-		UPDATE routes SET
-			image = ?,
-			format = ?,
-			maxc = ?,
-			memory = ?,
-			type = ?,
-			timeout = ?,
-			idle_timeout = ?,
-			headers = ?,
-			config = ?
-		WHERE app_name = ? AND path = ?;`,
-			route.Image,
-			route.Format,
-			route.MaxConcurrency,
-			route.Memory,
-			route.Type,
-			route.Timeout,
-			route.IdleTimeout,
-			string(hbyte),
-			string(cbyte),
-			route.AppName,
-			route.Path,
-		)
-
-		if err != nil {
+		if err := updateRoute(tx, oldPath, oldMethods, newroute, &route); err != nil {
 			return err
 		}
 
-		if n, err := res.RowsAffected(); err != nil {
+		_, err = tx.Exec("DELETE FROM revisions WHERE app_name=? AND path=? AND methods_key=?", appName, newPath, newMethods)
+		if err != nil {
 			return err
-		} else if n == 0 {
-			return models.ErrRoutesNotFound
 		}
 
-		return nil
+		_, err = tx.Exec("UPDATE revisions SET path=?, methods_key=? WHERE app_name=? AND path=? AND methods_key=?", newPath, newMethods, appName, oldPath, oldMethods)
+		return err
 	})
-
 	if err != nil {
 		return nil, err
 	}
@@ -399,33 +532,163 @@ func (ds *MySQLDatastore) UpdateRoute(ctx context.Context, newroute *models.Rout
 }
 
 /*
-RemoveRoute removes an existing route on MySQL.
+updateRoute updates the route at oldPath serving oldMethods with newroute,
+moving it to the path and methods of newroute, and stores the result in route.
 */
-func (ds *MySQLDatastore) RemoveRoute(ctx context.Context, appName, routePath string) error {
-	res, err := ds.db.Exec(`
-		DELETE FROM routes
-		WHERE path = ? AND app_name = ?
-	`, routePath, appName)
+func updateRoute(tx *sql.Tx, oldPath, oldMethods string, newroute *models.Route, route *models.Route) error {
+	row := tx.QueryRow(fmt.Sprintf("%s WHERE app_name=? AND path=? AND methods_key=? FOR UPDATE", routeSelector), newroute.AppName, oldPath, oldMethods)
+	if err := scanRoute(row, route); err == sql.ErrNoRows {
+		return models.ErrRoutesNotFound
+	} else if err != nil {
+		return err
+	}
+
+	route.Update(newroute)
+	if err := checkName(tx, route.AppName, route.Name, oldPath, oldMethods); err != nil {
+		return err
+	}
+	route.Path = newroute.Path
 
+	hbyte, err := json.Marshal(route.Headers)
 	if err != nil {
 		return err
 	}
 
-	n, err := res.RowsAffected()
+	cbyte, err := json.Marshal(route.Config)
 	if err != nil {
 		return err
 	}
 
-	if n == 0 {
-		return models.ErrRoutesRemoving
+	tbyte, err := json.Marshal(route.Targets)
+	if err != nil {
+		return err
+	}
+
+	abyte, err := json.Marshal(route.Aliases)
+	if err != nil {
+		return err
+	}
+
+	mbyte, err := json.Marshal(route.Methods)
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.Exec(`
+	UPDATE routes SET
+		path = ?,
+		methods_key = ?,
+		image = ?,
+		format = ?,
+		maxc = ?,
+		memory = ?,
+		type = ?,
+		timeout = ?,
+		idle_timeout = ?,
+		headers = ?,
+		config = ?,
+		targets = ?,
+		name = NULLIF(?, ''),
+		aliases = ?,
+		methods = ?,
+		jwt_key = ?
+	WHERE app_name = ? AND path = ? AND methods_key = ?;`,
+		route.Path,
+		models.MethodsKey(route.Methods),
+		route.Image,
+		route.Format,
+		route.MaxConcurrency,
+		route.Memory,
+		route.Type,
+		route.Timeout,
+		route.IdleTimeout,
+		string(hbyte),
+		string(cbyte),
+		string(tbyte),
+		route.Name,
+		string(abyte),
+		string(mbyte),
+		route.JwtKey,
+		route.AppName,
+		oldPath,
+		oldMethods,
+	)
+
+	if err != nil {
+		return nameConflict(err)
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return models.ErrRoutesNotFound
 	}
 
 	return nil
 }
 
+/*
+checkName returns ErrRoutesNameConflict if a route of the app other than the
+one at path serving methods is named name.
+*/
+func checkName(tx *sql.Tx, appName, name, path, methods string) error {
+	if name == "" {
+		return nil
+	}
+	err := tx.QueryRow("SELECT 1 FROM routes WHERE app_name=? AND name=? AND (path<>? OR methods_key<>?)", appName, name, path, methods).Scan(new(int))
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return models.ErrRoutesNameConflict
+}
+
+/*
+nameConflict turns the violation of the unique index on route names, left to
+routes named concurrently, into ErrRoutesNameConflict.
+*/
+func nameConflict(err error) error {
+	if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1062 && strings.Contains(mysqlErr.Message, "routes_app_name_name") {
+		return models.ErrRoutesNameConflict
+	}
+	return err
+}
+
+/*
+RemoveRoute removes an existing route on MySQL along with its revisions.
+*/
+func (ds *MySQLDatastore) RemoveRoute(ctx context.Context, appName, routePath, methods string) error {
+	return ds.Tx(func(tx *sql.Tx) error {
+		res, err := tx.Exec(`
+			DELETE FROM routes
+			WHERE path = ? AND app_name = ? AND methods_key = ?
+		`, routePath, appName, methods)
+
+		if err != nil {
+			return err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if n == 0 {
+			return models.ErrRoutesRemoving
+		}
+
+		_, err = tx.Exec("DELETE FROM revisions WHERE app_name=? AND path=? AND methods_key=?", appName, routePath, methods)
+		return err
+	})
+}
+
 func scanRoute(scanner rowScanner, route *models.Route) error {
 	var headerStr string
 	var configStr string
+	var targetsStr string
+	var aliasesStr string
+	var methodsStr string
 
 	err := scanner.Scan(
 		&route.AppName,
@@ -439,6 +702,11 @@ func scanRoute(scanner rowScanner, route *models.Route) error {
 		&route.IdleTimeout,
 		&headerStr,
 		&configStr,
+		&targetsStr,
+		&route.Name,
+		&aliasesStr,
+		&methodsStr,
+		&route.JwtKey,
 	)
 	if err != nil {
 		return err
@@ -451,16 +719,32 @@ func scanRoute(scanner rowScanner, route *models.Route) error {
 	if err := json.Unmarshal([]byte(headerStr), &route.Headers); err != nil {
 		return err
 	}
-	return json.Unmarshal([]byte(configStr), &route.Config)
+	if err := json.Unmarshal([]byte(configStr), &route.Config); err != nil {
+		return err
+	}
+	if len(targetsStr) > 0 {
+		if err := json.Unmarshal([]byte(targetsStr), &route.Targets); err != nil {
+			return err
+		}
+	}
+	if len(aliasesStr) > 0 {
+		if err := json.Unmarshal([]byte(aliasesStr), &route.Aliases); err != nil {
+			return err
+		}
+	}
+	if len(methodsStr) > 0 {
+		return json.Unmarshal([]byte(methodsStr), &route.Methods)
+	}
+	return nil
 }
 
 /*
 GetRoute retrieves a route from MySQL.
 */
-func (ds *MySQLDatastore) GetRoute(ctx context.Context, appName, routePath string) (*models.Route, error) {
+func (ds *MySQLDatastore) GetRoute(ctx context.Context, appName, routePath, methods string) (*models.Route, error) {
 	var route models.Route
 
-	row := ds.db.QueryRow(fmt.Sprintf("%s WHERE app_name=? AND path=?", routeSelector), appName, routePath)
+	row := ds.db.QueryRow(fmt.Sprintf("%s WHERE app_name=? AND path=? AND methods_key=?", routeSelector), appName, routePath, methods)
 	err := scanRoute(row, &route)
 
 	if err == sql.ErrNoRows {
@@ -502,55 +786,44 @@ func (ds *MySQLDatastore) GetRoutes(ctx context.Context, filter *models.RouteFil
 GetRoutesByApp retrieves a route with a specific app name.
 */
 func (ds *MySQLDatastore) GetRoutesByApp(ctx context.Context, appName string, filter *models.RouteFilter) ([]*models.Route, error) {
-	res := []*models.Route{}
+	f := *filter
+	f.AppName = appName
+	return ds.GetRoutes(ctx, &f)
+}
 
-	var filterQuery string
+/*
+buildFilterAppQuery compares names bytewise, with BINARY, so that pages
+follow the order the other datastores use.
+*/
+func buildFilterAppQuery(filter *models.AppFilter) (string, []interface{}) {
+	var b bytes.Buffer
 	var args []interface{}
-	if filter == nil {
-		filterQuery = "WHERE app_name = ?"
-		args = []interface{}{appName}
-	} else {
-		filter.AppName = appName
-		filterQuery, args = buildFilterRouteQuery(filter)
-	}
-	rows, err := ds.db.Query(fmt.Sprintf("%s %s", routeSelector, filterQuery), args...)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var route models.Route
-		err := scanRoute(rows, &route)
-		if err != nil {
-			continue
+	where := func(colOp string, val interface{}) {
+		args = append(args, val)
+		if len(args) == 1 {
+			fmt.Fprintf(&b, "WHERE %s ?", colOp)
+		} else {
+			fmt.Fprintf(&b, " AND %s ?", colOp)
 		}
-		res = append(res, &route)
-
 	}
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-
-	return res, nil
-}
 
-func buildFilterAppQuery(filter *models.AppFilter) (string, []interface{}) {
-	if filter == nil {
-		return "", nil
+	if filter.Name != "" {
+		where("name LIKE BINARY", datastoreutil.GlobToLike(filter.Name))
+	}
+	if filter.Cursor != "" {
+		where("BINARY name >", filter.Cursor)
 	}
 
-	if filter.Name != "" {
-		return "WHERE name LIKE ?", []interface{}{filter.Name}
+	b.WriteString(" ORDER BY BINARY name")
+	if filter.PerPage > 0 {
+		fmt.Fprintf(&b, " LIMIT %d", filter.PerPage)
 	}
 
-	return "", nil
+	return b.String(), args
 }
 
 func buildFilterRouteQuery(filter *models.RouteFilter) (string, []interface{}) {
-	if filter == nil {
-		return "", nil
-	}
 	var b bytes.Buffer
 	var args []interface{}
 
@@ -567,11 +840,233 @@ func buildFilterRouteQuery(filter *models.RouteFilter) (string, []interface{}) {
 
 	where("path =", filter.Path)
 	where("app_name =", filter.AppName)
-	where("image =", filter.Image)
+	where("image LIKE BINARY", datastoreutil.PrefixToLike(filter.Image))
+	where("name LIKE BINARY", datastoreutil.GlobToLike(filter.Name))
+	where("type =", filter.Type)
+	where("format =", filter.Format)
+
+	if filter.CursorApp != "" {
+		if len(args) == 0 {
+			b.WriteString("WHERE ")
+		} else {
+			b.WriteString(" AND ")
+		}
+		b.WriteString("(BINARY app_name > ? OR (app_name = ? AND (BINARY path > ? OR (path = ? AND BINARY methods_key > ?))))")
+		args = append(args, filter.CursorApp, filter.CursorApp, filter.CursorPath, filter.CursorPath, filter.CursorMethods)
+	}
+
+	b.WriteString(" ORDER BY BINARY app_name, BINARY path, BINARY methods_key")
+	if filter.PerPage > 0 {
+		fmt.Fprintf(&b, " LIMIT %d", filter.PerPage)
+	}
 
 	return b.String(), args
 }
 
+/*
+InsertAuditEvent inserts an audit event into MySQL.
+*/
+func (ds *MySQLDatastore) InsertAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	buf, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = ds.db.Exec(`
+		INSERT INTO audit (
+			id,
+			created_at,
+			app_name,
+			path,
+			actor,
+			event
+		)
+		VALUES (?, ?, ?, ?, ?, ?);`,
+		event.ID,
+		event.Timestamp.UnixNano(),
+		event.AppName,
+		event.Path,
+		event.Actor,
+		string(buf),
+	)
+	return err
+}
+
+/*
+GetAuditEvents retrieves audit events from MySQL, newest first.
+*/
+func (ds *MySQLDatastore) GetAuditEvents(ctx context.Context, filter *models.AuditFilter) ([]*models.AuditEvent, error) {
+	res := []*models.AuditEvent{}
+
+	filterQuery, args := buildFilterAuditQuery(filter)
+	rows, err := ds.db.Query(fmt.Sprintf("SELECT event FROM audit %s", filterQuery), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var buf string
+		if err := rows.Scan(&buf); err != nil {
+			return nil, err
+		}
+		var event models.AuditEvent
+		if err := json.Unmarshal([]byte(buf), &event); err != nil {
+			return nil, err
+		}
+		res = append(res, &event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func buildFilterAuditQuery(filter *models.AuditFilter) (string, []interface{}) {
+	var b bytes.Buffer
+	var args []interface{}
+
+	where := func(colOp string, val interface{}) {
+		args = append(args, val)
+		if len(args) == 1 {
+			fmt.Fprintf(&b, "WHERE %s ?", colOp)
+		} else {
+			fmt.Fprintf(&b, " AND %s ?", colOp)
+		}
+	}
+
+	if filter.AppName != "" {
+		where("app_name =", filter.AppName)
+	}
+	if filter.Path != "" {
+		where("path =", filter.Path)
+	}
+	if filter.Actor != "" {
+		where("actor =", filter.Actor)
+	}
+	if !filter.Since.IsZero() {
+		where("created_at >=", filter.Since.UnixNano())
+	}
+
+	b.WriteString(" ORDER BY created_at DESC")
+	if filter.Limit > 0 {
+		fmt.Fprintf(&b, " LIMIT %d", filter.Limit)
+	}
+
+	return b.String(), args
+}
+
+/*
+revisionRetries is how many times a revision whose number was taken by a
+concurrent insert is numbered again.
+*/
+const revisionRetries = 5
+
+/*
+InsertRouteRevision inserts a route revision into MySQL, numbered after the
+newest revision of its route. Concurrent inserts for the same route conflict
+on the primary key rather than sharing a number, and the ones losing are
+numbered again.
+*/
+func (ds *MySQLDatastore) InsertRouteRevision(ctx context.Context, rev *models.RouteRevision) (*models.RouteRevision, error) {
+	for i := 0; ; i++ {
+		err := ds.Tx(func(tx *sql.Tx) error {
+			methods := models.MethodsKey(rev.Methods)
+			row := tx.QueryRow("SELECT COALESCE(MAX(revision), 0) FROM revisions WHERE app_name=? AND path=? AND methods_key=?", rev.AppName, rev.Path, methods)
+
+			var last int64
+			if err := row.Scan(&last); err != nil {
+				return err
+			}
+			rev.Revision = last + 1
+
+			buf, err := json.Marshal(rev)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.Exec(`
+				INSERT INTO revisions (
+					app_name,
+					path,
+					methods_key,
+					revision,
+					revision_data
+				)
+				VALUES (?, ?, ?, ?, ?);`,
+				rev.AppName,
+				rev.Path,
+				methods,
+				rev.Revision,
+				string(buf),
+			)
+			return err
+		})
+		if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1062 && i < revisionRetries {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return rev, nil
+	}
+}
+
+/*
+GetRouteRevisions retrieves the revisions of a route from MySQL, newest first.
+*/
+func (ds *MySQLDatastore) GetRouteRevisions(ctx context.Context, appName, routePath, methods string) ([]*models.RouteRevision, error) {
+	res := []*models.RouteRevision{}
+
+	rows, err := ds.db.Query("SELECT revision_data FROM revisions WHERE app_name=? AND path=? AND methods_key=? ORDER BY revision DESC", appName, routePath, methods)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var buf string
+		if err := rows.Scan(&buf); err != nil {
+			return nil, err
+		}
+		var rev models.RouteRevision
+		if err := json.Unmarshal([]byte(buf), &rev); err != nil {
+			return nil, err
+		}
+		rev.AppName, rev.Path, rev.Methods = appName, routePath, models.ParseMethodsKey(methods)
+		res = append(res, &rev)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+/*
+addColumns returns a migration step adding columns, given as name and
+definition, to table unless they already exist, which MySQL cannot tell by
+itself.
+*/
+func addColumns(table string, columns ...[2]string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		for _, c := range columns {
+			var n int
+			err := tx.QueryRow(`SELECT COUNT(*) FROM information_schema.COLUMNS
+				WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?`, table, c[0]).Scan(&n)
+			if err != nil {
+				return err
+			}
+			if n > 0 {
+				continue
+			}
+			if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, c[0], c[1])); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
 /*
 Put inserts an extra into MySQL.
 */
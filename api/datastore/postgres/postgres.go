@@ -11,6 +11,7 @@ import (
 	"bytes"
 	"github.com/Sirupsen/logrus"
 	"github.com/iron-io/functions/api/datastore/internal/datastoreutil"
+	"github.com/iron-io/functions/api/datastore/internal/migrate"
 	"github.com/iron-io/functions/api/models"
 	"github.com/lib/pq"
 	_ "github.com/lib/pq"
@@ -42,7 +43,86 @@ const extrasTableCreate = `CREATE TABLE IF NOT EXISTS extras (
 	value character varying(256) NOT NULL
 );`
 
-const routeSelector = `SELECT app_name, path, image, format, maxc, memory, type, timeout, idle_timeout, headers, config FROM routes`
+const auditTableCreate = `CREATE TABLE IF NOT EXISTS audit (
+	id character varying(64) NOT NULL PRIMARY KEY,
+	created_at bigint NOT NULL,
+	app_name character varying(256) NOT NULL,
+	path text NOT NULL,
+	actor character varying(256) NOT NULL,
+	event text NOT NULL
+);`
+
+const revisionsTableCreate = `CREATE TABLE IF NOT EXISTS revisions (
+	app_name character varying(256) NOT NULL,
+	path text NOT NULL,
+	revision bigint NOT NULL,
+	revision_data text NOT NULL,
+	PRIMARY KEY (app_name, path, revision)
+);`
+
+// migrations upgrade the schema of existing databases. They are written to
+// also upgrade databases created before migrations existed, whose routes
+// tables may already have some of the columns routes gained since.
+var migrations = []migrate.SQLMigration{
+	{
+		Migration: migrate.Migration{Version: 1, Name: "create tables"},
+		Up:        migrate.Exec(routesTableCreate, appsTableCreate, extrasTableCreate, auditTableCreate, revisionsTableCreate),
+		Down:      migrate.Exec("DROP TABLE routes", "DROP TABLE apps", "DROP TABLE extras", "DROP TABLE audit", "DROP TABLE revisions"),
+	},
+	{
+		Migration: migrate.Migration{Version: 2, Name: "add routes.targets"},
+		Up:        migrate.Exec("ALTER TABLE routes ADD COLUMN IF NOT EXISTS targets text"),
+		Down:      migrate.Exec("ALTER TABLE routes DROP COLUMN targets"),
+	},
+	{
+		Migration: migrate.Migration{Version: 3, Name: "add routes.name and routes.aliases"},
+		Up:        migrate.Exec("ALTER TABLE routes ADD COLUMN IF NOT EXISTS name character varying(256), ADD COLUMN IF NOT EXISTS aliases text"),
+		Down:      migrate.Exec("ALTER TABLE routes DROP COLUMN name, DROP COLUMN aliases"),
+	},
+	{
+		Migration: migrate.Migration{Version: 4, Name: "add routes.methods"},
+		Up:        migrate.Exec("ALTER TABLE routes ADD COLUMN IF NOT EXISTS methods text"),
+		Down:      migrate.Exec("ALTER TABLE routes DROP COLUMN methods"),
+	},
+	{
+		Migration: migrate.Migration{Version: 5, Name: "add routes.jwt_key"},
+		Up:        migrate.Exec("ALTER TABLE routes ADD COLUMN IF NOT EXISTS jwt_key text"),
+		Down:      migrate.Exec("ALTER TABLE routes DROP COLUMN jwt_key"),
+	},
+	{
+		// Unnamed routes used to be stored with an empty name, which the
+		// index would take as a name shared by all of them.
+		Migration: migrate.Migration{Version: 6, Name: "add routes name index"},
+		Up: migrate.Exec(
+			"UPDATE routes SET name = NULL WHERE name = ''",
+			"CREATE UNIQUE INDEX IF NOT EXISTS routes_app_name_name ON routes (app_name, name)",
+		),
+		Down: migrate.Exec("DROP INDEX routes_app_name_name"),
+	},
+	{
+		// Routes serving different methods can share a path.
+		Migration: migrate.Migration{Version: 7, Name: "key routes and revisions by methods"},
+		Up: migrate.Steps(
+			migrate.Exec(
+				"ALTER TABLE routes ADD COLUMN IF NOT EXISTS methods_key character varying(64) NOT NULL DEFAULT ''",
+				"ALTER TABLE revisions ADD COLUMN IF NOT EXISTS methods_key character varying(64) NOT NULL DEFAULT ''",
+			),
+			datastoreutil.FillMethodsKeys("UPDATE routes SET methods_key = $1 WHERE app_name = $2 AND path = $3"),
+			migrate.Exec(
+				"ALTER TABLE routes DROP CONSTRAINT routes_pkey, ADD PRIMARY KEY (app_name, path, methods_key)",
+				"ALTER TABLE revisions DROP CONSTRAINT revisions_pkey, ADD PRIMARY KEY (app_name, path, methods_key, revision)",
+			),
+		),
+		Down: migrate.Exec(
+			"ALTER TABLE routes DROP CONSTRAINT routes_pkey, ADD PRIMARY KEY (app_name, path)",
+			"ALTER TABLE revisions DROP CONSTRAINT revisions_pkey, ADD PRIMARY KEY (app_name, path, revision)",
+			"ALTER TABLE routes DROP COLUMN methods_key",
+			"ALTER TABLE revisions DROP COLUMN methods_key",
+		),
+	},
+}
+
+const routeSelector = `SELECT app_name, path, image, format, maxc, memory, type, timeout, idle_timeout, headers, config, COALESCE(targets, ''), COALESCE(name, ''), COALESCE(aliases, ''), COALESCE(methods, ''), COALESCE(jwt_key, '') FROM routes`
 
 type rowScanner interface {
 	Scan(dest ...interface{}) error
@@ -52,8 +132,10 @@ type PostgresDatastore struct {
 	db *sql.DB
 }
 
+// New migrates the database up to the latest schema version, unless the URL
+// asks otherwise, see migrate.FromURL.
 func New(url *url.URL) (models.Datastore, error) {
-	db, err := sql.Open("postgres", url.String())
+	db, err := sql.Open("postgres", migrate.StripURL(url).String())
 	if err != nil {
 		return nil, err
 	}
@@ -71,11 +153,12 @@ func New(url *url.URL) (models.Datastore, error) {
 		db: db,
 	}
 
-	for _, v := range []string{routesTableCreate, appsTableCreate, extrasTableCreate} {
-		_, err = db.Exec(v)
-		if err != nil {
-			return nil, err
-		}
+	schema, err := migrate.NewSQLSchema(db, migrations)
+	if err != nil {
+		return nil, err
+	}
+	if err := migrate.FromURL(schema, url); err != nil {
+		return nil, err
 	}
 
 	return datastoreutil.NewValidator(pg), nil
@@ -155,17 +238,46 @@ func (ds *PostgresDatastore) UpdateApp(ctx context.Context, newapp *models.App)
 	return app, nil
 }
 
-func (ds *PostgresDatastore) RemoveApp(ctx context.Context, appName string) error {
-	_, err := ds.db.Exec(`
-	  DELETE FROM apps
-	  WHERE name = $1
-	`, appName)
+// RemoveApp removes the app along with its routes, their revisions and its
+// extras in a single transaction. The app is locked first, so that no route
+// is inserted for it while its routes are checked.
+func (ds *PostgresDatastore) RemoveApp(ctx context.Context, appName string, cascade bool) error {
+	return ds.Tx(func(tx *sql.Tx) error {
+		if err := checkAppRoutes(tx, appName, cascade); err != nil {
+			return err
+		}
 
-	if err != nil {
+		for _, q := range []string{
+			"DELETE FROM routes WHERE app_name = $1",
+			"DELETE FROM revisions WHERE app_name = $1",
+			"DELETE FROM apps WHERE name = $1",
+		} {
+			if _, err := tx.Exec(q, appName); err != nil {
+				return err
+			}
+		}
+
+		_, err := tx.Exec("DELETE FROM extras WHERE left(key, char_length($1::text)) = $1::text", string(models.AppExtrasPrefix(appName)))
 		return err
-	}
+	})
+}
 
-	return nil
+// checkAppRoutes locks the app and returns ErrDeleteAppsWithRoutes if it has
+// routes, unless cascade is true.
+func checkAppRoutes(tx *sql.Tx, appName string, cascade bool) error {
+	if _, err := tx.Exec("SELECT 1 FROM apps WHERE name = $1 FOR UPDATE", appName); err != nil {
+		return err
+	}
+	if cascade {
+		return nil
+	}
+	err := tx.QueryRow("SELECT 1 FROM routes WHERE app_name = $1 LIMIT 1", appName).Scan(new(int))
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return models.ErrDeleteAppsWithRoutes
 }
 
 func (ds *PostgresDatastore) GetApp(ctx context.Context, name string) (*models.App, error) {
@@ -220,7 +332,7 @@ func (ds *PostgresDatastore) GetApps(ctx context.Context, filter *models.AppFilt
 	res := []*models.App{}
 
 	filterQuery, args := buildFilterAppQuery(filter)
-	rows, err := ds.db.Query(fmt.Sprintf("SELECT DISTINCT * FROM apps %s", filterQuery), args...)
+	rows, err := ds.db.Query(fmt.Sprintf("SELECT * FROM apps %s", filterQuery), args...)
 	if err != nil {
 		return nil, err
 	}
@@ -256,8 +368,23 @@ func (ds *PostgresDatastore) InsertRoute(ctx context.Context, route *models.Rout
 		return nil, err
 	}
 
+	tbyte, err := json.Marshal(route.Targets)
+	if err != nil {
+		return nil, err
+	}
+
+	abyte, err := json.Marshal(route.Aliases)
+	if err != nil {
+		return nil, err
+	}
+
+	mbyte, err := json.Marshal(route.Methods)
+	if err != nil {
+		return nil, err
+	}
+
 	err = ds.Tx(func(tx *sql.Tx) error {
-		r := tx.QueryRow(`SELECT 1 FROM apps WHERE name=$1`, route.AppName)
+		r := tx.QueryRow(`SELECT 1 FROM apps WHERE name=$1 FOR SHARE`, route.AppName)
 		if err := r.Scan(new(int)); err != nil {
 			if err == sql.ErrNoRows {
 				return models.ErrAppsNotFound
@@ -265,8 +392,9 @@ func (ds *PostgresDatastore) InsertRoute(ctx context.Context, route *models.Rout
 			return err
 		}
 
-		same, err := tx.Query(`SELECT 1 FROM routes WHERE app_name=$1 AND path=$2`,
-			route.AppName, route.Path)
+		methods := models.MethodsKey(route.Methods)
+		same, err := tx.Query(`SELECT 1 FROM routes WHERE app_name=$1 AND path=$2 AND methods_key=$3`,
+			route.AppName, route.Path, methods)
 		if err != nil {
 			return err
 		}
@@ -275,10 +403,15 @@ func (ds *PostgresDatastore) InsertRoute(ctx context.Context, route *models.Rout
 			return models.ErrRoutesAlreadyExists
 		}
 
+		if err := checkName(tx, route.AppName, route.Name, route.Path, methods); err != nil {
+			return err
+		}
+
 		_, err = tx.Exec(`
 		INSERT INTO routes (
 			app_name,
 			path,
+			methods_key,
 			image,
 			format,
 			maxc,
@@ -287,11 +420,17 @@ func (ds *PostgresDatastore) InsertRoute(ctx context.Context, route *models.Rout
 			timeout,
 			idle_timeout,
 			headers,
-			config
+			config,
+			targets,
+			name,
+			aliases,
+			methods,
+			jwt_key
 		)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11);`,
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, NULLIF($14, ''), $15, $16, $17);`,
 			route.AppName,
 			route.Path,
+			methods,
 			route.Image,
 			route.Format,
 			route.MaxConcurrency,
@@ -301,8 +440,13 @@ func (ds *PostgresDatastore) InsertRoute(ctx context.Context, route *models.Rout
 			route.IdleTimeout,
 			string(hbyte),
 			string(cbyte),
+			string(tbyte),
+			route.Name,
+			string(abyte),
+			string(mbyte),
+			route.JwtKey,
 		)
-		return err
+		return nameConflict(err)
 	})
 
 	if err != nil {
@@ -314,94 +458,203 @@ func (ds *PostgresDatastore) InsertRoute(ctx context.Context, route *models.Rout
 func (ds *PostgresDatastore) UpdateRoute(ctx context.Context, newroute *models.Route) (*models.Route, error) {
 	var route models.Route
 	err := ds.Tx(func(tx *sql.Tx) error {
-		row := ds.db.QueryRow(fmt.Sprintf("%s WHERE app_name=$1 AND path=$2", routeSelector), newroute.AppName, newroute.Path)
-		if err := scanRoute(row, &route); err == sql.ErrNoRows {
-			return models.ErrRoutesNotFound
-		} else if err != nil {
-			return err
-		}
+		return updateRoute(tx, newroute.Path, models.MethodsKey(newroute.Methods), newroute, &route)
+	})
 
-		route.Update(newroute)
+	if err != nil {
+		return nil, err
+	}
+	return &route, nil
+}
 
-		hbyte, err := json.Marshal(route.Headers)
-		if err != nil {
-			return err
+// MoveRoute updates a route and changes its path and methods to the ones of
+// newroute, along with those of its revisions, replacing any revisions left
+// there.
+func (ds *PostgresDatastore) MoveRoute(ctx context.Context, oldPath, oldMethods string, newroute *models.Route) (*models.Route, error) {
+	var route models.Route
+	err := ds.Tx(func(tx *sql.Tx) error {
+		appName, newPath, newMethods := newroute.AppName, newroute.Path, oldMethods
+		if newroute.Methods != nil {
+			newMethods = models.MethodsKey(newroute.Methods)
 		}
 
-		cbyte, err := json.Marshal(route.Config)
+		var exists int
+		err := tx.QueryRow("SELECT COUNT(*) FROM routes WHERE app_name=$1 AND path=$2 AND methods_key=$3", appName, newPath, newMethods).Scan(&exists)
 		if err != nil {
 			return err
 		}
+		if exists > 0 {
+			return models.ErrRoutesAlreadyExists
+		}
 
-		res, err := tx.Exec(`
-		UPDATE routes SET
-			image = $3,
-			format = $4,
-			maxc = $5,
-			memory = $6,
-			type = $7,
-			timeout = $8,
-			idle_timeout = $9,
-			headers = $10,
-			config = $11
-		WHERE app_name = $1 AND path = $2;`,
-			route.AppName,
-			route.Path,
-			route.Image,
-			route.Format,
-			route.MaxConcurrency,
-			route.Memory,
-			route.Type,
-			route.Timeout,
-			route.IdleTimeout,
-			string(hbyte),
-			string(cbyte),
-		)
-
-		if err != nil {
+		if err := updateRoute(tx, oldPath, oldMethods, newroute, &route); err != nil {
 			return err
 		}
 
-		if n, err := res.RowsAffected(); err != nil {
+		_, err = tx.Exec("DELETE FROM revisions WHERE app_name=$1 AND path=$2 AND methods_key=$3", appName, newPath, newMethods)
+		if err != nil {
 			return err
-		} else if n == 0 {
-			return models.ErrRoutesNotFound
 		}
 
-		return nil
+		_, err = tx.Exec("UPDATE revisions SET path=$4, methods_key=$5 WHERE app_name=$1 AND path=$2 AND methods_key=$3", appName, oldPath, oldMethods, newPath, newMethods)
+		return err
 	})
-
 	if err != nil {
 		return nil, err
 	}
 	return &route, nil
 }
 
-func (ds *PostgresDatastore) RemoveRoute(ctx context.Context, appName, routePath string) error {
-	res, err := ds.db.Exec(`
-		DELETE FROM routes
-		WHERE path = $1 AND app_name = $2
-	`, routePath, appName)
+// updateRoute updates the route at oldPath serving oldMethods with newroute,
+// moving it to the path and methods of newroute, and stores the result in
+// route.
+func updateRoute(tx *sql.Tx, oldPath, oldMethods string, newroute *models.Route, route *models.Route) error {
+	row := tx.QueryRow(fmt.Sprintf("%s WHERE app_name=$1 AND path=$2 AND methods_key=$3 FOR UPDATE", routeSelector), newroute.AppName, oldPath, oldMethods)
+	if err := scanRoute(row, route); err == sql.ErrNoRows {
+		return models.ErrRoutesNotFound
+	} else if err != nil {
+		return err
+	}
 
+	route.Update(newroute)
+	if err := checkName(tx, route.AppName, route.Name, oldPath, oldMethods); err != nil {
+		return err
+	}
+	route.Path = newroute.Path
+
+	hbyte, err := json.Marshal(route.Headers)
 	if err != nil {
 		return err
 	}
 
-	n, err := res.RowsAffected()
+	cbyte, err := json.Marshal(route.Config)
 	if err != nil {
 		return err
 	}
 
-	if n == 0 {
-		return models.ErrRoutesRemoving
+	tbyte, err := json.Marshal(route.Targets)
+	if err != nil {
+		return err
+	}
+
+	abyte, err := json.Marshal(route.Aliases)
+	if err != nil {
+		return err
+	}
+
+	mbyte, err := json.Marshal(route.Methods)
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.Exec(`
+	UPDATE routes SET
+		path = $4,
+		methods_key = $5,
+		image = $6,
+		format = $7,
+		maxc = $8,
+		memory = $9,
+		type = $10,
+		timeout = $11,
+		idle_timeout = $12,
+		headers = $13,
+		config = $14,
+		targets = $15,
+		name = NULLIF($16, ''),
+		aliases = $17,
+		methods = $18,
+		jwt_key = $19
+	WHERE app_name = $1 AND path = $2 AND methods_key = $3;`,
+		route.AppName,
+		oldPath,
+		oldMethods,
+		route.Path,
+		models.MethodsKey(route.Methods),
+		route.Image,
+		route.Format,
+		route.MaxConcurrency,
+		route.Memory,
+		route.Type,
+		route.Timeout,
+		route.IdleTimeout,
+		string(hbyte),
+		string(cbyte),
+		string(tbyte),
+		route.Name,
+		string(abyte),
+		string(mbyte),
+		route.JwtKey,
+	)
+
+	if err != nil {
+		return nameConflict(err)
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return models.ErrRoutesNotFound
 	}
 
 	return nil
 }
 
+// checkName returns ErrRoutesNameConflict if a route of the app other than
+// the one at path serving methods is named name.
+func checkName(tx *sql.Tx, appName, name, path, methods string) error {
+	if name == "" {
+		return nil
+	}
+	err := tx.QueryRow("SELECT 1 FROM routes WHERE app_name=$1 AND name=$2 AND (path<>$3 OR methods_key<>$4)", appName, name, path, methods).Scan(new(int))
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return models.ErrRoutesNameConflict
+}
+
+// nameConflict turns the violation of the unique index on route names, left
+// to routes named concurrently, into ErrRoutesNameConflict.
+func nameConflict(err error) error {
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" && pqErr.Constraint == "routes_app_name_name" {
+		return models.ErrRoutesNameConflict
+	}
+	return err
+}
+
+func (ds *PostgresDatastore) RemoveRoute(ctx context.Context, appName, routePath, methods string) error {
+	return ds.Tx(func(tx *sql.Tx) error {
+		res, err := tx.Exec(`
+			DELETE FROM routes
+			WHERE path = $1 AND app_name = $2 AND methods_key = $3
+		`, routePath, appName, methods)
+
+		if err != nil {
+			return err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if n == 0 {
+			return models.ErrRoutesRemoving
+		}
+
+		_, err = tx.Exec("DELETE FROM revisions WHERE app_name=$1 AND path=$2 AND methods_key=$3", appName, routePath, methods)
+		return err
+	})
+}
+
 func scanRoute(scanner rowScanner, route *models.Route) error {
 	var headerStr string
 	var configStr string
+	var targetsStr string
+	var aliasesStr string
+	var methodsStr string
 
 	err := scanner.Scan(
 		&route.AppName,
@@ -415,6 +668,11 @@ func scanRoute(scanner rowScanner, route *models.Route) error {
 		&route.IdleTimeout,
 		&headerStr,
 		&configStr,
+		&targetsStr,
+		&route.Name,
+		&aliasesStr,
+		&methodsStr,
+		&route.JwtKey,
 	)
 	if err != nil {
 		return err
@@ -434,13 +692,34 @@ func scanRoute(scanner rowScanner, route *models.Route) error {
 		}
 	}
 
+	if len(targetsStr) > 0 {
+		err = json.Unmarshal([]byte(targetsStr), &route.Targets)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(aliasesStr) > 0 {
+		err = json.Unmarshal([]byte(aliasesStr), &route.Aliases)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(methodsStr) > 0 {
+		err = json.Unmarshal([]byte(methodsStr), &route.Methods)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-func (ds *PostgresDatastore) GetRoute(ctx context.Context, appName, routePath string) (*models.Route, error) {
+func (ds *PostgresDatastore) GetRoute(ctx context.Context, appName, routePath, methods string) (*models.Route, error) {
 	var route models.Route
 
-	row := ds.db.QueryRow(fmt.Sprintf("%s WHERE app_name=$1 AND path=$2", routeSelector), appName, routePath)
+	row := ds.db.QueryRow(fmt.Sprintf("%s WHERE app_name=$1 AND path=$2 AND methods_key=$3", routeSelector), appName, routePath, methods)
 	err := scanRoute(row, &route)
 
 	if err == sql.ErrNoRows {
@@ -477,55 +756,42 @@ func (ds *PostgresDatastore) GetRoutes(ctx context.Context, filter *models.Route
 }
 
 func (ds *PostgresDatastore) GetRoutesByApp(ctx context.Context, appName string, filter *models.RouteFilter) ([]*models.Route, error) {
-	res := []*models.Route{}
+	f := *filter
+	f.AppName = appName
+	return ds.GetRoutes(ctx, &f)
+}
 
-	var filterQuery string
+// Names and paths are compared bytewise, in the "C" collation, so that
+// pages follow the order the other datastores use.
+func buildFilterAppQuery(filter *models.AppFilter) (string, []interface{}) {
+	var b bytes.Buffer
 	var args []interface{}
-	if filter == nil {
-		filterQuery = "WHERE app_name = $1"
-		args = []interface{}{appName}
-	} else {
-		filter.AppName = appName
-		filterQuery, args = buildFilterRouteQuery(filter)
-	}
-	rows, err := ds.db.Query(fmt.Sprintf("%s %s", routeSelector, filterQuery), args...)
-	// todo: check for no rows so we don't respond with a sql 500 err
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var route models.Route
-		err := scanRoute(rows, &route)
-		if err != nil {
-			continue
+	where := func(colOp string, val interface{}) {
+		args = append(args, val)
+		if len(args) == 1 {
+			fmt.Fprintf(&b, "WHERE %s $1", colOp)
+		} else {
+			fmt.Fprintf(&b, " AND %s $%d", colOp, len(args))
 		}
-		res = append(res, &route)
-
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
 	}
 
-	return res, nil
-}
-func buildFilterAppQuery(filter *models.AppFilter) (string, []interface{}) {
-	if filter == nil {
-		return "", nil
+	if filter.Name != "" {
+		where("name LIKE", datastoreutil.GlobToLike(filter.Name))
+	}
+	if filter.Cursor != "" {
+		where(`name COLLATE "C" >`, filter.Cursor)
 	}
 
-	if filter.Name != "" {
-		return "WHERE name LIKE $1", []interface{}{filter.Name}
+	b.WriteString(` ORDER BY name COLLATE "C"`)
+	if filter.PerPage > 0 {
+		fmt.Fprintf(&b, " LIMIT %d", filter.PerPage)
 	}
 
-	return "", nil
+	return b.String(), args
 }
 
 func buildFilterRouteQuery(filter *models.RouteFilter) (string, []interface{}) {
-	if filter == nil {
-		return "", nil
-	}
 	var b bytes.Buffer
 	var args []interface{}
 
@@ -542,11 +808,195 @@ func buildFilterRouteQuery(filter *models.RouteFilter) (string, []interface{}) {
 
 	where("path =", filter.Path)
 	where("app_name =", filter.AppName)
-	where("image =", filter.Image)
+	where("image LIKE", datastoreutil.PrefixToLike(filter.Image))
+	where("name LIKE", datastoreutil.GlobToLike(filter.Name))
+	where("type =", filter.Type)
+	where("format =", filter.Format)
+
+	if filter.CursorApp != "" {
+		args = append(args, filter.CursorApp, filter.CursorPath, filter.CursorMethods)
+		if len(args) == 3 {
+			b.WriteString("WHERE ")
+		} else {
+			b.WriteString(" AND ")
+		}
+		fmt.Fprintf(&b, `(app_name COLLATE "C" > $%[1]d OR (app_name = $%[1]d AND (path COLLATE "C" > $%[2]d OR (path = $%[2]d AND methods_key COLLATE "C" > $%[3]d))))`,
+			len(args)-2, len(args)-1, len(args))
+	}
+
+	b.WriteString(` ORDER BY app_name COLLATE "C", path COLLATE "C", methods_key COLLATE "C"`)
+	if filter.PerPage > 0 {
+		fmt.Fprintf(&b, " LIMIT %d", filter.PerPage)
+	}
 
 	return b.String(), args
 }
 
+func (ds *PostgresDatastore) InsertAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	buf, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = ds.db.Exec(`
+		INSERT INTO audit (
+			id,
+			created_at,
+			app_name,
+			path,
+			actor,
+			event
+		)
+		VALUES ($1, $2, $3, $4, $5, $6);`,
+		event.ID,
+		event.Timestamp.UnixNano(),
+		event.AppName,
+		event.Path,
+		event.Actor,
+		string(buf),
+	)
+	return err
+}
+
+func (ds *PostgresDatastore) GetAuditEvents(ctx context.Context, filter *models.AuditFilter) ([]*models.AuditEvent, error) {
+	res := []*models.AuditEvent{}
+
+	filterQuery, args := buildFilterAuditQuery(filter)
+	rows, err := ds.db.Query(fmt.Sprintf("SELECT event FROM audit %s", filterQuery), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var buf string
+		if err := rows.Scan(&buf); err != nil {
+			return nil, err
+		}
+		var event models.AuditEvent
+		if err := json.Unmarshal([]byte(buf), &event); err != nil {
+			return nil, err
+		}
+		res = append(res, &event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func buildFilterAuditQuery(filter *models.AuditFilter) (string, []interface{}) {
+	var b bytes.Buffer
+	var args []interface{}
+
+	where := func(colOp string, val interface{}) {
+		args = append(args, val)
+		if len(args) == 1 {
+			fmt.Fprintf(&b, "WHERE %s $1", colOp)
+		} else {
+			fmt.Fprintf(&b, " AND %s $%d", colOp, len(args))
+		}
+	}
+
+	if filter.AppName != "" {
+		where("app_name =", filter.AppName)
+	}
+	if filter.Path != "" {
+		where("path =", filter.Path)
+	}
+	if filter.Actor != "" {
+		where("actor =", filter.Actor)
+	}
+	if !filter.Since.IsZero() {
+		where("created_at >=", filter.Since.UnixNano())
+	}
+
+	b.WriteString(" ORDER BY created_at DESC")
+	if filter.Limit > 0 {
+		fmt.Fprintf(&b, " LIMIT %d", filter.Limit)
+	}
+
+	return b.String(), args
+}
+
+// revisionRetries is how many times a revision whose number was taken by a
+// concurrent insert is numbered again.
+const revisionRetries = 5
+
+// InsertRouteRevision numbers rev after the newest revision of its route.
+// Concurrent inserts for the same route conflict on the primary key rather
+// than sharing a number, and the ones losing are numbered again.
+func (ds *PostgresDatastore) InsertRouteRevision(ctx context.Context, rev *models.RouteRevision) (*models.RouteRevision, error) {
+	for i := 0; ; i++ {
+		err := ds.Tx(func(tx *sql.Tx) error {
+			methods := models.MethodsKey(rev.Methods)
+			row := tx.QueryRow("SELECT COALESCE(MAX(revision), 0) FROM revisions WHERE app_name=$1 AND path=$2 AND methods_key=$3", rev.AppName, rev.Path, methods)
+
+			var last int64
+			if err := row.Scan(&last); err != nil {
+				return err
+			}
+			rev.Revision = last + 1
+
+			buf, err := json.Marshal(rev)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.Exec(`
+				INSERT INTO revisions (
+					app_name,
+					path,
+					methods_key,
+					revision,
+					revision_data
+				)
+				VALUES ($1, $2, $3, $4, $5);`,
+				rev.AppName,
+				rev.Path,
+				methods,
+				rev.Revision,
+				string(buf),
+			)
+			return err
+		})
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" && i < revisionRetries {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return rev, nil
+	}
+}
+
+func (ds *PostgresDatastore) GetRouteRevisions(ctx context.Context, appName, routePath, methods string) ([]*models.RouteRevision, error) {
+	res := []*models.RouteRevision{}
+
+	rows, err := ds.db.Query("SELECT revision_data FROM revisions WHERE app_name=$1 AND path=$2 AND methods_key=$3 ORDER BY revision DESC", appName, routePath, methods)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var buf string
+		if err := rows.Scan(&buf); err != nil {
+			return nil, err
+		}
+		var rev models.RouteRevision
+		if err := json.Unmarshal([]byte(buf), &rev); err != nil {
+			return nil, err
+		}
+		rev.AppName, rev.Path, rev.Methods = appName, routePath, models.ParseMethodsKey(methods)
+		res = append(res, &rev)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
 func (ds *PostgresDatastore) Put(ctx context.Context, key, value []byte) error {
 	_, err := ds.db.Exec(`
 	    INSERT INTO extras (
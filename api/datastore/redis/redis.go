@@ -4,8 +4,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/url"
-	"regexp"
-	"strings"
 	"time"
 
 	"context"
@@ -13,6 +11,7 @@ import (
 	"github.com/Sirupsen/logrus"
 	"github.com/garyburd/redigo/redis"
 	"github.com/iron-io/functions/api/datastore/internal/datastoreutil"
+	"github.com/iron-io/functions/api/datastore/internal/migrate"
 	"github.com/iron-io/functions/api/models"
 )
 
@@ -20,6 +19,8 @@ type RedisDataStore struct {
 	conn redis.Conn
 }
 
+// New migrates the datastore up to the latest schema version, unless the URL
+// asks otherwise, see migrate.FromURL.
 func New(url *url.URL) (models.Datastore, error) {
 	pool := &redis.Pool{
 		MaxIdle: 4,
@@ -44,6 +45,9 @@ func New(url *url.URL) (models.Datastore, error) {
 	ds := &RedisDataStore{
 		conn: conn,
 	}
+	if err := migrate.FromURL(&redisSchema{conn: conn, migrations: migrations}, url); err != nil {
+		return nil, err
+	}
 	return datastoreutil.NewValidator(ds), nil
 }
 
@@ -84,12 +88,58 @@ func (ds *RedisDataStore) UpdateApp(ctx context.Context, newapp *models.App) (*m
 	return ds.setApp(app)
 }
 
-func (ds *RedisDataStore) RemoveApp(ctx context.Context, appName string) error {
+// RemoveApp removes the app, then its routes, their revisions and its extras.
+// Redis has no transactions spanning reads, so a failure may leave some of
+// them behind, in which case removing the app again cleans them up.
+func (ds *RedisDataStore) RemoveApp(ctx context.Context, appName string, cascade bool) error {
+	if !cascade {
+		n, err := redis.Int(ds.conn.Do("HLEN", fmt.Sprintf("routes:%s", appName)))
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return models.ErrDeleteAppsWithRoutes
+		}
+	}
+
 	if _, err := ds.conn.Do("HDEL", "apps", appName); err != nil {
 		return err
 	}
 
-	return nil
+	counters := fmt.Sprintf("revisions:%s", appName)
+	routes, err := redis.Strings(ds.conn.Do("HKEYS", counters))
+	if err != nil {
+		return err
+	}
+	keys := []interface{}{fmt.Sprintf("routes:%s", appName), fmt.Sprintf("names:%s", appName), counters}
+	for _, r := range routes {
+		keys = append(keys, fmt.Sprintf("revisions:%s:%s", appName, r))
+	}
+	if _, err := ds.conn.Do("DEL", keys...); err != nil {
+		return err
+	}
+
+	match := string(models.AppExtrasPrefix(appName)) + "*"
+	cursor := "0"
+	for {
+		reply, err := redis.Values(ds.conn.Do("HSCAN", "extras", cursor, "MATCH", match))
+		if err != nil {
+			return err
+		}
+		var fields []string
+		if _, err := redis.Scan(reply, &cursor, &fields); err != nil {
+			return err
+		}
+		// HSCAN returns fields and values interleaved
+		for i := 0; i < len(fields); i += 2 {
+			if _, err := ds.conn.Do("HDEL", "extras", fields[i]); err != nil {
+				return err
+			}
+		}
+		if cursor == "0" {
+			return nil
+		}
+	}
 }
 
 func (ds *RedisDataStore) GetApp(ctx context.Context, name string) (*models.App, error) {
@@ -126,11 +176,20 @@ func (ds *RedisDataStore) GetApps(ctx context.Context, filter *models.AppFilter)
 		if err := json.Unmarshal([]byte(v), &app); err != nil {
 			return nil, err
 		}
-		if applyAppFilter(&app, filter) {
-			res = append(res, &app)
-		}
+		res = append(res, &app)
 	}
-	return res, nil
+	return datastoreutil.FilterApps(res, filter), nil
+}
+
+// routeKey is the field of the route at path serving methods, a key as
+// returned by models.MethodsKey, in the "routes:<app>" hash of its app. The
+// fields of routes serving every method are their path, the others follow it
+// with a NUL byte and their methods. Revisions and names use the same key.
+func routeKey(path, methods string) string {
+	if methods == "" {
+		return path
+	}
+	return path + "\x00" + methods
 }
 
 func (ds *RedisDataStore) setRoute(set string, route *models.Route) (*models.Route, error) {
@@ -139,7 +198,7 @@ func (ds *RedisDataStore) setRoute(set string, route *models.Route) (*models.Rou
 		return nil, err
 	}
 
-	if _, err := ds.conn.Do("HSET", set, route.Path, buf); err != nil {
+	if _, err := ds.conn.Do("HSET", set, routeKey(route.Path, models.MethodsKey(route.Methods)), buf); err != nil {
 		return nil, err
 	}
 
@@ -158,8 +217,9 @@ func (ds *RedisDataStore) InsertRoute(ctx context.Context, route *models.Route)
 	}
 
 	hset := fmt.Sprintf("routes:%s", route.AppName)
+	key := routeKey(route.Path, models.MethodsKey(route.Methods))
 
-	reply, err = ds.conn.Do("HEXISTS", hset, route.Path)
+	reply, err = ds.conn.Do("HEXISTS", hset, key)
 	if err != nil {
 		return nil, err
 	}
@@ -170,36 +230,160 @@ func (ds *RedisDataStore) InsertRoute(ctx context.Context, route *models.Route)
 		return nil, models.ErrRoutesAlreadyExists
 	}
 
+	if err := ds.setName(route.AppName, "", "", route.Name, key); err != nil {
+		return nil, err
+	}
+
 	return ds.setRoute(hset, route)
 }
 
 func (ds *RedisDataStore) UpdateRoute(ctx context.Context, newroute *models.Route) (*models.Route, error) {
-	route, err := ds.GetRoute(ctx, newroute.AppName, newroute.Path)
+	methods := models.MethodsKey(newroute.Methods)
+	route, err := ds.GetRoute(ctx, newroute.AppName, newroute.Path, methods)
 	if err != nil {
 		return nil, err
 	}
 
+	oldName := route.Name
 	route.Update(newroute)
+	key := routeKey(route.Path, methods)
+	if err := ds.setName(route.AppName, oldName, key, route.Name, key); err != nil {
+		return nil, err
+	}
 
 	hset := fmt.Sprintf("routes:%s", route.AppName)
 
 	return ds.setRoute(hset, route)
 }
 
-func (ds *RedisDataStore) RemoveRoute(ctx context.Context, appName, routePath string) error {
+// setName points name to the route at key in the "names:<app>" hash, which
+// keeps route names unique within their app, and releases oldName, the name
+// the route had at oldKey.
+func (ds *RedisDataStore) setName(appName, oldName, oldKey, name, key string) error {
+	names := fmt.Sprintf("names:%s", appName)
+	if name != "" {
+		set, err := redis.Bool(ds.conn.Do("HSETNX", names, name, key))
+		if err != nil {
+			return err
+		}
+		if !set {
+			owner, err := redis.String(ds.conn.Do("HGET", names, name))
+			if err != nil && err != redis.ErrNil {
+				return err
+			}
+			if owner != oldKey && owner != key {
+				return models.ErrRoutesNameConflict
+			}
+			if _, err := ds.conn.Do("HSET", names, name, key); err != nil {
+				return err
+			}
+		}
+	}
+	if oldName != "" && oldName != name {
+		if _, err := ds.conn.Do("HDEL", names, oldName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MoveRoute updates the route and re-keys it in its app's hash, then renames
+// its revisions sorted set and moves its revision counter along, replacing
+// the revisions left at the new key.
+func (ds *RedisDataStore) MoveRoute(ctx context.Context, oldPath, oldMethods string, newroute *models.Route) (*models.Route, error) {
+	appName, newPath := newroute.AppName, newroute.Path
+	route, err := ds.GetRoute(ctx, appName, oldPath, oldMethods)
+	if err != nil {
+		return nil, err
+	}
+
+	oldName := route.Name
+	route.Update(newroute)
+	route.Path = newPath
+	oldKey, newKey := routeKey(oldPath, oldMethods), routeKey(newPath, models.MethodsKey(route.Methods))
+
 	hset := fmt.Sprintf("routes:%s", appName)
-	if n, err := ds.conn.Do("HDEL", hset, routePath); err != nil {
+	if exists, err := redis.Bool(ds.conn.Do("HEXISTS", hset, newKey)); err != nil {
+		return nil, err
+	} else if exists {
+		return nil, models.ErrRoutesAlreadyExists
+	}
+
+	if err := ds.setName(appName, oldName, oldKey, route.Name, newKey); err != nil {
+		return nil, err
+	}
+	if _, err := ds.setRoute(hset, route); err != nil {
+		return nil, err
+	}
+	if _, err := ds.conn.Do("HDEL", hset, oldKey); err != nil {
+		return nil, err
+	}
+
+	if err := ds.moveRevisions(appName, oldKey, newKey); err != nil {
+		return nil, err
+	}
+	return route, nil
+}
+
+// moveRevisions renames the revisions sorted set of the route at oldKey and
+// moves its revision counter along, replacing the revisions left at newKey.
+func (ds *RedisDataStore) moveRevisions(appName, oldKey, newKey string) error {
+	if err := ds.removeRevisions(appName, newKey); err != nil {
+		return err
+	}
+	counters := fmt.Sprintf("revisions:%s", appName)
+	n, err := redis.Int64(ds.conn.Do("HGET", counters, oldKey))
+	if err == redis.ErrNil {
+		return nil
+	} else if err != nil {
 		return err
-	} else if n == 0 {
+	}
+	if _, err := ds.conn.Do("HSET", counters, newKey, n); err != nil {
+		return err
+	}
+	if _, err := ds.conn.Do("HDEL", counters, oldKey); err != nil {
+		return err
+	}
+	_, err = ds.conn.Do("RENAME", fmt.Sprintf("revisions:%s:%s", appName, oldKey), fmt.Sprintf("revisions:%s:%s", appName, newKey))
+	return err
+}
+
+// removeRevisions removes the revisions sorted set and revision counter of
+// the route at key.
+func (ds *RedisDataStore) removeRevisions(appName, key string) error {
+	if _, err := ds.conn.Do("DEL", fmt.Sprintf("revisions:%s:%s", appName, key)); err != nil {
+		return err
+	}
+	_, err := ds.conn.Do("HDEL", fmt.Sprintf("revisions:%s", appName), key)
+	return err
+}
+
+// RemoveRoute removes the route, then its name and revisions.
+func (ds *RedisDataStore) RemoveRoute(ctx context.Context, appName, routePath, methods string) error {
+	route, err := ds.GetRoute(ctx, appName, routePath, methods)
+	if err == models.ErrRoutesNotFound {
 		return models.ErrRoutesRemoving
+	} else if err != nil {
+		return err
 	}
 
-	return nil
+	key := routeKey(routePath, methods)
+	hset := fmt.Sprintf("routes:%s", appName)
+	if _, err := ds.conn.Do("HDEL", hset, key); err != nil {
+		return err
+	}
+	if route.Name != "" {
+		if _, err := ds.conn.Do("HDEL", fmt.Sprintf("names:%s", appName), route.Name); err != nil {
+			return err
+		}
+	}
+
+	return ds.removeRevisions(appName, key)
 }
 
-func (ds *RedisDataStore) GetRoute(ctx context.Context, appName, routePath string) (*models.Route, error) {
+func (ds *RedisDataStore) GetRoute(ctx context.Context, appName, routePath, methods string) (*models.Route, error) {
 	hset := fmt.Sprintf("routes:%s", appName)
-	reply, err := ds.conn.Do("HGET", hset, routePath)
+	reply, err := ds.conn.Do("HGET", hset, routeKey(routePath, methods))
 	if err != nil {
 		return nil, err
 	} else if reply == nil {
@@ -240,20 +424,14 @@ func (ds *RedisDataStore) GetRoutes(ctx context.Context, filter *models.RouteFil
 			if err := json.Unmarshal([]byte(v), &route); err != nil {
 				return nil, err
 			}
-			if applyRouteFilter(&route, filter) {
-				res = append(res, &route)
-			}
+			res = append(res, &route)
 		}
 	}
 
-	return res, nil
+	return datastoreutil.FilterRoutes(res, filter), nil
 }
 
 func (ds *RedisDataStore) GetRoutesByApp(ctx context.Context, appName string, filter *models.RouteFilter) ([]*models.Route, error) {
-	if filter == nil {
-		filter = new(models.RouteFilter)
-	}
-	filter.AppName = appName
 	res := []*models.Route{}
 
 	hset := fmt.Sprintf("routes:%s", appName)
@@ -270,11 +448,89 @@ func (ds *RedisDataStore) GetRoutesByApp(ctx context.Context, appName string, fi
 		if err := json.Unmarshal([]byte(v), &route); err != nil {
 			return nil, err
 		}
-		if applyRouteFilter(&route, filter) {
-			res = append(res, &route)
+		res = append(res, &route)
+	}
+
+	return datastoreutil.FilterRoutes(res, filter), nil
+}
+
+// InsertAuditEvent adds event to the "audit" sorted set, scored by its
+// timestamp in microseconds (nanoseconds would not fit a score's precision).
+func (ds *RedisDataStore) InsertAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	buf, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = ds.conn.Do("ZADD", "audit", event.Timestamp.UnixNano()/int64(time.Microsecond), buf)
+	return err
+}
+
+func (ds *RedisDataStore) GetAuditEvents(ctx context.Context, filter *models.AuditFilter) ([]*models.AuditEvent, error) {
+	res := []*models.AuditEvent{}
+
+	min := "-inf"
+	if !filter.Since.IsZero() {
+		min = fmt.Sprint(filter.Since.UnixNano() / int64(time.Microsecond))
+	}
+	events, err := redis.ByteSlices(ds.conn.Do("ZREVRANGEBYSCORE", "audit", "+inf", min))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range events {
+		if filter.Limit > 0 && len(res) == filter.Limit {
+			break
 		}
+		var event models.AuditEvent
+		if err := json.Unmarshal(v, &event); err != nil {
+			return nil, err
+		}
+		if filter.Match(&event) {
+			res = append(res, &event)
+		}
+	}
+	return res, nil
+}
+
+// InsertRouteRevision numbers rev with a per route counter kept in the
+// "revisions:<app>" hash and adds it to the "revisions:<app>:<key>" sorted
+// set, scored by its number, where key is the routeKey of its route.
+func (ds *RedisDataStore) InsertRouteRevision(ctx context.Context, rev *models.RouteRevision) (*models.RouteRevision, error) {
+	key := routeKey(rev.Path, models.MethodsKey(rev.Methods))
+	n, err := redis.Int64(ds.conn.Do("HINCRBY", fmt.Sprintf("revisions:%s", rev.AppName), key, 1))
+	if err != nil {
+		return nil, err
+	}
+	rev.Revision = n
+
+	buf, err := json.Marshal(rev)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := ds.conn.Do("ZADD", fmt.Sprintf("revisions:%s:%s", rev.AppName, key), n, buf); err != nil {
+		return nil, err
 	}
+	return rev, nil
+}
 
+func (ds *RedisDataStore) GetRouteRevisions(ctx context.Context, appName, routePath, methods string) ([]*models.RouteRevision, error) {
+	res := []*models.RouteRevision{}
+
+	revs, err := redis.ByteSlices(ds.conn.Do("ZREVRANGE", fmt.Sprintf("revisions:%s:%s", appName, routeKey(routePath, methods)), 0, -1))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range revs {
+		var rev models.RouteRevision
+		if err := json.Unmarshal(v, &rev); err != nil {
+			return nil, err
+		}
+		rev.AppName, rev.Path, rev.Methods = appName, routePath, models.ParseMethodsKey(methods)
+		res = append(res, &rev)
+	}
 	return res, nil
 }
 
@@ -288,24 +544,9 @@ func (ds *RedisDataStore) Put(ctx context.Context, key, value []byte) error {
 
 func (ds *RedisDataStore) Get(ctx context.Context, key []byte) ([]byte, error) {
 	value, err := ds.conn.Do("HGET", "extras", key)
-	if err != nil {
+	if err != nil || value == nil {
 		return nil, err
 	}
 
 	return value.([]byte), nil
 }
-
-func applyAppFilter(app *models.App, filter *models.AppFilter) bool {
-	if filter != nil && filter.Name != "" {
-		nameLike, err := regexp.MatchString(strings.Replace(filter.Name, "%", ".*", -1), app.Name)
-		return err == nil && nameLike
-	}
-
-	return true
-}
-
-func applyRouteFilter(route *models.Route, filter *models.RouteFilter) bool {
-	return filter == nil || (filter.Path == "" || route.Path == filter.Path) &&
-		(filter.AppName == "" || route.AppName == filter.AppName) &&
-		(filter.Image == "" || route.Image == filter.Image)
-}
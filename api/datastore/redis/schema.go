@@ -0,0 +1,172 @@
+package redis
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/iron-io/functions/api/datastore/internal/migrate"
+	"github.com/iron-io/functions/api/models"
+)
+
+// redisMigration reshapes the documents of a redis datastore. Redis cannot
+// run it in a transaction along with the update of the version, so steps
+// should be safe to run again.
+type redisMigration struct {
+	migrate.Migration
+	Up   func(conn redis.Conn) error
+	Down func(conn redis.Conn) error
+}
+
+func noop(conn redis.Conn) error { return nil }
+
+// migrations upgrade the documents of existing datastores. Datastores written
+// before migrations existed hold the documents of version 1.
+var migrations = []redisMigration{
+	{Migration: migrate.Migration{Version: 1, Name: "initial"}, Up: noop, Down: noop},
+	{Migration: migrate.Migration{Version: 2, Name: "index route names"}, Up: indexNames, Down: unindexNames},
+	{Migration: migrate.Migration{Version: 3, Name: "key routes by methods"}, Up: keyByMethods, Down: keyByPath},
+}
+
+// indexNames fills the "names:<app>" hashes, which keep route names unique,
+// from the routes already stored.
+func indexNames(conn redis.Conn) error {
+	apps, err := redis.Strings(conn.Do("HKEYS", "apps"))
+	if err != nil {
+		return err
+	}
+	for _, app := range apps {
+		routes, err := redis.ByteSlices(conn.Do("HVALS", fmt.Sprintf("routes:%s", app)))
+		if err != nil {
+			return err
+		}
+		for _, buf := range routes {
+			var route models.Route
+			if err := json.Unmarshal(buf, &route); err != nil {
+				return err
+			}
+			if route.Name == "" {
+				continue
+			}
+			if _, err := conn.Do("HSETNX", fmt.Sprintf("names:%s", app), route.Name, route.Path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func unindexNames(conn redis.Conn) error {
+	apps, err := redis.Strings(conn.Do("HKEYS", "apps"))
+	if err != nil {
+		return err
+	}
+	for _, app := range apps {
+		if _, err := conn.Do("DEL", fmt.Sprintf("names:%s", app)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func keyByMethods(conn redis.Conn) error {
+	return rekeyRoutes(conn, routeKey)
+}
+
+func keyByPath(conn redis.Conn) error {
+	return rekeyRoutes(conn, func(path, methods string) string { return path })
+}
+
+// rekeyRoutes moves every route, along with its name and revisions, to the
+// field returned by key for its path and methods.
+func rekeyRoutes(conn redis.Conn, key func(path, methods string) string) error {
+	ds := &RedisDataStore{conn: conn}
+	apps, err := redis.Strings(conn.Do("HKEYS", "apps"))
+	if err != nil {
+		return err
+	}
+	for _, app := range apps {
+		hset := fmt.Sprintf("routes:%s", app)
+		routes, err := redis.StringMap(conn.Do("HGETALL", hset))
+		if err != nil {
+			return err
+		}
+		for oldKey, v := range routes {
+			var route models.Route
+			if err := json.Unmarshal([]byte(v), &route); err != nil {
+				return err
+			}
+			newKey := key(route.Path, models.MethodsKey(route.Methods))
+			if newKey == oldKey {
+				continue
+			}
+			if _, ok := routes[newKey]; ok {
+				return fmt.Errorf("several routes of app %s are keyed %q", app, newKey)
+			}
+
+			if _, err := conn.Do("HSET", hset, newKey, v); err != nil {
+				return err
+			}
+			if _, err := conn.Do("HDEL", hset, oldKey); err != nil {
+				return err
+			}
+			if route.Name != "" {
+				if _, err := conn.Do("HSET", fmt.Sprintf("names:%s", app), route.Name, newKey); err != nil {
+					return err
+				}
+			}
+			if err := ds.moveRevisions(app, oldKey, newKey); err != nil {
+				return err
+			}
+			delete(routes, oldKey)
+			routes[newKey] = v
+		}
+	}
+	return nil
+}
+
+const schemaVersionKey = "schema_version"
+
+// redisSchema keeps the version of a datastore under the schema_version key.
+type redisSchema struct {
+	conn       redis.Conn
+	migrations []redisMigration
+}
+
+func (s *redisSchema) Migrations() []migrate.Migration {
+	ms := make([]migrate.Migration, len(s.migrations))
+	for i, m := range s.migrations {
+		ms[i] = m.Migration
+	}
+	return ms
+}
+
+func (s *redisSchema) Version() (int, error) {
+	version, err := redis.Int(s.conn.Do("GET", schemaVersionKey))
+	if err == redis.ErrNil {
+		return 0, nil
+	}
+	return version, err
+}
+
+func (s *redisSchema) Apply(m migrate.Migration, up bool) error {
+	var step func(conn redis.Conn) error
+	version := m.Version
+	for _, rm := range s.migrations {
+		if rm.Version == m.Version {
+			step = rm.Up
+			if !up {
+				step, version = rm.Down, m.Version-1
+			}
+		}
+	}
+	if step == nil {
+		return fmt.Errorf("no step for schema migration %d", m.Version)
+	}
+
+	if err := step(s.conn); err != nil {
+		return err
+	}
+	_, err := s.conn.Do("SET", schemaVersionKey, version)
+	return err
+}
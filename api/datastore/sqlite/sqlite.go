@@ -0,0 +1,1070 @@
+package sqlite
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/iron-io/functions/api/datastore/internal/datastoreutil"
+	"github.com/iron-io/functions/api/datastore/internal/migrate"
+	"github.com/iron-io/functions/api/models"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const routesTableCreate = `CREATE TABLE IF NOT EXISTS routes (
+	app_name varchar(256) NOT NULL,
+	path varchar(256) NOT NULL,
+	image varchar(256) NOT NULL,
+	format varchar(16) NOT NULL,
+	maxc int NOT NULL,
+	memory int NOT NULL,
+	timeout int NOT NULL,
+	idle_timeout int NOT NULL,
+	type varchar(16) NOT NULL,
+	headers text NOT NULL,
+	config text NOT NULL,
+	targets text,
+	name varchar(256),
+	aliases text,
+	methods text,
+	jwt_key text,
+	PRIMARY KEY (app_name, path)
+);`
+
+const appsTableCreate = `CREATE TABLE IF NOT EXISTS apps (
+	name varchar(256) NOT NULL PRIMARY KEY,
+	config text NOT NULL
+);`
+
+const extrasTableCreate = `CREATE TABLE IF NOT EXISTS extras (
+	id varchar(256) NOT NULL PRIMARY KEY,
+	value varchar(256) NOT NULL
+);`
+
+const auditTableCreate = `CREATE TABLE IF NOT EXISTS audit (
+	id varchar(64) NOT NULL PRIMARY KEY,
+	created_at bigint NOT NULL,
+	app_name varchar(256) NOT NULL,
+	path varchar(256) NOT NULL,
+	actor varchar(256) NOT NULL,
+	event text NOT NULL
+);`
+
+const auditIndexCreate = `CREATE INDEX IF NOT EXISTS audit_created_at ON audit (created_at);`
+
+const revisionsTableCreate = `CREATE TABLE IF NOT EXISTS revisions (
+	app_name varchar(256) NOT NULL,
+	path varchar(256) NOT NULL,
+	revision bigint NOT NULL,
+	revision_data text NOT NULL,
+	PRIMARY KEY (app_name, path, revision)
+);`
+
+// routesByMethodsTableCreate creates the routes table of version 3, keyed by
+// methods as well as by path, under a temporary name.
+const routesByMethodsTableCreate = `CREATE TABLE routes_new (
+	app_name varchar(256) NOT NULL,
+	path varchar(256) NOT NULL,
+	methods_key varchar(64) NOT NULL DEFAULT '',
+	image varchar(256) NOT NULL,
+	format varchar(16) NOT NULL,
+	maxc int NOT NULL,
+	memory int NOT NULL,
+	timeout int NOT NULL,
+	idle_timeout int NOT NULL,
+	type varchar(16) NOT NULL,
+	headers text NOT NULL,
+	config text NOT NULL,
+	targets text,
+	name varchar(256),
+	aliases text,
+	methods text,
+	jwt_key text,
+	PRIMARY KEY (app_name, path, methods_key)
+);`
+
+const revisionsByMethodsTableCreate = `CREATE TABLE revisions_new (
+	app_name varchar(256) NOT NULL,
+	path varchar(256) NOT NULL,
+	methods_key varchar(64) NOT NULL DEFAULT '',
+	revision bigint NOT NULL,
+	revision_data text NOT NULL,
+	PRIMARY KEY (app_name, path, methods_key, revision)
+);`
+
+const (
+	routeColumns    = "app_name, path, image, format, maxc, memory, timeout, idle_timeout, type, headers, config, targets, name, aliases, methods, jwt_key"
+	revisionColumns = "app_name, path, revision, revision_data"
+)
+
+// migrations upgrade the schema of existing databases.
+var migrations = []migrate.SQLMigration{
+	{
+		Migration: migrate.Migration{Version: 1, Name: "create tables"},
+		Up:        migrate.Exec(routesTableCreate, appsTableCreate, extrasTableCreate, auditTableCreate, auditIndexCreate, revisionsTableCreate),
+		Down:      migrate.Exec("DROP TABLE routes", "DROP TABLE apps", "DROP TABLE extras", "DROP TABLE audit", "DROP TABLE revisions"),
+	},
+	{
+		// Unnamed routes used to be stored with an empty name, which the
+		// index would take as a name shared by all of them.
+		Migration: migrate.Migration{Version: 2, Name: "add routes name index"},
+		Up: migrate.Exec(
+			"UPDATE routes SET name = NULL WHERE name = ''",
+			"CREATE UNIQUE INDEX IF NOT EXISTS routes_app_name_name ON routes (app_name, name)",
+		),
+		Down: migrate.Exec("DROP INDEX routes_app_name_name"),
+	},
+	{
+		// Routes serving different methods can share a path. SQLite cannot
+		// change the primary key of a table, which is built again.
+		Migration: migrate.Migration{Version: 3, Name: "key routes and revisions by methods"},
+		Up: migrate.Steps(
+			rebuild("routes", routesByMethodsTableCreate, routeColumns),
+			rebuild("revisions", revisionsByMethodsTableCreate, revisionColumns),
+			migrate.Exec("CREATE UNIQUE INDEX routes_app_name_name ON routes (app_name, name)"),
+			datastoreutil.FillMethodsKeys("UPDATE routes SET methods_key = ? WHERE app_name = ? AND path = ?"),
+		),
+		Down: migrate.Steps(
+			rebuild("routes", strings.Replace(routesTableCreate, "IF NOT EXISTS routes (", "routes_new (", 1), routeColumns),
+			rebuild("revisions", strings.Replace(revisionsTableCreate, "IF NOT EXISTS revisions (", "revisions_new (", 1), revisionColumns),
+			migrate.Exec("CREATE UNIQUE INDEX routes_app_name_name ON routes (app_name, name)"),
+		),
+	},
+}
+
+// rebuild returns a migration step replacing table with the one create
+// makes under the name table_new, copying columns over.
+func rebuild(table, create, columns string) func(tx *sql.Tx) error {
+	return migrate.Exec(
+		create,
+		fmt.Sprintf("INSERT INTO %s_new (%s) SELECT %s FROM %s", table, columns, columns, table),
+		"DROP TABLE "+table,
+		fmt.Sprintf("ALTER TABLE %s_new RENAME TO %s", table, table),
+	)
+}
+
+const routeSelector = `SELECT app_name, path, image, format, maxc, memory, type, timeout, idle_timeout, headers, config, COALESCE(targets, ''), COALESCE(name, ''), COALESCE(aliases, ''), COALESCE(methods, ''), COALESCE(jwt_key, '') FROM routes`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// SQLiteDatastore keeps its data in a single SQLite file, which other
+// processes may read while the server runs.
+type SQLiteDatastore struct {
+	db *sql.DB
+}
+
+// New opens the SQLite file at the path of the URL, creating it if needed,
+// and migrates it up to the latest schema version unless the URL asks
+// otherwise, see migrate.FromURL.
+func New(url *url.URL) (models.Datastore, error) {
+	db, err := Open(url)
+	if err != nil {
+		return nil, err
+	}
+
+	ds := &SQLiteDatastore{
+		db: db,
+	}
+
+	schema, err := migrate.NewSQLSchema(db, migrations)
+	if err != nil {
+		return nil, err
+	}
+	if err := migrate.FromURL(schema, url); err != nil {
+		return nil, err
+	}
+
+	return datastoreutil.NewValidator(ds), nil
+}
+
+// Open opens the SQLite file at the path of the URL, creating it along with
+// its directory if needed.
+func Open(url *url.URL) (*sql.DB, error) {
+	dir := filepath.Dir(url.Path)
+	log := logrus.WithFields(logrus.Fields{"db": url.Scheme, "dir": dir})
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.WithError(err).Errorln("Could not create data directory for db")
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite3", url.Path)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		return nil, err
+	}
+
+	// SQLite takes a lock on the whole file to write, a single connection
+	// queues writers up instead of failing them with SQLITE_BUSY.
+	db.SetMaxOpenConns(1)
+	log.WithFields(logrus.Fields{"file": url.Path}).Debug("SQLite opened")
+	return db, nil
+}
+
+// InsertApp inserts an app to SQLite.
+func (ds *SQLiteDatastore) InsertApp(ctx context.Context, app *models.App) (*models.App, error) {
+	var cbyte []byte
+	var err error
+
+	if app.Config != nil {
+		cbyte, err = json.Marshal(app.Config)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = ds.Tx(func(tx *sql.Tx) error {
+		r := tx.QueryRow(`SELECT 1 FROM apps WHERE name=?`, app.Name)
+		if err := r.Scan(new(int)); err == nil {
+			return models.ErrAppsAlreadyExists
+		} else if err != sql.ErrNoRows {
+			return err
+		}
+
+		_, err := tx.Exec(`INSERT INTO apps (name, config) VALUES (?, ?)`, app.Name, string(cbyte))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return app, nil
+}
+
+// UpdateApp updates an existing app on SQLite.
+func (ds *SQLiteDatastore) UpdateApp(ctx context.Context, newapp *models.App) (*models.App, error) {
+	app := &models.App{Name: newapp.Name}
+	err := ds.Tx(func(tx *sql.Tx) error {
+		row := tx.QueryRow(`SELECT config FROM apps WHERE name=?`, app.Name)
+
+		var config string
+		if err := row.Scan(&config); err != nil {
+			if err == sql.ErrNoRows {
+				return models.ErrAppsNotFound
+			}
+			return err
+		}
+
+		if config != "" {
+			err := json.Unmarshal([]byte(config), &app.Config)
+			if err != nil {
+				return err
+			}
+		}
+
+		app.UpdateConfig(newapp.Config)
+
+		cbyte, err := json.Marshal(app.Config)
+		if err != nil {
+			return err
+		}
+
+		res, err := tx.Exec(`UPDATE apps SET config=? WHERE name=?`, string(cbyte), app.Name)
+
+		if err != nil {
+			return err
+		}
+
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return models.ErrAppsNotFound
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return app, nil
+}
+
+// RemoveApp removes an existing app on SQLite, along with its routes, their
+// revisions and its extras in a single transaction.
+func (ds *SQLiteDatastore) RemoveApp(ctx context.Context, appName string, cascade bool) error {
+	return ds.Tx(func(tx *sql.Tx) error {
+		if !cascade {
+			err := tx.QueryRow("SELECT 1 FROM routes WHERE app_name = ? LIMIT 1", appName).Scan(new(int))
+			if err == nil {
+				return models.ErrDeleteAppsWithRoutes
+			} else if err != sql.ErrNoRows {
+				return err
+			}
+		}
+
+		for _, q := range []string{
+			"DELETE FROM routes WHERE app_name = ?",
+			"DELETE FROM revisions WHERE app_name = ?",
+			"DELETE FROM apps WHERE name = ?",
+		} {
+			if _, err := tx.Exec(q, appName); err != nil {
+				return err
+			}
+		}
+
+		prefix := string(models.AppExtrasPrefix(appName))
+		_, err := tx.Exec("DELETE FROM extras WHERE substr(id, 1, length(?)) = ?", prefix, prefix)
+		return err
+	})
+}
+
+// GetApp retrieves an app from SQLite.
+func (ds *SQLiteDatastore) GetApp(ctx context.Context, name string) (*models.App, error) {
+	row := ds.db.QueryRow(`SELECT name, config FROM apps WHERE name=?`, name)
+
+	var resName string
+	var config string
+	err := row.Scan(&resName, &config)
+
+	res := &models.App{
+		Name: resName,
+	}
+
+	json.Unmarshal([]byte(config), &res.Config)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, models.ErrAppsNotFound
+		}
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func scanApp(scanner rowScanner, app *models.App) error {
+	var configStr string
+
+	err := scanner.Scan(
+		&app.Name,
+		&configStr,
+	)
+
+	json.Unmarshal([]byte(configStr), &app.Config)
+
+	return err
+}
+
+// GetApps retrieves an array of apps according to a specific filter.
+func (ds *SQLiteDatastore) GetApps(ctx context.Context, filter *models.AppFilter) ([]*models.App, error) {
+	res := []*models.App{}
+	filterQuery, args := buildFilterAppQuery(filter)
+	rows, err := ds.db.Query(fmt.Sprintf("SELECT name, config FROM apps %s", filterQuery), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var app models.App
+		err := scanApp(rows, &app)
+
+		if err != nil {
+			break
+		}
+		res = append(res, &app)
+	}
+
+	if err := rows.Err(); err != nil {
+		return res, err
+	}
+	return res, nil
+}
+
+// InsertRoute inserts an route to SQLite.
+func (ds *SQLiteDatastore) InsertRoute(ctx context.Context, route *models.Route) (*models.Route, error) {
+	hbyte, err := json.Marshal(route.Headers)
+	if err != nil {
+		return nil, err
+	}
+
+	cbyte, err := json.Marshal(route.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	tbyte, err := json.Marshal(route.Targets)
+	if err != nil {
+		return nil, err
+	}
+
+	abyte, err := json.Marshal(route.Aliases)
+	if err != nil {
+		return nil, err
+	}
+
+	mbyte, err := json.Marshal(route.Methods)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ds.Tx(func(tx *sql.Tx) error {
+		r := tx.QueryRow(`SELECT 1 FROM apps WHERE name=?`, route.AppName)
+		if err := r.Scan(new(int)); err == sql.ErrNoRows {
+			return models.ErrAppsNotFound
+		} else if err != nil {
+			return err
+		}
+
+		methods := models.MethodsKey(route.Methods)
+		r = tx.QueryRow(`SELECT 1 FROM routes WHERE app_name=? AND path=? AND methods_key=?`, route.AppName, route.Path, methods)
+		if err := r.Scan(new(int)); err == nil {
+			return models.ErrRoutesAlreadyExists
+		} else if err != sql.ErrNoRows {
+			return err
+		}
+
+		if err := checkName(tx, route.AppName, route.Name, route.Path, methods); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec(`
+		INSERT INTO routes (
+			app_name,
+			path,
+			methods_key,
+			image,
+			format,
+			maxc,
+			memory,
+			type,
+			timeout,
+			idle_timeout,
+			headers,
+			config,
+			targets,
+			name,
+			aliases,
+			methods,
+			jwt_key
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?, ?);`,
+			route.AppName,
+			route.Path,
+			methods,
+			route.Image,
+			route.Format,
+			route.MaxConcurrency,
+			route.Memory,
+			route.Type,
+			route.Timeout,
+			route.IdleTimeout,
+			string(hbyte),
+			string(cbyte),
+			string(tbyte),
+			route.Name,
+			string(abyte),
+			string(mbyte),
+			route.JwtKey,
+		)
+		return nameConflict(err)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return route, nil
+}
+
+// UpdateRoute updates an existing route on SQLite.
+func (ds *SQLiteDatastore) UpdateRoute(ctx context.Context, newroute *models.Route) (*models.Route, error) {
+	var route models.Route
+	err := ds.Tx(func(tx *sql.Tx) error {
+		return updateRoute(tx, newroute.Path, models.MethodsKey(newroute.Methods), newroute, &route)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return &route, nil
+}
+
+// MoveRoute updates a route on SQLite and changes its path and methods to the
+// ones of newroute, along with those of its revisions, replacing any
+// revisions left there.
+func (ds *SQLiteDatastore) MoveRoute(ctx context.Context, oldPath, oldMethods string, newroute *models.Route) (*models.Route, error) {
+	var route models.Route
+	err := ds.Tx(func(tx *sql.Tx) error {
+		appName, newPath, newMethods := newroute.AppName, newroute.Path, oldMethods
+		if newroute.Methods != nil {
+			newMethods = models.MethodsKey(newroute.Methods)
+		}
+
+		var exists int
+		err := tx.QueryRow("SELECT COUNT(*) FROM routes WHERE app_name=? AND path=? AND methods_key=?", appName, newPath, newMethods).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists > 0 {
+			return models.ErrRoutesAlreadyExists
+		}
+
+		if err := updateRoute(tx, oldPath, oldMethods, newroute, &route); err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("DELETE FROM revisions WHERE app_name=? AND path=? AND methods_key=?", appName, newPath, newMethods)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("UPDATE revisions SET path=?, methods_key=? WHERE app_name=? AND path=? AND methods_key=?", newPath, newMethods, appName, oldPath, oldMethods)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &route, nil
+}
+
+// updateRoute updates the route at oldPath serving oldMethods with newroute,
+// moving it to the path and methods of newroute, and stores the result in
+// route.
+func updateRoute(tx *sql.Tx, oldPath, oldMethods string, newroute *models.Route, route *models.Route) error {
+	row := tx.QueryRow(fmt.Sprintf("%s WHERE app_name=? AND path=? AND methods_key=?", routeSelector), newroute.AppName, oldPath, oldMethods)
+	if err := scanRoute(row, route); err == sql.ErrNoRows {
+		return models.ErrRoutesNotFound
+	} else if err != nil {
+		return err
+	}
+
+	route.Update(newroute)
+	if err := checkName(tx, route.AppName, route.Name, oldPath, oldMethods); err != nil {
+		return err
+	}
+	route.Path = newroute.Path
+
+	hbyte, err := json.Marshal(route.Headers)
+	if err != nil {
+		return err
+	}
+
+	cbyte, err := json.Marshal(route.Config)
+	if err != nil {
+		return err
+	}
+
+	tbyte, err := json.Marshal(route.Targets)
+	if err != nil {
+		return err
+	}
+
+	abyte, err := json.Marshal(route.Aliases)
+	if err != nil {
+		return err
+	}
+
+	mbyte, err := json.Marshal(route.Methods)
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.Exec(`
+	UPDATE routes SET
+		path = ?,
+		methods_key = ?,
+		image = ?,
+		format = ?,
+		maxc = ?,
+		memory = ?,
+		type = ?,
+		timeout = ?,
+		idle_timeout = ?,
+		headers = ?,
+		config = ?,
+		targets = ?,
+		name = NULLIF(?, ''),
+		aliases = ?,
+		methods = ?,
+		jwt_key = ?
+	WHERE app_name = ? AND path = ? AND methods_key = ?;`,
+		route.Path,
+		models.MethodsKey(route.Methods),
+		route.Image,
+		route.Format,
+		route.MaxConcurrency,
+		route.Memory,
+		route.Type,
+		route.Timeout,
+		route.IdleTimeout,
+		string(hbyte),
+		string(cbyte),
+		string(tbyte),
+		route.Name,
+		string(abyte),
+		string(mbyte),
+		route.JwtKey,
+		route.AppName,
+		oldPath,
+		oldMethods,
+	)
+
+	if err != nil {
+		return nameConflict(err)
+	}
+
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return models.ErrRoutesNotFound
+	}
+
+	return nil
+}
+
+// checkName returns ErrRoutesNameConflict if a route of the app other than
+// the one at path serving methods is named name.
+func checkName(tx *sql.Tx, appName, name, path, methods string) error {
+	if name == "" {
+		return nil
+	}
+	err := tx.QueryRow("SELECT 1 FROM routes WHERE app_name=? AND name=? AND (path<>? OR methods_key<>?)", appName, name, path, methods).Scan(new(int))
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return models.ErrRoutesNameConflict
+}
+
+// nameConflict turns the violation of the unique index on route names into
+// ErrRoutesNameConflict. SQLite names the columns of the index in the error.
+func nameConflict(err error) error {
+	if err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed") && strings.Contains(err.Error(), "routes.name") {
+		return models.ErrRoutesNameConflict
+	}
+	return err
+}
+
+// RemoveRoute removes an existing route on SQLite along with its revisions.
+func (ds *SQLiteDatastore) RemoveRoute(ctx context.Context, appName, routePath, methods string) error {
+	return ds.Tx(func(tx *sql.Tx) error {
+		res, err := tx.Exec(`
+			DELETE FROM routes
+			WHERE path = ? AND app_name = ? AND methods_key = ?
+		`, routePath, appName, methods)
+
+		if err != nil {
+			return err
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if n == 0 {
+			return models.ErrRoutesRemoving
+		}
+
+		_, err = tx.Exec("DELETE FROM revisions WHERE app_name=? AND path=? AND methods_key=?", appName, routePath, methods)
+		return err
+	})
+}
+
+func scanRoute(scanner rowScanner, route *models.Route) error {
+	var headerStr string
+	var configStr string
+	var targetsStr string
+	var aliasesStr string
+	var methodsStr string
+
+	err := scanner.Scan(
+		&route.AppName,
+		&route.Path,
+		&route.Image,
+		&route.Format,
+		&route.MaxConcurrency,
+		&route.Memory,
+		&route.Type,
+		&route.Timeout,
+		&route.IdleTimeout,
+		&headerStr,
+		&configStr,
+		&targetsStr,
+		&route.Name,
+		&aliasesStr,
+		&methodsStr,
+		&route.JwtKey,
+	)
+	if err != nil {
+		return err
+	}
+
+	if headerStr == "" {
+		return models.ErrRoutesNotFound
+	}
+
+	if err := json.Unmarshal([]byte(headerStr), &route.Headers); err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(configStr), &route.Config); err != nil {
+		return err
+	}
+	if len(targetsStr) > 0 {
+		if err := json.Unmarshal([]byte(targetsStr), &route.Targets); err != nil {
+			return err
+		}
+	}
+	if len(aliasesStr) > 0 {
+		if err := json.Unmarshal([]byte(aliasesStr), &route.Aliases); err != nil {
+			return err
+		}
+	}
+	if len(methodsStr) > 0 {
+		return json.Unmarshal([]byte(methodsStr), &route.Methods)
+	}
+	return nil
+}
+
+// GetRoute retrieves a route from SQLite.
+func (ds *SQLiteDatastore) GetRoute(ctx context.Context, appName, routePath, methods string) (*models.Route, error) {
+	var route models.Route
+
+	row := ds.db.QueryRow(fmt.Sprintf("%s WHERE app_name=? AND path=? AND methods_key=?", routeSelector), appName, routePath, methods)
+	err := scanRoute(row, &route)
+
+	if err == sql.ErrNoRows {
+		return nil, models.ErrRoutesNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return &route, nil
+}
+
+// GetRoutes retrieves an array of routes according to a specific filter.
+func (ds *SQLiteDatastore) GetRoutes(ctx context.Context, filter *models.RouteFilter) ([]*models.Route, error) {
+	res := []*models.Route{}
+	filterQuery, args := buildFilterRouteQuery(filter)
+	rows, err := ds.db.Query(fmt.Sprintf("%s %s", routeSelector, filterQuery), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var route models.Route
+		err := scanRoute(rows, &route)
+		if err != nil {
+			continue
+		}
+		res = append(res, &route)
+
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// GetRoutesByApp retrieves a route with a specific app name.
+func (ds *SQLiteDatastore) GetRoutesByApp(ctx context.Context, appName string, filter *models.RouteFilter) ([]*models.Route, error) {
+	f := *filter
+	f.AppName = appName
+	return ds.GetRoutes(ctx, &f)
+}
+
+// buildFilterAppQuery matches names with GLOB, which unlike LIKE is case
+// sensitive. Text is compared bytewise, so that pages follow the order the
+// other datastores use.
+func buildFilterAppQuery(filter *models.AppFilter) (string, []interface{}) {
+	var b bytes.Buffer
+	var args []interface{}
+
+	where := func(colOp string, val interface{}) {
+		args = append(args, val)
+		if len(args) == 1 {
+			fmt.Fprintf(&b, "WHERE %s ?", colOp)
+		} else {
+			fmt.Fprintf(&b, " AND %s ?", colOp)
+		}
+	}
+
+	if filter.Name != "" {
+		where("name GLOB", globEscaper.Replace(filter.Name))
+	}
+	if filter.Cursor != "" {
+		where("name >", filter.Cursor)
+	}
+
+	b.WriteString(" ORDER BY name")
+	if filter.PerPage > 0 {
+		fmt.Fprintf(&b, " LIMIT %d", filter.PerPage)
+	}
+
+	return b.String(), args
+}
+
+func buildFilterRouteQuery(filter *models.RouteFilter) (string, []interface{}) {
+	var b bytes.Buffer
+	var args []interface{}
+
+	where := func(cond string, vals ...interface{}) {
+		if len(args) == 0 {
+			b.WriteString("WHERE ")
+		} else {
+			b.WriteString(" AND ")
+		}
+		b.WriteString(cond)
+		args = append(args, vals...)
+	}
+
+	if filter.Path != "" {
+		where("path = ?", filter.Path)
+	}
+	if filter.AppName != "" {
+		where("app_name = ?", filter.AppName)
+	}
+	if filter.Image != "" {
+		where("substr(image, 1, length(?)) = ?", filter.Image, filter.Image)
+	}
+	if filter.Name != "" {
+		where("name GLOB ?", globEscaper.Replace(filter.Name))
+	}
+	if filter.Type != "" {
+		where("type = ?", filter.Type)
+	}
+	if filter.Format != "" {
+		where("format = ?", filter.Format)
+	}
+	if filter.CursorApp != "" {
+		where("(app_name > ? OR (app_name = ? AND (path > ? OR (path = ? AND methods_key > ?))))",
+			filter.CursorApp, filter.CursorApp, filter.CursorPath, filter.CursorPath, filter.CursorMethods)
+	}
+
+	b.WriteString(" ORDER BY app_name, path, methods_key")
+	if filter.PerPage > 0 {
+		fmt.Fprintf(&b, " LIMIT %d", filter.PerPage)
+	}
+
+	return b.String(), args
+}
+
+// globEscaper escapes the GLOB wildcards filters do not support, '*' being
+// the only one they do.
+var globEscaper = strings.NewReplacer("?", "[?]", "[", "[[]")
+
+// InsertAuditEvent inserts an audit event into SQLite.
+func (ds *SQLiteDatastore) InsertAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	buf, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = ds.db.Exec(`
+		INSERT INTO audit (
+			id,
+			created_at,
+			app_name,
+			path,
+			actor,
+			event
+		)
+		VALUES (?, ?, ?, ?, ?, ?);`,
+		event.ID,
+		event.Timestamp.UnixNano(),
+		event.AppName,
+		event.Path,
+		event.Actor,
+		string(buf),
+	)
+	return err
+}
+
+// GetAuditEvents retrieves audit events from SQLite, newest first.
+func (ds *SQLiteDatastore) GetAuditEvents(ctx context.Context, filter *models.AuditFilter) ([]*models.AuditEvent, error) {
+	res := []*models.AuditEvent{}
+
+	filterQuery, args := buildFilterAuditQuery(filter)
+	rows, err := ds.db.Query(fmt.Sprintf("SELECT event FROM audit %s", filterQuery), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var buf string
+		if err := rows.Scan(&buf); err != nil {
+			return nil, err
+		}
+		var event models.AuditEvent
+		if err := json.Unmarshal([]byte(buf), &event); err != nil {
+			return nil, err
+		}
+		res = append(res, &event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func buildFilterAuditQuery(filter *models.AuditFilter) (string, []interface{}) {
+	var b bytes.Buffer
+	var args []interface{}
+
+	where := func(colOp string, val interface{}) {
+		args = append(args, val)
+		if len(args) == 1 {
+			fmt.Fprintf(&b, "WHERE %s ?", colOp)
+		} else {
+			fmt.Fprintf(&b, " AND %s ?", colOp)
+		}
+	}
+
+	if filter.AppName != "" {
+		where("app_name =", filter.AppName)
+	}
+	if filter.Path != "" {
+		where("path =", filter.Path)
+	}
+	if filter.Actor != "" {
+		where("actor =", filter.Actor)
+	}
+	if !filter.Since.IsZero() {
+		where("created_at >=", filter.Since.UnixNano())
+	}
+
+	b.WriteString(" ORDER BY created_at DESC")
+	if filter.Limit > 0 {
+		fmt.Fprintf(&b, " LIMIT %d", filter.Limit)
+	}
+
+	return b.String(), args
+}
+
+// revisionRetries is how many times a revision whose number was taken by a
+// concurrent insert is numbered again.
+const revisionRetries = 5
+
+// InsertRouteRevision inserts a route revision into SQLite, numbered after the
+// newest revision of its route. Concurrent inserts for the same route conflict
+// on the primary key rather than sharing a number, and the ones losing are
+// numbered again.
+func (ds *SQLiteDatastore) InsertRouteRevision(ctx context.Context, rev *models.RouteRevision) (*models.RouteRevision, error) {
+	for i := 0; ; i++ {
+		err := ds.Tx(func(tx *sql.Tx) error {
+			methods := models.MethodsKey(rev.Methods)
+			row := tx.QueryRow("SELECT COALESCE(MAX(revision), 0) FROM revisions WHERE app_name=? AND path=? AND methods_key=?", rev.AppName, rev.Path, methods)
+
+			var last int64
+			if err := row.Scan(&last); err != nil {
+				return err
+			}
+			rev.Revision = last + 1
+
+			buf, err := json.Marshal(rev)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.Exec(`
+				INSERT INTO revisions (
+					app_name,
+					path,
+					methods_key,
+					revision,
+					revision_data
+				)
+				VALUES (?, ?, ?, ?, ?);`,
+				rev.AppName,
+				rev.Path,
+				methods,
+				rev.Revision,
+				string(buf),
+			)
+			return err
+		})
+		if err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed") && i < revisionRetries {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return rev, nil
+	}
+}
+
+// GetRouteRevisions retrieves the revisions of a route from SQLite, newest first.
+func (ds *SQLiteDatastore) GetRouteRevisions(ctx context.Context, appName, routePath, methods string) ([]*models.RouteRevision, error) {
+	res := []*models.RouteRevision{}
+
+	rows, err := ds.db.Query("SELECT revision_data FROM revisions WHERE app_name=? AND path=? AND methods_key=? ORDER BY revision DESC", appName, routePath, methods)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var buf string
+		if err := rows.Scan(&buf); err != nil {
+			return nil, err
+		}
+		var rev models.RouteRevision
+		if err := json.Unmarshal([]byte(buf), &rev); err != nil {
+			return nil, err
+		}
+		rev.AppName, rev.Path, rev.Methods = appName, routePath, models.ParseMethodsKey(methods)
+		res = append(res, &rev)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Put inserts an extra into SQLite.
+func (ds *SQLiteDatastore) Put(ctx context.Context, key, value []byte) error {
+	_, err := ds.db.Exec(`
+		INSERT OR REPLACE INTO extras (
+			id,
+			value
+		)
+		VALUES (?, ?)
+		`, string(key), string(value))
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Get retrieves the value of a specific extra from SQLite.
+func (ds *SQLiteDatastore) Get(ctx context.Context, key []byte) ([]byte, error) {
+	row := ds.db.QueryRow("SELECT value FROM extras WHERE id=?", string(key))
+
+	var value string
+	err := row.Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return []byte(value), nil
+}
+
+// Tx Begins and commits a SQLite Transaction.
+func (ds *SQLiteDatastore) Tx(f func(*sql.Tx) error) error {
+	tx, err := ds.db.Begin()
+	if err != nil {
+		return err
+	}
+	err = f(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,26 @@
+package sqlite
+
+import (
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/iron-io/functions/api/datastore/internal/datastoretest"
+)
+
+const tmpSQLite = "/tmp/sqlite_fn_test.db"
+
+func TestDatastore(t *testing.T) {
+	os.Remove(tmpSQLite)
+	defer os.Remove(tmpSQLite)
+
+	u, err := url.Parse("sqlite://" + tmpSQLite)
+	if err != nil {
+		t.Fatalf("failed to parse url: %v", err)
+	}
+	ds, err := New(u)
+	if err != nil {
+		t.Fatalf("failed to create sqlite datastore: %v", err)
+	}
+	datastoretest.Test(t, ds)
+}
@@ -86,7 +86,19 @@ func (a *App) UpdateConfig(patch Config) {
 	}
 }
 
+// AppFilter selects apps, which are listed by name.
 type AppFilter struct {
-	// An SQL LIKE query. Empty does not filter.
+	// Name is a glob, '*' matching any sequence of characters. Empty does
+	// not filter.
 	Name string
+	// Cursor resumes the listing after the app of that name.
+	Cursor string
+	// PerPage limits how many apps are listed, zero meaning no limit.
+	PerPage int
+}
+
+// Match tells whether app satisfies the filter, ignoring PerPage.
+func (f *AppFilter) Match(app *App) bool {
+	return f == nil || (f.Name == "" || MatchGlob(f.Name, app.Name)) &&
+		(f.Cursor == "" || app.Name > f.Cursor)
 }
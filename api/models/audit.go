@@ -0,0 +1,65 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// Actions recorded in AuditEvent.Action.
+const (
+	AuditAppCreate     = "app_create"
+	AuditAppUpdate     = "app_update"
+	AuditAppDelete     = "app_delete"
+	AuditRouteCreate   = "route_create"
+	AuditRouteUpdate   = "route_update"
+	AuditRouteDelete   = "route_delete"
+	AuditRouteRollback = "route_rollback"
+	AuditQueuePurge    = "queue_purge"
+)
+
+var (
+	ErrAuditInvalidSince = errors.New("Invalid since, expected an RFC3339 timestamp")
+	ErrAuditInvalidLimit = errors.New("Invalid limit, expected a positive number")
+	ErrAuditList         = errors.New("Could not list audit events from datastore")
+)
+
+// AuditEvent records a change made to an app, route or app queue through the
+// management API: who did it, when, through which endpoint, and which fields changed.
+type AuditEvent struct {
+	ID         string         `json:"id"`
+	Timestamp  time.Time      `json:"timestamp"`
+	Actor      string         `json:"actor"`
+	RemoteAddr string         `json:"remote_addr"`
+	Method     string         `json:"method"`
+	Endpoint   string         `json:"endpoint"`
+	Action     string         `json:"action"`
+	AppName    string         `json:"app_name"`
+	Path       string         `json:"path,omitempty"`
+	Changes    []*AuditChange `json:"changes"`
+}
+
+// AuditChange is the before and after value of a single field. Secrets, such
+// as config values, are redacted.
+type AuditChange struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// AuditFilter narrows down the audit events returned by the datastore.
+// Empty fields match all events.
+type AuditFilter struct {
+	AppName string
+	Path    string
+	Actor   string
+	Since   time.Time
+	Limit   int
+}
+
+// Match tells whether event satisfies the filter, ignoring Limit.
+func (f *AuditFilter) Match(event *AuditEvent) bool {
+	return f == nil || (f.AppName == "" || event.AppName == f.AppName) &&
+		(f.Path == "" || event.Path == f.Path) &&
+		(f.Actor == "" || event.Actor == f.Actor) &&
+		(f.Since.IsZero() || !event.Timestamp.Before(f.Since))
+}
@@ -26,16 +26,19 @@ type Datastore interface {
 	// Returns ErrAppsNotFound if an App is not found.
 	UpdateApp(ctx context.Context, app *App) (*App, error)
 
-	// RemoveApp removes the App named appName. Returns ErrDatastoreEmptyAppName if appName is empty.
+	// RemoveApp removes the App named appName along with its routes, their revisions and the extra data
+	// stored under AppExtrasPrefix(appName), in a single transaction where the datastore supports them.
+	// Returns ErrDatastoreEmptyAppName if appName is empty.
 	// Returns ErrAppsNotFound if an App is not found.
-	//TODO remove routes automatically? #528
-	RemoveApp(ctx context.Context, appName string) error
+	// Returns ErrDeleteAppsWithRoutes, removing nothing, if the App has routes and cascade is false.
+	RemoveApp(ctx context.Context, appName string, cascade bool) error
 
-	// GetRoute looks up a matching Route for appName and the literal request route routePath.
+	// GetRoute looks up the Route of appName at the literal request route routePath serving methods, a key as
+	// returned by MethodsKey. Routes serving different methods can share a path.
 	// Returns ErrDatastoreEmptyAppName when appName is empty, and ErrDatastoreEmptyRoutePath when
 	// routePath is empty.
 	// Returns ErrRoutesNotFound when no matching route is found.
-	GetRoute(ctx context.Context, appName, routePath string) (*Route, error)
+	GetRoute(ctx context.Context, appName, routePath, methods string) (*Route, error)
 
 	// GetRoutes gets a slice of Routes, optionally filtered by filter.
 	GetRoutes(ctx context.Context, filter *RouteFilter) (routes []*Route, err error)
@@ -46,28 +49,76 @@ type Datastore interface {
 
 	// InsertRoute inserts a route. Returns ErrDatastoreEmptyRoute when route is nil, and ErrDatastoreEmptyAppName
 	// or ErrDatastoreEmptyRoutePath for empty AppName or Path.
-	// Returns ErrRoutesAlreadyExists if the exact route.Path already exists, or ErrRoutesCreate if a conflicting
-	// route already exists.
+	// Returns ErrRoutesAlreadyExists if a route serving the same methods already exists at route.Path, or
+	// ErrRoutesCreate if a conflicting route already exists. Returns ErrRoutesNameConflict if another route of
+	// the app has route.Name.
 	InsertRoute(ctx context.Context, route *Route) (*Route, error)
 
-	// UpdateRoute updates route's Config and Header fields. Returns ErrDatastoreEmptyRoute when route is nil, and
-	// ErrDatastoreEmptyAppName or ErrDatastoreEmptyRoutePath for empty AppName or Path.
+	// UpdateRoute updates the route at route.Path serving route.Methods, which it does not change, with the
+	// other fields of route. Returns ErrDatastoreEmptyRoute when route is nil, and ErrDatastoreEmptyAppName
+	// or ErrDatastoreEmptyRoutePath for empty AppName or Path.
+	// Returns ErrRoutesNameConflict if another route of the app has the updated name.
 	UpdateRoute(ctx context.Context, route *Route) (*Route, error)
 
-	// RemoveRoute removes a route. Returns ErrDatastoreEmptyAppName when appName is empty, and
-	// ErrDatastoreEmptyRoutePath when routePath is empty. Returns ErrRoutesNotFound when no route exists.
-	RemoveRoute(ctx context.Context, appName, routePath string) error
+	// MoveRoute moves the route at oldPath serving oldMethods, a key as returned by MethodsKey, to route.Path
+	// and the methods of route if set, along with its revisions, and updates it with route as UpdateRoute does,
+	// in a single transaction where the datastore supports them. Returns ErrDatastoreEmptyRoute when route is
+	// nil, ErrDatastoreEmptyAppName when route.AppName is empty, and ErrDatastoreEmptyRoutePath when oldPath or
+	// route.Path is empty. Returns ErrRoutesNotFound when no such route exists, ErrRoutesAlreadyExists when one
+	// serving the new methods exists at route.Path, and ErrRoutesNameConflict if another route of the app has
+	// the updated name.
+	MoveRoute(ctx context.Context, oldPath, oldMethods string, route *Route) (*Route, error)
+
+	// RemoveRoute removes the route at routePath serving methods, a key as returned by MethodsKey, along with
+	// its revisions. Returns ErrDatastoreEmptyAppName when appName is empty, and ErrDatastoreEmptyRoutePath
+	// when routePath is empty. Returns ErrRoutesNotFound when no route exists.
+	RemoveRoute(ctx context.Context, appName, routePath, methods string) error
+
+	// InsertAuditEvent records a change made through the management API.
+	// Returns ErrDatastoreEmptyAuditEvent when event is nil.
+	InsertAuditEvent(ctx context.Context, event *AuditEvent) error
+
+	// GetAuditEvents gets audit events matching filter, newest first. A
+	// missing filter matches all events, a zero filter.Limit means no limit.
+	GetAuditEvents(ctx context.Context, filter *AuditFilter) ([]*AuditEvent, error)
+
+	// InsertRouteRevision records rev as the newest revision of its route,
+	// the one at rev.Path serving rev.Methods, setting rev.Revision to the
+	// next number for that route. Returns
+	// ErrDatastoreEmptyRouteRevision when rev is nil, and ErrDatastoreEmptyAppName
+	// or ErrDatastoreEmptyRoutePath for empty AppName or Path.
+	InsertRouteRevision(ctx context.Context, rev *RouteRevision) (*RouteRevision, error)
+
+	// GetRouteRevisions gets all revisions of the route of appName at
+	// routePath serving methods, a key as returned by MethodsKey, newest
+	// first. Returns
+	// ErrDatastoreEmptyAppName when appName is empty, and
+	// ErrDatastoreEmptyRoutePath when routePath is empty.
+	GetRouteRevisions(ctx context.Context, appName, routePath, methods string) ([]*RouteRevision, error)
 
-	// The following provide a generic key value store for arbitrary data, can be used by extensions to store extra data
-	// todo: should we namespace these by app? Then when an app is deleted, it can delete any of this extra data too.
+	// The following provide a generic key value store for arbitrary data, can be used by extensions to store extra data.
+	// Data about an app should be stored under AppExtrasKey, so that it is removed along with the app.
 	Put(context.Context, []byte, []byte) error
 	Get(context.Context, []byte) ([]byte, error)
 }
 
+// AppExtrasPrefix is the prefix of the extra data keys of appName.
+func AppExtrasPrefix(appName string) []byte {
+	return []byte("apps/" + appName + "/")
+}
+
+// AppExtrasKey namespaces key by appName, for extensions to store extra data
+// about an app which is removed along with it.
+func AppExtrasKey(appName string, key []byte) []byte {
+	return append(AppExtrasPrefix(appName), key...)
+}
+
 var (
-	ErrDatastoreEmptyAppName   = errors.New("Missing app name")
-	ErrDatastoreEmptyRoutePath = errors.New("Missing route name")
-	ErrDatastoreEmptyApp       = errors.New("Missing app")
-	ErrDatastoreEmptyRoute     = errors.New("Missing route")
-	ErrDatastoreEmptyKey       = errors.New("Missing key")
+	ErrDatastoreEmptyAppName       = errors.New("Missing app name")
+	ErrDatastoreEmptyRoutePath     = errors.New("Missing route name")
+	ErrDatastoreEmptyApp           = errors.New("Missing app")
+	ErrDatastoreEmptyRoute         = errors.New("Missing route")
+	ErrDatastoreEmptyKey           = errors.New("Missing key")
+	ErrDatastoreEmptyAuditEvent    = errors.New("Missing audit event")
+	ErrDatastoreEmptyRouteRevision = errors.New("Missing route revision")
 )
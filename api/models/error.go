@@ -11,5 +11,7 @@ func (m *Error) Validate() error {
 }
 
 var (
-	ErrInvalidJSON = errors.New("Invalid JSON")
+	ErrInvalidJSON    = errors.New("Invalid JSON")
+	ErrInvalidCursor  = errors.New("Invalid cursor")
+	ErrInvalidPerPage = errors.New("Invalid per_page, expected a positive number")
 )
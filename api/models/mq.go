@@ -1,6 +1,10 @@
 package models
 
-import "context"
+import (
+	"context"
+	"errors"
+	"time"
+)
 
 // Titan uses a Message Queue to impose a total ordering on jobs that it will
 // execute in order. Tasks are added to the queue via the Push() interface. The
@@ -26,6 +30,14 @@ import "context"
 // queue.
 // A's timeout occurs before the job is finished. At this point the ordering
 // should be [A, C] and not [C, A].
+//
+// A reservation lasts as long as ReservationTimeout of its Task, and can be
+// extended with Touch() by the consumer of a Task running longer.
+//
+// Partitioning: so that the tasks queued for one app do not hold up the tasks
+// of every other app, the MQ keeps a queue per app, or per route, the total
+// ordering above holding within each queue. Reserve() takes turns between the
+// queues with tasks available.
 type MessageQueue interface {
 	// Push a Task onto the queue. If any error is returned, the Task SHOULD not be
 	// queued. Note that this does not completely avoid double queueing, that is
@@ -49,6 +61,43 @@ type MessageQueue interface {
 	// the job does not have an outstanding reservation, error. If a job did not
 	// exist, succeed.
 	Delete(context.Context, *Task) error
+
+	// Touch restarts the timeout of a pending reservation, as if the job was
+	// reserved now. If the job does not have an outstanding reservation,
+	// error.
+	Touch(context.Context, *Task) error
+
+	// Depth returns the number of tasks of the app available to reserve,
+	// leaving out the ones delayed or reserved. MQs which do not partition
+	// tasks return ErrQueueNotPartitioned.
+	Depth(ctx context.Context, appName string) (int64, error)
+
+	// Stats counts the tasks of every app in the queue. Counts which an MQ
+	// cannot tell are left at 0.
+	Stats(context.Context) (*QueueStats, error)
+
+	// Peek returns up to n of the tasks of the app available to reserve,
+	// without reserving them: the ones of higher priority first, then by
+	// queue, in FIFO order within a queue. MQs which do not partition tasks
+	// return ErrQueueNotPartitioned.
+	Peek(ctx context.Context, appName string, n int) ([]*Task, error)
+
+	// Purge deletes the tasks of the app available to reserve or delayed,
+	// returning how many, and leaves the reserved ones to their consumer. MQs
+	// which do not partition tasks return ErrQueueNotPartitioned.
+	Purge(ctx context.Context, appName string) (int64, error)
+}
+
+var ErrQueueNotPartitioned = errors.New("Message queue does not keep tasks per app")
+
+// ReservationTimeout returns how long a reservation of task lasts: the
+// timeout of the task, or the default route timeout for tasks without one.
+func ReservationTimeout(task *Task) time.Duration {
+	timeout := int32(defaultRouteTimeout)
+	if task.Timeout != nil && *task.Timeout > 0 {
+		timeout = *task.Timeout
+	}
+	return time.Duration(timeout) * time.Second
 }
 
 type Enqueue func(context.Context, MessageQueue, *Task) (*Task, error)
@@ -0,0 +1,35 @@
+package models
+
+import "errors"
+
+var (
+	ErrQueueInvalidPeek   = errors.New("Invalid peek, expected a positive number")
+	ErrTasksInvalidBatch  = errors.New("Invalid n, expected a positive number")
+	ErrTasksInvalidWait   = errors.New("Invalid wait, expected a duration such as 20s")
+	ErrRunnerUnauthorized = errors.New("Invalid runner credentials")
+)
+
+// Queue describes the tasks queued for an app.
+type Queue struct {
+	AppName string `json:"app_name"`
+
+	// Depth is the number of tasks available to run, leaving out the ones
+	// delayed or reserved.
+	Depth int64 `json:"depth"`
+
+	// Tasks lists the next tasks available to run, when asked for.
+	Tasks []*Task `json:"tasks,omitempty"`
+}
+
+// QueueStats counts the tasks of every app in a message queue.
+type QueueStats struct {
+	// Ready counts the tasks available to run by priority, from 0 to 2.
+	Ready []int64 `json:"ready"`
+
+	Delayed  int64 `json:"delayed"`
+	Reserved int64 `json:"reserved"`
+
+	// OldestAge is how long, in seconds, the task available to run the
+	// longest has been submitted for.
+	OldestAge int64 `json:"oldest_age"`
+}
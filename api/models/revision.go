@@ -0,0 +1,117 @@
+package models
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+var (
+	ErrRouteRevisionsList    = errors.New("Could not list route revisions from datastore")
+	ErrRouteRevisionNotFound = errors.New("Route revision not found")
+	ErrRouteRevisionInvalid  = errors.New("Invalid revision, expected a positive number")
+	ErrRoutesRollback        = errors.New("Could not roll back route")
+	ErrRouteRevisionRecord   = errors.New("Route changed, but its revision could not be recorded")
+)
+
+// RouteRevision is an immutable snapshot of the parts of a route that
+// determine what runs when it is called. A new revision is recorded every
+// time a route is created or changed, numbered from 1 for each route.
+// Methods are those of the route, which they identify along with its path,
+// and are left as they are by Patch.
+type RouteRevision struct {
+	AppName     string         `json:"app_name"`
+	Path        string         `json:"path"`
+	Methods     []string       `json:"methods,omitempty"`
+	Revision    int64          `json:"revision"`
+	CreatedAt   time.Time      `json:"created_at"`
+	Image       string         `json:"image"`
+	Memory      uint64         `json:"memory"`
+	Timeout     int32          `json:"timeout"`
+	IdleTimeout int32          `json:"idle_timeout"`
+	Format      string         `json:"format"`
+	Headers     http.Header    `json:"headers"`
+	Config      Config         `json:"config"`
+	Targets     []*RouteTarget `json:"targets,omitempty"`
+}
+
+// NewRouteRevision snapshots route. The revision number is assigned by the
+// datastore when the revision is inserted.
+func NewRouteRevision(route *Route) *RouteRevision {
+	rev := &RouteRevision{
+		AppName:     route.AppName,
+		Path:        route.Path,
+		Methods:     append([]string(nil), route.Methods...),
+		CreatedAt:   time.Now(),
+		Image:       route.Image,
+		Memory:      route.Memory,
+		Timeout:     route.Timeout,
+		IdleTimeout: route.IdleTimeout,
+		Format:      route.Format,
+		Headers:     http.Header{},
+		Config:      Config{},
+	}
+	for k, v := range route.Headers {
+		rev.Headers[k] = append([]string(nil), v...)
+	}
+	for k, v := range route.Config {
+		rev.Config[k] = v
+	}
+	for _, t := range route.Targets {
+		rev.Targets = append(rev.Targets, t.Clone())
+	}
+	return rev
+}
+
+// Patch returns the update that, applied to route with Route.Update, makes it
+// match the revision.
+func (rev *RouteRevision) Patch(route *Route) *Route {
+	patch := &Route{
+		AppName:     route.AppName,
+		Path:        route.Path,
+		Methods:     route.Methods,
+		Image:       rev.Image,
+		Memory:      rev.Memory,
+		Timeout:     rev.Timeout,
+		IdleTimeout: rev.IdleTimeout,
+		Format:      rev.Format,
+		Headers:     http.Header{},
+		Config:      Config{},
+		Targets:     rev.Targets,
+	}
+	if patch.Targets == nil {
+		patch.Targets = []*RouteTarget{}
+	}
+	for k := range route.Config {
+		if _, ok := rev.Config[k]; !ok {
+			patch.Config[k] = ""
+		}
+	}
+	for k, v := range rev.Config {
+		patch.Config[k] = v
+	}
+
+	for k := range route.Headers {
+		if _, ok := rev.Headers[k]; !ok {
+			patch.Headers[k] = nil
+		}
+	}
+	for k, v := range rev.Headers {
+		if !equalStrings(route.Headers[k], v) {
+			patch.Headers[k] = v
+		}
+	}
+	return patch
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"sort"
 	"strings"
 
 	apiErrors "github.com/go-openapi/errors"
@@ -26,12 +27,18 @@ var (
 	ErrRoutesPathImmutable = errors.New("Could not update route - path is immutable")
 	ErrRoutesRemoving      = errors.New("Could not remove route from datastore")
 	ErrRoutesUpdate        = errors.New("Could not update route")
+	ErrRoutesNameConflict  = errors.New("Another route of the app already has this name")
+	ErrRoutesMountConflict = errors.New("Another route of the app is already mounted at this path or alias")
+	ErrRoutesPathConflict  = errors.New("Path or alias conflicts with the path parameters of another route of the app")
+	ErrRoutesAmbiguous     = errors.New("Several routes serve this path, select one with the method query parameter")
+	ErrFunctionsNotFound   = errors.New("Function not found")
 )
 
 type Routes []*Route
 
 type Route struct {
 	AppName        string      `json:"app_name"`
+	Name           string      `json:"name,omitempty"`
 	Path           string      `json:"path"`
 	Image          string      `json:"image"`
 	Memory         uint64      `json:"memory"`
@@ -42,11 +49,24 @@ type Route struct {
 	Timeout        int32       `json:"timeout"`
 	IdleTimeout    int32       `json:"idle_timeout"`
 	Config         `json:"config"`
-	JwtKey         string `json:"jwt_key"`
+	JwtKey         string         `json:"jwt_key"`
+	Targets        []*RouteTarget `json:"targets,omitempty"`
+	Aliases        []string       `json:"aliases,omitempty"`
+	Methods        []string       `json:"methods,omitempty"`
+}
+
+// RouteTarget is a weighted variant of a route, used to split traffic
+// between several images or configs, eg, to canary a new image. Image
+// defaults to the route's image and Config is merged over the route's config.
+type RouteTarget struct {
+	Name   string `json:"name"`
+	Image  string `json:"image,omitempty"`
+	Weight int    `json:"weight"`
+	Config Config `json:"config,omitempty"`
 }
 
 var (
-	ErrRoutesValidationFoundDynamicURL        = errors.New("Dynamic URL is not allowed")
+	ErrRoutesValidationInvalidWildcard        = errors.New("Invalid path parameter, expected named /:param segments and at most a final /*wildcard segment")
 	ErrRoutesValidationInvalidPath            = errors.New("Invalid Path format")
 	ErrRoutesValidationInvalidType            = errors.New("Invalid route Type")
 	ErrRoutesValidationInvalidFormat          = errors.New("Invalid route Format")
@@ -59,6 +79,15 @@ var (
 	ErrRoutesValidationNegativeTimeout        = errors.New("Negative timeout")
 	ErrRoutesValidationNegativeIdleTimeout    = errors.New("Negative idle timeout")
 	ErrRoutesValidationNegativeMaxConcurrency = errors.New("Negative MaxConcurrency")
+	ErrRoutesValidationMissingTargetName      = errors.New("Missing route target Name")
+	ErrRoutesValidationDuplicateTargetName    = errors.New("Duplicate route target Name")
+	ErrRoutesValidationNegativeTargetWeight   = errors.New("Negative route target Weight")
+	ErrRoutesValidationZeroTargetWeights      = errors.New("Route target Weights must not all be zero")
+	ErrRoutesValidationInvalidName            = errors.New("Invalid route Name, can only contain alphanumeric, -, and _")
+	ErrRoutesValidationInvalidAlias           = errors.New("Invalid route Alias, expected an absolute path")
+	ErrRoutesValidationDuplicateAlias         = errors.New("Duplicate route Alias")
+	ErrRoutesValidationInvalidMethod          = errors.New("Invalid route Method, expected an upper case HTTP method")
+	ErrRoutesValidationDuplicateMethod        = errors.New("Duplicate route Method")
 )
 
 // SetDefaults sets zeroed field to defaults.
@@ -120,8 +149,8 @@ func (r *Route) Validate(skipZero bool) error {
 			res = append(res, ErrRoutesValidationPathMalformed)
 		}
 
-		if strings.Contains(u.Path, ":") {
-			res = append(res, ErrRoutesValidationFoundDynamicURL)
+		if !validWildcards(u.Path) {
+			res = append(res, ErrRoutesValidationInvalidWildcard)
 		}
 
 		if !path.IsAbs(u.Path) {
@@ -153,6 +182,63 @@ func (r *Route) Validate(skipZero bool) error {
 		res = append(res, ErrRoutesValidationNegativeIdleTimeout)
 	}
 
+	if r.Name != "" {
+		if len(r.Name) > maxAppName {
+			res = append(res, ErrRoutesValidationInvalidName)
+		}
+		for _, c := range r.Name {
+			if (c < '0' || '9' < c) && (c < 'A' || 'Z' < c) && (c < 'a' || 'z' < c) && c != '_' && c != '-' {
+				res = append(res, ErrRoutesValidationInvalidName)
+				break
+			}
+		}
+	}
+
+	if len(r.Aliases) > 0 {
+		seen := map[string]bool{r.Path: true}
+		for _, alias := range r.Aliases {
+			if !path.IsAbs(alias) || path.Clean(alias) != alias || !validWildcards(alias) {
+				res = append(res, ErrRoutesValidationInvalidAlias)
+			} else if seen[alias] {
+				res = append(res, ErrRoutesValidationDuplicateAlias)
+			}
+			seen[alias] = true
+		}
+	}
+
+	if len(r.Methods) > 0 {
+		seen := map[string]bool{}
+		for _, m := range r.Methods {
+			if !routeMethods[m] {
+				res = append(res, ErrRoutesValidationInvalidMethod)
+			} else if seen[m] {
+				res = append(res, ErrRoutesValidationDuplicateMethod)
+			}
+			seen[m] = true
+		}
+	}
+
+	if len(r.Targets) > 0 {
+		names := map[string]bool{}
+		total := 0
+		for _, t := range r.Targets {
+			if t.Name == "" {
+				res = append(res, ErrRoutesValidationMissingTargetName)
+			} else if names[t.Name] {
+				res = append(res, ErrRoutesValidationDuplicateTargetName)
+			}
+			names[t.Name] = true
+
+			if t.Weight < 0 {
+				res = append(res, ErrRoutesValidationNegativeTargetWeight)
+			}
+			total += t.Weight
+		}
+		if total <= 0 {
+			res = append(res, ErrRoutesValidationZeroTargetWeights)
+		}
+	}
+
 	if len(res) > 0 {
 		return apiErrors.CompositeValidationError(res...)
 	}
@@ -169,6 +255,7 @@ func (r *Route) Clone() *Route {
 }
 
 // Update updates fields in r with non-zero field values from new.
+// Header values replace the existing values of their header.
 // 0-length slice Header values, and empty-string Config values trigger removal of map entry.
 func (r *Route) Update(new *Route) {
 	if new.Image != "" {
@@ -195,18 +282,33 @@ func (r *Route) Update(new *Route) {
 	if new.JwtKey != "" {
 		r.JwtKey = new.JwtKey
 	}
+	if new.Name != "" {
+		r.Name = new.Name
+	}
+	if new.Aliases != nil {
+		// Aliases are replaced as a whole, an empty list removes them.
+		r.Aliases = append([]string{}, new.Aliases...)
+	}
+	if new.Methods != nil {
+		// Methods are replaced as a whole, an empty list allows them all.
+		r.Methods = append([]string{}, new.Methods...)
+	}
+	if new.Targets != nil {
+		// Targets are replaced as a whole, an empty list removes them.
+		r.Targets = make([]*RouteTarget, 0, len(new.Targets))
+		for _, t := range new.Targets {
+			r.Targets = append(r.Targets, t.Clone())
+		}
+	}
 
 	if new.Headers != nil {
 		if r.Headers == nil {
 			r.Headers = make(http.Header)
 		}
 		for k, v := range new.Headers {
-			if len(v) == 0 {
-				r.Headers.Del(k)
-			} else {
-				for _, val := range v {
-					r.Headers.Add(k, val)
-				}
+			r.Headers.Del(k)
+			for _, val := range v {
+				r.Headers.Add(k, val)
 			}
 		}
 	}
@@ -224,9 +326,162 @@ func (r *Route) Update(new *Route) {
 	}
 }
 
-//TODO are these sql LIKE queries? or strict matches?
+func (t *RouteTarget) Clone() *RouteTarget {
+	clone := *t
+	if t.Config != nil {
+		clone.Config = make(Config, len(t.Config))
+		for k, v := range t.Config {
+			clone.Config[k] = v
+		}
+	}
+	return &clone
+}
+
+// RouteFilter selects routes, which are listed by app name, path, then
+// methods key. Path,
+// AppName, Type and Format must match exactly, Image is a prefix and Name a
+// glob, '*' matching any sequence of characters. Empty fields do not filter.
 type RouteFilter struct {
 	Path    string
 	AppName string
 	Image   string
+	Name    string
+	Type    string
+	Format  string
+
+	// CursorApp, CursorPath and CursorMethods resume the listing after the
+	// route at that app and path serving those methods, see MethodsKey.
+	CursorApp     string
+	CursorPath    string
+	CursorMethods string
+	// PerPage limits how many routes are listed, zero meaning no limit.
+	PerPage int
+}
+
+// Match tells whether route satisfies the filter, ignoring PerPage.
+func (f *RouteFilter) Match(route *Route) bool {
+	return f == nil || (f.Path == "" || route.Path == f.Path) &&
+		(f.AppName == "" || route.AppName == f.AppName) &&
+		(f.Image == "" || strings.HasPrefix(route.Image, f.Image)) &&
+		(f.Name == "" || MatchGlob(f.Name, route.Name)) &&
+		(f.Type == "" || route.Type == f.Type) &&
+		(f.Format == "" || route.Format == f.Format) &&
+		(f.CursorApp == "" && f.CursorPath == "" || RouteLess(f.CursorApp, f.CursorPath, f.CursorMethods, route.AppName, route.Path, MethodsKey(route.Methods)))
+}
+
+// RouteLess tells whether the route at appName and routePath serving methods
+// is listed before the one at otherApp and otherPath serving otherMethods.
+func RouteLess(appName, routePath, methods, otherApp, otherPath, otherMethods string) bool {
+	if appName != otherApp {
+		return appName < otherApp
+	}
+	if routePath != otherPath {
+		return routePath < otherPath
+	}
+	return methods < otherMethods
+}
+
+// MatchGlob tells whether s matches pattern, in which '*' matches any
+// sequence of characters.
+func MatchGlob(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return s == pattern
+	}
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	for _, p := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, p)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(p):]
+	}
+	return strings.HasSuffix(s, parts[len(parts)-1])
+}
+
+// Mounts returns the paths the route is served at: its path, then its
+// aliases.
+func (r *Route) Mounts() []string {
+	return append([]string{r.Path}, r.Aliases...)
+}
+
+// validWildcards tells whether the :param and *wildcard segments of a route
+// path are well formed: named, and with the wildcard last.
+func validWildcards(p string) bool {
+	segments := strings.Split(p, "/")
+	for i, s := range segments {
+		if !strings.ContainsAny(s, ":*") {
+			continue
+		}
+		if len(s) < 2 || strings.ContainsAny(s[1:], ":*") {
+			return false
+		}
+		if s[0] == '*' && i != len(segments)-1 {
+			return false
+		}
+		if s[0] != ':' && s[0] != '*' {
+			return false
+		}
+	}
+	return true
+}
+
+// routeMethods are the HTTP methods routes can be restricted to.
+var routeMethods = map[string]bool{
+	"GET":     true,
+	"HEAD":    true,
+	"POST":    true,
+	"PUT":     true,
+	"PATCH":   true,
+	"DELETE":  true,
+	"OPTIONS": true,
+}
+
+// AllowsMethod tells whether the route serves calls made with the HTTP
+// method. Routes without methods serve them all.
+func (r *Route) AllowsMethod(method string) bool {
+	if len(r.Methods) == 0 {
+		return true
+	}
+	for _, m := range r.Methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// MethodsKey returns the key of a set of route methods: the methods sorted
+// and separated by commas, empty for routes serving them all. Routes are
+// identified by their app, their path and the key of their methods, as
+// routes serving different methods can share a path.
+func MethodsKey(methods []string) string {
+	sorted := append([]string{}, methods...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
+
+// ParseMethodsKey returns the methods of a key returned by MethodsKey.
+func ParseMethodsKey(key string) []string {
+	if key == "" {
+		return nil
+	}
+	return strings.Split(key, ",")
+}
+
+// SharesMethods tells whether some HTTP method is served by both r and
+// other, in which case they cannot be mounted at the same path.
+func (r *Route) SharesMethods(other *Route) bool {
+	if len(r.Methods) == 0 || len(other.Methods) == 0 {
+		return true
+	}
+	for _, m := range r.Methods {
+		if other.AllowsMethod(m) {
+			return true
+		}
+	}
+	return false
 }
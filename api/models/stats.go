@@ -0,0 +1,155 @@
+package models
+
+import "time"
+
+// StatsLatencyBuckets are the upper bounds of the latency histogram kept in
+// Stats. Calls slower than the last bound are counted in an extra overflow
+// bucket, hence Stats.Histogram has len(StatsLatencyBuckets)+1 entries.
+var StatsLatencyBuckets = []time.Duration{
+	1 * time.Millisecond,
+	2 * time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	1 * time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+	30 * time.Second,
+	60 * time.Second,
+}
+
+// Stats summarizes the calls made to an app or to a single route over a
+// rolling window. Stats taken from several nodes can be combined with Merge,
+// which is why the raw latency Histogram is kept alongside the percentiles.
+type Stats struct {
+	AppName string `json:"app_name"`
+	Path    string `json:"path,omitempty"`
+
+	// Window is the length, in seconds, of the period these stats cover.
+	Window int64 `json:"window"`
+
+	Requests uint64 `json:"requests"`
+	Errors   uint64 `json:"errors"`
+	Timeouts uint64 `json:"timeouts"`
+
+	ErrorRate   float64 `json:"error_rate"`
+	TimeoutRate float64 `json:"timeout_rate"`
+
+	Latency   StatsLatency `json:"latency"`
+	Histogram []uint64     `json:"histogram"`
+
+	// HotContainers is the number of hot function containers currently up.
+	HotContainers int64 `json:"hot_containers"`
+
+	// Targets breaks down the calls by the route target that served them,
+	// for routes that split traffic between targets.
+	Targets map[string]*StatsTarget `json:"targets,omitempty"`
+}
+
+// StatsTarget counts the calls served by a single route target.
+type StatsTarget struct {
+	Requests  uint64  `json:"requests"`
+	Errors    uint64  `json:"errors"`
+	Timeouts  uint64  `json:"timeouts"`
+	ErrorRate float64 `json:"error_rate"`
+}
+
+// Target returns the counters of the named target, creating them if needed.
+func (s *Stats) Target(name string) *StatsTarget {
+	if s.Targets == nil {
+		s.Targets = make(map[string]*StatsTarget)
+	}
+	t, ok := s.Targets[name]
+	if !ok {
+		t = &StatsTarget{}
+		s.Targets[name] = t
+	}
+	return t
+}
+
+// StatsLatency holds latency percentiles, in milliseconds. Percentiles are
+// estimated from the histogram, so they are the upper bound of the bucket
+// the percentile falls in.
+type StatsLatency struct {
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+}
+
+// Merge adds the counters of o into s and recomputes the derived fields.
+func (s *Stats) Merge(o *Stats) {
+	if o.Window > s.Window {
+		s.Window = o.Window
+	}
+	s.Requests += o.Requests
+	s.Errors += o.Errors
+	s.Timeouts += o.Timeouts
+	s.HotContainers += o.HotContainers
+	if len(s.Histogram) < len(o.Histogram) {
+		h := make([]uint64, len(o.Histogram))
+		copy(h, s.Histogram)
+		s.Histogram = h
+	}
+	for i, n := range o.Histogram {
+		s.Histogram[i] += n
+	}
+	for name, ot := range o.Targets {
+		t := s.Target(name)
+		t.Requests += ot.Requests
+		t.Errors += ot.Errors
+		t.Timeouts += ot.Timeouts
+	}
+	s.Summarize()
+}
+
+// Summarize computes the rates and latency percentiles out of the counters
+// and the latency histogram.
+func (s *Stats) Summarize() {
+	s.ErrorRate, s.TimeoutRate = 0, 0
+	if s.Requests > 0 {
+		s.ErrorRate = float64(s.Errors) / float64(s.Requests)
+		s.TimeoutRate = float64(s.Timeouts) / float64(s.Requests)
+	}
+	for _, t := range s.Targets {
+		t.ErrorRate = 0
+		if t.Requests > 0 {
+			t.ErrorRate = float64(t.Errors) / float64(t.Requests)
+		}
+	}
+	s.Latency = StatsLatency{
+		P50: s.percentile(0.50),
+		P90: s.percentile(0.90),
+		P99: s.percentile(0.99),
+	}
+}
+
+func (s *Stats) percentile(p float64) float64 {
+	var total uint64
+	for _, n := range s.Histogram {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+
+	rank := uint64(p*float64(total) + 0.5)
+	if rank == 0 {
+		rank = 1
+	}
+	var seen uint64
+	for i, n := range s.Histogram {
+		seen += n
+		if seen >= rank {
+			if i >= len(StatsLatencyBuckets) {
+				i = len(StatsLatencyBuckets) - 1
+			}
+			return float64(StatsLatencyBuckets[i]) / float64(time.Millisecond)
+		}
+	}
+	return float64(StatsLatencyBuckets[len(StatsLatencyBuckets)-1]) / float64(time.Millisecond)
+}
@@ -1,6 +1,7 @@
 package mqs
 
 import (
+	"bytes"
 	"context"
 	"encoding/binary"
 	"encoding/json"
@@ -9,6 +10,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"time"
 
 	"github.com/Sirupsen/logrus"
@@ -17,9 +19,15 @@ import (
 	"github.com/iron-io/runner/common"
 )
 
+// BoltDbMQ keeps the tasks of each queue in a bucket nested in the bucket of
+// their priority.
 type BoltDbMQ struct {
-	db     *bolt.DB
-	ticker *time.Ticker
+	db      *bolt.DB
+	ticker  *time.Ticker
+	queueOf queueFunc
+	// last is the queue of the last task reserved, only accessed in write
+	// transactions
+	last string
 }
 
 type BoltDbConfig struct {
@@ -53,9 +61,14 @@ func timeoutName(i int) []byte {
 }
 
 func NewBoltMQ(url *url.URL) (*BoltDbMQ, error) {
+	queueOf, _, err := queueFuncFromURL(url)
+	if err != nil {
+		return nil, err
+	}
+
 	dir := filepath.Dir(url.Path)
 	log := logrus.WithFields(logrus.Fields{"mq": url.Scheme, "dir": dir})
-	err := os.MkdirAll(dir, 0755)
+	err = os.MkdirAll(dir, 0755)
 	if err != nil {
 		log.WithError(err).Errorln("Could not create data directory for mq")
 		return nil, err
@@ -93,8 +106,13 @@ func NewBoltMQ(url *url.URL) (*BoltDbMQ, error) {
 
 	ticker := time.NewTicker(time.Second)
 	mq := &BoltDbMQ{
-		ticker: ticker,
-		db:     db,
+		ticker:  ticker,
+		db:      db,
+		queueOf: queueOf,
+	}
+	if err := db.Update(mq.queueUnqueuedTasks); err != nil {
+		log.WithError(err).Errorln("Error moving tasks into their queue")
+		return nil, err
 	}
 	mq.Start()
 	log.WithFields(logrus.Fields{"file": url.Path}).Debug("BoltDb initialized")
@@ -109,7 +127,6 @@ func (mq *BoltDbMQ) Start() {
 				now := uint64(time.Now().UnixNano())
 				for i := 0; i < 3; i++ {
 					// Assume our timeouts bucket exists and has resKey encoded keys.
-					jobBucket := tx.Bucket(queueName(i))
 					timeoutBucket := tx.Bucket(timeoutName(i))
 					c := timeoutBucket.Cursor()
 
@@ -119,10 +136,15 @@ func (mq *BoltDbMQ) Start() {
 						if reserved > now {
 							break
 						}
-						err = jobBucket.Put(id, v)
+						err = mq.putTask(tx, i, id, v)
 						if err != nil {
 							return err
 						}
+						if jobID := timeoutBucket.Get(timeoutToIDKey(k)); jobID != nil {
+							// The job is no longer reserved, so it can neither be
+							// touched nor deleted through the timed out reservation.
+							timeoutBucket.Delete(jobKey(string(jobID)))
+						}
 						timeoutBucket.Delete(k)
 						timeoutBucket.Delete(timeoutToIDKey(k))
 					}
@@ -155,8 +177,7 @@ func (mq *BoltDbMQ) Start() {
 						continue
 					}
 
-					jobBucket := tx.Bucket(queueName(int(priority)))
-					err = jobBucket.Put(id, job)
+					err = mq.putTask(tx, int(priority), id, job)
 					if err != nil {
 						return err
 					}
@@ -177,6 +198,44 @@ func (mq *BoltDbMQ) Start() {
 	}()
 }
 
+// putTask puts the task buf in the bucket of its queue at priority, under key.
+func (mq *BoltDbMQ) putTask(tx *bolt.Tx, priority int, key, buf []byte) error {
+	var job models.Task
+	if err := json.Unmarshal(buf, &job); err != nil {
+		return err
+	}
+	qb, err := tx.Bucket(queueName(priority)).CreateBucketIfNotExists([]byte(mq.queueOf(&job)))
+	if err != nil {
+		return err
+	}
+	return qb.Put(key, buf)
+}
+
+// queueUnqueuedTasks moves the tasks pushed before tasks were kept in a queue
+// per app into their queue.
+func (mq *BoltDbMQ) queueUnqueuedTasks(tx *bolt.Tx) error {
+	prefix := []byte(msgKeyPrefix)
+	for i := 0; i < 3; i++ {
+		b := tx.Bucket(queueName(i))
+		var keys, values [][]byte
+		c := b.Cursor()
+		// queues are named after apps, whose names have no colon
+		for k, v := c.Seek(prefix); bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			keys = append(keys, append([]byte(nil), k...))
+			values = append(values, append([]byte(nil), v...))
+		}
+		for j, k := range keys {
+			if err := mq.putTask(tx, i, k, values[j]); err != nil {
+				return err
+			}
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // We insert a "reservation" at readyAt, and store the json blob at the msg
 // key. The timer loop plucks this out and puts it in the jobs bucket when the
 // time elapses. The value stored at the reservation key is the priority.
@@ -222,7 +281,11 @@ func (mq *BoltDbMQ) Push(ctx context.Context, job *models.Task) (*models.Task, e
 			return err
 		}
 
-		return b.Put(msgKey(id), buf)
+		qb, err := b.CreateBucketIfNotExists([]byte(mq.queueOf(job)))
+		if err != nil {
+			return err
+		}
+		return qb.Put(msgKey(id), buf)
 	})
 	if err != nil {
 		return nil, err
@@ -272,53 +335,77 @@ func (mq *BoltDbMQ) Reserve(ctx context.Context) (*models.Task, error) {
 	}
 	defer tx.Rollback()
 
-	for i := 2; i >= 0; i-- {
-		// Use the transaction...
-		b := tx.Bucket(queueName(i))
-		c := b.Cursor()
-		key, value := c.Seek([]byte(msgKeyPrefix))
-		if key == nil {
-			// No jobs, try next bucket
-			continue
-		}
+	var queues []string
+	seen := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		tx.Bucket(queueName(i)).ForEach(func(k, v []byte) error {
+			// nested buckets have no value
+			if v == nil && !seen[string(k)] {
+				seen[string(k)] = true
+				queues = append(queues, string(k))
+			}
+			return nil
+		})
+	}
+
+	for _, queue := range roundRobin(queues, mq.last) {
+		for i := 2; i >= 0; i-- {
+			// Use the transaction...
+			b := tx.Bucket(queueName(i))
+			qb := b.Bucket([]byte(queue))
+			if qb == nil {
+				// No jobs, try next bucket
+				continue
+			}
+			key, value := qb.Cursor().First()
+			if key == nil {
+				continue
+			}
+			key = append([]byte(nil), key...)
+			value = append([]byte(nil), value...)
 
-		b.Delete(key)
+			qb.Delete(key)
+			if k, _ := qb.Cursor().First(); k == nil {
+				b.DeleteBucket([]byte(queue))
+			}
 
-		var job models.Task
-		err = json.Unmarshal([]byte(value), &job)
-		if err != nil {
-			return nil, err
-		}
+			var job models.Task
+			err = json.Unmarshal([]byte(value), &job)
+			if err != nil {
+				return nil, err
+			}
 
-		reservationKey := resKey(key, time.Now().Add(time.Minute))
-		b = tx.Bucket(timeoutName(i))
-		// Reserve introduces 3 keys in timeout bucket:
-		// Save reservationKey -> Task to allow release
-		// Save job.ID -> reservationKey to allow Deletes
-		// Save reservationKey -> job.ID to allow clearing job.ID -> reservationKey in recovery without unmarshaling the job.
-		// On Delete:
-		// We have job ID, we get the reservationKey
-		// Delete job.ID -> reservationKey
-		// Delete reservationKey -> job.ID
-		// Delete reservationKey -> Task
-		// On Release:
-		// We have reservationKey, we get the jobID
-		// Delete reservationKey -> job.ID
-		// Delete job.ID -> reservationKey
-		// Move reservationKey -> Task to job bucket.
-		b.Put(reservationKey, value)
-		b.Put(jobKey(job.ID), reservationKey)
-		b.Put(timeoutToIDKey(reservationKey), []byte(job.ID))
-
-		// Commit the transaction and check for error.
-		if err := tx.Commit(); err != nil {
-			return nil, err
-		}
+			reservationKey := resKey(key, time.Now().Add(models.ReservationTimeout(&job)))
+			b = tx.Bucket(timeoutName(i))
+			// Reserve introduces 3 keys in timeout bucket:
+			// Save reservationKey -> Task to allow release
+			// Save job.ID -> reservationKey to allow Deletes
+			// Save reservationKey -> job.ID to allow clearing job.ID -> reservationKey in recovery without unmarshaling the job.
+			// On Delete:
+			// We have job ID, we get the reservationKey
+			// Delete job.ID -> reservationKey
+			// Delete reservationKey -> job.ID
+			// Delete reservationKey -> Task
+			// On Release:
+			// We have reservationKey, we get the jobID
+			// Delete reservationKey -> job.ID
+			// Delete job.ID -> reservationKey
+			// Move reservationKey -> Task to job bucket.
+			b.Put(reservationKey, value)
+			b.Put(jobKey(job.ID), reservationKey)
+			b.Put(timeoutToIDKey(reservationKey), []byte(job.ID))
+
+			mq.last = queue
+			// Commit the transaction and check for error.
+			if err := tx.Commit(); err != nil {
+				return nil, err
+			}
 
-		_, log := common.LoggerWithFields(ctx, logrus.Fields{"call_id": job.ID})
-		log.Println("Reserved")
+			_, log := common.LoggerWithFields(ctx, logrus.Fields{"call_id": job.ID})
+			log.Println("Reserved")
 
-		return &job, nil
+			return &job, nil
+		}
 	}
 
 	return nil, nil
@@ -347,3 +434,190 @@ func (mq *BoltDbMQ) Delete(ctx context.Context, job *models.Task) error {
 		return nil
 	})
 }
+
+// Touch moves the reservation of job to its new timeout, the reservation key
+// ordering the timeout bucket by time.
+func (mq *BoltDbMQ) Touch(ctx context.Context, job *models.Task) error {
+	_, log := common.LoggerWithFields(ctx, logrus.Fields{"call_id": job.ID})
+
+	return mq.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(timeoutName(int(*job.Priority)))
+		k := jobKey(job.ID)
+
+		reservationKey := b.Get(k)
+		if reservationKey == nil {
+			return errors.New("Not reserved")
+		}
+		_, id := resKeyToProperties(reservationKey)
+		value := b.Get(reservationKey)
+
+		// The keys returned by Get are only valid until the next write.
+		touchedKey := resKey(id, time.Now().Add(models.ReservationTimeout(job)))
+		value = append([]byte(nil), value...)
+		for _, k := range [][]byte{timeoutToIDKey(reservationKey), reservationKey} {
+			err := b.Delete(k)
+			if err != nil {
+				return err
+			}
+		}
+
+		b.Put(touchedKey, value)
+		b.Put(k, touchedKey)
+		b.Put(timeoutToIDKey(touchedKey), []byte(job.ID))
+
+		log.Println("Touched")
+		return nil
+	})
+}
+
+func (mq *BoltDbMQ) Depth(ctx context.Context, appName string) (int64, error) {
+	var n int64
+	err := mq.db.View(func(tx *bolt.Tx) error {
+		for i := 0; i < 3; i++ {
+			b := tx.Bucket(queueName(i))
+			err := b.ForEach(func(k, v []byte) error {
+				if v == nil && inApp(string(k), appName) {
+					n += int64(b.Bucket(k).Stats().KeyN)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return n, err
+}
+
+// countPrefix returns the number of keys of b starting with prefix.
+func countPrefix(b *bolt.Bucket, prefix []byte) int64 {
+	var n int64
+	c := b.Cursor()
+	for k, _ := c.Seek(prefix); bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		n++
+	}
+	return n
+}
+
+// appQueues returns the names of the queues of the app, in order.
+func appQueues(tx *bolt.Tx, appName string) []string {
+	var queues []string
+	seen := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		tx.Bucket(queueName(i)).ForEach(func(k, v []byte) error {
+			if v == nil && !seen[string(k)] && inApp(string(k), appName) {
+				seen[string(k)] = true
+				queues = append(queues, string(k))
+			}
+			return nil
+		})
+	}
+	sort.Strings(queues)
+	return queues
+}
+
+func (mq *BoltDbMQ) Stats(ctx context.Context) (*models.QueueStats, error) {
+	stats := newQueueStats()
+	err := mq.db.View(func(tx *bolt.Tx) error {
+		for i := 0; i < 3; i++ {
+			b := tx.Bucket(queueName(i))
+			err := b.ForEach(func(k, v []byte) error {
+				if v != nil {
+					return nil
+				}
+				qb := b.Bucket(k)
+				stats.Ready[i] += int64(qb.Stats().KeyN)
+				if _, head := qb.Cursor().First(); head != nil {
+					var job models.Task
+					if err := json.Unmarshal(head, &job); err != nil {
+						return err
+					}
+					observeOldest(stats, &job)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			stats.Reserved += countPrefix(tx.Bucket(timeoutName(i)), []byte(resKeyPrefix))
+		}
+		stats.Delayed = countPrefix(tx.Bucket(delayQueueName), []byte(resKeyPrefix))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+func (mq *BoltDbMQ) Peek(ctx context.Context, appName string, n int) ([]*models.Task, error) {
+	var tasks []*models.Task
+	err := mq.db.View(func(tx *bolt.Tx) error {
+		queues := appQueues(tx, appName)
+		for i := 2; i >= 0; i-- {
+			for _, queue := range queues {
+				qb := tx.Bucket(queueName(i)).Bucket([]byte(queue))
+				if qb == nil {
+					continue
+				}
+				c := qb.Cursor()
+				for k, v := c.First(); k != nil && len(tasks) < n; k, v = c.Next() {
+					var job models.Task
+					if err := json.Unmarshal(v, &job); err != nil {
+						return err
+					}
+					tasks = append(tasks, &job)
+				}
+			}
+		}
+		return nil
+	})
+	return tasks, err
+}
+
+func (mq *BoltDbMQ) Purge(ctx context.Context, appName string) (int64, error) {
+	var n int64
+	err := mq.db.Update(func(tx *bolt.Tx) error {
+		for _, queue := range appQueues(tx, appName) {
+			for i := 0; i < 3; i++ {
+				b := tx.Bucket(queueName(i))
+				if qb := b.Bucket([]byte(queue)); qb != nil {
+					n += int64(qb.Stats().KeyN)
+					if err := b.DeleteBucket([]byte(queue)); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		// Delayed tasks are kept under their message key, along with the
+		// reservation key of the time they are ready at.
+		b := tx.Bucket(delayQueueName)
+		var keys [][]byte
+		c := b.Cursor()
+		prefix := []byte(resKeyPrefix)
+		for k, _ := c.Seek(prefix); bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			_, id := resKeyToProperties(k)
+			buf := b.Get(id)
+			if buf == nil {
+				continue
+			}
+			var job models.Task
+			if err := json.Unmarshal(buf, &job); err != nil {
+				return err
+			}
+			if inApp(mq.queueOf(&job), appName) {
+				keys = append(keys, append([]byte(nil), k...), append([]byte(nil), id...))
+				n++
+			}
+		}
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return n, err
+}
@@ -0,0 +1,70 @@
+package mqs
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/iron-io/functions/api/models"
+	"github.com/iron-io/functions/api/mqs/internal/mqtest"
+)
+
+func TestBoltMQ(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bolt_mq_test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	mq, err := NewBoltMQ(&url.URL{Scheme: "bolt", Path: filepath.Join(dir, "mq.db")})
+	if err != nil {
+		t.Fatalf("failed to create bolt mq: %v", err)
+	}
+	mqtest.Test(t, mq)
+}
+
+func TestBoltMQUnqueuedTasks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bolt_mq_test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "mq.db")
+
+	// a task pushed before tasks were kept in a queue per app
+	db, err := bolt.Open(path, 0655, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		t.Fatalf("failed to open bolt db: %v", err)
+	}
+	priority := int32(1)
+	buf, _ := json.Marshal(&models.Task{IDStatus: models.IDStatus{ID: "1"}, NewTask: models.NewTask{Priority: &priority}, AppName: "myapp"})
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(queueName(1))
+		if err != nil {
+			return err
+		}
+		return b.Put(msgKey(1), buf)
+	})
+	db.Close()
+	if err != nil {
+		t.Fatalf("failed to push task: %v", err)
+	}
+
+	mq, err := NewBoltMQ(&url.URL{Scheme: "bolt", Path: path})
+	if err != nil {
+		t.Fatalf("failed to create bolt mq: %v", err)
+	}
+	if n, err := mq.Depth(context.Background(), "myapp"); err != nil || n != 1 {
+		t.Fatalf("expected the task in the queue of its app, got %d, %v", n, err)
+	}
+	task, err := mq.Reserve(context.Background())
+	if err != nil || task == nil || task.ID != "1" {
+		t.Fatalf("expected to reserve the task, got %v, %v", task, err)
+	}
+}
@@ -0,0 +1,323 @@
+// Package mqtest checks that a models.MessageQueue behaves as specified in
+// api/models/mq.go.
+package mqtest
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/iron-io/functions/api/models"
+)
+
+// GetContainerHostIP returns the host of the containers which tests start.
+func GetContainerHostIP() string {
+	dockerHost := os.Getenv("DOCKER_HOST")
+	if dockerHost == "" {
+		return "127.0.0.1"
+	}
+	parts, _ := url.Parse(dockerHost)
+	return parts.Hostname()
+}
+
+func newTask(id string, priority int32, delay int32) *models.Task {
+	image := "iron/hello"
+	return &models.Task{
+		IDStatus: models.IDStatus{ID: id},
+		NewTask:  models.NewTask{Image: &image, Priority: &priority, Delay: delay},
+		AppName:  "myapp",
+		Path:     "/hello",
+	}
+}
+
+// reserveAll reserves and deletes tasks until the queue is empty, returning
+// their IDs in the order they were reserved.
+func reserveAll(t *testing.T, ctx context.Context, mq models.MessageQueue) []string {
+	var ids []string
+	for {
+		task, err := mq.Reserve(ctx)
+		if err != nil {
+			t.Fatalf("Reserve: unexpected error: %v", err)
+		}
+		if task == nil {
+			return ids
+		}
+		ids = append(ids, task.ID)
+		if err := mq.Delete(ctx, task); err != nil {
+			t.Fatalf("Delete %s: unexpected error: %v", task.ID, err)
+		}
+	}
+}
+
+// Test runs the conformance suite against mq, which must be empty.
+func Test(t *testing.T, mq models.MessageQueue) {
+	ctx := context.Background()
+
+	t.Run("empty", func(t *testing.T) {
+		task, err := mq.Reserve(ctx)
+		if err != nil || task != nil {
+			t.Fatalf("Reserve: expected no task from an empty queue, got %v, %v", task, err)
+		}
+	})
+
+	t.Run("round-trip", func(t *testing.T) {
+		pushed := newTask("round-trip", 1, 0)
+		pushed.EnvVars = map[string]string{"KEY": "value"}
+		if _, err := mq.Push(ctx, pushed); err != nil {
+			t.Fatalf("Push: unexpected error: %v", err)
+		}
+
+		reserved, err := mq.Reserve(ctx)
+		if err != nil {
+			t.Fatalf("Reserve: unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(reserved, pushed) {
+			t.Fatalf("Reserve: expected the task pushed\n%+v\nbut got\n%+v", pushed, reserved)
+		}
+		if err := mq.Delete(ctx, reserved); err != nil {
+			t.Fatalf("Delete: unexpected error: %v", err)
+		}
+		if ids := reserveAll(t, ctx, mq); len(ids) != 0 {
+			t.Fatalf("Delete: expected the task to be gone, got %v", ids)
+		}
+	})
+
+	t.Run("order", func(t *testing.T) {
+		for _, task := range []*models.Task{
+			newTask("a", 0, 0),
+			newTask("b", 1, 0),
+			newTask("c", 2, 0),
+			newTask("d", 1, 0),
+			newTask("e", 0, 0),
+		} {
+			if _, err := mq.Push(ctx, task); err != nil {
+				t.Fatalf("Push %s: unexpected error: %v", task.ID, err)
+			}
+		}
+
+		// Higher priorities first, FIFO within a priority.
+		expected := []string{"c", "b", "d", "a", "e"}
+		if ids := reserveAll(t, ctx, mq); !reflect.DeepEqual(ids, expected) {
+			t.Fatalf("Reserve: expected tasks in order %v, got %v", expected, ids)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		for _, task := range []*models.Task{newTask("reserved", 1, 0), newTask("queued", 0, 0)} {
+			if _, err := mq.Push(ctx, task); err != nil {
+				t.Fatalf("Push %s: unexpected error: %v", task.ID, err)
+			}
+		}
+		reserved, err := mq.Reserve(ctx)
+		if err != nil || reserved == nil || reserved.ID != "reserved" {
+			t.Fatalf("Reserve: expected task `reserved`, got %v, %v", reserved, err)
+		}
+
+		if err := mq.Delete(ctx, newTask("queued", 0, 0)); err == nil {
+			t.Fatal("Delete: expected an error deleting a task which is not reserved")
+		}
+		if err := mq.Delete(ctx, reserved); err != nil {
+			t.Fatalf("Delete: unexpected error: %v", err)
+		}
+
+		expected := []string{"queued"}
+		if ids := reserveAll(t, ctx, mq); !reflect.DeepEqual(ids, expected) {
+			t.Fatalf("Reserve: expected tasks %v to remain, got %v", expected, ids)
+		}
+	})
+
+	t.Run("delay", func(t *testing.T) {
+		for _, task := range []*models.Task{newTask("delayed", 2, 1), newTask("ready", 0, 0)} {
+			if _, err := mq.Push(ctx, task); err != nil {
+				t.Fatalf("Push %s: unexpected error: %v", task.ID, err)
+			}
+		}
+
+		expected := []string{"ready"}
+		if ids := reserveAll(t, ctx, mq); !reflect.DeepEqual(ids, expected) {
+			t.Fatalf("Reserve: expected only %v before the delay elapsed, got %v", expected, ids)
+		}
+
+		// Queues may only notice the delay elapsed on their next tick.
+		var ids []string
+		for deadline := time.Now().Add(5 * time.Second); len(ids) == 0 && time.Now().Before(deadline); {
+			time.Sleep(100 * time.Millisecond)
+			ids = reserveAll(t, ctx, mq)
+		}
+		if expected := []string{"delayed"}; !reflect.DeepEqual(ids, expected) {
+			t.Fatalf("Reserve: expected %v once the delay elapsed, got %v", expected, ids)
+		}
+	})
+	t.Run("timeout", func(t *testing.T) {
+		task := newTask("timeout", 0, 0)
+		timeout := int32(1)
+		task.Timeout = &timeout
+		if _, err := mq.Push(ctx, task); err != nil {
+			t.Fatalf("Push: unexpected error: %v", err)
+		}
+		if reserved, err := mq.Reserve(ctx); err != nil || reserved == nil {
+			t.Fatalf("Reserve: expected the task pushed, got %v, %v", reserved, err)
+		}
+		if reserved, err := mq.Reserve(ctx); err != nil || reserved != nil {
+			t.Fatalf("Reserve: expected no task while reserved, got %v, %v", reserved, err)
+		}
+
+		// The task is restored once its reservation timed out.
+		var ids []string
+		for deadline := time.Now().Add(5 * time.Second); len(ids) == 0 && time.Now().Before(deadline); {
+			time.Sleep(100 * time.Millisecond)
+			ids = reserveAll(t, ctx, mq)
+		}
+		if expected := []string{"timeout"}; !reflect.DeepEqual(ids, expected) {
+			t.Fatalf("Reserve: expected %v once its reservation timed out, got %v", expected, ids)
+		}
+	})
+
+	t.Run("touch", func(t *testing.T) {
+		task := newTask("touch", 0, 0)
+		timeout := int32(1)
+		task.Timeout = &timeout
+		if _, err := mq.Push(ctx, task); err != nil {
+			t.Fatalf("Push: unexpected error: %v", err)
+		}
+		if err := mq.Touch(ctx, task); err == nil {
+			t.Fatal("Touch: expected an error touching a task which is not reserved")
+		}
+		reserved, err := mq.Reserve(ctx)
+		if err != nil || reserved == nil {
+			t.Fatalf("Reserve: expected the task pushed, got %v, %v", reserved, err)
+		}
+
+		// Touching keeps the task reserved past its timeout.
+		for deadline := time.Now().Add(3 * time.Second); time.Now().Before(deadline); {
+			time.Sleep(300 * time.Millisecond)
+			if err := mq.Touch(ctx, reserved); err != nil {
+				t.Fatalf("Touch: unexpected error: %v", err)
+			}
+			if task, err := mq.Reserve(ctx); err != nil || task != nil {
+				t.Fatalf("Reserve: expected no task while touched, got %v, %v", task, err)
+			}
+		}
+		if err := mq.Delete(ctx, reserved); err != nil {
+			t.Fatalf("Delete: unexpected error: %v", err)
+		}
+		if err := mq.Touch(ctx, reserved); err == nil {
+			t.Fatal("Touch: expected an error touching a deleted task")
+		}
+	})
+	t.Run("queues", func(t *testing.T) {
+		for _, task := range []*models.Task{
+			newTask("a1", 0, 0),
+			newTask("a2", 0, 0),
+			newTask("a3", 0, 0),
+			newTask("b1", 0, 0),
+			newTask("c1", 0, 0),
+		} {
+			task.AppName = task.ID[:1]
+			if _, err := mq.Push(ctx, task); err != nil {
+				t.Fatalf("Push %s: unexpected error: %v", task.ID, err)
+			}
+		}
+
+		for app, expected := range map[string]int64{"a": 3, "b": 1, "none": 0} {
+			if n, err := mq.Depth(ctx, app); err != nil || n != expected {
+				t.Fatalf("Depth: expected %d tasks queued for app %s, got %d, %v", expected, app, n, err)
+			}
+		}
+
+		// Reserve takes turns between the queues of the apps, FIFO within a
+		// queue.
+		ids := reserveAll(t, ctx, mq)
+		if len(ids) != 5 {
+			t.Fatalf("Reserve: expected the 5 tasks pushed, got %v", ids)
+		}
+		if apps := map[byte]bool{ids[0][0]: true, ids[1][0]: true, ids[2][0]: true}; len(apps) != 3 {
+			t.Fatalf("Reserve: expected a task of each app first, got %v", ids)
+		}
+		var queued []string
+		for _, id := range ids {
+			if id[0] == 'a' {
+				queued = append(queued, id)
+			}
+		}
+		if expected := []string{"a1", "a2", "a3"}; !reflect.DeepEqual(queued, expected) {
+			t.Fatalf("Reserve: expected the tasks of app a in order %v, got %v", expected, queued)
+		}
+
+		if n, err := mq.Depth(ctx, "a"); err != nil || n != 0 {
+			t.Fatalf("Depth: expected no task queued once reserved, got %d, %v", n, err)
+		}
+	})
+
+	t.Run("stats", func(t *testing.T) {
+		for _, task := range []*models.Task{
+			newTask("a1", 0, 0),
+			newTask("a2", 2, 0),
+			newTask("a3", 0, 60),
+			newTask("b1", 1, 0),
+			newTask("b2", 0, 0),
+		} {
+			task.AppName = task.ID[:1]
+			if _, err := mq.Push(ctx, task); err != nil {
+				t.Fatalf("Push %s: unexpected error: %v", task.ID, err)
+			}
+		}
+
+		reserved, err := mq.Reserve(ctx)
+		if err != nil || reserved == nil {
+			t.Fatalf("Reserve: expected a task, got %v, %v", reserved, err)
+		}
+		stats, err := mq.Stats(ctx)
+		if err != nil {
+			t.Fatalf("Stats: unexpected error: %v", err)
+		}
+		var ready int64
+		for _, n := range stats.Ready {
+			ready += n
+		}
+		if ready != 3 || stats.Delayed != 1 || stats.Reserved != 1 {
+			t.Fatalf("Stats: expected 3 tasks ready, 1 delayed and 1 reserved, got %+v", stats)
+		}
+		if err := mq.Delete(ctx, reserved); err != nil {
+			t.Fatalf("Delete: unexpected error: %v", err)
+		}
+
+		tasks, err := mq.Peek(ctx, "a", 10)
+		if err != nil {
+			t.Fatalf("Peek: unexpected error: %v", err)
+		}
+		var ids []string
+		for _, task := range tasks {
+			ids = append(ids, task.ID)
+		}
+		expected := []string{"a2", "a1"}
+		if reserved.ID[0] == 'a' {
+			expected = []string{"a1"}
+		}
+		if !reflect.DeepEqual(ids, expected) {
+			t.Fatalf("Peek: expected the tasks of app a in order %v, got %v", expected, ids)
+		}
+		if tasks, err := mq.Peek(ctx, "a", 1); err != nil || len(tasks) != 1 {
+			t.Fatalf("Peek: expected 1 task, got %v, %v", tasks, err)
+		}
+
+		// Purging the app removes its delayed task too.
+		if n, err := mq.Purge(ctx, "a"); err != nil || n != int64(len(expected)+1) {
+			t.Fatalf("Purge: expected %d tasks purged, got %d, %v", len(expected)+1, n, err)
+		}
+		if n, err := mq.Depth(ctx, "a"); err != nil || n != 0 {
+			t.Fatalf("Depth: expected no task queued once purged, got %d, %v", n, err)
+		}
+		if stats, err := mq.Stats(ctx); err != nil || stats.Delayed != 0 {
+			t.Fatalf("Stats: expected no task delayed once purged, got %+v, %v", stats, err)
+		}
+		for _, id := range reserveAll(t, ctx, mq) {
+			if id[0] != 'b' {
+				t.Fatalf("Reserve: expected only the tasks of app b to remain, got %s", id)
+			}
+		}
+	})
+}
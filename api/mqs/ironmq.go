@@ -20,6 +20,8 @@ type assoc struct {
 	reservationId string
 }
 
+// IronMQ keeps all tasks in a queue per priority, tasks not being partitioned
+// by app.
 type IronMQ struct {
 	queues []ironmq.Queue
 	// Protects the map
@@ -142,8 +144,14 @@ func (mq *IronMQ) Reserve(ctx context.Context) (*models.Task, error) {
 	if err != nil {
 		return nil, err
 	}
+	// The timeout of the task is only known once it is reserved, so its
+	// reservation is extended to it right away.
+	reservationId, err := mq.queues[*job.Priority].TouchMessage(message.Id, message.ReservationId, int(models.ReservationTimeout(&job).Seconds()))
+	if err != nil {
+		return nil, err
+	}
 	mq.Lock()
-	mq.msgAssoc[job.ID] = &assoc{message.Id, message.ReservationId}
+	mq.msgAssoc[job.ID] = &assoc{message.Id, reservationId}
 	mq.Unlock()
 	return &job, nil
 }
@@ -162,3 +170,57 @@ func (mq *IronMQ) Delete(ctx context.Context, job *models.Task) error {
 	}
 	return nil
 }
+
+func (mq *IronMQ) Touch(ctx context.Context, job *models.Task) error {
+	if job.Priority == nil || *job.Priority < 0 || *job.Priority > 2 {
+		return fmt.Errorf("IronMQ Touch job %s: Bad priority", job.ID)
+	}
+	mq.Lock()
+	a, exists := mq.msgAssoc[job.ID]
+	mq.Unlock()
+	if !exists {
+		return fmt.Errorf("IronMQ Touch job %s: Not reserved", job.ID)
+	}
+
+	reservationId, err := mq.queues[*job.Priority].TouchMessage(a.msgId, a.reservationId, int(models.ReservationTimeout(job).Seconds()))
+	if err != nil {
+		return err
+	}
+	mq.Lock()
+	// unless deleted meanwhile
+	if _, exists := mq.msgAssoc[job.ID]; exists {
+		mq.msgAssoc[job.ID] = &assoc{a.msgId, reservationId}
+	}
+	mq.Unlock()
+	return nil
+}
+
+func (mq *IronMQ) Depth(ctx context.Context, appName string) (int64, error) {
+	return 0, models.ErrQueueNotPartitioned
+}
+
+// Stats only tells the tasks ready of each priority, which IronMQ counts
+// with the delayed and reserved ones.
+func (mq *IronMQ) Stats(ctx context.Context) (*models.QueueStats, error) {
+	stats := newQueueStats()
+	for i, queue := range mq.queues {
+		info, err := queue.Info()
+		if err != nil {
+			// It is OK if the queue does not exist, it will be created when a message is queued.
+			if !strings.Contains(err.Error(), "404 Not Found") {
+				return nil, err
+			}
+			continue
+		}
+		stats.Ready[i] = int64(info.Size)
+	}
+	return stats, nil
+}
+
+func (mq *IronMQ) Peek(ctx context.Context, appName string, n int) ([]*models.Task, error) {
+	return nil, models.ErrQueueNotPartitioned
+}
+
+func (mq *IronMQ) Purge(ctx context.Context, appName string) (int64, error) {
+	return 0, models.ErrQueueNotPartitioned
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"math/rand"
+	"sort"
 	"sync"
 	"time"
 
@@ -14,16 +15,20 @@ import (
 )
 
 type MemoryMQ struct {
-	// WorkQueue A buffered channel that we can send work requests on.
-	PriorityQueues []chan *models.Task
-	Ticker         *time.Ticker
-	BTree          *btree.BTree
-	Timeouts       map[string]*TaskItem
-	// Protects B-tree and Timeouts
+	// Queues holds the tasks ready to run of each queue, by priority.
+	Queues   map[string][][]*models.Task
+	Ticker   *time.Ticker
+	BTree    *btree.BTree
+	Timeouts map[string]*TaskItem
+	// Protects Queues, B-tree and Timeouts
 	// If this becomes a bottleneck, consider separating the two mutexes. The
 	// goroutine to clear up timed out messages could also become a bottleneck at
 	// some point. May need to switch to bucketing of some sort.
 	Mutex sync.Mutex
+
+	queueOf queueFunc
+	// last is the queue of the last task reserved
+	last string
 }
 
 var letters = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
@@ -40,16 +45,13 @@ func randSeq(n int) string {
 const NumPriorities = 3
 
 func NewMemoryMQ() *MemoryMQ {
-	var queues []chan *models.Task
-	for i := 0; i < NumPriorities; i++ {
-		queues = append(queues, make(chan *models.Task, 5000))
-	}
 	ticker := time.NewTicker(time.Second)
 	mq := &MemoryMQ{
-		PriorityQueues: queues,
-		Ticker:         ticker,
-		BTree:          btree.New(2),
-		Timeouts:       make(map[string]*TaskItem, 0),
+		Queues:   make(map[string][][]*models.Task),
+		Ticker:   ticker,
+		BTree:    btree.New(2),
+		Timeouts: make(map[string]*TaskItem, 0),
+		queueOf:  queueByApp,
 	}
 	mq.start()
 	logrus.Info("MemoryMQ initialized")
@@ -68,10 +70,7 @@ func (mq *MemoryMQ) start() {
 				logrus.WithFields(logrus.Fields{"queue": a}).Debug("delayed job move to queue")
 				ji2 := mq.BTree.Delete(a).(*TaskItem)
 				// put it onto the regular queue now
-				_, err := mq.pushForce(ji2.Task)
-				if err != nil {
-					logrus.WithError(err).Error("Couldn't push delayed message onto main queue")
-				}
+				mq.pushForce(ji2.Task, false)
 				return true
 			})
 			mq.Mutex.Unlock()
@@ -88,10 +87,8 @@ func (mq *MemoryMQ) start() {
 			for _, jobItem := range mq.Timeouts {
 				if jobItem.Less(ji) {
 					delete(mq.Timeouts, jobItem.Task.ID)
-					_, err := mq.pushForce(jobItem.Task)
-					if err != nil {
-						logrus.WithError(err).Error("Couldn't push timed out message onto main queue")
-					}
+					// back at the head of its queue, where it was reserved from
+					mq.pushForce(jobItem.Task, true)
 				}
 			}
 			mq.Mutex.Unlock()
@@ -133,49 +130,70 @@ func (mq *MemoryMQ) Push(ctx context.Context, job *models.Task) (*models.Task, e
 	}
 
 	// Push the work onto the queue.
-	return mq.pushForce(job)
-}
-
-func (mq *MemoryMQ) pushTimeout(job *models.Task) error {
-
-	ji := &TaskItem{
-		Task:    job,
-		StartAt: time.Now().Add(time.Minute),
-	}
 	mq.Mutex.Lock()
-	mq.Timeouts[job.ID] = ji
+	mq.pushForce(job, false)
 	mq.Mutex.Unlock()
-	return nil
-}
-
-func (mq *MemoryMQ) pushForce(job *models.Task) (*models.Task, error) {
-	mq.PriorityQueues[*job.Priority] <- job
 	return job, nil
 }
 
-// This is recursive, so be careful how many channels you pass in.
-func pickEarliestNonblocking(channels ...chan *models.Task) *models.Task {
-	if len(channels) == 0 {
-		return nil
+// pushForce adds job to the tail of its queue, or to the head, with the
+// mutex held.
+func (mq *MemoryMQ) pushForce(job *models.Task, head bool) {
+	queue := mq.queueOf(job)
+	priorities, ok := mq.Queues[queue]
+	if !ok {
+		priorities = make([][]*models.Task, NumPriorities)
+		mq.Queues[queue] = priorities
 	}
-
-	select {
-	case job := <-channels[0]:
-		return job
-	default:
-		return pickEarliestNonblocking(channels[1:]...)
+	if head {
+		priorities[*job.Priority] = append([]*models.Task{job}, priorities[*job.Priority]...)
+	} else {
+		priorities[*job.Priority] = append(priorities[*job.Priority], job)
 	}
 }
 
 func (mq *MemoryMQ) Reserve(ctx context.Context) (*models.Task, error) {
-	job := pickEarliestNonblocking(mq.PriorityQueues[2], mq.PriorityQueues[1], mq.PriorityQueues[0])
-	if job == nil {
-		return nil, nil
+	mq.Mutex.Lock()
+	defer mq.Mutex.Unlock()
+
+	queues := make([]string, 0, len(mq.Queues))
+	for queue := range mq.Queues {
+		queues = append(queues, queue)
 	}
+	for _, queue := range roundRobin(queues, mq.last) {
+		priorities := mq.Queues[queue]
+		for i := NumPriorities - 1; i >= 0; i-- {
+			if len(priorities[i]) == 0 {
+				continue
+			}
+			job := priorities[i][0]
+			priorities[i] = priorities[i][1:]
+			if mq.queueLen(queue) == 0 {
+				delete(mq.Queues, queue)
+			}
+			mq.last = queue
 
-	_, log := common.LoggerWithFields(ctx, logrus.Fields{"call_id": job.ID})
-	log.Println("Reserved")
-	return job, mq.pushTimeout(job)
+			mq.Timeouts[job.ID] = &TaskItem{
+				Task:    job,
+				StartAt: time.Now().Add(models.ReservationTimeout(job)),
+			}
+
+			_, log := common.LoggerWithFields(ctx, logrus.Fields{"call_id": job.ID})
+			log.Println("Reserved")
+			return job, nil
+		}
+	}
+	return nil, nil
+}
+
+// queueLen returns the number of tasks ready to run in queue, with the mutex
+// held.
+func (mq *MemoryMQ) queueLen(queue string) int64 {
+	var n int64
+	for _, tasks := range mq.Queues[queue] {
+		n += int64(len(tasks))
+	}
+	return n
 }
 
 func (mq *MemoryMQ) Delete(ctx context.Context, job *models.Task) error {
@@ -192,3 +210,100 @@ func (mq *MemoryMQ) Delete(ctx context.Context, job *models.Task) error {
 	log.Println("Deleted")
 	return nil
 }
+
+func (mq *MemoryMQ) Touch(ctx context.Context, job *models.Task) error {
+	_, log := common.LoggerWithFields(ctx, logrus.Fields{"call_id": job.ID})
+
+	mq.Mutex.Lock()
+	defer mq.Mutex.Unlock()
+	ji, exists := mq.Timeouts[job.ID]
+	if !exists {
+		return errors.New("Not reserved")
+	}
+
+	ji.StartAt = time.Now().Add(models.ReservationTimeout(ji.Task))
+	log.Println("Touched")
+	return nil
+}
+
+func (mq *MemoryMQ) Depth(ctx context.Context, appName string) (int64, error) {
+	mq.Mutex.Lock()
+	defer mq.Mutex.Unlock()
+
+	var n int64
+	for queue := range mq.Queues {
+		if inApp(queue, appName) {
+			n += mq.queueLen(queue)
+		}
+	}
+	return n, nil
+}
+
+func (mq *MemoryMQ) Stats(ctx context.Context) (*models.QueueStats, error) {
+	mq.Mutex.Lock()
+	defer mq.Mutex.Unlock()
+
+	stats := newQueueStats()
+	for _, priorities := range mq.Queues {
+		for i, tasks := range priorities {
+			stats.Ready[i] += int64(len(tasks))
+			if len(tasks) > 0 {
+				observeOldest(stats, tasks[0])
+			}
+		}
+	}
+	stats.Delayed = int64(mq.BTree.Len())
+	stats.Reserved = int64(len(mq.Timeouts))
+	return stats, nil
+}
+
+func (mq *MemoryMQ) Peek(ctx context.Context, appName string, n int) ([]*models.Task, error) {
+	mq.Mutex.Lock()
+	defer mq.Mutex.Unlock()
+
+	var queues []string
+	for queue := range mq.Queues {
+		if inApp(queue, appName) {
+			queues = append(queues, queue)
+		}
+	}
+	sort.Strings(queues)
+
+	var tasks []*models.Task
+	for i := NumPriorities - 1; i >= 0; i-- {
+		for _, queue := range queues {
+			for _, task := range mq.Queues[queue][i] {
+				if len(tasks) == n {
+					return tasks, nil
+				}
+				tasks = append(tasks, task)
+			}
+		}
+	}
+	return tasks, nil
+}
+
+func (mq *MemoryMQ) Purge(ctx context.Context, appName string) (int64, error) {
+	mq.Mutex.Lock()
+	defer mq.Mutex.Unlock()
+
+	var n int64
+	for queue := range mq.Queues {
+		if inApp(queue, appName) {
+			n += mq.queueLen(queue)
+			delete(mq.Queues, queue)
+		}
+	}
+
+	var delayed []btree.Item
+	mq.BTree.Ascend(func(i btree.Item) bool {
+		if inApp(mq.queueOf(i.(*TaskItem).Task), appName) {
+			delayed = append(delayed, i)
+		}
+		return true
+	})
+	for _, i := range delayed {
+		mq.BTree.Delete(i)
+	}
+	return n + int64(len(delayed)), nil
+}
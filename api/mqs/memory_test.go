@@ -0,0 +1,11 @@
+package mqs
+
+import (
+	"testing"
+
+	"github.com/iron-io/functions/api/mqs/internal/mqtest"
+)
+
+func TestMemoryMQ(t *testing.T) {
+	mqtest.Test(t, NewMemoryMQ())
+}
@@ -24,3 +24,23 @@ func (mock *Mock) Reserve(context.Context) (*models.Task, error) {
 func (mock *Mock) Delete(context.Context, *models.Task) error {
 	return nil
 }
+
+func (mock *Mock) Touch(context.Context, *models.Task) error {
+	return nil
+}
+
+func (mock *Mock) Depth(context.Context, string) (int64, error) {
+	return 0, nil
+}
+
+func (mock *Mock) Stats(context.Context) (*models.QueueStats, error) {
+	return newQueueStats(), nil
+}
+
+func (mock *Mock) Peek(context.Context, string, int) ([]*models.Task, error) {
+	return nil, nil
+}
+
+func (mock *Mock) Purge(context.Context, string) (int64, error) {
+	return 0, nil
+}
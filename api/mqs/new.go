@@ -19,11 +19,21 @@ func New(mqURL string) (models.MessageQueue, error) {
 	logrus.WithFields(logrus.Fields{"mq": u.Scheme}).Debug("selecting MQ")
 	switch u.Scheme {
 	case "memory":
-		return NewMemoryMQ(), nil
+		queueOf, _, err := queueFuncFromURL(u)
+		if err != nil {
+			return nil, err
+		}
+		mq := NewMemoryMQ()
+		mq.queueOf = queueOf
+		return mq, nil
 	case "redis":
 		return NewRedisMQ(u)
 	case "bolt":
 		return NewBoltMQ(u)
+	case "sqlite":
+		return NewSQLiteMQ(u)
+	case "postgres":
+		return NewPostgresMQ(u)
 	}
 	if strings.HasPrefix(u.Scheme, "ironmq") {
 		return NewIronMQ(u), nil
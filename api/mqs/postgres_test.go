@@ -0,0 +1,73 @@
+package mqs
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/iron-io/functions/api/mqs/internal/mqtest"
+)
+
+const tmpPostgresMQ = "postgres://postgres@%v:15433/funcs?sslmode=disable"
+
+func preparePostgresMQTest(logf, fatalf func(string, ...interface{})) func() {
+	fmt.Println("initializing postgres for test")
+	tryRun(logf, "remove old postgres container", exec.Command("docker", "rm", "-f", "iron-postgres-mq-test"))
+	mustRun(fatalf, "start postgres container", exec.Command("docker", "run", "--name", "iron-postgres-mq-test", "-p", "15433:5432", "-d", "postgres"))
+
+	wait := 1 * time.Second
+	for {
+		db, err := sql.Open("postgres", fmt.Sprintf("postgres://postgres@%v:15433?sslmode=disable",
+			mqtest.GetContainerHostIP()))
+		if err == nil {
+			_, err = db.Exec(`CREATE DATABASE funcs;`)
+			db.Close()
+		}
+		if err == nil {
+			break
+		}
+		fmt.Println("failed to create database:", err)
+		fmt.Println("retrying in:", wait)
+		time.Sleep(wait)
+		wait = 2 * wait
+	}
+	fmt.Println("postgres for test ready")
+	return func() {
+		tryRun(logf, "stop postgres container", exec.Command("docker", "rm", "-f", "iron-postgres-mq-test"))
+	}
+}
+
+func TestPostgresMQ(t *testing.T) {
+	close := preparePostgresMQTest(t.Logf, t.Fatalf)
+	defer close()
+
+	u, err := url.Parse(fmt.Sprintf(tmpPostgresMQ, mqtest.GetContainerHostIP()))
+	if err != nil {
+		t.Fatalf("failed to parse url: %v", err)
+	}
+	mq, err := NewPostgresMQ(u)
+	if err != nil {
+		t.Fatalf("failed to create postgres mq: %v", err)
+	}
+	mqtest.Test(t, mq)
+}
+
+func tryRun(logf func(string, ...interface{}), desc string, cmd *exec.Cmd) {
+	var b bytes.Buffer
+	cmd.Stderr = &b
+	if err := cmd.Run(); err != nil {
+		logf("failed to %s: %s", desc, b.String())
+	}
+}
+
+func mustRun(fatalf func(string, ...interface{}), desc string, cmd *exec.Cmd) {
+	var b bytes.Buffer
+	cmd.Stderr = &b
+	if err := cmd.Run(); err != nil {
+		fatalf("failed to %s: %s", desc, b.String())
+	}
+}
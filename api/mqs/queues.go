@@ -0,0 +1,77 @@
+package mqs
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/iron-io/functions/api/models"
+)
+
+// queueFunc returns the queue a task is kept in within an MQ.
+type queueFunc func(*models.Task) string
+
+// queueByApp keeps a queue per app, named after it.
+func queueByApp(task *models.Task) string {
+	return task.AppName
+}
+
+// queueByRoute keeps a queue per route, named after its app and path.
+func queueByRoute(task *models.Task) string {
+	return task.AppName + task.Path
+}
+
+// queueFuncFromURL returns how the MQ at u partitions tasks, as its queue_by
+// parameter asks, and u without the parameter for the MQs which pass their
+// URL's parameters on to their driver.
+func queueFuncFromURL(u *url.URL) (queueFunc, *url.URL, error) {
+	q := u.Query()
+	by := q.Get("queue_by")
+	q.Del("queue_by")
+	c := *u
+	c.RawQuery = q.Encode()
+
+	switch by {
+	case "", "app":
+		return queueByApp, &c, nil
+	case "route":
+		return queueByRoute, &c, nil
+	}
+	return nil, nil, fmt.Errorf("invalid queue_by parameter %q, expected app or route", by)
+}
+
+// inApp returns whether queue holds tasks of app, app names not containing
+// slashes.
+func inApp(queue, app string) bool {
+	return queue == app || strings.HasPrefix(queue, app+"/")
+}
+
+// roundRobin orders queues in the turn they are reserved from after last,
+// the queue of the last task reserved: by name, starting after last.
+func roundRobin(queues []string, last string) []string {
+	sort.Strings(queues)
+	i := sort.SearchStrings(queues, last)
+	if i < len(queues) && queues[i] == last {
+		i++
+	}
+	return append(queues[i:len(queues):len(queues)], queues[:i]...)
+}
+
+// newQueueStats returns stats counting no task.
+func newQueueStats() *models.QueueStats {
+	return &models.QueueStats{Ready: make([]int64, 3)}
+}
+
+// observeOldest accounts for task, available to reserve, in the OldestAge of
+// stats, tasks submitted without a creation time being left out.
+func observeOldest(stats *models.QueueStats, task *models.Task) {
+	created := time.Time(task.CreatedAt)
+	if created.IsZero() {
+		return
+	}
+	if age := int64(time.Since(created) / time.Second); age > stats.OldestAge {
+		stats.OldestAge = age
+	}
+}
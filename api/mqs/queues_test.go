@@ -0,0 +1,60 @@
+package mqs
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/iron-io/functions/api/models"
+)
+
+func TestQueueFuncFromURL(t *testing.T) {
+	task := &models.Task{AppName: "myapp", Path: "/hello"}
+	for i, test := range []struct {
+		url      string
+		queue    string
+		stripped string
+		err      bool
+	}{
+		{"bolt:///tmp/mq.db", "myapp", "bolt:///tmp/mq.db", false},
+		{"redis://localhost:6379/?queue_by=app", "myapp", "redis://localhost:6379/", false},
+		{"postgres://localhost/funcs?queue_by=route&sslmode=disable", "myapp/hello", "postgres://localhost/funcs?sslmode=disable", false},
+		{"bolt:///tmp/mq.db?queue_by=image", "", "", true},
+	} {
+		u, err := url.Parse(test.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		queueOf, stripped, err := queueFuncFromURL(u)
+		if (err != nil) != test.err {
+			t.Errorf("Test %d: expected error %v, got %v", i, test.err, err)
+		}
+		if err != nil {
+			continue
+		}
+		if queue := queueOf(task); queue != test.queue {
+			t.Errorf("Test %d: expected queue %q, got %q", i, test.queue, queue)
+		}
+		if stripped.String() != test.stripped {
+			t.Errorf("Test %d: expected url %q, got %q", i, test.stripped, stripped)
+		}
+	}
+}
+
+func TestRoundRobin(t *testing.T) {
+	for i, test := range []struct {
+		queues   []string
+		last     string
+		expected []string
+	}{
+		{[]string{"c", "a", "b"}, "", []string{"a", "b", "c"}},
+		{[]string{"c", "a", "b"}, "a", []string{"b", "c", "a"}},
+		{[]string{"c", "a", "b"}, "bb", []string{"c", "a", "b"}},
+		{[]string{"c", "a", "b"}, "c", []string{"a", "b", "c"}},
+		{nil, "a", nil},
+	} {
+		if queues := roundRobin(test.queues, test.last); !reflect.DeepEqual(queues, test.expected) {
+			t.Errorf("Test %d: expected %v, got %v", i, test.expected, queues)
+		}
+	}
+}
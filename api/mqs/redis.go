@@ -6,7 +6,9 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"sort"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/Sirupsen/logrus"
@@ -15,14 +17,25 @@ import (
 	"github.com/iron-io/runner/common"
 )
 
+// RedisMQ keeps the tasks of each queue in a list per priority, and the names
+// of the queues with tasks in a set.
 type RedisMQ struct {
 	pool      *redis.Pool
 	queueName string
 	ticker    *time.Ticker
 	prefix    string
+	queueOf   queueFunc
+
+	// Protects last, the queue of the last task reserved
+	mu   sync.Mutex
+	last string
 }
 
 func NewRedisMQ(url *url.URL) (*RedisMQ, error) {
+	queueOf, url, err := queueFuncFromURL(url)
+	if err != nil {
+		return nil, err
+	}
 
 	pool := &redis.Pool{
 		MaxIdle: 4,
@@ -47,13 +60,21 @@ func NewRedisMQ(url *url.URL) (*RedisMQ, error) {
 	conn.Close()
 
 	mq := &RedisMQ{
-		pool:   pool,
-		ticker: time.NewTicker(time.Second),
-		prefix: url.Path,
+		pool:    pool,
+		ticker:  time.NewTicker(time.Second),
+		prefix:  url.Path,
+		queueOf: queueOf,
 	}
 	mq.queueName = mq.k("queue")
 	logrus.WithFields(logrus.Fields{"name": mq.queueName}).Info("Redis initialized with queue name")
 
+	conn = pool.Get()
+	err = mq.queueUnqueuedTasks(conn)
+	conn.Close()
+	if err != nil {
+		return nil, err
+	}
+
 	mq.start()
 	return mq, nil
 }
@@ -62,6 +83,12 @@ func (mq *RedisMQ) k(s string) string {
 	return mq.prefix + s
 }
 
+// reservationScore orders reservations by the millisecond they time out at,
+// as tasks may time out within a second.
+func reservationScore(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
 func getFirstKeyValue(resp map[string]string) (string, string, error) {
 
 	for key, value := range resp {
@@ -86,7 +113,7 @@ func (mq *RedisMQ) processPendingReservations(conn redis.Conn) {
 	}
 
 	timeout, err := strconv.ParseInt(timeoutString, 10, 64)
-	if err != nil || timeout > time.Now().Unix() {
+	if err != nil || timeout > reservationScore(time.Now()) {
 		return
 	}
 	response, err := redis.Bytes(conn.Do("HGET", mq.k("timeout_jobs"), reservationId))
@@ -108,7 +135,7 @@ func (mq *RedisMQ) processPendingReservations(conn redis.Conn) {
 	conn.Do("ZREM", mq.k("timeouts"), reservationId)
 	conn.Do("HDEL", mq.k("timeout_jobs"), reservationId)
 	conn.Do("HDEL", mq.k("reservations"), job.ID)
-	redisPush(conn, mq.queueName, &job)
+	mq.push(conn, &job)
 }
 
 func (mq *RedisMQ) processDelayedTasks(conn redis.Conn) {
@@ -142,7 +169,7 @@ func (mq *RedisMQ) processDelayedTasks(conn redis.Conn) {
 			return
 		}
 
-		_, err = redisPush(conn, mq.queueName, &job)
+		_, err = mq.push(conn, &job)
 		if err != nil {
 			logrus.WithError(err).WithFields(logrus.Fields{"reservationId": resId}).Error("Pushing delayed job")
 			return
@@ -169,18 +196,64 @@ func (mq *RedisMQ) start() {
 	}()
 }
 
-func redisPush(conn redis.Conn, queue string, job *models.Task) (*models.Task, error) {
+// queueKey returns the key of the list of tasks of queue at priority.
+func (mq *RedisMQ) queueKey(queue string, priority int) string {
+	return fmt.Sprintf("%s:%s:%d", mq.queueName, queue, priority)
+}
+
+func (mq *RedisMQ) push(conn redis.Conn, job *models.Task) (*models.Task, error) {
 	buf, err := json.Marshal(job)
 	if err != nil {
 		return nil, err
 	}
-	_, err = conn.Do("LPUSH", fmt.Sprintf("%s%d", queue, *job.Priority), buf)
+	queue := mq.queueOf(job)
+	_, err = conn.Do("LPUSH", mq.queueKey(queue, int(*job.Priority)), buf)
+	if err != nil {
+		return nil, err
+	}
+	_, err = conn.Do("SADD", mq.k("queues"), queue)
 	if err != nil {
 		return nil, err
 	}
 	return job, nil
 }
 
+// queueUnqueuedTasks moves the tasks pushed before tasks were kept in a queue
+// per app into their queue, oldest first.
+func (mq *RedisMQ) queueUnqueuedTasks(conn redis.Conn) error {
+	for i := 2; i >= 0; i-- {
+		for {
+			buf, err := redis.Bytes(conn.Do("RPOP", fmt.Sprintf("%s%d", mq.queueName, i)))
+			if mq.checkNilResponse(err) {
+				break
+			} else if err != nil {
+				return err
+			}
+			var job models.Task
+			if err := json.Unmarshal(buf, &job); err != nil {
+				return err
+			}
+			if _, err := mq.push(conn, &job); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// queueLen returns the number of tasks ready to run in queue.
+func (mq *RedisMQ) queueLen(conn redis.Conn, queue string) (int64, error) {
+	var n int64
+	for i := 0; i < 3; i++ {
+		l, err := redis.Int64(conn.Do("LLEN", mq.queueKey(queue, i)))
+		if err != nil {
+			return 0, err
+		}
+		n += l
+	}
+	return n, nil
+}
+
 func (mq *RedisMQ) delayTask(conn redis.Conn, job *models.Task) (*models.Task, error) {
 	buf, err := json.Marshal(job)
 	if err != nil {
@@ -219,7 +292,7 @@ func (mq *RedisMQ) Push(ctx context.Context, job *models.Task) (*models.Task, er
 	if job.Delay > 0 {
 		return mq.delayTask(conn, job)
 	}
-	return redisPush(conn, mq.queueName, job)
+	return mq.push(conn, job)
 }
 func (mq *RedisMQ) checkNilResponse(err error) bool {
 	return err != nil && err.Error() == redis.ErrNil.Error()
@@ -231,30 +304,54 @@ func (mq *RedisMQ) Reserve(ctx context.Context) (*models.Task, error) {
 	conn := mq.pool.Get()
 	defer conn.Close()
 	var job models.Task
+
+	queues, err := redis.Strings(conn.Do("SMEMBERS", mq.k("queues")))
+	if err != nil {
+		return nil, err
+	}
+	mq.mu.Lock()
+	last := mq.last
+	mq.mu.Unlock()
+
 	var resp []byte
-	var err error
-	for i := 2; i >= 0; i-- {
-		resp, err = redis.Bytes(conn.Do("RPOP", fmt.Sprintf("%s%d", mq.queueName, i)))
-		if mq.checkNilResponse(err) {
-			if i == 0 {
-				// Out of queues!
-				return nil, nil
+	for _, queue := range roundRobin(queues, last) {
+		for i := 2; i >= 0; i-- {
+			resp, err = redis.Bytes(conn.Do("RPOP", mq.queueKey(queue, i)))
+			if mq.checkNilResponse(err) {
+				// No valid job on this queue, try lower priority queue.
+				continue
+			} else if err != nil {
+				// Some other error!
+				return nil, err
 			}
 
-			// No valid job on this queue, try lower priority queue.
-			continue
-		} else if err != nil {
-			// Some other error!
-			return nil, err
+			// We got a valid high priority job.
+			break
+		}
+		if resp != nil {
+			mq.mu.Lock()
+			mq.last = queue
+			mq.mu.Unlock()
+			break
 		}
 
-		// We got a valid high priority job.
-		break
+		// Forget the empty queue, unless a task was pushed to it meanwhile.
+		if _, err := conn.Do("SREM", mq.k("queues"), queue); err != nil {
+			return nil, err
+		}
+		if n, err := mq.queueLen(conn, queue); err != nil {
+			return nil, err
+		} else if n > 0 {
+			if _, err := conn.Do("SADD", mq.k("queues"), queue); err != nil {
+				return nil, err
+			}
+		}
 	}
-
-	if err != nil {
-		return nil, err
+	if resp == nil {
+		// Out of queues!
+		return nil, nil
 	}
+
 	err = json.Unmarshal(resp, &job)
 	if err != nil {
 		return nil, err
@@ -265,17 +362,17 @@ func (mq *RedisMQ) Reserve(ctx context.Context) (*models.Task, error) {
 		return nil, err
 	}
 	reservationId := strconv.FormatInt(response, 10)
-	_, err = conn.Do("ZADD", "timeout:", time.Now().Add(time.Minute).Unix(), reservationId)
+	_, err = conn.Do("ZADD", mq.k("timeouts"), reservationScore(time.Now().Add(models.ReservationTimeout(&job))), reservationId)
 	if err != nil {
 		return nil, err
 	}
-	_, err = conn.Do("HSET", "timeout", reservationId, resp)
+	_, err = conn.Do("HSET", mq.k("timeout_jobs"), reservationId, resp)
 	if err != nil {
 		return nil, err
 	}
 
 	// Map from job.ID -> reservation ID
-	_, err = conn.Do("HSET", "reservations", job.ID, reservationId)
+	_, err = conn.Do("HSET", mq.k("reservations"), job.ID, reservationId)
 	if err != nil {
 		return nil, err
 	}
@@ -292,18 +389,195 @@ func (mq *RedisMQ) Delete(ctx context.Context, job *models.Task) error {
 
 	conn := mq.pool.Get()
 	defer conn.Close()
-	resId, err := conn.Do("HGET", "reservations", job.ID)
-	if err != nil {
+	resId, err := redis.String(conn.Do("HGET", mq.k("reservations"), job.ID))
+	if mq.checkNilResponse(err) {
+		return errors.New("Not reserved")
+	} else if err != nil {
 		return err
 	}
-	_, err = conn.Do("HDEL", "reservations", job.ID)
+	_, err = conn.Do("HDEL", mq.k("reservations"), job.ID)
 	if err != nil {
 		return err
 	}
-	_, err = conn.Do("ZREM", "timeout:", resId)
+	_, err = conn.Do("ZREM", mq.k("timeouts"), resId)
 	if err != nil {
 		return err
 	}
-	_, err = conn.Do("HDEL", "timeout", resId)
+	_, err = conn.Do("HDEL", mq.k("timeout_jobs"), resId)
 	return err
 }
+
+func (mq *RedisMQ) Touch(ctx context.Context, job *models.Task) error {
+	_, log := common.LoggerWithFields(ctx, logrus.Fields{"call_id": job.ID})
+
+	conn := mq.pool.Get()
+	defer conn.Close()
+	resId, err := redis.String(conn.Do("HGET", mq.k("reservations"), job.ID))
+	if mq.checkNilResponse(err) {
+		return errors.New("Not reserved")
+	} else if err != nil {
+		return err
+	}
+	_, err = conn.Do("ZADD", mq.k("timeouts"), "XX", reservationScore(time.Now().Add(models.ReservationTimeout(job))), resId)
+	if err != nil {
+		return err
+	}
+	log.Println("Touched")
+	return nil
+}
+
+func (mq *RedisMQ) Depth(ctx context.Context, appName string) (int64, error) {
+	conn := mq.pool.Get()
+	defer conn.Close()
+
+	queues, err := redis.Strings(conn.Do("SMEMBERS", mq.k("queues")))
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	for _, queue := range queues {
+		if inApp(queue, appName) {
+			l, err := mq.queueLen(conn, queue)
+			if err != nil {
+				return 0, err
+			}
+			n += l
+		}
+	}
+	return n, nil
+}
+
+// appQueues returns the names of the queues of the app, in order.
+func (mq *RedisMQ) appQueues(conn redis.Conn, appName string) ([]string, error) {
+	queues, err := redis.Strings(conn.Do("SMEMBERS", mq.k("queues")))
+	if err != nil {
+		return nil, err
+	}
+	var appQueues []string
+	for _, queue := range queues {
+		if inApp(queue, appName) {
+			appQueues = append(appQueues, queue)
+		}
+	}
+	sort.Strings(appQueues)
+	return appQueues, nil
+}
+
+func (mq *RedisMQ) Stats(ctx context.Context) (*models.QueueStats, error) {
+	conn := mq.pool.Get()
+	defer conn.Close()
+
+	queues, err := redis.Strings(conn.Do("SMEMBERS", mq.k("queues")))
+	if err != nil {
+		return nil, err
+	}
+	stats := newQueueStats()
+	for _, queue := range queues {
+		for i := 0; i < 3; i++ {
+			l, err := redis.Int64(conn.Do("LLEN", mq.queueKey(queue, i)))
+			if err != nil {
+				return nil, err
+			}
+			stats.Ready[i] += l
+
+			// tasks are popped from the tail of the list
+			head, err := redis.Bytes(conn.Do("LINDEX", mq.queueKey(queue, i), -1))
+			if mq.checkNilResponse(err) {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			var job models.Task
+			if err := json.Unmarshal(head, &job); err != nil {
+				return nil, err
+			}
+			observeOldest(stats, &job)
+		}
+	}
+	if stats.Delayed, err = redis.Int64(conn.Do("ZCARD", mq.k("delays"))); err != nil {
+		return nil, err
+	}
+	if stats.Reserved, err = redis.Int64(conn.Do("HLEN", mq.k("reservations"))); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+func (mq *RedisMQ) Peek(ctx context.Context, appName string, n int) ([]*models.Task, error) {
+	conn := mq.pool.Get()
+	defer conn.Close()
+
+	queues, err := mq.appQueues(conn, appName)
+	if err != nil {
+		return nil, err
+	}
+	var tasks []*models.Task
+	for i := 2; i >= 0; i-- {
+		for _, queue := range queues {
+			if len(tasks) >= n {
+				return tasks, nil
+			}
+			// the oldest tasks are at the tail of the list
+			bufs, err := redis.ByteSlices(conn.Do("LRANGE", mq.queueKey(queue, i), -(n - len(tasks)), -1))
+			if err != nil {
+				return nil, err
+			}
+			for j := len(bufs) - 1; j >= 0; j-- {
+				var job models.Task
+				if err := json.Unmarshal(bufs[j], &job); err != nil {
+					return nil, err
+				}
+				tasks = append(tasks, &job)
+			}
+		}
+	}
+	return tasks, nil
+}
+
+func (mq *RedisMQ) Purge(ctx context.Context, appName string) (int64, error) {
+	conn := mq.pool.Get()
+	defer conn.Close()
+
+	queues, err := mq.appQueues(conn, appName)
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	for _, queue := range queues {
+		for i := 0; i < 3; i++ {
+			l, err := redis.Int64(conn.Do("LLEN", mq.queueKey(queue, i)))
+			if err != nil {
+				return n, err
+			}
+			if _, err := conn.Do("DEL", mq.queueKey(queue, i)); err != nil {
+				return n, err
+			}
+			n += l
+		}
+		if _, err := conn.Do("SREM", mq.k("queues"), queue); err != nil {
+			return n, err
+		}
+	}
+
+	delayed, err := redis.StringMap(conn.Do("HGETALL", mq.k("delayed_jobs")))
+	if err != nil {
+		return n, err
+	}
+	for resId, buf := range delayed {
+		var job models.Task
+		if err := json.Unmarshal([]byte(buf), &job); err != nil {
+			return n, err
+		}
+		if !inApp(mq.queueOf(&job), appName) {
+			continue
+		}
+		if _, err := conn.Do("HDEL", mq.k("delayed_jobs"), resId); err != nil {
+			return n, err
+		}
+		if _, err := conn.Do("ZREM", mq.k("delays"), resId); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,58 @@
+package mqs
+
+import (
+	"fmt"
+	"net/url"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/iron-io/functions/api/mqs/internal/mqtest"
+)
+
+const tmpRedisMQ = "redis://%v:6302/"
+
+func prepareRedisMQTest(logf, fatalf func(string, ...interface{})) func() {
+	fmt.Println("initializing redis for test")
+	tryRun(logf, "remove old redis container", exec.Command("docker", "rm", "-f", "iron-redis-mq-test"))
+	mustRun(fatalf, "start redis container", exec.Command("docker", "run", "--name", "iron-redis-mq-test", "-p", "6302:6379", "-d", "redis"))
+	timeout := time.After(20 * time.Second)
+
+	for {
+		c, err := redis.DialURL(fmt.Sprintf(tmpRedisMQ, mqtest.GetContainerHostIP()))
+		if err == nil {
+			_, err = c.Do("PING")
+			c.Close()
+			if err == nil {
+				break
+			}
+		}
+		fmt.Println("failed to PING redis:", err)
+		select {
+		case <-timeout:
+			fatalf("timed out waiting for redis")
+		case <-time.After(500 * time.Millisecond):
+			continue
+		}
+	}
+	fmt.Println("redis for test ready")
+	return func() {
+		tryRun(logf, "stop redis container", exec.Command("docker", "rm", "-f", "iron-redis-mq-test"))
+	}
+}
+
+func TestRedisMQ(t *testing.T) {
+	close := prepareRedisMQTest(t.Logf, t.Fatalf)
+	defer close()
+
+	u, err := url.Parse(fmt.Sprintf(tmpRedisMQ, mqtest.GetContainerHostIP()))
+	if err != nil {
+		t.Fatalf("failed to parse url: %v", err)
+	}
+	mq, err := NewRedisMQ(u)
+	if err != nil {
+		t.Fatalf("failed to create redis mq: %v", err)
+	}
+	mqtest.Test(t, mq)
+}
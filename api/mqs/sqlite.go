@@ -0,0 +1,265 @@
+package mqs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/iron-io/functions/api/datastore/sqlite"
+	"github.com/iron-io/functions/api/models"
+	"github.com/iron-io/runner/common"
+)
+
+// SQLiteMQ keeps every task in a single table. A task is available once its
+// delay elapsed and while it is not reserved, a reservation which timed out
+// making it available again at its former place in the queue.
+type SQLiteMQ struct {
+	db      *sql.DB
+	queueOf queueFunc
+
+	// Protects last, the queue of the last task reserved
+	mu   sync.Mutex
+	last string
+}
+
+const sqliteTasksTableCreate = `CREATE TABLE IF NOT EXISTS mq_tasks (
+	seq integer PRIMARY KEY AUTOINCREMENT,
+	id varchar(256) NOT NULL,
+	queue varchar(256) NOT NULL,
+	priority integer NOT NULL,
+	available_at bigint NOT NULL,
+	reserved_until bigint,
+	task text NOT NULL
+);`
+
+const sqliteTasksIndexCreate = `CREATE INDEX IF NOT EXISTS mq_tasks_queue_order ON mq_tasks (queue, priority DESC, seq);`
+
+func NewSQLiteMQ(url *url.URL) (*SQLiteMQ, error) {
+	queueOf, url, err := queueFuncFromURL(url)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sqlite.Open(url)
+	if err != nil {
+		return nil, err
+	}
+	for _, q := range []string{sqliteTasksTableCreate, sqliteTasksIndexCreate} {
+		if _, err := db.Exec(q); err != nil {
+			return nil, err
+		}
+	}
+	logrus.WithFields(logrus.Fields{"file": url.Path}).Debug("SQLite MQ initialized")
+	return &SQLiteMQ{db: db, queueOf: queueOf}, nil
+}
+
+func (mq *SQLiteMQ) Push(ctx context.Context, job *models.Task) (*models.Task, error) {
+	ctx, log := common.LoggerWithFields(ctx, logrus.Fields{"call_id": job.ID})
+	log.Println("Pushed to MQ")
+
+	buf, err := json.Marshal(job)
+	if err != nil {
+		return nil, err
+	}
+
+	availableAt := time.Now().Add(time.Duration(job.Delay) * time.Second)
+	_, err = mq.db.Exec(`INSERT INTO mq_tasks (id, queue, priority, available_at, task) VALUES (?, ?, ?, ?, ?)`,
+		job.ID, mq.queueOf(job), *job.Priority, availableAt.UnixNano(), string(buf))
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (mq *SQLiteMQ) Reserve(ctx context.Context) (*models.Task, error) {
+	tx, err := mq.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	mq.mu.Lock()
+	last := mq.last
+	mq.mu.Unlock()
+
+	// The queues after the last one reserved from come first, in turn.
+	now := time.Now().UnixNano()
+	var seq int64
+	var queue, buf string
+	err = tx.QueryRow(`SELECT seq, queue, task FROM mq_tasks
+		WHERE available_at <= ? AND (reserved_until IS NULL OR reserved_until <= ?)
+		ORDER BY queue <= ?, queue, priority DESC, seq LIMIT 1`, now, now, last).Scan(&seq, &queue, &buf)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var job models.Task
+	if err := json.Unmarshal([]byte(buf), &job); err != nil {
+		return nil, err
+	}
+
+	reservedUntil := time.Now().Add(models.ReservationTimeout(&job)).UnixNano()
+	if _, err := tx.Exec(`UPDATE mq_tasks SET reserved_until = ? WHERE seq = ?`, reservedUntil, seq); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	mq.mu.Lock()
+	mq.last = queue
+	mq.mu.Unlock()
+
+	_, log := common.LoggerWithFields(ctx, logrus.Fields{"call_id": job.ID})
+	log.Println("Reserved")
+	return &job, nil
+}
+
+func (mq *SQLiteMQ) Delete(ctx context.Context, job *models.Task) error {
+	_, log := common.LoggerWithFields(ctx, logrus.Fields{"call_id": job.ID})
+	defer log.Println("Deleted")
+
+	tx, err := mq.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`DELETE FROM mq_tasks WHERE id = ? AND reserved_until IS NOT NULL`, job.ID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		// Tasks which do not exist are deleted already, the others are not
+		// reserved.
+		err := tx.QueryRow(`SELECT 1 FROM mq_tasks WHERE id = ?`, job.ID).Scan(new(int))
+		if err == nil {
+			return errors.New("Not reserved")
+		} else if err != sql.ErrNoRows {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (mq *SQLiteMQ) Touch(ctx context.Context, job *models.Task) error {
+	_, log := common.LoggerWithFields(ctx, logrus.Fields{"call_id": job.ID})
+
+	now := time.Now()
+	res, err := mq.db.Exec(`UPDATE mq_tasks SET reserved_until = ? WHERE id = ? AND reserved_until > ?`,
+		now.Add(models.ReservationTimeout(job)).UnixNano(), job.ID, now.UnixNano())
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errors.New("Not reserved")
+	}
+	log.Println("Touched")
+	return nil
+}
+
+func (mq *SQLiteMQ) Depth(ctx context.Context, appName string) (int64, error) {
+	now := time.Now().UnixNano()
+	var n int64
+	err := mq.db.QueryRow(`SELECT COUNT(*) FROM mq_tasks
+		WHERE available_at <= ? AND (reserved_until IS NULL OR reserved_until <= ?)
+		AND (queue = ? OR substr(queue, 1, ?) = ?)`, now, now, appName, len(appName)+1, appName+"/").Scan(&n)
+	return n, err
+}
+
+func (mq *SQLiteMQ) Stats(ctx context.Context) (*models.QueueStats, error) {
+	now := time.Now().UnixNano()
+	stats := newQueueStats()
+
+	rows, err := mq.db.Query(`SELECT priority, COUNT(*) FROM mq_tasks
+		WHERE available_at <= ? AND (reserved_until IS NULL OR reserved_until <= ?)
+		GROUP BY priority`, now, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var priority int
+		var n int64
+		if err := rows.Scan(&priority, &n); err != nil {
+			return nil, err
+		}
+		if priority >= 0 && priority < len(stats.Ready) {
+			stats.Ready[priority] = n
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = mq.db.QueryRow(`SELECT COUNT(*) FROM mq_tasks WHERE available_at > ? AND reserved_until IS NULL`,
+		now).Scan(&stats.Delayed)
+	if err != nil {
+		return nil, err
+	}
+	err = mq.db.QueryRow(`SELECT COUNT(*) FROM mq_tasks WHERE reserved_until > ?`, now).Scan(&stats.Reserved)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf string
+	err = mq.db.QueryRow(`SELECT task FROM mq_tasks
+		WHERE available_at <= ? AND (reserved_until IS NULL OR reserved_until <= ?)
+		ORDER BY seq LIMIT 1`, now, now).Scan(&buf)
+	if err == sql.ErrNoRows {
+		return stats, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var job models.Task
+	if err := json.Unmarshal([]byte(buf), &job); err != nil {
+		return nil, err
+	}
+	observeOldest(stats, &job)
+	return stats, nil
+}
+
+func (mq *SQLiteMQ) Peek(ctx context.Context, appName string, n int) ([]*models.Task, error) {
+	now := time.Now().UnixNano()
+	rows, err := mq.db.Query(`SELECT task FROM mq_tasks
+		WHERE available_at <= ? AND (reserved_until IS NULL OR reserved_until <= ?)
+		AND (queue = ? OR substr(queue, 1, ?) = ?)
+		ORDER BY priority DESC, queue, seq LIMIT ?`, now, now, appName, len(appName)+1, appName+"/", n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []*models.Task
+	for rows.Next() {
+		var buf string
+		if err := rows.Scan(&buf); err != nil {
+			return nil, err
+		}
+		var job models.Task
+		if err := json.Unmarshal([]byte(buf), &job); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, &job)
+	}
+	return tasks, rows.Err()
+}
+
+func (mq *SQLiteMQ) Purge(ctx context.Context, appName string) (int64, error) {
+	res, err := mq.db.Exec(`DELETE FROM mq_tasks
+		WHERE (reserved_until IS NULL OR reserved_until <= ?)
+		AND (queue = ? OR substr(queue, 1, ?) = ?)`, time.Now().UnixNano(), appName, len(appName)+1, appName+"/")
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
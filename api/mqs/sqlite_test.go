@@ -0,0 +1,25 @@
+package mqs
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/iron-io/functions/api/mqs/internal/mqtest"
+)
+
+func TestSQLiteMQ(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqlite_mq_test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	mq, err := NewSQLiteMQ(&url.URL{Scheme: "sqlite", Path: filepath.Join(dir, "mq.db")})
+	if err != nil {
+		t.Fatalf("failed to create sqlite mq: %v", err)
+	}
+	mqtest.Test(t, mq)
+}
@@ -3,12 +3,14 @@ package runner
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -19,27 +21,116 @@ import (
 	"github.com/iron-io/runner/common"
 )
 
-func getTask(ctx context.Context, url string) (*models.Task, error) {
-	resp, err := http.Get(url)
+// TaskQueue hands async runners the tasks to run.
+type TaskQueue interface {
+	// Reserve returns up to n tasks, waiting up to wait for some to be
+	// queued if there are none.
+	Reserve(ctx context.Context, n int, wait time.Duration) ([]*models.Task, error)
+
+	// Delete acknowledges a task done.
+	Delete(context.Context, *models.Task) error
+
+	// Touch extends the reservation of a task still running.
+	Touch(context.Context, *models.Task) error
+}
+
+// httpTaskQueue reserves tasks from the /tasks endpoint of an API server,
+// long-polling it.
+type httpTaskQueue struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+// NewHTTPTaskQueue returns a TaskQueue for runners which do not share the
+// process of the API server at tasksrv. Runners authenticate with token, if
+// any, and the client certificates of tlsConfig, if any.
+func NewHTTPTaskQueue(tasksrv, token string, tlsConfig *tls.Config) TaskQueue {
+	client := &http.Client{}
+	if tlsConfig != nil {
+		client.Transport = &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		}
+	}
+	return &httpTaskQueue{url: tasksrvURL(tasksrv), token: token, client: client}
+}
+
+func (q *httpTaskQueue) Reserve(ctx context.Context, n int, wait time.Duration) ([]*models.Task, error) {
+	u, err := url.Parse(q.url)
 	if err != nil {
 		return nil, err
 	}
+	u.RawQuery = url.Values{"n": {strconv.Itoa(n)}, "wait": {wait.String()}}.Encode()
 
-	body, err := ioutil.ReadAll(resp.Body)
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	body, status, err := q.do(req.WithContext(ctx))
 	if err != nil {
 		return nil, err
 	}
 
-	var task models.Task
-
-	if err := json.Unmarshal(body, &task); err != nil {
+	var reserved struct {
+		Tasks []*models.Task `json:"tasks"`
+	}
+	if err := json.Unmarshal(body, &reserved); err != nil {
 		return nil, err
 	}
+	if status != http.StatusAccepted {
+		return nil, errors.New(string(body))
+	}
+	return reserved.Tasks, nil
+}
+
+// Delete acknowledges a task done.
+func (q *httpTaskQueue) Delete(ctx context.Context, task *models.Task) error {
+	return q.send(ctx, http.MethodDelete, task)
+}
+
+// Touch extends the reservation of a task still running.
+func (q *httpTaskQueue) Touch(ctx context.Context, task *models.Task) error {
+	return q.send(ctx, http.MethodPatch, task)
+}
 
-	if task.ID == "" {
-		return nil, nil
+func (q *httpTaskQueue) send(ctx context.Context, method string, task *models.Task) error {
+	// Unmarshal task to be sent over as a json
+	body, err := json.Marshal(task)
+	if err != nil {
+		return err
 	}
-	return &task, nil
+
+	req, err := http.NewRequest(method, q.url, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	body, status, err := q.do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	} else if status != http.StatusAccepted {
+		return errors.New(string(body))
+	}
+	return nil
+}
+
+// do sends req with the credentials of the runner, returning the body and
+// status of the response.
+func (q *httpTaskQueue) do(req *http.Request) ([]byte, int, error) {
+	if q.token != "" {
+		req.Header.Set("Authorization", "Bearer "+q.token)
+	}
+	resp, err := q.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+	return body, resp.StatusCode, nil
 }
 
 func getCfg(t *models.Task) *task.Config {
@@ -56,6 +147,7 @@ func getCfg(t *models.Task) *task.Config {
 		Timeout:     time.Duration(*t.Timeout) * time.Second,
 		IdleTimeout: time.Duration(*t.IdleTimeout) * time.Second,
 		ID:          t.ID,
+		Path:        t.Path,
 		AppName:     t.AppName,
 		Stdin:       strings.NewReader(t.Payload),
 		Env:         t.EnvVars,
@@ -63,92 +155,207 @@ func getCfg(t *models.Task) *task.Config {
 	return cfg
 }
 
-func deleteTask(url string, task *models.Task) error {
-	// Unmarshal task to be sent over as a json
-	body, err := json.Marshal(task)
-	if err != nil {
-		return err
-	}
-
-	// Send out Delete request to delete task from queue
-	req, err := http.NewRequest(http.MethodDelete, url, bytes.NewBuffer(body))
-	if err != nil {
-		return err
-	}
-	c := &http.Client{}
-	if resp, err := c.Do(req); err != nil {
-		return err
-	} else if resp.StatusCode != http.StatusAccepted {
-		body, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return err
+// heartbeat touches the reservation of task at half its timeout until done is
+// closed, so that tasks running longer than their reservation are not handed
+// out again.
+func heartbeat(ctx context.Context, queue TaskQueue, task *models.Task, done <-chan struct{}) {
+	_, log := common.LoggerWithFields(ctx, logrus.Fields{"call_id": task.ID})
+	ticker := time.NewTicker(models.ReservationTimeout(task) / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := queue.Touch(ctx, task); err != nil {
+				log.WithError(err).Error("Cannot touch task")
+			}
 		}
-		return errors.New(string(body))
 	}
-	return nil
 }
 
-// RunAsyncRunner pulls tasks off a queue and processes them
-func RunAsyncRunner(ctx context.Context, tasksrv string, tasks chan task.Request, rnr *Runner) {
-	u := tasksrvURL(tasksrv)
+// AsyncConfig tunes how async runners get their tasks.
+type AsyncConfig struct {
+	// Concurrency bounds the async tasks running at once, 0 leaving it to
+	// the memory available.
+	Concurrency int
+
+	// Batch is how many tasks are reserved at once.
+	Batch int
+
+	// Wait is how long a reservation waits for tasks to be queued.
+	Wait time.Duration
+
+	// MaxBackoff bounds how long runners back off after failing to reserve
+	// tasks.
+	MaxBackoff time.Duration
+}
+
+var DefaultAsyncConfig = AsyncConfig{
+	Batch:      1,
+	Wait:       20 * time.Second,
+	MaxBackoff: 30 * time.Second,
+}
+
+const minBackoff = 100 * time.Millisecond
 
-	startAsyncRunners(ctx, u, tasks, rnr)
+// RunAsyncRunner pulls tasks off a queue and processes them
+func RunAsyncRunner(ctx context.Context, queue TaskQueue, cfg AsyncConfig, tasks chan task.Request, rnr *Runner) {
+	startAsyncRunners(ctx, queue, cfg, tasks, rnr)
 	<-ctx.Done()
 }
 
-func startAsyncRunners(ctx context.Context, url string, tasks chan task.Request, rnr *Runner) {
+func startAsyncRunners(ctx context.Context, queue TaskQueue, cfg AsyncConfig, tasks chan task.Request, rnr *Runner) {
 	var wg sync.WaitGroup
 	ctx, log := common.LoggerWithFields(ctx, logrus.Fields{"runner": "async"})
+
+	if cfg.Batch <= 0 {
+		cfg.Batch = 1
+	}
+	if cfg.MaxBackoff < minBackoff {
+		cfg.MaxBackoff = minBackoff
+	}
+	// slots holds a token per task running, when their number is bounded
+	var slots chan struct{}
+	if cfg.Concurrency > 0 {
+		slots = make(chan struct{}, cfg.Concurrency)
+	}
+	var backoff time.Duration
+
 	for {
-		select {
-		case <-ctx.Done():
+		if backoff > 0 {
+			sleep(ctx, backoff)
+		}
+		if ctx.Err() != nil {
 			wg.Wait()
 			return
+		}
 
-		default:
-			if !rnr.hasAsyncAvailableMemory() {
-				log.Debug("memory full")
-				time.Sleep(1 * time.Second)
+		if !rnr.hasAsyncAvailableMemory() {
+			log.Debug("memory full")
+			sleep(ctx, 1*time.Second)
+			continue
+		}
+		n := acquire(ctx, slots, cfg.Batch)
+		if n == 0 {
+			continue
+		}
+
+		start := time.Now()
+		reserved, err := queue.Reserve(ctx, n, cfg.Wait)
+		release(slots, n-len(reserved))
+		if err != nil {
+			if ctx.Err() != nil {
 				continue
 			}
-			task, err := getTask(ctx, url)
-			if err != nil {
-				if err, ok := err.(net.Error); ok && err.Timeout() {
-					log.WithError(err).Errorln("Could not fetch task, timeout.")
-					continue
-				}
-				log.WithError(err).Error("Could not fetch task")
-				time.Sleep(1 * time.Second)
+			backoff = nextBackoff(backoff, cfg.MaxBackoff)
+			if err, ok := err.(net.Error); ok && err.Timeout() {
+				log.WithError(err).Errorln("Could not fetch task, timeout.")
 				continue
 			}
-			if task == nil {
-				time.Sleep(1 * time.Second)
-				continue
+			log.WithError(err).Error("Could not fetch task")
+			continue
+		}
+		if len(reserved) == 0 {
+			// Queues answering right away instead of waiting for tasks
+			// are not polled in a tight loop.
+			if time.Since(start) < cfg.Wait {
+				backoff = nextBackoff(backoff, cfg.MaxBackoff)
+			} else {
+				backoff = 0
 			}
+			continue
+		}
+		backoff = 0
 
+		for _, task := range reserved {
 			ctx, log := common.LoggerWithFields(ctx, logrus.Fields{"call_id": task.ID})
 			log.Debug("Running task:", task.ID)
 
 			wg.Add(1)
-			go func() {
+			go func(task *models.Task) {
 				defer wg.Done()
+				defer release(slots, 1)
+				cfg := getCfg(task)
+				done := make(chan struct{})
+				go heartbeat(ctx, queue, task, done)
+
 				// Process Task
-				if _, err := RunTask(tasks, ctx, getCfg(task)); err != nil {
+				_, _, err := RunTask(tasks, ctx, cfg)
+				close(done)
+				if err != nil {
 					log.WithError(err).Error("Cannot run task")
 				}
-			}()
+				if ctx.Err() != nil {
+					// Interrupted by a shutdown, the reservation times out and
+					// another runner picks the task up.
+					return
+				}
 
-			log.Debug("Processed task")
+				// Delete task from queue only once it ran, so that the tasks
+				// of runners which crashed are redelivered.
+				if err := queue.Delete(ctx, task); err != nil {
+					log.WithError(err).Error("Cannot delete task")
+					return
+				}
+				log.Info("Task complete")
+			}(task)
 
-			// Delete task from queue
-			if err := deleteTask(url, task); err != nil {
-				log.WithError(err).Error("Cannot delete task")
-				continue
-			}
-			log.Info("Task complete")
+			log.Debug("Started task")
+		}
+	}
+}
 
+// acquire takes up to n slots, waiting for the first one, and returns how
+// many it took. Without slots, it takes n right away.
+func acquire(ctx context.Context, slots chan struct{}, n int) int {
+	if slots == nil {
+		return n
+	}
+	select {
+	case slots <- struct{}{}:
+	case <-ctx.Done():
+		return 0
+	}
+	for i := 1; i < n; i++ {
+		select {
+		case slots <- struct{}{}:
+		default:
+			return i
 		}
 	}
+	return n
+}
+
+// release gives back n slots taken by acquire.
+func release(slots chan struct{}, n int) {
+	if slots == nil {
+		return
+	}
+	for i := 0; i < n; i++ {
+		<-slots
+	}
+}
+
+func nextBackoff(backoff, max time.Duration) time.Duration {
+	backoff *= 2
+	if backoff < minBackoff {
+		backoff = minBackoff
+	}
+	if backoff > max {
+		backoff = max
+	}
+	return backoff
+}
+
+// sleep waits for d, or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
 }
 
 func tasksrvURL(tasksrv string) string {
@@ -4,12 +4,15 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"math/rand"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
@@ -37,6 +40,7 @@ func getMockTask() models.Task {
 	task.Image = &image
 	task.ID = fmt.Sprintf("ID-%d", rand.Int31()%1000)
 	task.AppName = fmt.Sprintf("RouteName-%d", rand.Int31()%1000)
+	task.Path = "/hello"
 	task.Priority = &priority
 	return *task
 }
@@ -54,40 +58,51 @@ func getTestServer(mockTasks []*models.Task) *httptest.Server {
 	}
 
 	getHandler := func(c *gin.Context) {
-		task, err := mq.Reserve(ctx)
-		if err != nil {
-			logrus.WithError(err)
-			c.JSON(http.StatusInternalServerError, err)
-			return
+		n, _ := strconv.Atoi(c.Query("n"))
+		tasks := []*models.Task{}
+		for len(tasks) < n {
+			task, err := mq.Reserve(ctx)
+			if err != nil {
+				logrus.WithError(err)
+				c.JSON(http.StatusInternalServerError, err)
+				return
+			}
+			if task == nil {
+				break
+			}
+			tasks = append(tasks, task)
 		}
-		c.JSON(http.StatusAccepted, task)
+		c.JSON(http.StatusAccepted, gin.H{"tasks": tasks})
 	}
 
-	delHandler := func(c *gin.Context) {
-		body, err := ioutil.ReadAll(c.Request.Body)
-		if err != nil {
-			logrus.WithError(err)
-			c.JSON(http.StatusInternalServerError, err.Error())
-			return
-		}
-		var task models.Task
-		if err = json.Unmarshal(body, &task); err != nil {
-			logrus.WithError(err)
-			c.JSON(http.StatusInternalServerError, err.Error())
-			return
-		}
+	taskHandler := func(op func(context.Context, *models.Task) error) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			body, err := ioutil.ReadAll(c.Request.Body)
+			if err != nil {
+				logrus.WithError(err)
+				c.JSON(http.StatusInternalServerError, err.Error())
+				return
+			}
+			var task models.Task
+			if err = json.Unmarshal(body, &task); err != nil {
+				logrus.WithError(err)
+				c.JSON(http.StatusInternalServerError, err.Error())
+				return
+			}
 
-		if err := mq.Delete(ctx, &task); err != nil {
-			logrus.WithError(err)
-			c.JSON(http.StatusInternalServerError, err.Error())
-			return
+			if err := op(ctx, &task); err != nil {
+				logrus.WithError(err)
+				c.JSON(http.StatusInternalServerError, err.Error())
+				return
+			}
+			c.JSON(http.StatusAccepted, task)
 		}
-		c.JSON(http.StatusAccepted, task)
 	}
 
 	r := gin.Default()
 	r.GET("/tasks", getHandler)
-	r.DELETE("/tasks", delHandler)
+	r.DELETE("/tasks", taskHandler(mq.Delete))
+	r.PATCH("/tasks", taskHandler(mq.Touch))
 	return httptest.NewServer(r)
 }
 
@@ -98,15 +113,19 @@ func TestGetTask(t *testing.T) {
 	ts := getTestServer([]*models.Task{&mockTask})
 	defer ts.Close()
 
-	url := ts.URL + "/tasks"
-	task, err := getTask(context.Background(), url)
+	q := NewHTTPTaskQueue(ts.URL+"/tasks", "", nil)
+	tasks, err := q.Reserve(context.Background(), 2, 0)
 	if err != nil {
 		t.Log(buf.String())
 		t.Error("expected no error, got", err)
 	}
-	if task.ID != mockTask.ID {
+	if len(tasks) != 1 {
 		t.Log(buf.String())
-		t.Errorf("expected task ID '%s', got '%s'", task.ID, mockTask.ID)
+		t.Fatalf("expected 1 task, got %d", len(tasks))
+	}
+	if tasks[0].ID != mockTask.ID {
+		t.Log(buf.String())
+		t.Errorf("expected task ID '%s', got '%s'", tasks[0].ID, mockTask.ID)
 	}
 }
 
@@ -131,8 +150,8 @@ func TestGetTaskError(t *testing.T) {
 	defer ts.Close()
 
 	for i, test := range tests {
-		url := ts.URL + test["url"].(string)
-		_, err := getTask(context.Background(), url)
+		q := NewHTTPTaskQueue(ts.URL+test["url"].(string), "", nil)
+		_, err := q.Reserve(context.Background(), 1, 0)
 		if err == nil {
 			t.Log(buf.String())
 			t.Errorf("expected error '%s'", test["error"].(string))
@@ -151,26 +170,68 @@ func TestDeleteTask(t *testing.T) {
 	ts := getTestServer([]*models.Task{&mockTask})
 	defer ts.Close()
 
-	url := ts.URL + "/tasks"
-	err := deleteTask(url, &mockTask)
+	q := NewHTTPTaskQueue(ts.URL+"/tasks", "", nil)
+	err := q.Delete(context.Background(), &mockTask)
 	if err == nil {
 		t.Log(buf.String())
 		t.Error("expected error 'Not reserver', got", err)
 	}
 
-	_, err = getTask(context.Background(), url)
+	_, err = q.Reserve(context.Background(), 1, 0)
 	if err != nil {
 		t.Log(buf.String())
 		t.Error("expected no error, got", err)
 	}
 
-	err = deleteTask(url, &mockTask)
+	err = q.Delete(context.Background(), &mockTask)
 	if err != nil {
 		t.Log(buf.String())
 		t.Error("expected no error, got", err)
 	}
 }
 
+func TestTouchTask(t *testing.T) {
+	buf := setLogBuffer()
+	mockTask := getMockTask()
+
+	ts := getTestServer([]*models.Task{&mockTask})
+	defer ts.Close()
+
+	q := NewHTTPTaskQueue(ts.URL+"/tasks", "", nil)
+	if err := q.Touch(context.Background(), &mockTask); err == nil {
+		t.Log(buf.String())
+		t.Error("expected error 'Not reserved', got", err)
+	}
+
+	if _, err := q.Reserve(context.Background(), 1, 0); err != nil {
+		t.Log(buf.String())
+		t.Error("expected no error, got", err)
+	}
+
+	if err := q.Touch(context.Background(), &mockTask); err != nil {
+		t.Log(buf.String())
+		t.Error("expected no error, got", err)
+	}
+}
+
+func TestHTTPTaskQueueToken(t *testing.T) {
+	var auth string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error":{"message":"Invalid runner credentials"}}`))
+	}))
+	defer ts.Close()
+
+	q := NewHTTPTaskQueue(ts.URL, "secret", nil)
+	if _, err := q.Reserve(context.Background(), 1, 0); err == nil {
+		t.Error("expected an error reserving tasks unauthorized")
+	}
+	if auth != "Bearer secret" {
+		t.Errorf("expected the runner token to be presented, got `%s`", auth)
+	}
+}
+
 func TestTasksrvURL(t *testing.T) {
 	tests := []struct {
 		in, out string
@@ -220,10 +281,151 @@ func TestAsyncRunnersGracefulShutdown(t *testing.T) {
 
 	rnr, cancel := testRunner(t)
 	defer cancel()
-	startAsyncRunners(ctx, ts.URL+"/tasks", tasks, rnr)
+	startAsyncRunners(ctx, NewHTTPTaskQueue(ts.URL, "", nil), DefaultAsyncConfig, tasks, rnr)
 
 	if err := ctx.Err(); err != context.DeadlineExceeded {
 		t.Log(buf.String())
 		t.Errorf("async runners stopped unexpectedly. context error: %v", err)
 	}
 }
+
+// fakeTaskQueue hands out count tasks, recording how many were asked for and
+// deleted.
+type fakeTaskQueue struct {
+	mu       sync.Mutex
+	count    int
+	err      error
+	reserves int
+	maxBatch int
+	deleted  int
+}
+
+func (q *fakeTaskQueue) Reserve(ctx context.Context, n int, wait time.Duration) ([]*models.Task, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.reserves++
+	if q.err != nil {
+		return nil, q.err
+	}
+	if n > q.maxBatch {
+		q.maxBatch = n
+	}
+	var tasks []*models.Task
+	for ; q.count > 0 && len(tasks) < n; q.count-- {
+		task := getMockTask()
+		tasks = append(tasks, &task)
+	}
+	return tasks, nil
+}
+
+func (q *fakeTaskQueue) Delete(ctx context.Context, task *models.Task) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.deleted++
+	return nil
+}
+
+func (q *fakeTaskQueue) Touch(ctx context.Context, task *models.Task) error {
+	return nil
+}
+
+func TestAsyncRunnersConcurrency(t *testing.T) {
+	buf := setLogBuffer()
+
+	tasks := make(chan task.Request)
+	defer close(tasks)
+	var mu sync.Mutex
+	var running, maxRunning int
+	go func() {
+		for t := range tasks {
+			mu.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mu.Unlock()
+			go func(t task.Request) {
+				time.Sleep(50 * time.Millisecond)
+				mu.Lock()
+				running--
+				mu.Unlock()
+				t.Response <- task.Response{}
+			}(t)
+		}
+	}()
+
+	rnr, cancel := testRunner(t)
+	defer cancel()
+	queue := &fakeTaskQueue{count: 10}
+	ctx, stop := context.WithTimeout(context.Background(), 2*time.Second)
+	defer stop()
+	startAsyncRunners(ctx, queue, AsyncConfig{Concurrency: 3, Batch: 5, Wait: time.Second}, tasks, rnr)
+
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	if queue.deleted != 10 {
+		t.Log(buf.String())
+		t.Errorf("expected the 10 tasks to be deleted, got %d", queue.deleted)
+	}
+	if queue.maxBatch != 3 {
+		t.Log(buf.String())
+		t.Errorf("expected batches of up to 3 tasks with 3 slots, got %d", queue.maxBatch)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if maxRunning > 3 {
+		t.Log(buf.String())
+		t.Errorf("expected at most 3 tasks running at once, got %d", maxRunning)
+	}
+}
+
+func TestAsyncRunnersStats(t *testing.T) {
+	buf := setLogBuffer()
+
+	rnr, cancel := testRunner(t)
+	defer cancel()
+
+	// Tasks are observed with their config, as the workers do.
+	tasks := make(chan task.Request)
+	defer close(tasks)
+	go func() {
+		for t := range tasks {
+			rnr.Observe(t.Config.AppName, t.Config.Path, t.Config.Target, "success", time.Millisecond)
+			t.Response <- task.Response{}
+		}
+	}()
+
+	mockTask := getMockTask()
+	ts := getTestServer([]*models.Task{&mockTask})
+	defer ts.Close()
+	ctx, stop := context.WithTimeout(context.Background(), time.Second)
+	defer stop()
+	startAsyncRunners(ctx, NewHTTPTaskQueue(ts.URL, "", nil), AsyncConfig{Batch: 1, Wait: 100 * time.Millisecond}, tasks, rnr)
+
+	if st := rnr.RouteStats(mockTask.AppName, "/hello"); st.Requests != 1 {
+		t.Log(buf.String())
+		t.Errorf("expected the async call to be counted under its route, got %d requests", st.Requests)
+	}
+}
+
+func TestAsyncRunnersBackoff(t *testing.T) {
+	buf := setLogBuffer()
+
+	tasks := make(chan task.Request)
+	defer close(tasks)
+
+	rnr, cancel := testRunner(t)
+	defer cancel()
+	queue := &fakeTaskQueue{err: errors.New("unavailable")}
+	ctx, stop := context.WithTimeout(context.Background(), time.Second)
+	defer stop()
+	startAsyncRunners(ctx, queue, AsyncConfig{Batch: 1, Wait: time.Second, MaxBackoff: time.Second}, tasks, rnr)
+
+	// 100ms, 200ms, 400ms then 800ms apart
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	if queue.reserves > 5 {
+		t.Log(buf.String())
+		t.Errorf("expected runners to back off after errors, got %d reservations in 1s", queue.reserves)
+	}
+}
@@ -117,6 +117,16 @@ func (r *Runner) handleTask(task *containerTask) {
 	task.canRun <- true
 }
 
+// Stats returns the calls counts of the runner, along with its memory.
+func (r *Runner) Stats() Stats {
+	stats := r.stats.Stats()
+	r.usedMemMutex.RLock()
+	stats.Memory = r.availableMem
+	stats.MemoryUsed = r.usedMem
+	r.usedMemMutex.RUnlock()
+	return stats
+}
+
 func (r *Runner) hasAsyncAvailableMemory() bool {
 	r.usedMemMutex.RLock()
 	defer r.usedMemMutex.RUnlock()
@@ -155,6 +165,13 @@ func (r *Runner) checkMemAndUse(req uint64) bool {
 }
 
 func (r *Runner) Run(ctx context.Context, cfg *task.Config) (drivers.RunResult, error) {
+	result, _, err := r.run(ctx, cfg)
+	return result, err
+}
+
+// run executes a task, also returning how long the container took to run,
+// which leaves out the time spent waiting for memory and preparing it.
+func (r *Runner) run(ctx context.Context, cfg *task.Config) (drivers.RunResult, time.Duration, error) {
 	var err error
 
 	if cfg.Memory == 0 {
@@ -184,13 +201,13 @@ func (r *Runner) Run(ctx context.Context, cfg *task.Config) (drivers.RunResult,
 		default:
 			// If queue is full, return error
 			r.mlog.LogCount(ctx, "queue.full", 1)
-			return nil, ErrFullQueue
+			return nil, 0, ErrFullQueue
 		}
 
 		// If task was added to the queue, wait for permission
 		if ok := <-ctask.canRun; !ok {
 			// This task timed out, not available memory
-			return nil, ErrTimeOutNoMemory
+			return nil, 0, ErrTimeOutNoMemory
 		}
 	} else {
 		r.mlog.LogTime(ctx, metricBaseName+"waittime", 0)
@@ -199,7 +216,7 @@ func (r *Runner) Run(ctx context.Context, cfg *task.Config) (drivers.RunResult,
 
 	cookie, err := r.driver.Prepare(ctx, ctask)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer cookie.Close()
 
@@ -207,7 +224,7 @@ func (r *Runner) Run(ctx context.Context, cfg *task.Config) (drivers.RunResult,
 
 	result, err := cookie.Run(ctx)
 	if err != nil {
-		return nil, err
+		return nil, time.Since(metricStart), err
 	}
 
 	if result.Status() == "success" {
@@ -220,7 +237,7 @@ func (r *Runner) Run(ctx context.Context, cfg *task.Config) (drivers.RunResult,
 	r.mlog.LogTime(ctx, metricBaseName+"time", metricElapsed)
 	r.mlog.LogTime(ctx, "run.exec_time", metricElapsed)
 
-	return result, nil
+	return result, metricElapsed, nil
 }
 
 func (r Runner) EnsureImageExists(ctx context.Context, cfg *task.Config) error {
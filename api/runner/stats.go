@@ -1,18 +1,60 @@
 package runner
 
-import "sync"
+import (
+	"sync"
+	"time"
+
+	"github.com/iron-io/functions/api/models"
+)
+
+// statsSlots is the number of one second slots kept for each function, ie,
+// per-function stats cover the last minute.
+const statsSlots = 60
 
 type stats struct {
 	mu       sync.Mutex
 	queue    uint64
 	running  uint64
 	complete uint64
+
+	fns   map[fnKey]*fnStats
+	swept int64
 }
 
 type Stats struct {
 	Queue    uint64
 	Running  uint64
 	Complete uint64
+
+	// Memory is the memory the runner can give functions, MemoryUsed the
+	// part of it in use, in bytes.
+	Memory     int64
+	MemoryUsed int64
+}
+
+// fnKey identifies a route, or one of its targets if the route splits its
+// traffic between targets.
+type fnKey struct {
+	app    string
+	path   string
+	target string
+}
+
+// fnStats is a ring of one second slots holding call outcomes of a single
+// route target, plus the number of hot containers currently serving it and
+// the second of its last call.
+type fnStats struct {
+	slots [statsSlots]statsSlot
+	hot   int64
+	last  int64
+}
+
+type statsSlot struct {
+	sec       int64
+	requests  uint64
+	errors    uint64
+	timeouts  uint64
+	histogram []uint64
 }
 
 func (s *stats) Enqueue() {
@@ -44,3 +86,148 @@ func (s *stats) Stats() Stats {
 	s.mu.Unlock()
 	return stats
 }
+
+// fn returns the stats of a route target, creating them if needed. Once per
+// window, it drops the stats of the route targets without hot containers
+// which had no call during the whole window, so that removed routes do not
+// pile up. Must be called with s.mu held.
+func (s *stats) fn(app, path, target string) *fnStats {
+	if s.fns == nil {
+		s.fns = make(map[fnKey]*fnStats)
+	}
+	if now := time.Now().Unix(); now-s.swept >= statsSlots {
+		for k, fs := range s.fns {
+			if fs.hot <= 0 && now-fs.last >= statsSlots {
+				delete(s.fns, k)
+			}
+		}
+		s.swept = now
+	}
+	k := fnKey{app, path, target}
+	fs, ok := s.fns[k]
+	if !ok {
+		fs = &fnStats{}
+		s.fns[k] = fs
+	}
+	return fs
+}
+
+// Observe records the outcome of a single call to a route target, target
+// being empty for routes without targets. status is the one reported by the
+// driver: "success", "timeout" or anything else for errors.
+func (s *stats) Observe(app, path, target, status string, elapsed time.Duration) {
+	now := time.Now().Unix()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fs := s.fn(app, path, target)
+	fs.last = now
+	slot := &fs.slots[now%statsSlots]
+	if slot.sec != now {
+		h := slot.histogram
+		for i := range h {
+			h[i] = 0
+		}
+		*slot = statsSlot{sec: now, histogram: h}
+	}
+	if slot.histogram == nil {
+		slot.histogram = make([]uint64, len(models.StatsLatencyBuckets)+1)
+	}
+
+	slot.requests++
+	switch status {
+	case "success":
+	case "timeout":
+		slot.timeouts++
+	default:
+		slot.errors++
+	}
+
+	i := 0
+	for i < len(models.StatsLatencyBuckets) && elapsed > models.StatsLatencyBuckets[i] {
+		i++
+	}
+	slot.histogram[i]++
+}
+
+// hotStarted and hotStopped keep track of the hot containers of a route
+// target.
+func (s *stats) hotStarted(app, path, target string) {
+	s.mu.Lock()
+	s.fn(app, path, target).hot++
+	s.mu.Unlock()
+}
+
+func (s *stats) hotStopped(app, path, target string) {
+	s.mu.Lock()
+	s.fn(app, path, target).hot--
+	s.mu.Unlock()
+}
+
+// AppStats returns the stats of all routes of an app over the last minute.
+func (s *stats) AppStats(app string) *models.Stats {
+	st := newModelStats(app, "")
+	now := time.Now().Unix()
+
+	s.mu.Lock()
+	for k, fs := range s.fns {
+		if k.app == app {
+			fs.addTo(st, now, "")
+		}
+	}
+	s.mu.Unlock()
+
+	st.Summarize()
+	return st
+}
+
+// RouteStats returns the stats of a single route over the last minute.
+func (s *stats) RouteStats(app, path string) *models.Stats {
+	st := newModelStats(app, path)
+	now := time.Now().Unix()
+
+	s.mu.Lock()
+	for k, fs := range s.fns {
+		if k.app == app && k.path == path {
+			fs.addTo(st, now, k.target)
+		}
+	}
+	s.mu.Unlock()
+
+	st.Summarize()
+	return st
+}
+
+func newModelStats(app, path string) *models.Stats {
+	return &models.Stats{
+		AppName:   app,
+		Path:      path,
+		Window:    statsSlots,
+		Histogram: make([]uint64, len(models.StatsLatencyBuckets)+1),
+	}
+}
+
+// addTo adds the calls of the last minute to st, and to the breakdown of
+// target in st unless target is empty.
+func (fs *fnStats) addTo(st *models.Stats, now int64, target string) {
+	st.HotContainers += fs.hot
+	for i := range fs.slots {
+		slot := &fs.slots[i]
+		if now-slot.sec >= statsSlots {
+			continue
+		}
+		st.Requests += slot.requests
+		st.Errors += slot.errors
+		st.Timeouts += slot.timeouts
+		for j, n := range slot.histogram {
+			st.Histogram[j] += n
+		}
+		if target != "" && slot.requests > 0 {
+			t := st.Target(target)
+			t.Requests += slot.requests
+			t.Errors += slot.errors
+			t.Timeouts += slot.timeouts
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package runner
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStatsObserve(t *testing.T) {
+	var s stats
+
+	s.Observe("myapp", "/a", "", "success", 3*time.Millisecond)
+	s.Observe("myapp", "/a", "", "success", 3*time.Millisecond)
+	s.Observe("myapp", "/a", "", "timeout", 2*time.Minute)
+	s.Observe("myapp", "/b", "", "error", 40*time.Millisecond)
+	s.Observe("otherapp", "/a", "", "success", time.Millisecond)
+	s.hotStarted("myapp", "/b", "")
+
+	route := s.RouteStats("myapp", "/a")
+	if route.Requests != 3 || route.Timeouts != 1 || route.Errors != 0 {
+		t.Fatalf("unexpected route counters: %+v", route)
+	}
+	if route.Latency.P50 != 5 || route.Latency.P99 != 60000 {
+		t.Errorf("unexpected route latency percentiles: %+v", route.Latency)
+	}
+
+	app := s.AppStats("myapp")
+	if app.Requests != 4 || app.Errors != 1 || app.HotContainers != 1 {
+		t.Fatalf("unexpected app counters: %+v", app)
+	}
+	if app.ErrorRate != 0.25 || app.TimeoutRate != 0.25 {
+		t.Errorf("unexpected app rates: %v %v", app.ErrorRate, app.TimeoutRate)
+	}
+
+	if empty := s.RouteStats("myapp", "/none"); empty.Requests != 0 || len(empty.Histogram) == 0 {
+		t.Errorf("unexpected stats for unknown route: %+v", empty)
+	}
+}
+
+func TestStatsTargets(t *testing.T) {
+	var s stats
+
+	s.Observe("myapp", "/a", "stable", "success", time.Millisecond)
+	s.Observe("myapp", "/a", "stable", "success", time.Millisecond)
+	s.Observe("myapp", "/a", "canary", "error", time.Millisecond)
+	s.Observe("myapp", "/a", "canary", "success", time.Millisecond)
+
+	route := s.RouteStats("myapp", "/a")
+	if route.Requests != 4 || route.Errors != 1 {
+		t.Fatalf("unexpected route counters: %+v", route)
+	}
+	if stable := route.Targets["stable"]; stable == nil || stable.Requests != 2 || stable.ErrorRate != 0 {
+		t.Errorf("unexpected stable target counters: %+v", stable)
+	}
+	if canary := route.Targets["canary"]; canary == nil || canary.Requests != 2 || canary.ErrorRate != 0.5 {
+		t.Errorf("unexpected canary target counters: %+v", canary)
+	}
+
+	if app := s.AppStats("myapp"); app.Requests != 4 || app.Targets != nil {
+		t.Errorf("unexpected app counters: %+v", app)
+	}
+}
+
+func TestStatsExpire(t *testing.T) {
+	var s stats
+
+	s.Observe("myapp", "/a", "", "success", time.Millisecond)
+	s.Observe("myapp", "/b", "", "success", time.Millisecond)
+	s.hotStarted("myapp", "/b", "")
+
+	// A window goes by without calls.
+	s.mu.Lock()
+	s.swept -= statsSlots
+	for _, fs := range s.fns {
+		fs.last -= statsSlots
+	}
+	s.mu.Unlock()
+	s.Observe("myapp", "/c", "", "success", time.Millisecond)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.fns[fnKey{"myapp", "/a", ""}]; ok {
+		t.Error("Expected the stats of idle route /a to be dropped")
+	}
+	if _, ok := s.fns[fnKey{"myapp", "/b", ""}]; !ok {
+		t.Error("Expected the stats of /b to be kept while it has hot containers")
+	}
+	if _, ok := s.fns[fnKey{"myapp", "/c", ""}]; !ok {
+		t.Error("Expected the stats of /c to be kept")
+	}
+}
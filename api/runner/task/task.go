@@ -20,6 +20,11 @@ type Config struct {
 	Format         string
 	MaxConcurrency int
 
+	// Target is the route target the task runs, if the route splits its
+	// traffic between targets. Targets of a route run in separate hot
+	// containers, since they may differ in config.
+	Target string
+
 	Stdin  io.Reader
 	Stdout io.Writer
 	Stderr io.Writer
@@ -38,4 +43,20 @@ type Request struct {
 type Response struct {
 	Result drivers.RunResult
 	Err    error
+	Info   Info
+}
+
+// Info describes how a Request was executed.
+type Info struct {
+	// WaitTime is how long the task waited before it started executing,
+	// ExecTime how long it took to execute.
+	WaitTime time.Duration
+	ExecTime time.Duration
+
+	// Hot tells whether the task was served by a hot function.
+	Hot bool
+
+	// ContainerID identifies the container that ran the task. Hot
+	// containers are named after the first task they were started for.
+	ContainerID string
 }
@@ -63,12 +63,14 @@ import (
 
 // RunTask helps sending a task.Request into the common concurrency stream.
 // Refer to StartWorkers() to understand what this is about.
-func RunTask(tasks chan task.Request, ctx context.Context, cfg *task.Config) (drivers.RunResult, error) {
+func RunTask(tasks chan task.Request, ctx context.Context, cfg *task.Config) (drivers.RunResult, task.Info, error) {
+	start := time.Now()
 	tresp := make(chan task.Response)
 	treq := task.Request{Ctx: ctx, Config: cfg, Response: tresp}
 	tasks <- treq
 	resp := <-treq.Response
-	return resp.Result, resp.Err
+	resp.Info.WaitTime = time.Since(start) - resp.Info.ExecTime
+	return resp.Result, resp.Info, resp.Err
 }
 
 // StartWorkers operates the common concurrency stream, ie, it will process all
@@ -125,7 +127,7 @@ func (h *htfnmgr) getPipe(ctx context.Context, rnr *Runner, cfg *task.Config) ch
 	}
 
 	// TODO(ccirello): re-implement this without memory allocation (fmt.Sprint)
-	fn := fmt.Sprint(cfg.AppName, ",", cfg.Path, cfg.Image, cfg.Timeout, cfg.Memory, cfg.Format, cfg.MaxConcurrency)
+	fn := fmt.Sprint(cfg.AppName, ",", cfg.Path, ",", cfg.Target, cfg.Image, cfg.Timeout, cfg.Memory, cfg.Format, cfg.MaxConcurrency)
 	tasks, ok := h.chn[fn]
 	if !ok {
 		h.chn[fn] = make(chan task.Request)
@@ -201,7 +203,9 @@ func (svr *htfnsvr) launch(ctx context.Context) error {
 			return err
 		}
 		go func() {
+			svr.rnr.hotStarted(svr.cfg.AppName, svr.cfg.Path, svr.cfg.Target)
 			hc.serve(ctx)
+			svr.rnr.hotStopped(svr.cfg.AppName, svr.cfg.Path, svr.cfg.Target)
 			<-svr.maxc
 		}()
 	default:
@@ -285,18 +289,28 @@ func (hc *htfn) serve(ctx context.Context) {
 				cancel()
 
 			case t := <-hc.tasks:
+				start := time.Now()
 				if err := hc.proto.Dispatch(lctx, t); err != nil {
 					logrus.WithField("ctx", lctx).Info("task failed")
+					status := "error"
+					if t.Ctx.Err() == context.DeadlineExceeded {
+						status = "timeout"
+					}
+					elapsed := time.Since(start)
+					hc.rnr.Observe(cfg.AppName, cfg.Path, cfg.Target, status, elapsed)
 					t.Response <- task.Response{
-						&runResult{StatusValue: "error", error: err},
-						err,
+						Result: &runResult{StatusValue: "error", error: err},
+						Err:    err,
+						Info:   task.Info{ExecTime: elapsed, Hot: true, ContainerID: cfg.ID},
 					}
 					continue
 				}
 
+				elapsed := time.Since(start)
+				hc.rnr.Observe(cfg.AppName, cfg.Path, cfg.Target, "success", elapsed)
 				t.Response <- task.Response{
-					&runResult{StatusValue: "success"},
-					nil,
+					Result: &runResult{StatusValue: "success"},
+					Info:   task.Info{ExecTime: elapsed, Hot: true, ContainerID: cfg.ID},
 				}
 			}
 		}
@@ -347,9 +361,20 @@ func runTaskReq(rnr *Runner, wg *sync.WaitGroup, t task.Request) {
 	defer wg.Done()
 	rnr.Start()
 	defer rnr.Complete()
-	result, err := rnr.Run(t.Ctx, t.Config)
+	start := time.Now()
+	result, exec, err := rnr.run(t.Ctx, t.Config)
+	status := "error"
+	if err == nil {
+		status = result.Status()
+	}
+	rnr.Observe(t.Config.AppName, t.Config.Path, t.Config.Target, status, time.Since(start))
+	resp := task.Response{
+		Result: result,
+		Err:    err,
+		Info:   task.Info{ExecTime: exec, ContainerID: t.Config.ID},
+	}
 	select {
-	case t.Response <- task.Response{result, err}:
+	case t.Response <- resp:
 		close(t.Response)
 	default:
 	}
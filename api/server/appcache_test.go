@@ -0,0 +1,123 @@
+// +build server
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/iron-io/functions/api/datastore"
+	"github.com/iron-io/functions/api/models"
+	"github.com/iron-io/functions/api/mqs"
+)
+
+// countingDatastore counts the datastore round-trips made to serve calls.
+type countingDatastore struct {
+	models.Datastore
+	apps, routes int64
+}
+
+func (ds *countingDatastore) GetApp(ctx context.Context, appName string) (*models.App, error) {
+	atomic.AddInt64(&ds.apps, 1)
+	return ds.Datastore.GetApp(ctx, appName)
+}
+
+func (ds *countingDatastore) GetRoutesByApp(ctx context.Context, appName string, filter *models.RouteFilter) ([]*models.Route, error) {
+	atomic.AddInt64(&ds.routes, 1)
+	return ds.Datastore.GetRoutesByApp(ctx, appName, filter)
+}
+
+func (ds *countingDatastore) roundtrips() int64 {
+	return atomic.LoadInt64(&ds.apps) + atomic.LoadInt64(&ds.routes)
+}
+
+func newCountingDatastore() *countingDatastore {
+	return &countingDatastore{Datastore: datastore.NewMockInit(
+		[]*models.App{
+			{Name: "myapp", Config: models.Config{}},
+		},
+		[]*models.Route{
+			{Path: "/users/:id", AppName: "myapp", Image: "iron/hello", Methods: []string{"GET"}},
+		},
+	)}
+}
+
+func TestAppCache(t *testing.T) {
+	buf := setLogBuffer()
+	tasks := mockTasksConduit()
+	defer close(tasks)
+
+	rnr, cancel := testRunner(t)
+	defer cancel()
+
+	ds := newCountingDatastore()
+	srv := testServer(ds, &mqs.Mock{}, rnr, tasks)
+
+	// PUT calls go through the app and route lookups without running
+	// anything, the routes only serving GET.
+	for i, test := range []struct {
+		method             string
+		path               string
+		body               string
+		expectedCode       int
+		expectedRoundtrips int64
+	}{
+		{"PUT", "/r/myapp/users/1", ``, http.StatusMethodNotAllowed, 2},
+		{"PUT", "/r/myapp/users/2", ``, http.StatusMethodNotAllowed, 2},
+		{"PUT", "/r/myapp/other", ``, http.StatusNotFound, 2},
+		{"PUT", "/r/newapp/users/1", ``, http.StatusNotFound, 3},
+		{"PUT", "/r/newapp/users/1", ``, http.StatusNotFound, 3},
+		{"POST", "/v1/apps", `{ "app": { "name": "newapp" } }`, http.StatusOK, 3},
+		{"PUT", "/r/newapp/users/1", ``, http.StatusNotFound, 5},
+		{"PATCH", "/v1/apps/myapp", `{ "app": { "config": { "A": "1" } } }`, http.StatusOK, 6},
+		{"PUT", "/r/myapp/users/1", ``, http.StatusMethodNotAllowed, 8},
+		{"PUT", "/r/myapp/users/1", ``, http.StatusMethodNotAllowed, 8},
+	} {
+		_, rec := routerRequest(t, srv.Router, test.method, test.path, bytes.NewBufferString(test.body))
+		if rec.Code != test.expectedCode {
+			t.Log(buf.String())
+			t.Fatalf("Test %d: Expected status code to be %d but was %d", i, test.expectedCode, rec.Code)
+		}
+		if n := ds.roundtrips(); n != test.expectedRoundtrips {
+			t.Fatalf("Test %d: Expected %d datastore round-trips but got %d", i, test.expectedRoundtrips, n)
+		}
+	}
+
+	cached, _, ok := srv.cacheget("myapp")
+	if !ok || cached.app.Config["A"] != "1" {
+		t.Errorf("Expected the updated app to be cached, got %v", cached)
+	}
+}
+
+func benchmarkRouteRunner(b *testing.B, evict bool) {
+	setLogBuffer()
+	tasks := mockTasksConduit()
+	defer close(tasks)
+
+	rnr, cancel := testRunner(b)
+	defer cancel()
+
+	ds := newCountingDatastore()
+	srv := testServer(ds, &mqs.Mock{}, rnr, tasks)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if evict {
+			srv.cacheevict("myapp")
+		}
+		req, rec := newRouterRequest(b, "PUT", "/r/myapp/users/1", &bytes.Buffer{})
+		srv.Router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusMethodNotAllowed {
+			b.Fatalf("Expected status code to be %d but was %d", http.StatusMethodNotAllowed, rec.Code)
+		}
+	}
+	b.StopTimer()
+
+	b.Logf("%d calls, %.2f datastore round-trips per call", b.N, float64(ds.roundtrips())/float64(b.N))
+}
+
+func BenchmarkRouteRunnerCached(b *testing.B)   { benchmarkRouteRunner(b, false) }
+func BenchmarkRouteRunnerUncached(b *testing.B) { benchmarkRouteRunner(b, true) }
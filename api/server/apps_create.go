@@ -47,6 +47,10 @@ func (s *Server) handleAppCreate(c *gin.Context) {
 		return
 	}
 
+	s.audit(c, models.AuditAppCreate, app.Name, "", nil, app)
+
+	s.cachedelete(ctx, app.Name)
+
 	err = s.FireAfterAppCreate(ctx, wapp.App)
 	if err != nil {
 		log.WithError(err).Error(models.ErrAppsCreate)
@@ -10,11 +10,18 @@ import (
 	"github.com/iron-io/runner/common"
 )
 
+// handleAppDelete deletes an app along with its queued tasks. Apps with
+// routes are only deleted along with them, when the cascade query parameter
+// is true.
 func (s *Server) handleAppDelete(c *gin.Context) {
 	ctx := c.MustGet("ctx").(context.Context)
 	log := common.Logger(ctx)
 
-	app := &models.App{Name: c.MustGet(api.AppName).(string)}
+	app, err := s.Datastore.GetApp(ctx, c.MustGet(api.AppName).(string))
+	if err != nil {
+		handleErrorResponse(c, err)
+		return
+	}
 
 	routes, err := s.Datastore.GetRoutesByApp(ctx, app.Name, &models.RouteFilter{})
 	if err != nil {
@@ -22,8 +29,10 @@ func (s *Server) handleAppDelete(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, simpleError(ErrInternalServerError))
 		return
 	}
-	//TODO allow this? #528
-	if len(routes) > 0 {
+	// The datastore checks the routes again, in case some are added
+	// meanwhile, but the listeners should not hear of a refused delete.
+	cascade := c.Query("cascade") == "true"
+	if len(routes) > 0 && !cascade {
 		log.WithError(err).Debug(models.ErrDeleteAppsWithRoutes)
 		c.JSON(http.StatusBadRequest, simpleError(models.ErrDeleteAppsWithRoutes))
 		return
@@ -36,12 +45,25 @@ func (s *Server) handleAppDelete(c *gin.Context) {
 		return
 	}
 
-	err = s.Datastore.RemoveApp(ctx, app.Name)
+	err = s.Datastore.RemoveApp(ctx, app.Name, cascade)
 	if err != nil {
 		handleErrorResponse(c, err)
 		return
 	}
 
+	// Tasks left in the queue would otherwise run once an app of the same
+	// name is created again.
+	if _, err := s.MQ.Purge(ctx, app.Name); err != nil && err != models.ErrQueueNotPartitioned {
+		log.WithError(err).Error("Could not purge the queue of the deleted app")
+	}
+
+	for _, r := range routes {
+		s.audit(c, models.AuditRouteDelete, app.Name, r.Path, r, nil)
+	}
+	s.audit(c, models.AuditAppDelete, app.Name, "", app, nil)
+
+	s.cachedelete(ctx, app.Name)
+
 	err = s.FireAfterAppDelete(ctx, app)
 	if err != nil {
 		log.WithError(err).Error(models.ErrAppsRemoving)
@@ -11,7 +11,23 @@ import (
 func (s *Server) handleAppList(c *gin.Context) {
 	ctx := c.MustGet("ctx").(context.Context)
 
-	filter := &models.AppFilter{}
+	filter := &models.AppFilter{Name: c.Query("name")}
+
+	perPage, err := queryPerPage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, simpleError(err))
+		return
+	}
+	filter.PerPage = perPage
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		name, err := decodeCursor(cursor)
+		if err != nil || name == "" {
+			c.JSON(http.StatusBadRequest, simpleError(models.ErrInvalidCursor))
+			return
+		}
+		filter.Cursor = name
+	}
 
 	apps, err := s.Datastore.GetApps(ctx, filter)
 	if err != nil {
@@ -19,5 +35,10 @@ func (s *Server) handleAppList(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, appsResponse{"Successfully listed applications", apps})
+	var next string
+	if perPage > 0 && len(apps) == perPage {
+		next = encodeCursor(apps[len(apps)-1].Name)
+	}
+
+	c.JSON(http.StatusOK, appsResponse{"Successfully listed applications", apps, next})
 }
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iron-io/functions/api"
+	"github.com/iron-io/functions/api/models"
+)
+
+func (s *Server) handleAppQueue(c *gin.Context) {
+	ctx := c.MustGet("ctx").(context.Context)
+
+	appName := c.MustGet(api.AppName).(string)
+	if _, err := s.Datastore.GetApp(ctx, appName); err != nil {
+		handleErrorResponse(c, err)
+		return
+	}
+
+	depth, err := s.MQ.Depth(ctx, appName)
+	if err != nil {
+		handleErrorResponse(c, err)
+		return
+	}
+	queue := &models.Queue{AppName: appName, Depth: depth}
+
+	if peek := c.Query("peek"); peek != "" {
+		n, err := strconv.Atoi(peek)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, simpleError(models.ErrQueueInvalidPeek))
+			return
+		}
+		queue.Tasks, err = s.MQ.Peek(ctx, appName, n)
+		if err != nil {
+			handleErrorResponse(c, err)
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, queueResponse{"Successfully loaded app queue", queue})
+}
+
+// queuePurge is what the audit trail records of a purge of an app queue.
+type queuePurge struct {
+	Purged int64 `json:"purged"`
+}
+
+func (s *Server) handleAppQueuePurge(c *gin.Context) {
+	ctx := c.MustGet("ctx").(context.Context)
+
+	appName := c.MustGet(api.AppName).(string)
+	if _, err := s.Datastore.GetApp(ctx, appName); err != nil {
+		handleErrorResponse(c, err)
+		return
+	}
+
+	n, err := s.MQ.Purge(ctx, appName)
+	if err != nil {
+		handleErrorResponse(c, err)
+		return
+	}
+
+	s.audit(c, models.AuditQueuePurge, appName, "", nil, &queuePurge{n})
+
+	c.JSON(http.StatusOK, queuePurgeResponse{"Successfully purged app queue", n})
+}
+
+func (s *Server) handleQueueStats(c *gin.Context) {
+	ctx := c.MustGet("ctx").(context.Context)
+
+	stats, err := s.MQ.Stats(ctx)
+	if err != nil {
+		handleErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, queueStatsResponse{"Successfully loaded queue stats", stats})
+}
@@ -0,0 +1,97 @@
+// +build server
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/iron-io/functions/api/datastore"
+	"github.com/iron-io/functions/api/models"
+	"github.com/iron-io/functions/api/mqs"
+)
+
+func TestAppQueue(t *testing.T) {
+	buf := setLogBuffer()
+	tasks := mockTasksConduit()
+	defer close(tasks)
+
+	rnr, cancel := testRunner(t)
+	defer cancel()
+
+	ds := datastore.NewMockInit(
+		[]*models.App{{Name: "myapp"}, {Name: "other"}},
+		nil,
+	)
+	mq := mqs.NewMemoryMQ()
+	srv := testServer(ds, mq, rnr, tasks)
+
+	var priority int32
+	for _, task := range []*models.Task{
+		{IDStatus: models.IDStatus{ID: "1"}, AppName: "myapp", Path: "/myroute"},
+		{IDStatus: models.IDStatus{ID: "2"}, AppName: "myapp", Path: "/other"},
+		{IDStatus: models.IDStatus{ID: "3"}, AppName: "other", Path: "/myroute"},
+	} {
+		task.Priority = &priority
+		if _, err := mq.Push(context.Background(), task); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i, test := range []struct {
+		method        string
+		path          string
+		expectedCode  int
+		expectedBody  string
+		expectedError error
+	}{
+		{"GET", "/v1/apps/myapp/queue", http.StatusOK, `"depth":2`, nil},
+		{"GET", "/v1/apps/other/queue", http.StatusOK, `"depth":1`, nil},
+		{"GET", "/v1/apps/notfound/queue", http.StatusNotFound, "", models.ErrAppsNotFound},
+		{"GET", "/v1/apps/myapp/queue?peek=1", http.StatusOK, `"tasks":[{`, nil},
+		{"GET", "/v1/apps/myapp/queue?peek=0", http.StatusBadRequest, "", models.ErrQueueInvalidPeek},
+		{"GET", "/v1/queue", http.StatusOK, `"ready":[3,0,0]`, nil},
+		{"DELETE", "/v1/apps/notfound/queue", http.StatusNotFound, "", models.ErrAppsNotFound},
+		{"DELETE", "/v1/apps/myapp/queue", http.StatusOK, `"purged":2`, nil},
+		{"GET", "/v1/apps/myapp/queue", http.StatusOK, `"depth":0`, nil},
+		{"GET", "/v1/queue", http.StatusOK, `"ready":[1,0,0]`, nil},
+	} {
+		_, rec := routerRequest(t, srv.Router, test.method, test.path, nil)
+
+		if rec.Code != test.expectedCode {
+			t.Log(buf.String())
+			t.Errorf("Test %d: Expected status code to be %d but was %d",
+				i, test.expectedCode, rec.Code)
+		}
+
+		if test.expectedBody != "" && !strings.Contains(rec.Body.String(), test.expectedBody) {
+			t.Log(buf.String())
+			t.Errorf("Test %d: Expected body to have `%s` but was `%s`",
+				i, test.expectedBody, rec.Body.String())
+		}
+
+		if test.expectedError != nil {
+			resp := getErrorResponse(t, rec)
+
+			if !strings.Contains(resp.Error.Message, test.expectedError.Error()) {
+				t.Log(buf.String())
+				t.Errorf("Test %d: Expected error message to have `%s`",
+					i, test.expectedError.Error())
+			}
+		}
+	}
+
+	// The purge is audited along with the number of tasks it removed.
+	events, err := ds.GetAuditEvents(context.Background(), &models.AuditFilter{AppName: "myapp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Action != models.AuditQueuePurge || events[0].Actor != auditAnonymous {
+		t.Fatalf("Expected a single queue purge event, got %+v", events)
+	}
+	if changes := events[0].Changes; len(changes) != 1 || changes[0].Field != "purged" || changes[0].After != float64(2) {
+		t.Errorf("Expected the purge of 2 tasks to be recorded, got %+v", changes)
+	}
+}
@@ -4,8 +4,11 @@ package server
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"log"
 	"net/http"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -103,6 +106,14 @@ func TestAppDelete(t *testing.T) {
 				Name: "myapp",
 			}}, nil,
 		), "/v1/apps/myapp", "", http.StatusOK, nil},
+		{datastore.NewMockInit(
+			[]*models.App{{Name: "myapp"}},
+			[]*models.Route{{AppName: "myapp", Path: "/myroute"}},
+		), "/v1/apps/myapp", "", http.StatusBadRequest, models.ErrDeleteAppsWithRoutes},
+		{datastore.NewMockInit(
+			[]*models.App{{Name: "myapp"}},
+			[]*models.Route{{AppName: "myapp", Path: "/myroute"}},
+		), "/v1/apps/myapp?cascade=true", "", http.StatusOK, nil},
 	} {
 		rnr, cancel := testRunner(t)
 		srv := testServer(test.ds, &mqs.Mock{}, rnr, tasks)
@@ -128,6 +139,57 @@ func TestAppDelete(t *testing.T) {
 	}
 }
 
+func TestAppDeleteCascade(t *testing.T) {
+	buf := setLogBuffer()
+	tasks := mockTasksConduit()
+	defer close(tasks)
+
+	rnr, cancel := testRunner(t)
+	defer cancel()
+
+	ds := datastore.NewMockInit(
+		[]*models.App{{Name: "myapp"}, {Name: "other"}},
+		[]*models.Route{
+			{AppName: "myapp", Path: "/myroute", Image: "iron/hello"},
+			{AppName: "other", Path: "/myroute", Image: "iron/hello"},
+		},
+	)
+	mq := mqs.NewMemoryMQ()
+	srv := testServer(ds, mq, rnr, tasks)
+
+	var priority int32
+	for _, task := range []*models.Task{
+		{IDStatus: models.IDStatus{ID: "1"}, AppName: "myapp", Path: "/myroute"},
+		{IDStatus: models.IDStatus{ID: "2"}, AppName: "other", Path: "/myroute"},
+	} {
+		task.Priority = &priority
+		if _, err := mq.Push(context.Background(), task); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, rec := routerRequest(t, srv.Router, "DELETE", "/v1/apps/myapp?cascade=true", nil)
+	if rec.Code != http.StatusOK {
+		t.Log(buf.String())
+		t.Fatalf("Expected status code to be %d but was %d", http.StatusOK, rec.Code)
+	}
+
+	if routes, _ := ds.GetRoutesByApp(context.Background(), "myapp", &models.RouteFilter{}); len(routes) != 0 {
+		t.Errorf("Expected the routes of the app to be deleted, got %v", routes)
+	}
+	if routes, _ := ds.GetRoutesByApp(context.Background(), "other", &models.RouteFilter{}); len(routes) != 1 {
+		t.Errorf("Expected the routes of other apps to be kept, got %v", routes)
+	}
+
+	// the queued task of the deleted app is purged
+	if depth, err := mq.Depth(context.Background(), "myapp"); err != nil || depth != 0 {
+		t.Errorf("Expected the queue of the deleted app to be purged, got %d tasks, %v", depth, err)
+	}
+	if depth, err := mq.Depth(context.Background(), "other"); err != nil || depth != 1 {
+		t.Errorf("Expected the queue of app other to be kept, got %d tasks, %v", depth, err)
+	}
+}
+
 func TestAppList(t *testing.T) {
 	buf := setLogBuffer()
 	tasks := mockTasksConduit()
@@ -144,6 +206,10 @@ func TestAppList(t *testing.T) {
 		expectedError error
 	}{
 		{"/v1/apps", "", http.StatusOK, nil},
+		{"/v1/apps?per_page=2&name=my*", "", http.StatusOK, nil},
+		{"/v1/apps?per_page=0", "", http.StatusBadRequest, models.ErrInvalidPerPage},
+		{"/v1/apps?per_page=many", "", http.StatusBadRequest, models.ErrInvalidPerPage},
+		{"/v1/apps?cursor=!", "", http.StatusBadRequest, models.ErrInvalidCursor},
 	} {
 		_, rec := routerRequest(t, srv.Router, "GET", test.path, nil)
 
@@ -165,6 +231,48 @@ func TestAppList(t *testing.T) {
 	}
 }
 
+func TestAppListPages(t *testing.T) {
+	buf := setLogBuffer()
+	tasks := mockTasksConduit()
+	defer close(tasks)
+
+	rnr, cancel := testRunner(t)
+	defer cancel()
+	ds := datastore.NewMockInit([]*models.App{
+		{Name: "myapp3"}, {Name: "other"}, {Name: "myapp1"}, {Name: "myapp2"},
+	}, nil)
+	srv := testServer(ds, &mqs.Mock{}, rnr, tasks)
+
+	var pages [][]string
+	path := "/v1/apps?name=my*&per_page=2"
+	for len(pages) < 4 {
+		_, rec := routerRequest(t, srv.Router, "GET", path, nil)
+		if rec.Code != http.StatusOK {
+			t.Log(buf.String())
+			t.Fatalf("Expected status code to be %d but was %d", http.StatusOK, rec.Code)
+		}
+		var resp appsResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, app := range resp.Apps {
+			names = append(names, app.Name)
+		}
+		pages = append(pages, names)
+		if resp.NextCursor == "" {
+			break
+		}
+		path = "/v1/apps?name=my*&per_page=2&cursor=" + resp.NextCursor
+	}
+
+	expected := [][]string{{"myapp1", "myapp2"}, {"myapp3"}}
+	if !reflect.DeepEqual(pages, expected) {
+		t.Log(buf.String())
+		t.Errorf("Expected pages %v, got %v", expected, pages)
+	}
+}
+
 func TestAppGet(t *testing.T) {
 	buf := setLogBuffer()
 	tasks := mockTasksConduit()
@@ -44,12 +44,25 @@ func (s *Server) handleAppUpdate(c *gin.Context) {
 		return
 	}
 
+	before, err := s.Datastore.GetApp(ctx, wapp.App.Name)
+	if err != nil {
+		handleErrorResponse(c, err)
+		return
+	}
+	// the datastore may hand out the stored value itself, keep a copy for
+	// the audit trail before it gets updated.
+	before = before.Clone()
+
 	app, err := s.Datastore.UpdateApp(ctx, wapp.App)
 	if err != nil {
 		handleErrorResponse(c, err)
 		return
 	}
 
+	s.audit(c, models.AuditAppUpdate, app.Name, "", before, app)
+
+	s.cachedelete(ctx, app.Name)
+
 	err = s.FireAfterAppUpdate(ctx, wapp.App)
 	if err != nil {
 		log.WithError(err).Error(models.ErrAppsUpdate)
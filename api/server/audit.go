@@ -0,0 +1,190 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iron-io/functions/api/models"
+	f_common "github.com/iron-io/functions/common"
+	"github.com/iron-io/runner/common"
+	uuid "github.com/satori/go.uuid"
+	"github.com/spf13/viper"
+)
+
+const (
+	auditDefaultLimit = 100
+	auditRedacted     = "[redacted]"
+	auditAnonymous    = "anonymous"
+)
+
+// auditRedactedFields are never shown in audit events, only whether they
+// changed. Config entries are redacted as well.
+var auditRedactedFields = map[string]bool{
+	"jwt_key": true,
+}
+
+func (s *Server) handleAuditList(c *gin.Context) {
+	ctx := c.MustGet("ctx").(context.Context)
+	log := common.Logger(ctx)
+
+	filter := &models.AuditFilter{
+		AppName: c.Query("app"),
+		Path:    c.Query("route"),
+		Actor:   c.Query("actor"),
+		Limit:   auditDefaultLimit,
+	}
+
+	if since := c.Query("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, simpleError(models.ErrAuditInvalidSince))
+			return
+		}
+		filter.Since = t
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, simpleError(models.ErrAuditInvalidLimit))
+			return
+		}
+		filter.Limit = n
+	}
+
+	events, err := s.Datastore.GetAuditEvents(ctx, filter)
+	if err != nil {
+		log.WithError(err).Error(models.ErrAuditList)
+		c.JSON(http.StatusInternalServerError, simpleError(models.ErrAuditList))
+		return
+	}
+
+	c.JSON(http.StatusOK, auditResponse{"Successfully listed audit events", events})
+}
+
+// audit records a change to an app, route or app queue. before is nil for
+// creations and after is nil for deletions. Failing to record the event does not fail the
+// request, since the change has already been made.
+func (s *Server) audit(c *gin.Context, action, appName, routePath string, before, after interface{}) {
+	ctx := c.MustGet("ctx").(context.Context)
+	log := common.Logger(ctx)
+
+	event := &models.AuditEvent{
+		ID:         uuid.NewV4().String(),
+		Timestamp:  time.Now(),
+		Actor:      auditActor(c.Request),
+		RemoteAddr: c.ClientIP(),
+		Method:     c.Request.Method,
+		Endpoint:   c.Request.URL.Path,
+		Action:     action,
+		AppName:    appName,
+		Path:       routePath,
+		Changes:    auditDiff(before, after),
+	}
+
+	if err := s.Datastore.InsertAuditEvent(ctx, event); err != nil {
+		log.WithError(err).WithField("action", action).Error("Could not record audit event")
+	}
+}
+
+// auditActor identifies who made a request, by the subject of the JWT it
+// was authenticated with.
+func auditActor(req *http.Request) string {
+	jwtAuthKey := viper.GetString("jwt_auth_key")
+	if jwtAuthKey == "" {
+		return auditAnonymous
+	}
+	sub, err := f_common.JwtSubject(jwtAuthKey, req)
+	if err != nil || sub == "" {
+		return auditAnonymous
+	}
+	return sub
+}
+
+// auditDiff lists the fields that differ between before and after, which are
+// either nil or an *models.App, *models.Route or *queuePurge.
+func auditDiff(before, after interface{}) []*models.AuditChange {
+	b, a := auditFields(before), auditFields(after)
+
+	var fields []string
+	for k := range b {
+		fields = append(fields, k)
+	}
+	for k := range a {
+		if _, ok := b[k]; !ok {
+			fields = append(fields, k)
+		}
+	}
+	sort.Strings(fields)
+
+	changes := []*models.AuditChange{}
+	for _, k := range fields {
+		bv, bok := b[k]
+		av, aok := a[k]
+		if bok == aok && reflect.DeepEqual(bv, av) {
+			continue
+		}
+		if auditRedactedFields[k] || strings.HasPrefix(k, "config.") {
+			if bok {
+				bv = auditRedacted
+			}
+			if aok {
+				av = auditRedacted
+			}
+		}
+		if k == "targets" {
+			auditRedactTargets(bv)
+			auditRedactTargets(av)
+		}
+		changes = append(changes, &models.AuditChange{Field: k, Before: bv, After: av})
+	}
+	return changes
+}
+
+// auditRedactTargets redacts the config values of route targets, given as
+// unmarshaled JSON.
+func auditRedactTargets(targets interface{}) {
+	list, _ := targets.([]interface{})
+	for _, t := range list {
+		target, _ := t.(map[string]interface{})
+		config, _ := target["config"].(map[string]interface{})
+		for k := range config {
+			config[k] = auditRedacted
+		}
+	}
+}
+
+// auditFields flattens v into its JSON fields, with each config entry as a
+// field of its own.
+func auditFields(v interface{}) map[string]interface{} {
+	fields := map[string]interface{}{}
+	if v == nil || reflect.ValueOf(v).IsNil() {
+		return fields
+	}
+
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return fields
+	}
+	if err := json.Unmarshal(buf, &fields); err != nil {
+		return fields
+	}
+
+	delete(fields, "routes")
+	if config, ok := fields["config"].(map[string]interface{}); ok {
+		delete(fields, "config")
+		for k, v := range config {
+			fields["config."+k] = v
+		}
+	} else if fields["config"] == nil {
+		delete(fields, "config")
+	}
+	return fields
+}
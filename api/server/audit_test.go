@@ -0,0 +1,76 @@
+// +build server
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/iron-io/functions/api/datastore"
+	"github.com/iron-io/functions/api/models"
+	"github.com/iron-io/functions/api/mqs"
+)
+
+func TestAudit(t *testing.T) {
+	buf := setLogBuffer()
+	tasks := mockTasksConduit()
+	defer close(tasks)
+
+	rnr, cancel := testRunner(t)
+	defer cancel()
+
+	srv := testServer(datastore.NewMock(), &mqs.Mock{}, rnr, tasks)
+
+	for i, test := range []struct {
+		method       string
+		path         string
+		body         string
+		expectedCode int
+	}{
+		{"POST", "/v1/apps", `{ "app": { "name": "myapp" } }`, http.StatusOK},
+		{"PATCH", "/v1/apps/myapp", `{ "app": { "config": { "SECRET": "hunter2" } } }`, http.StatusOK},
+		{"POST", "/v1/apps/myapp/routes", `{ "route": { "image": "iron/hello", "path": "/myroute" } }`, http.StatusOK},
+		{"DELETE", "/v1/apps/myapp/routes/myroute", "", http.StatusOK},
+		{"GET", "/v1/audit?since=yesterday", "", http.StatusBadRequest},
+		{"GET", "/v1/audit?limit=-1", "", http.StatusBadRequest},
+	} {
+		_, rec := routerRequest(t, srv.Router, test.method, test.path, bytes.NewBufferString(test.body))
+		if rec.Code != test.expectedCode {
+			t.Log(buf.String())
+			t.Fatalf("Test %d: Expected status code to be %d but was %d", i, test.expectedCode, rec.Code)
+		}
+	}
+
+	_, rec := routerRequest(t, srv.Router, "GET", "/v1/audit?app=myapp", nil)
+	if rec.Code != http.StatusOK {
+		t.Log(buf.String())
+		t.Fatalf("Expected status code to be %d but was %d", http.StatusOK, rec.Code)
+	}
+	var resp struct {
+		Events []*models.AuditEvent `json:"events"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{models.AuditRouteDelete, models.AuditRouteCreate, models.AuditAppUpdate, models.AuditAppCreate}
+	if len(resp.Events) != len(expected) {
+		t.Fatalf("Expected %d audit events, got %d", len(expected), len(resp.Events))
+	}
+	for i, event := range resp.Events {
+		if event.Action != expected[i] {
+			t.Errorf("Event %d: expected action %s, got %s", i, expected[i], event.Action)
+		}
+		if event.Actor != auditAnonymous {
+			t.Errorf("Event %d: expected actor %s, got %s", i, auditAnonymous, event.Actor)
+		}
+	}
+
+	update := resp.Events[2]
+	if len(update.Changes) != 1 || update.Changes[0].Field != "config.SECRET" ||
+		update.Changes[0].Before != nil || update.Changes[0].After != auditRedacted {
+		t.Errorf("Expected config change to be redacted, got %+v", update.Changes)
+	}
+}
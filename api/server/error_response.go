@@ -16,10 +16,19 @@ func simpleError(err error) *models.Error {
 }
 
 var errStatusCode = map[error]int{
-	models.ErrAppsNotFound:        http.StatusNotFound,
-	models.ErrAppsAlreadyExists:   http.StatusConflict,
-	models.ErrRoutesNotFound:      http.StatusNotFound,
-	models.ErrRoutesAlreadyExists: http.StatusConflict,
+	models.ErrAppsNotFound:         http.StatusNotFound,
+	models.ErrAppsAlreadyExists:    http.StatusConflict,
+	models.ErrDeleteAppsWithRoutes: http.StatusBadRequest,
+	models.ErrRoutesNotFound:       http.StatusNotFound,
+	models.ErrRoutesAlreadyExists:  http.StatusConflict,
+	models.ErrRoutesNameConflict:   http.StatusConflict,
+	models.ErrRoutesMountConflict:  http.StatusConflict,
+	models.ErrRoutesPathConflict:   http.StatusConflict,
+	models.ErrRoutesAmbiguous:      http.StatusConflict,
+	models.ErrFunctionsNotFound:    http.StatusNotFound,
+	models.ErrInvalidCursor:        http.StatusBadRequest,
+	models.ErrInvalidPerPage:       http.StatusBadRequest,
+	models.ErrQueueNotPartitioned:  http.StatusNotImplemented,
 }
 
 func handleErrorResponse(c *gin.Context, err error) {
@@ -0,0 +1,202 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"path"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iron-io/functions/api"
+	"github.com/iron-io/functions/api/models"
+	"github.com/iron-io/runner/common"
+)
+
+// Functions are named routes. Unlike routes, which are identified by their
+// path, functions are identified by their name, so they can be moved to
+// another path and renamed without losing their configuration.
+
+func (s *Server) handleFunctionList(c *gin.Context) {
+	ctx := c.MustGet("ctx").(context.Context)
+
+	routes, err := s.Datastore.GetRoutesByApp(ctx, c.MustGet(api.AppName).(string), &models.RouteFilter{})
+	if err != nil {
+		handleErrorResponse(c, err)
+		return
+	}
+
+	functions := models.Routes{}
+	for _, r := range routes {
+		if r.Name != "" {
+			functions = append(functions, r)
+		}
+	}
+
+	c.JSON(http.StatusOK, routesResponse{"Successfully listed functions", functions, ""})
+}
+
+func (s *Server) handleFunctionGet(c *gin.Context) {
+	ctx := c.MustGet("ctx").(context.Context)
+
+	route, err := s.function(ctx, c.MustGet(api.AppName).(string), c.Param("name"))
+	if err != nil {
+		handleErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, routeResponse{"Successfully loaded function", route})
+}
+
+// handleFunctionUpdate updates a function like handleRouteUpdate updates a
+// route, except that the path may change as well, which moves the function.
+func (s *Server) handleFunctionUpdate(c *gin.Context) {
+	ctx := c.MustGet("ctx").(context.Context)
+	log := common.Logger(ctx)
+
+	var wroute models.RouteWrapper
+
+	err := c.BindJSON(&wroute)
+	if err != nil {
+		log.WithError(err).Debug(models.ErrInvalidJSON)
+		c.JSON(http.StatusBadRequest, simpleError(models.ErrInvalidJSON))
+		return
+	}
+
+	if wroute.Route == nil {
+		log.Debug(models.ErrRoutesMissingNew)
+		c.JSON(http.StatusBadRequest, simpleError(models.ErrRoutesMissingNew))
+		return
+	}
+
+	appName := c.MustGet(api.AppName).(string)
+
+	before, err := s.function(ctx, appName, c.Param("name"))
+	if err != nil {
+		handleErrorResponse(c, err)
+		return
+	}
+	before = before.Clone()
+
+	newPath := before.Path
+	if wroute.Route.Path != "" {
+		newPath = path.Clean(wroute.Route.Path)
+	}
+
+	wroute.Route.AppName = appName
+	wroute.Route.Path = newPath
+
+	if err := wroute.Validate(true); err != nil {
+		log.WithError(err).Debug(models.ErrRoutesUpdate)
+		c.JSON(http.StatusBadRequest, simpleError(err))
+		return
+	}
+
+	merged := before.Clone()
+	merged.Update(wroute.Route)
+	merged.Path = newPath
+	if err := s.checkMounts(ctx, merged, before); err != nil {
+		handleErrorResponse(c, err)
+		return
+	}
+
+	route, err := s.updateRoute(ctx, before, wroute.Route)
+	if err != nil {
+		handleErrorResponse(c, err)
+		return
+	}
+
+	s.audit(c, models.AuditRouteUpdate, route.AppName, route.Path, before, route)
+	s.cachedelete(ctx, route.AppName)
+	if err := s.revision(ctx, route); err != nil {
+		handleErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, routeResponse{"Function successfully updated", route})
+}
+
+func (s *Server) handleFunctionDelete(c *gin.Context) {
+	ctx := c.MustGet("ctx").(context.Context)
+
+	appName := c.MustGet(api.AppName).(string)
+
+	route, err := s.function(ctx, appName, c.Param("name"))
+	if err != nil {
+		handleErrorResponse(c, err)
+		return
+	}
+
+	if err := s.Datastore.RemoveRoute(ctx, appName, route.Path, models.MethodsKey(route.Methods)); err != nil {
+		handleErrorResponse(c, err)
+		return
+	}
+
+	s.audit(c, models.AuditRouteDelete, appName, route.Path, route, nil)
+
+	s.cachedelete(ctx, appName)
+	c.JSON(http.StatusOK, gin.H{"message": "Function deleted"})
+}
+
+// updateRoute applies patch, whose path is the one the route should end up
+// at, to the stored route before. Routes are identified by their path and
+// methods, so the route is moved when either changes.
+func (s *Server) updateRoute(ctx context.Context, before, patch *models.Route) (*models.Route, error) {
+	methods := models.MethodsKey(before.Methods)
+	if patch.Path != before.Path || patch.Methods != nil && models.MethodsKey(patch.Methods) != methods {
+		return s.Datastore.MoveRoute(ctx, before.Path, methods, patch)
+	}
+	patch.Methods = before.Methods
+	return s.Datastore.UpdateRoute(ctx, patch)
+}
+
+// function loads the route of appName named name.
+func (s *Server) function(ctx context.Context, appName, name string) (*models.Route, error) {
+	routes, err := s.Datastore.GetRoutesByApp(ctx, appName, &models.RouteFilter{Name: name})
+	if err != nil {
+		return nil, err
+	}
+	if name == "" || len(routes) == 0 {
+		return nil, models.ErrFunctionsNotFound
+	}
+	return routes[0], nil
+}
+
+// checkMounts makes sure route can be stored in its app alongside the other
+// routes: no other route may have the same name, nor be mounted at one of
+// its path and aliases unless they serve different HTTP methods, nor at a
+// path the routing tree cannot tell apart. self is the route as currently
+// stored, if any, so that it does not conflict with itself.
+func (s *Server) checkMounts(ctx context.Context, route, self *models.Route) error {
+	routes, err := s.Datastore.GetRoutesByApp(ctx, route.AppName, &models.RouteFilter{})
+	if err != nil {
+		return err
+	}
+
+	mounts := map[string]bool{}
+	for _, m := range route.Mounts() {
+		mounts[m] = true
+	}
+
+	all := []*models.Route{route}
+	for _, r := range routes {
+		if self != nil && r.Path == self.Path && models.MethodsKey(r.Methods) == models.MethodsKey(self.Methods) {
+			continue
+		}
+		all = append(all, r)
+		if route.Name != "" && r.Name == route.Name {
+			return models.ErrRoutesNameConflict
+		}
+		if !r.SharesMethods(route) {
+			continue
+		}
+		for _, m := range r.Mounts() {
+			if mounts[m] {
+				return models.ErrRoutesMountConflict
+			}
+		}
+	}
+
+	if _, err := newRouteTree(all); err != nil {
+		return models.ErrRoutesPathConflict
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+// +build server
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/iron-io/functions/api/datastore"
+	"github.com/iron-io/functions/api/models"
+	"github.com/iron-io/functions/api/mqs"
+)
+
+func TestFunctions(t *testing.T) {
+	buf := setLogBuffer()
+	tasks := mockTasksConduit()
+	defer close(tasks)
+
+	rnr, cancel := testRunner(t)
+	defer cancel()
+
+	srv := testServer(datastore.NewMock(), &mqs.Mock{}, rnr, tasks)
+
+	for i, test := range []struct {
+		method       string
+		path         string
+		body         string
+		expectedCode int
+	}{
+		{"POST", "/v1/apps/myapp/routes", `{ "route": { "name": "hello", "image": "iron/hello", "path": "/hello", "aliases": ["/hi"], "config": { "A": "1" } } }`, http.StatusOK},
+		{"POST", "/v1/apps/myapp/routes", `{ "route": { "name": "hello", "image": "iron/hello", "path": "/other" } }`, http.StatusConflict},
+		{"POST", "/v1/apps/myapp/routes", `{ "route": { "image": "iron/hello", "path": "/hi" } }`, http.StatusConflict},
+		{"POST", "/v1/apps/myapp/routes", `{ "route": { "image": "iron/hello", "path": "/other", "aliases": ["/hello"] } }`, http.StatusConflict},
+		{"POST", "/v1/apps/myapp/routes", `{ "route": { "name": "in valid", "image": "iron/hello", "path": "/other" } }`, http.StatusBadRequest},
+		{"POST", "/v1/apps/myapp/routes", `{ "route": { "image": "iron/hello", "path": "/other", "aliases": ["other"] } }`, http.StatusBadRequest},
+		{"POST", "/v1/apps/myapp/routes", `{ "route": { "name": "other", "image": "iron/hello", "path": "/other" } }`, http.StatusOK},
+		{"PATCH", "/v1/apps/myapp/routes/other", `{ "route": { "aliases": ["/hi"] } }`, http.StatusConflict},
+		{"PATCH", "/v1/apps/myapp/functions/other", `{ "route": { "name": "hello" } }`, http.StatusConflict},
+		{"PATCH", "/v1/apps/myapp/functions/other", `{ "route": { "path": "/hello" } }`, http.StatusConflict},
+		{"PATCH", "/v1/apps/myapp/functions/notfound", `{ "route": { "path": "/moved" } }`, http.StatusNotFound},
+		{"GET", "/v1/apps/myapp/functions/notfound", "", http.StatusNotFound},
+		{"PATCH", "/v1/apps/myapp/functions/hello", `{ "route": { "name": "greeter", "path": "/greet", "image": "iron/hello:2" } }`, http.StatusOK},
+		{"GET", "/v1/apps/myapp/routes/hello", "", http.StatusNotFound},
+		{"GET", "/v1/apps/myapp/routes/greet", "", http.StatusOK},
+		{"GET", "/v1/apps/myapp/functions/hello", "", http.StatusNotFound},
+		{"POST", "/v1/apps/myapp/routes", `{ "route": { "image": "iron/hello", "path": "/get", "methods": ["GET"] } }`, http.StatusOK},
+		{"POST", "/v1/apps/myapp/routes", `{ "route": { "image": "iron/hello", "path": "/post", "methods": ["POST"], "aliases": ["/get"] } }`, http.StatusOK},
+		{"POST", "/v1/apps/myapp/routes", `{ "route": { "image": "iron/hello", "path": "/put", "methods": ["PUT", "GET"], "aliases": ["/get"] } }`, http.StatusConflict},
+		{"DELETE", "/v1/apps/myapp/functions/other", "", http.StatusOK},
+		{"DELETE", "/v1/apps/myapp/functions/other", "", http.StatusNotFound},
+	} {
+		_, rec := routerRequest(t, srv.Router, test.method, test.path, bytes.NewBufferString(test.body))
+		if rec.Code != test.expectedCode {
+			t.Log(buf.String())
+			t.Fatalf("Test %d: Expected status code to be %d but was %d", i, test.expectedCode, rec.Code)
+		}
+	}
+
+	_, rec := routerRequest(t, srv.Router, "GET", "/v1/apps/myapp/functions/greeter", nil)
+	if rec.Code != http.StatusOK {
+		t.Log(buf.String())
+		t.Fatalf("Expected status code to be %d but was %d", http.StatusOK, rec.Code)
+	}
+	var resp struct {
+		Route *models.Route `json:"route"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Route.Path != "/greet" || resp.Route.Image != "iron/hello:2" {
+		t.Errorf("Expected function to be moved to /greet with image iron/hello:2, got %s with image %s", resp.Route.Path, resp.Route.Image)
+	}
+	if resp.Route.Config["A"] != "1" {
+		t.Errorf("Expected function to keep its config through the move, got %v", resp.Route.Config)
+	}
+	if len(resp.Route.Aliases) != 1 || resp.Route.Aliases[0] != "/hi" {
+		t.Errorf("Expected function to keep its aliases through the move, got %v", resp.Route.Aliases)
+	}
+
+	_, rec = routerRequest(t, srv.Router, "GET", "/v1/apps/myapp/functions", nil)
+	var list struct {
+		Routes []*models.Route `json:"routes"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Routes) != 1 || list.Routes[0].Name != "greeter" {
+		t.Errorf("Expected only the greeter function to be listed, got %v", list.Routes)
+	}
+
+	_, rec = routerRequest(t, srv.Router, "GET", "/v1/apps/myapp/routes/greet/revisions", nil)
+	var revs struct {
+		Revisions []*models.RouteRevision `json:"revisions"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&revs); err != nil {
+		t.Fatal(err)
+	}
+	if len(revs.Revisions) != 2 {
+		t.Errorf("Expected the revisions of the function to move along, got %d", len(revs.Revisions))
+	}
+}
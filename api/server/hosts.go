@@ -0,0 +1,61 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ServeHTTP serves the API and the function calls. Requests to a host mapped
+// to an app, see EnableHostRouting, are calls to the routes of that app
+// without the /r/:app prefix.
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if appName, ok := s.hostApp(req.Host); ok {
+		req = req.WithContext(context.WithValue(req.Context(), requestPathKey{}, req.URL.Path))
+		req.URL.Path = "/r/" + appName + req.URL.Path
+		req.URL.RawPath = ""
+	}
+	s.Router.ServeHTTP(w, req)
+}
+
+type requestPathKey struct{}
+
+// requestPath returns the path req was made to by its client, before
+// ServeHTTP prefixed it with the app of its host.
+func requestPath(req *http.Request) string {
+	if p, ok := req.Context().Value(requestPathKey{}).(string); ok {
+		return p
+	}
+	return req.URL.Path
+}
+
+// hostApp returns the app host is mapped to, if any.
+func (s *Server) hostApp(host string) (string, bool) {
+	if len(s.hosts) == 0 {
+		return "", false
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	appName, ok := s.hosts[strings.ToLower(host)]
+	return appName, ok
+}
+
+// parseHosts parses a comma separated list of host=app mappings.
+func parseHosts(v string) (map[string]string, error) {
+	hosts := map[string]string{}
+	for _, pair := range strings.Split(v, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" || strings.TrimSpace(kv[1]) == "" {
+			return nil, fmt.Errorf("invalid host mapping %q, expected host=app", pair)
+		}
+		hosts[strings.ToLower(strings.TrimSpace(kv[0]))] = strings.TrimSpace(kv[1])
+	}
+	return hosts, nil
+}
@@ -0,0 +1,32 @@
+// +build server
+
+package server
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseHosts(t *testing.T) {
+	for i, test := range []struct {
+		value    string
+		expected map[string]string
+		valid    bool
+	}{
+		{"", map[string]string{}, true},
+		{"api.example.com=myapp", map[string]string{"api.example.com": "myapp"}, true},
+		{" API.example.com = myapp, other.example.com=other ,", map[string]string{"api.example.com": "myapp", "other.example.com": "other"}, true},
+		{"api.example.com", nil, false},
+		{"api.example.com=", nil, false},
+		{"=myapp", nil, false},
+	} {
+		hosts, err := parseHosts(test.value)
+		if test.valid != (err == nil) {
+			t.Errorf("Test %d: expected valid to be %v, got error %v", i, test.valid, err)
+			continue
+		}
+		if test.valid && !reflect.DeepEqual(hosts, test.expected) {
+			t.Errorf("Test %d: expected hosts %v, got %v", i, test.expected, hosts)
+		}
+	}
+}
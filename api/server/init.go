@@ -9,6 +9,7 @@ import (
 
 	"github.com/Sirupsen/logrus"
 	"github.com/gin-gonic/gin"
+	"github.com/iron-io/functions/api/runner"
 	"github.com/spf13/viper"
 )
 
@@ -25,7 +26,10 @@ func init() {
 	viper.SetDefault(EnvMQURL, fmt.Sprintf("bolt://%s/data/worker_mq.db", cwd))
 	viper.SetDefault(EnvDBURL, fmt.Sprintf("bolt://%s/data/bolt.db?bucket=funcs", cwd))
 	viper.SetDefault(EnvPort, 8080)
-	viper.SetDefault(EnvAPIURL, fmt.Sprintf("http://127.0.0.1:%d", viper.GetInt(EnvPort)))
+	viper.SetDefault(EnvCacheTTL, "1m")
+	viper.SetDefault(EnvAsyncBatch, runner.DefaultAsyncConfig.Batch)
+	viper.SetDefault(EnvAsyncWait, runner.DefaultAsyncConfig.Wait.String())
+	viper.SetDefault(EnvAsyncMaxBackoff, runner.DefaultAsyncConfig.MaxBackoff.String())
 	viper.AutomaticEnv() // picks up env vars automatically
 	logLevel, err := logrus.ParseLevel(viper.GetString(EnvLogLevel))
 	if err != nil {
@@ -1,25 +1,33 @@
-// Package routecache is meant to assist in resolving the most used routes at
-// an application. Implemented as a LRU, it returns always its full context for
-// iteration at the router handler.
+// Package routecache is meant to assist in resolving the routes of the most
+// used applications. Implemented as a LRU, it holds the routing of each
+// application, as loaded by the router handler, under the application name.
 package routecache
 
 // based on groupcache's LRU
 
 import (
 	"container/list"
-
-	"github.com/iron-io/functions/api/models"
+	"time"
 )
 
 // Cache holds an internal linkedlist for hotness management. It is not safe
 // for concurrent use, must be guarded externally.
 type Cache struct {
 	MaxEntries int
+	// TTL is how long the routing of an application is kept once set, zero
+	// keeping it until evicted or deleted.
+	TTL time.Duration
 
 	ll    *list.List
 	cache map[string]*list.Element
 }
 
+type entry struct {
+	appname string
+	value   interface{}
+	expires time.Time
+}
+
 // New returns a route cache.
 func New(maxentries int) *Cache {
 	return &Cache{
@@ -29,45 +37,72 @@ func New(maxentries int) *Cache {
 	}
 }
 
-// Refresh updates internal linkedlist either adding a new route to the front,
-// or moving it to the front when used. It will discard seldom used routes.
-func (c *Cache) Refresh(route *models.Route) {
+// Set stores the routing of an application, either adding it to the front
+// or replacing it and moving it to the front. It will discard the routing of
+// seldom used applications.
+func (c *Cache) Set(appname string, value interface{}) {
+	c.SetTTL(appname, value, c.TTL)
+}
+
+// SetTTL is like Set, except that the routing expires after ttl rather than
+// the TTL of the cache.
+func (c *Cache) SetTTL(appname string, value interface{}, ttl time.Duration) {
 	if c.cache == nil {
 		return
 	}
 
-	if ee, ok := c.cache[route.AppName+route.Path]; ok {
+	var expires time.Time
+	if ttl > 0 {
+		expires = time.Now().Add(ttl)
+	}
+
+	if ee, ok := c.cache[appname]; ok {
 		c.ll.MoveToFront(ee)
-		ee.Value = route
+		ee.Value.(*entry).value = value
+		ee.Value.(*entry).expires = expires
 		return
 	}
 
-	ele := c.ll.PushFront(route)
-	c.cache[route.AppName+route.Path] = ele
+	ele := c.ll.PushFront(&entry{appname, value, expires})
+	c.cache[appname] = ele
 	if c.MaxEntries != 0 && c.ll.Len() > c.MaxEntries {
 		c.removeOldest()
 	}
 }
 
-// Get looks up a path's route from the cache.
-func (c *Cache) Get(appname, path string) (route *models.Route, ok bool) {
+// Get looks up the routing of an application from the cache. Expired
+// routings are removed instead.
+func (c *Cache) Get(appname string) (value interface{}, ok bool) {
 	if c.cache == nil {
 		return
 	}
-	if ele, hit := c.cache[appname+path]; hit {
+	if ele, hit := c.cache[appname]; hit {
+		if e := ele.Value.(*entry).expires; !e.IsZero() && time.Now().After(e) {
+			c.removeElement(ele)
+			return
+		}
 		c.ll.MoveToFront(ele)
-		return ele.Value.(*models.Route), true
+		return ele.Value.(*entry).value, true
 	}
 	return
 }
 
-// Delete removes the element for the given appname and path from the cache.
-func (c *Cache) Delete(appname, path string) {
-	if ele, hit := c.cache[appname+path]; hit {
+// Delete removes the routing of the given application from the cache.
+func (c *Cache) Delete(appname string) {
+	if ele, hit := c.cache[appname]; hit {
 		c.removeElement(ele)
 	}
 }
 
+// Purge removes the routing of every application from the cache.
+func (c *Cache) Purge() {
+	if c.cache == nil {
+		return
+	}
+	c.ll.Init()
+	c.cache = make(map[string]*list.Element)
+}
+
 func (c *Cache) removeOldest() {
 	if c.cache == nil {
 		return
@@ -79,8 +114,8 @@ func (c *Cache) removeOldest() {
 
 func (c *Cache) removeElement(e *list.Element) {
 	c.ll.Remove(e)
-	kv := e.Value.(*models.Route)
-	delete(c.cache, kv.AppName+kv.Path)
+	kv := e.Value.(*entry)
+	delete(c.cache, kv.appname)
 }
 
 func (c *Cache) Len() int {
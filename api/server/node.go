@@ -0,0 +1,380 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+	"github.com/iron-io/functions/api/models"
+	"github.com/iron-io/functions/api/runner"
+	"github.com/iron-io/functions/api/runner/task"
+	"github.com/iron-io/runner/drivers"
+)
+
+// NodeMode tells which parts of IronFunctions a node runs.
+type NodeMode string
+
+const (
+	// NodeModeFull nodes serve the API and run functions.
+	NodeModeFull NodeMode = "full"
+
+	// NodeModeAPI nodes serve the API, forwarding sync calls to runner
+	// nodes and leaving async tasks to them.
+	NodeModeAPI NodeMode = "api"
+
+	// NodeModeRunner nodes run the sync calls forwarded by API nodes and the
+	// async tasks they reserve from API_URL, without a datastore.
+	NodeModeRunner NodeMode = "runner"
+)
+
+var ErrNoRunnerNodes = errors.New("No runner node available")
+
+// runnerPollInterval is how often API nodes ask runner nodes for their
+// capacity.
+const runnerPollInterval = 2 * time.Second
+
+func parseNodeMode(s string) (NodeMode, error) {
+	switch mode := NodeMode(s); mode {
+	case "":
+		return NodeModeFull, nil
+	case NodeModeFull, NodeModeAPI, NodeModeRunner:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid node mode `%s`, expected full, api or runner", s)
+}
+
+// servesAPI tells whether the node serves the API, the zero mode being full.
+func (s *Server) servesAPI() bool {
+	return s.mode != NodeModeRunner
+}
+
+// runsTasks tells whether the node runs functions.
+func (s *Server) runsTasks() bool {
+	return s.mode != NodeModeAPI
+}
+
+// runRequest is a sync call an API node forwards to a runner node.
+type runRequest struct {
+	ID             string            `json:"id"`
+	AppName        string            `json:"app_name"`
+	Path           string            `json:"path"`
+	Target         string            `json:"target,omitempty"`
+	Image          string            `json:"image"`
+	Format         string            `json:"format,omitempty"`
+	Memory         uint64            `json:"memory"`
+	MaxConcurrency int               `json:"max_concurrency,omitempty"`
+	Timeout        time.Duration     `json:"timeout"`
+	IdleTimeout    time.Duration     `json:"idle_timeout"`
+	Env            map[string]string `json:"env,omitempty"`
+	Payload        []byte            `json:"payload,omitempty"`
+}
+
+// runResponse is the outcome of a sync call run by a runner node. Error is
+// set along with an empty Status if the call could not be run.
+type runResponse struct {
+	Status      string        `json:"status,omitempty"`
+	Error       string        `json:"error,omitempty"`
+	Output      []byte        `json:"output,omitempty"`
+	WaitTime    time.Duration `json:"wait_time"`
+	ExecTime    time.Duration `json:"exec_time"`
+	Hot         bool          `json:"hot,omitempty"`
+	ContainerID string        `json:"container_id,omitempty"`
+}
+
+// runResult is the drivers.RunResult of a call run by a runner node.
+type runResult struct {
+	status string
+	err    string
+}
+
+func (r *runResult) Error() string  { return r.err }
+func (r *runResult) Status() string { return r.status }
+
+// run runs cfg on this node, or on a runner node for API nodes.
+func (s *Server) run(ctx context.Context, cfg *task.Config) (drivers.RunResult, task.Info, error) {
+	if s.runsTasks() {
+		return runner.RunTask(s.tasks, ctx, cfg)
+	}
+
+	// API nodes record the calls they forward in their own stats, the app
+	// and route stats being served by them rather than by runner nodes.
+	// Calls no runner node took are left out, as full nodes leave out the
+	// ones refused for their queue being full.
+	start := time.Now()
+	result, info, err := s.runners.run(ctx, cfg)
+	if err != ErrNoRunnerNodes && err != runner.ErrFullQueue {
+		status := "error"
+		if err == nil {
+			status = result.Status()
+		}
+		s.Runner.Observe(cfg.AppName, cfg.Path, cfg.Target, status, time.Since(start))
+	}
+	return result, info, err
+}
+
+// handleRun runs the sync calls forwarded by API nodes.
+func (s *Server) handleRun(c *gin.Context) {
+	ctx := c.MustGet("ctx").(context.Context)
+
+	var req runRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, simpleError(models.ErrInvalidJSON))
+		return
+	}
+
+	var stdout bytes.Buffer
+	cfg := &task.Config{
+		ID:             req.ID,
+		AppName:        req.AppName,
+		Path:           req.Path,
+		Target:         req.Target,
+		Image:          req.Image,
+		Format:         req.Format,
+		Memory:         req.Memory,
+		MaxConcurrency: req.MaxConcurrency,
+		Timeout:        req.Timeout,
+		IdleTimeout:    req.IdleTimeout,
+		Env:            req.Env,
+		Stdin:          bytes.NewReader(req.Payload),
+		Stdout:         &stdout,
+	}
+
+	s.Runner.Enqueue()
+	result, info, err := runner.RunTask(s.tasks, ctx, cfg)
+	resp := runResponse{
+		WaitTime:    info.WaitTime,
+		ExecTime:    info.ExecTime,
+		Hot:         info.Hot,
+		ContainerID: info.ContainerID,
+	}
+	if err != nil {
+		resp.Error = err.Error()
+	} else {
+		resp.Status = result.Status()
+		if resp.Status != "success" {
+			resp.Error = result.Error()
+		}
+		resp.Output = stdout.Bytes()
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// runnerNode is a runner node sync calls are forwarded to.
+type runnerNode struct {
+	url string
+
+	// free is the memory the node had free as of its last report, reserved
+	// the memory of the calls forwarded to it since, in bytes.
+	free     int64
+	reserved int64
+	healthy  bool
+}
+
+// runnerPool forwards the sync calls of API nodes to the runner node with the
+// most memory free.
+type runnerPool struct {
+	token  string
+	client *http.Client
+
+	mu    sync.Mutex
+	nodes []*runnerNode
+	next  int // where ties start to be broken
+}
+
+func newRunnerPool(urls []string, token string, tlsConfig *tls.Config) *runnerPool {
+	p := &runnerPool{token: token, client: &http.Client{}}
+	if tlsConfig != nil {
+		p.client.Transport = &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		}
+	}
+	for _, u := range urls {
+		if u = strings.TrimRight(strings.TrimSpace(u), "/"); u != "" {
+			p.nodes = append(p.nodes, &runnerNode{url: u, healthy: true})
+		}
+	}
+	return p
+}
+
+// poll updates the capacity of the nodes until ctx is done.
+func (p *runnerPool) poll(ctx context.Context) {
+	ticker := time.NewTicker(runnerPollInterval)
+	defer ticker.Stop()
+	for {
+		p.update(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *runnerPool) update(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, node := range p.nodes {
+		wg.Add(1)
+		go func(node *runnerNode) {
+			defer wg.Done()
+			stats, err := p.stats(ctx, node)
+			if err != nil {
+				logrus.WithError(err).WithField("runner", node.url).Warn("Could not get runner node stats")
+			}
+
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			node.healthy = err == nil
+			if err == nil {
+				node.free = stats.Memory - stats.MemoryUsed
+				node.reserved = 0
+			}
+		}(node)
+	}
+	wg.Wait()
+}
+
+func (p *runnerPool) stats(ctx context.Context, node *runnerNode) (*runner.Stats, error) {
+	req, err := http.NewRequest(http.MethodGet, node.url+"/stats", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	var stats runner.Stats
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// pick returns the healthy node with the most memory free, reserving memory
+// on it, in bytes.
+func (p *runnerPool) pick(memory int64) *runnerNode {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var best *runnerNode
+	for i := range p.nodes {
+		node := p.nodes[(p.next+i)%len(p.nodes)]
+		if node.healthy && (best == nil || node.free-node.reserved > best.free-best.reserved) {
+			best = node
+		}
+	}
+	if best != nil {
+		best.reserved += memory
+		p.next++
+	}
+	return best
+}
+
+func (p *runnerPool) release(node *runnerNode, memory int64, healthy bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	node.reserved -= memory
+	if !healthy {
+		node.healthy = false
+	}
+}
+
+// run forwards cfg to a runner node.
+func (p *runnerPool) run(ctx context.Context, cfg *task.Config) (drivers.RunResult, task.Info, error) {
+	var info task.Info
+
+	memory := int64(cfg.Memory) * 1024 * 1024
+	if memory == 0 {
+		memory = 128 * 1024 * 1024
+	}
+	node := p.pick(memory)
+	if node == nil {
+		return nil, info, ErrNoRunnerNodes
+	}
+
+	resp, err := p.forward(ctx, node, cfg)
+	p.release(node, memory, err == nil || ctx.Err() != nil)
+	if err != nil {
+		return nil, info, err
+	}
+
+	info.WaitTime = resp.WaitTime
+	info.ExecTime = resp.ExecTime
+	info.Hot = resp.Hot
+	info.ContainerID = resp.ContainerID
+	if resp.Status == "" {
+		if resp.Error == runner.ErrFullQueue.Error() {
+			return nil, info, runner.ErrFullQueue
+		}
+		return nil, info, errors.New(resp.Error)
+	}
+	if cfg.Stdout != nil {
+		cfg.Stdout.Write(resp.Output)
+	}
+	return &runResult{status: resp.Status, err: resp.Error}, info, nil
+}
+
+func (p *runnerPool) forward(ctx context.Context, node *runnerNode, cfg *task.Config) (*runResponse, error) {
+	req := runRequest{
+		ID:             cfg.ID,
+		AppName:        cfg.AppName,
+		Path:           cfg.Path,
+		Target:         cfg.Target,
+		Image:          cfg.Image,
+		Format:         cfg.Format,
+		Memory:         cfg.Memory,
+		MaxConcurrency: cfg.MaxConcurrency,
+		Timeout:        cfg.Timeout,
+		IdleTimeout:    cfg.IdleTimeout,
+		Env:            cfg.Env,
+	}
+	if cfg.Stdin != nil {
+		payload, err := ioutil.ReadAll(cfg.Stdin)
+		if err != nil {
+			return nil, err
+		}
+		req.Payload = payload
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	hreq, err := http.NewRequest(http.MethodPost, node.url+"/run", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	hreq.Header.Set("Content-Type", "application/json")
+	if p.token != "" {
+		hreq.Header.Set("Authorization", "Bearer "+p.token)
+	}
+	hresp, err := p.client.Do(hreq.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer hresp.Body.Close()
+
+	if hresp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(hresp.Body)
+		return nil, fmt.Errorf("runner node %s: %s %s", node.url, hresp.Status, msg)
+	}
+	var resp runResponse
+	if err := json.NewDecoder(hresp.Body).Decode(&resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
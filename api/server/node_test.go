@@ -0,0 +1,203 @@
+// +build server
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iron-io/functions/api/runner"
+	"github.com/iron-io/functions/api/runner/task"
+)
+
+func TestParseNodeMode(t *testing.T) {
+	for i, test := range []struct {
+		mode     string
+		expected NodeMode
+		err      bool
+	}{
+		{"", NodeModeFull, false},
+		{"full", NodeModeFull, false},
+		{"api", NodeModeAPI, false},
+		{"runner", NodeModeRunner, false},
+		{"both", "", true},
+	} {
+		mode, err := parseNodeMode(test.mode)
+		if (err != nil) != test.err {
+			t.Errorf("Test %d: Expected error to be %v but got %v", i, test.err, err)
+		}
+		if mode != test.expected {
+			t.Errorf("Test %d: Expected mode `%s` but got `%s`", i, test.expected, mode)
+		}
+	}
+}
+
+func TestRunnerNode(t *testing.T) {
+	buf := setLogBuffer()
+	tasks := mockTasksConduit()
+	defer close(tasks)
+
+	rnr, cancel := testRunner(t)
+	defer cancel()
+
+	ctx := context.Background()
+	srv := &Server{
+		Runner: rnr,
+		Router: gin.New(),
+		tasks:  tasks,
+		mode:   NodeModeRunner,
+	}
+	srv.Router.Use(prepareMiddleware(ctx))
+	srv.bindHandlers(ctx)
+
+	for i, test := range []struct {
+		token        string
+		method       string
+		path         string
+		auth         string
+		expectedCode int
+	}{
+		{"", "GET", "/v1/apps", "", http.StatusNotFound},
+		{"", "GET", "/tasks", "", http.StatusNotFound},
+		{"", "GET", "/stats", "", http.StatusOK},
+		{"", "POST", "/run", "", http.StatusUnauthorized},
+		{"secret", "POST", "/run", "", http.StatusUnauthorized},
+		{"secret", "POST", "/run", "Bearer wrong", http.StatusUnauthorized},
+		{"secret", "POST", "/run", "Bearer secret", http.StatusBadRequest},
+	} {
+		srv.runnerToken = test.token
+
+		_, rec := routerRequestWithAuth(t, srv.Router, test.method, test.path, nil, func(req *http.Request) {
+			if test.auth != "" {
+				req.Header.Set("Authorization", test.auth)
+			}
+		})
+
+		if rec.Code != test.expectedCode {
+			t.Log(buf.String())
+			t.Errorf("Test %d: Expected status code of %s %s to be %d but was %d",
+				i, test.method, test.path, test.expectedCode, rec.Code)
+		}
+	}
+}
+
+// fakeRunnerNode serves the stats and runs of a runner node, answering every
+// run with output.
+func fakeRunnerNode(t *testing.T, memory int64, output string, runs *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/stats":
+			json.NewEncoder(w).Encode(runner.Stats{Memory: memory})
+		case "/run":
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			var req runRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("Could not decode the forwarded call: %v", err)
+			}
+			*runs++
+			json.NewEncoder(w).Encode(runResponse{Status: "success", Output: append([]byte(output), req.Payload...)})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestRunnerPool(t *testing.T) {
+	var smallRuns, bigRuns int
+	small := fakeRunnerNode(t, 256*1024*1024, "small:", &smallRuns)
+	defer small.Close()
+	big := fakeRunnerNode(t, 1024*1024*1024, "big:", &bigRuns)
+	defer big.Close()
+
+	ctx := context.Background()
+	pool := newRunnerPool([]string{small.URL, big.URL + "/", " "}, "secret", nil)
+	if len(pool.nodes) != 2 {
+		t.Fatalf("Expected 2 runner nodes but got %d", len(pool.nodes))
+	}
+	pool.update(ctx)
+
+	// Calls go to the node with the most memory free.
+	for i := 0; i < 4; i++ {
+		var stdout bytes.Buffer
+		cfg := &task.Config{
+			ID:     "call",
+			Image:  "iron/hello",
+			Memory: 128,
+			Stdin:  bytes.NewBufferString("payload"),
+			Stdout: &stdout,
+		}
+		result, _, err := pool.run(ctx, cfg)
+		if err != nil {
+			t.Fatalf("Test %d: Unexpected error: %v", i, err)
+		}
+		if result.Status() != "success" {
+			t.Errorf("Test %d: Expected status `success` but got `%s`", i, result.Status())
+		}
+		if out := stdout.String(); out != "big:payload" {
+			t.Errorf("Test %d: Expected output `big:payload` but got `%s`", i, out)
+		}
+	}
+	if smallRuns != 0 || bigRuns != 4 {
+		t.Errorf("Expected the big node to run the 4 calls, but small ran %d and big %d", smallRuns, bigRuns)
+	}
+
+	big.Close()
+	pool.update(ctx)
+	var stdout bytes.Buffer
+	if _, _, err := pool.run(ctx, &task.Config{ID: "call", Stdout: &stdout}); err != nil {
+		t.Fatalf("Unexpected error once the big node is gone: %v", err)
+	}
+	if out := stdout.String(); out != "small:" {
+		t.Errorf("Expected output `small:` but got `%s`", out)
+	}
+
+	small.Close()
+	pool.update(ctx)
+	if _, _, err := pool.run(ctx, &task.Config{ID: "call"}); err != ErrNoRunnerNodes {
+		t.Errorf("Expected error `%v` but got `%v`", ErrNoRunnerNodes, err)
+	}
+}
+
+func TestAPINodeStats(t *testing.T) {
+	var runs int
+	node := fakeRunnerNode(t, 1024*1024*1024, "", &runs)
+	defer node.Close()
+
+	rnr, cancel := testRunner(t)
+	defer cancel()
+
+	ctx := context.Background()
+	srv := &Server{
+		Runner:  rnr,
+		mode:    NodeModeAPI,
+		runners: newRunnerPool([]string{node.URL}, "secret", nil),
+	}
+	srv.runners.update(ctx)
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := srv.run(ctx, &task.Config{ID: "call", AppName: "myapp", Path: "/hello"}); err != nil {
+			t.Fatalf("Test %d: Unexpected error: %v", i, err)
+		}
+	}
+	node.Close()
+	srv.runners.update(ctx)
+	if _, _, err := srv.run(ctx, &task.Config{ID: "call", AppName: "myapp", Path: "/hello"}); err != ErrNoRunnerNodes {
+		t.Fatalf("Expected error `%v` but got `%v`", ErrNoRunnerNodes, err)
+	}
+
+	// The forwarded calls are counted, the one no runner node took is not.
+	if stats := rnr.RouteStats("myapp", "/hello"); stats.Requests != 2 || stats.Errors != 0 {
+		t.Errorf("Expected 2 successful requests in the route stats but got %d requests and %d errors", stats.Requests, stats.Errors)
+	}
+	if stats := rnr.AppStats("myapp"); stats.Requests != 2 {
+		t.Errorf("Expected 2 requests in the app stats but got %d", stats.Requests)
+	}
+}
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"encoding/base64"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iron-io/functions/api/models"
+)
+
+// queryPerPage reads the per_page query parameter, zero when it is absent.
+func queryPerPage(c *gin.Context) (int, error) {
+	perPage := c.Query("per_page")
+	if perPage == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(perPage)
+	if err != nil || n <= 0 {
+		return 0, models.ErrInvalidPerPage
+	}
+	return n, nil
+}
+
+// Cursors are opaque to clients, which only pass back the next_cursor of the
+// previous page, so that their encoding may change.
+func encodeCursor(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+func decodeCursor(cursor string) (string, error) {
+	key, err := base64.RawURLEncoding.DecodeString(cursor)
+	return string(key), err
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+	"github.com/iron-io/functions/api"
+	"github.com/iron-io/functions/api/models"
+	"github.com/iron-io/runner/common"
+)
+
+func (s *Server) handleRouteRevisions(c *gin.Context, routePath string) {
+	ctx := c.MustGet("ctx").(context.Context)
+	log := common.Logger(ctx)
+
+	appName := c.MustGet(api.AppName).(string)
+	route, err := s.route(ctx, appName, routePath, c.Query("method"))
+	if err != nil {
+		handleErrorResponse(c, err)
+		return
+	}
+
+	revs, err := s.Datastore.GetRouteRevisions(ctx, appName, routePath, models.MethodsKey(route.Methods))
+	if err != nil {
+		log.WithError(err).Error(models.ErrRouteRevisionsList)
+		c.JSON(http.StatusInternalServerError, simpleError(models.ErrRouteRevisionsList))
+		return
+	}
+
+	c.JSON(http.StatusOK, revisionsResponse{"Successfully listed route revisions", revs})
+}
+
+// handleRoutePost serves the actions on a route, which are POSTed to a
+// sub-resource of the route.
+func (s *Server) handleRoutePost(c *gin.Context) {
+	routePath := path.Clean(c.MustGet(api.Path).(string))
+
+	if base, sub := routeSubresource(routePath); sub == "rollback" {
+		s.handleRouteRollback(c, base)
+		return
+	}
+
+	c.JSON(http.StatusNotFound, simpleError(models.ErrRoutesNotFound))
+}
+
+// handleRouteRollback restores the route to one of its previous revisions,
+// which is in turn recorded as the newest revision.
+func (s *Server) handleRouteRollback(c *gin.Context, routePath string) {
+	ctx := c.MustGet("ctx").(context.Context)
+	log := common.Logger(ctx)
+
+	appName := c.MustGet(api.AppName).(string)
+
+	n, err := strconv.ParseInt(c.Query("revision"), 10, 64)
+	if err != nil || n <= 0 {
+		c.JSON(http.StatusBadRequest, simpleError(models.ErrRouteRevisionInvalid))
+		return
+	}
+
+	route, err := s.route(ctx, appName, routePath, c.Query("method"))
+	if err != nil {
+		handleErrorResponse(c, err)
+		return
+	}
+	before := route.Clone()
+
+	revs, err := s.Datastore.GetRouteRevisions(ctx, appName, routePath, models.MethodsKey(route.Methods))
+	if err != nil {
+		log.WithError(err).Error(models.ErrRouteRevisionsList)
+		c.JSON(http.StatusInternalServerError, simpleError(models.ErrRouteRevisionsList))
+		return
+	}
+
+	var rev *models.RouteRevision
+	for _, r := range revs {
+		if r.Revision == n {
+			rev = r
+			break
+		}
+	}
+	if rev == nil {
+		c.JSON(http.StatusNotFound, simpleError(models.ErrRouteRevisionNotFound))
+		return
+	}
+
+	route, err = s.Datastore.UpdateRoute(ctx, rev.Patch(before))
+	// The cache is cleared even if the update failed, as the route may
+	// still have changed in the meantime.
+	s.cachedelete(ctx, appName)
+	if err != nil {
+		log.WithError(err).Error(models.ErrRoutesRollback)
+		c.JSON(http.StatusInternalServerError, simpleError(models.ErrRoutesRollback))
+		return
+	}
+
+	s.audit(c, models.AuditRouteRollback, appName, routePath, before, route)
+	if err := s.revision(ctx, route); err != nil {
+		handleErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, routeResponse{fmt.Sprintf("Route successfully rolled back to revision %d", n), route})
+}
+
+// revision records the current state of route as its newest revision. The
+// change has already been made when it fails, which the request reports.
+func (s *Server) revision(ctx context.Context, route *models.Route) error {
+	log := common.Logger(ctx)
+
+	if _, err := s.Datastore.InsertRouteRevision(ctx, models.NewRouteRevision(route)); err != nil {
+		log.WithError(err).WithFields(logrus.Fields{"app": route.AppName, "path": route.Path}).Error("Could not record route revision")
+		return models.ErrRouteRevisionRecord
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+// +build server
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/iron-io/functions/api/datastore"
+	"github.com/iron-io/functions/api/models"
+	"github.com/iron-io/functions/api/mqs"
+)
+
+func TestRouteRevisions(t *testing.T) {
+	buf := setLogBuffer()
+	tasks := mockTasksConduit()
+	defer close(tasks)
+
+	rnr, cancel := testRunner(t)
+	defer cancel()
+
+	srv := testServer(datastore.NewMock(), &mqs.Mock{}, rnr, tasks)
+
+	for i, test := range []struct {
+		method       string
+		path         string
+		body         string
+		expectedCode int
+	}{
+		{"POST", "/v1/apps/myapp/routes", `{ "route": { "image": "iron/hello:1", "path": "/myroute", "config": { "A": "1" }, "headers": { "X-Test": ["a"] } } }`, http.StatusOK},
+		{"PATCH", "/v1/apps/myapp/routes/myroute", `{ "route": { "image": "iron/hello:2", "config": { "B": "2" }, "headers": { "X-Test": ["b"] } } }`, http.StatusOK},
+		{"POST", "/v1/apps/myapp/routes/myroute/rollback", "", http.StatusBadRequest},
+		{"POST", "/v1/apps/myapp/routes/myroute/rollback?revision=0", "", http.StatusBadRequest},
+		{"POST", "/v1/apps/myapp/routes/myroute/rollback?revision=5", "", http.StatusNotFound},
+		{"POST", "/v1/apps/myapp/routes/notfound/rollback?revision=1", "", http.StatusNotFound},
+		{"POST", "/v1/apps/myapp/routes/myroute/other", "", http.StatusNotFound},
+		{"GET", "/v1/apps/myapp/routes/notfound/revisions", "", http.StatusNotFound},
+		{"POST", "/v1/apps/myapp/routes/myroute/rollback?revision=1", "", http.StatusOK},
+	} {
+		_, rec := routerRequest(t, srv.Router, test.method, test.path, bytes.NewBufferString(test.body))
+		if rec.Code != test.expectedCode {
+			t.Log(buf.String())
+			t.Fatalf("Test %d: Expected status code to be %d but was %d", i, test.expectedCode, rec.Code)
+		}
+	}
+
+	_, rec := routerRequest(t, srv.Router, "GET", "/v1/apps/myapp/routes/myroute", nil)
+	var route struct {
+		Route *models.Route `json:"route"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&route); err != nil {
+		t.Fatal(err)
+	}
+	if route.Route.Image != "iron/hello:1" {
+		t.Errorf("Expected image to be rolled back to iron/hello:1, got %s", route.Route.Image)
+	}
+	if expected := (models.Config{"A": "1"}); !reflect.DeepEqual(route.Route.Config, expected) {
+		t.Errorf("Expected config to be rolled back to %v, got %v", expected, route.Route.Config)
+	}
+	if expected := (http.Header{"X-Test": {"a"}}); !reflect.DeepEqual(route.Route.Headers, expected) {
+		t.Errorf("Expected headers to be rolled back to %v, got %v", expected, route.Route.Headers)
+	}
+
+	_, rec = routerRequest(t, srv.Router, "GET", "/v1/apps/myapp/routes/myroute/revisions", nil)
+	if rec.Code != http.StatusOK {
+		t.Log(buf.String())
+		t.Fatalf("Expected status code to be %d but was %d", http.StatusOK, rec.Code)
+	}
+	var resp struct {
+		Revisions []*models.RouteRevision `json:"revisions"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"iron/hello:1", "iron/hello:2", "iron/hello:1"}
+	if len(resp.Revisions) != len(expected) {
+		t.Fatalf("Expected %d revisions, got %d", len(expected), len(resp.Revisions))
+	}
+	for i, rev := range resp.Revisions {
+		if n := int64(len(expected) - i); rev.Revision != n {
+			t.Errorf("Revision %d: expected number %d, got %d", i, n, rev.Revision)
+		}
+		if rev.Image != expected[i] {
+			t.Errorf("Revision %d: expected image %s, got %s", i, expected[i], rev.Image)
+		}
+	}
+}
+
+// failingRevisions is a datastore which cannot record route revisions.
+type failingRevisions struct {
+	models.Datastore
+}
+
+func (ds failingRevisions) InsertRouteRevision(ctx context.Context, rev *models.RouteRevision) (*models.RouteRevision, error) {
+	return nil, errors.New("revisions unavailable")
+}
+
+func TestRouteRevisionFailure(t *testing.T) {
+	buf := setLogBuffer()
+	tasks := mockTasksConduit()
+	defer close(tasks)
+
+	rnr, cancel := testRunner(t)
+	defer cancel()
+
+	ds := datastore.NewMockInit(
+		[]*models.App{{Name: "myapp"}},
+		[]*models.Route{{AppName: "myapp", Path: "/myroute", Image: "iron/hello:1"}},
+	)
+	srv := testServer(failingRevisions{ds}, &mqs.Mock{}, rnr, tasks)
+
+	_, rec := routerRequest(t, srv.Router, "PATCH", "/v1/apps/myapp/routes/myroute", bytes.NewBufferString(`{ "route": { "image": "iron/hello:2" } }`))
+	if rec.Code != http.StatusInternalServerError {
+		t.Log(buf.String())
+		t.Fatalf("Expected status code to be %d but was %d", http.StatusInternalServerError, rec.Code)
+	}
+	if resp := getErrorResponse(t, rec); resp.Error.Message != models.ErrRouteRevisionRecord.Error() {
+		t.Errorf("Expected error `%v` but got `%s`", models.ErrRouteRevisionRecord, resp.Error.Message)
+	}
+
+	// The change itself was made.
+	route, err := ds.GetRoute(context.Background(), "myapp", "/myroute", "")
+	if err != nil || route.Image != "iron/hello:2" {
+		t.Errorf("Expected the route to be updated to iron/hello:2 but got %v, %v", route, err)
+	}
+}
@@ -75,6 +75,10 @@ func (s *Server) handleRouteCreate(c *gin.Context) {
 			return
 		}
 
+		s.audit(c, models.AuditAppCreate, newapp.Name, "", nil, newapp)
+
+		s.cachedelete(ctx, newapp.Name)
+
 		err = s.FireAfterAppCreate(ctx, newapp)
 		if err != nil {
 			log.WithError(err).Error(models.ErrRoutesCreate)
@@ -84,13 +88,23 @@ func (s *Server) handleRouteCreate(c *gin.Context) {
 
 	}
 
+	if err := s.checkMounts(ctx, wroute.Route, wroute.Route); err != nil {
+		handleErrorResponse(c, err)
+		return
+	}
+
 	route, err := s.Datastore.InsertRoute(ctx, wroute.Route)
 	if err != nil {
 		handleErrorResponse(c, err)
 		return
 	}
 
-	s.cacherefresh(route)
+	s.audit(c, models.AuditRouteCreate, route.AppName, route.Path, nil, route)
+	s.cachedelete(ctx, route.AppName)
+	if err := s.revision(ctx, route); err != nil {
+		handleErrorResponse(c, err)
+		return
+	}
 
 	c.JSON(http.StatusOK, routeResponse{"Route successfully created", route})
 }
@@ -7,6 +7,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/iron-io/functions/api"
+	"github.com/iron-io/functions/api/models"
 )
 
 func (s *Server) handleRouteDelete(c *gin.Context) {
@@ -15,11 +16,19 @@ func (s *Server) handleRouteDelete(c *gin.Context) {
 	appName := c.MustGet(api.AppName).(string)
 	routePath := path.Clean(c.MustGet(api.Path).(string))
 
-	if err := s.Datastore.RemoveRoute(ctx, appName, routePath); err != nil {
+	route, err := s.route(ctx, appName, routePath, c.Query("method"))
+	if err != nil {
 		handleErrorResponse(c, err)
 		return
 	}
 
-	s.cachedelete(appName, routePath)
+	if err := s.Datastore.RemoveRoute(ctx, appName, routePath, models.MethodsKey(route.Methods)); err != nil {
+		handleErrorResponse(c, err)
+		return
+	}
+
+	s.audit(c, models.AuditRouteDelete, appName, routePath, route, nil)
+
+	s.cachedelete(ctx, appName)
 	c.JSON(http.StatusOK, gin.H{"message": "Route deleted"})
 }
@@ -4,9 +4,11 @@ import (
 	"context"
 	"net/http"
 	"path"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/iron-io/functions/api"
+	"github.com/iron-io/functions/api/models"
 )
 
 func (s *Server) handleRouteGet(c *gin.Context) {
@@ -15,7 +17,19 @@ func (s *Server) handleRouteGet(c *gin.Context) {
 	appName := c.MustGet(api.AppName).(string)
 	routePath := path.Clean(c.MustGet(api.Path).(string))
 
-	route, err := s.Datastore.GetRoute(ctx, appName, routePath)
+	route, err := s.route(ctx, appName, routePath, c.Query("method"))
+	if err == models.ErrRoutesNotFound {
+		// Sub-resources only apply if no route is registered under the
+		// full path.
+		switch base, sub := routeSubresource(routePath); sub {
+		case "stats":
+			s.handleRouteStats(c, base)
+			return
+		case "revisions":
+			s.handleRouteRevisions(c, base)
+			return
+		}
+	}
 	if err != nil {
 		handleErrorResponse(c, err)
 		return
@@ -23,3 +37,28 @@ func (s *Server) handleRouteGet(c *gin.Context) {
 
 	c.JSON(http.StatusOK, routeResponse{"Successfully loaded route", route})
 }
+
+// route loads the route of appName at routePath an admin request is about.
+// Routes serving different methods can share a path, method selects the one
+// serving it and is needed when there are several.
+func (s *Server) route(ctx context.Context, appName, routePath, method string) (*models.Route, error) {
+	routes, err := s.Datastore.GetRoutesByApp(ctx, appName, &models.RouteFilter{Path: routePath})
+	if err != nil {
+		return nil, err
+	}
+
+	var route *models.Route
+	for _, r := range routes {
+		if method != "" && !r.AllowsMethod(strings.ToUpper(method)) {
+			continue
+		}
+		if route != nil {
+			return nil, models.ErrRoutesAmbiguous
+		}
+		route = r
+	}
+	if route == nil {
+		return nil, models.ErrRoutesNotFound
+	}
+	return route, nil
+}
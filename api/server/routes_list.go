@@ -3,6 +3,7 @@ package server
 import (
 	"context"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/iron-io/functions/api"
@@ -12,15 +13,40 @@ import (
 func (s *Server) handleRouteList(c *gin.Context) {
 	ctx := c.MustGet("ctx").(context.Context)
 
-	filter := &models.RouteFilter{}
+	filter := &models.RouteFilter{
+		Image:  c.Query("image"),
+		Name:   c.Query("name"),
+		Type:   c.Query("type"),
+		Format: c.Query("format"),
+	}
 
-	if img := c.Query("image"); img != "" {
-		filter.Image = img
+	perPage, err := queryPerPage(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, simpleError(err))
+		return
 	}
+	filter.PerPage = perPage
 
+	// A route cursor is its app name followed by its path, which starts at the
+	// first slash since app names cannot hold one, then by a NUL byte and the
+	// key of its methods for routes restricted to some.
+	if cursor := c.Query("cursor"); cursor != "" {
+		key, err := decodeCursor(cursor)
+		i := strings.Index(key, "/")
+		if err != nil || i <= 0 {
+			c.JSON(http.StatusBadRequest, simpleError(models.ErrInvalidCursor))
+			return
+		}
+		filter.CursorApp, filter.CursorPath = key[:i], key[i:]
+		if j := strings.Index(filter.CursorPath, "\x00"); j >= 0 {
+			filter.CursorPath, filter.CursorMethods = filter.CursorPath[:j], filter.CursorPath[j+1:]
+		}
+	}
+
+	// /routes lists the routes of every app, no app name is set then.
 	var routes []*models.Route
-	var err error
-	if appName, ok := c.MustGet(api.AppName).(string); ok && appName != "" {
+	if v, _ := c.Get(api.AppName); v != nil && v.(string) != "" {
+		appName := v.(string)
 		routes, err = s.Datastore.GetRoutesByApp(ctx, appName, filter)
 	} else {
 		routes, err = s.Datastore.GetRoutes(ctx, filter)
@@ -31,5 +57,15 @@ func (s *Server) handleRouteList(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, routesResponse{"Sucessfully listed routes", routes})
+	var next string
+	if perPage > 0 && len(routes) == perPage {
+		last := routes[len(routes)-1]
+		key := last.AppName + last.Path
+		if methods := models.MethodsKey(last.Methods); methods != "" {
+			key += "\x00" + methods
+		}
+		next = encodeCursor(key)
+	}
+
+	c.JSON(http.StatusOK, routesResponse{"Sucessfully listed routes", routes, next})
 }
@@ -4,7 +4,9 @@ package server
 
 import (
 	"bytes"
+	"encoding/json"
 	"net/http"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -34,9 +36,20 @@ func TestRouteCreate(t *testing.T) {
 		{datastore.NewMock(), "/v1/apps/a/routes", `{ "route": { "image": "iron/hello" } }`, http.StatusBadRequest, models.ErrRoutesValidationMissingPath},
 		{datastore.NewMock(), "/v1/apps/a/routes", `{ "route": { "image": "iron/hello", "path": "myroute" } }`, http.StatusBadRequest, models.ErrRoutesValidationInvalidPath},
 		{datastore.NewMock(), "/v1/apps/$/routes", `{ "route": { "image": "iron/hello", "path": "/myroute" } }`, http.StatusInternalServerError, models.ErrAppsValidationInvalidName},
+		{datastore.NewMock(), "/v1/apps/a/routes", `{ "route": { "image": "iron/hello", "path": "/myroute", "targets": [ { "weight": 1 } ] } }`, http.StatusBadRequest, models.ErrRoutesValidationMissingTargetName},
+		{datastore.NewMock(), "/v1/apps/a/routes", `{ "route": { "image": "iron/hello", "path": "/myroute", "targets": [ { "name": "a", "weight": 1 }, { "name": "a", "weight": 1 } ] } }`, http.StatusBadRequest, models.ErrRoutesValidationDuplicateTargetName},
+		{datastore.NewMock(), "/v1/apps/a/routes", `{ "route": { "image": "iron/hello", "path": "/myroute", "targets": [ { "name": "a", "weight": 0 } ] } }`, http.StatusBadRequest, models.ErrRoutesValidationZeroTargetWeights},
+		{datastore.NewMock(), "/v1/apps/a/routes", `{ "route": { "image": "iron/hello", "path": "/myroute", "methods": [ "get" ] } }`, http.StatusBadRequest, models.ErrRoutesValidationInvalidMethod},
+		{datastore.NewMock(), "/v1/apps/a/routes", `{ "route": { "image": "iron/hello", "path": "/users/:" } }`, http.StatusBadRequest, models.ErrRoutesValidationInvalidWildcard},
+		{datastore.NewMock(), "/v1/apps/a/routes", `{ "route": { "image": "iron/hello", "path": "/users/a:id" } }`, http.StatusBadRequest, models.ErrRoutesValidationInvalidWildcard},
+		{datastore.NewMock(), "/v1/apps/a/routes", `{ "route": { "image": "iron/hello", "path": "/files/*path/more" } }`, http.StatusBadRequest, models.ErrRoutesValidationInvalidWildcard},
+		{datastore.NewMock(), "/v1/apps/a/routes", `{ "route": { "image": "iron/hello", "path": "/myroute", "methods": [ "GET", "GET" ] } }`, http.StatusBadRequest, models.ErrRoutesValidationDuplicateMethod},
 
 		// success
 		{datastore.NewMock(), "/v1/apps/a/routes", `{ "route": { "image": "iron/hello", "path": "/myroute" } }`, http.StatusOK, nil},
+		{datastore.NewMock(), "/v1/apps/a/routes", `{ "route": { "image": "iron/hello", "path": "/myroute", "targets": [ { "name": "stable", "weight": 95 }, { "name": "canary", "image": "iron/hello:next", "weight": 5 } ] } }`, http.StatusOK, nil},
+		{datastore.NewMock(), "/v1/apps/a/routes", `{ "route": { "image": "iron/hello", "path": "/myroute", "methods": [ "GET", "HEAD" ] } }`, http.StatusOK, nil},
+		{datastore.NewMock(), "/v1/apps/a/routes", `{ "route": { "image": "iron/hello", "path": "/users/:id/files/*path" } }`, http.StatusOK, nil},
 	} {
 		rnr, cancel := testRunner(t)
 		srv := testServer(test.mock, &mqs.Mock{}, rnr, tasks)
@@ -124,6 +137,9 @@ func TestRouteList(t *testing.T) {
 		expectedError error
 	}{
 		{"/v1/apps/a/routes", "", http.StatusOK, nil},
+		{"/v1/apps/a/routes?image=iron/&type=sync&format=http&name=hello*", "", http.StatusOK, nil},
+		{"/v1/apps/a/routes?per_page=-1", "", http.StatusBadRequest, models.ErrInvalidPerPage},
+		{"/v1/apps/a/routes?cursor=YQ", "", http.StatusBadRequest, models.ErrInvalidCursor},
 	} {
 		_, rec := routerRequest(t, srv.Router, "GET", test.path, nil)
 
@@ -145,6 +161,69 @@ func TestRouteList(t *testing.T) {
 	}
 }
 
+func TestRouteListPages(t *testing.T) {
+	buf := setLogBuffer()
+	tasks := mockTasksConduit()
+	defer close(tasks)
+
+	rnr, cancel := testRunner(t)
+	defer cancel()
+	ds := datastore.NewMockInit(
+		[]*models.App{{Name: "a"}, {Name: "b"}},
+		[]*models.Route{
+			{AppName: "b", Path: "/hello", Image: "iron/hello"},
+			{AppName: "a", Path: "/hello/world", Image: "iron/hello"},
+			{AppName: "a", Path: "/error", Image: "iron/error"},
+			{AppName: "a", Path: "/hello", Image: "iron/hello"},
+			{AppName: "b", Path: "/users", Image: "iron/create", Methods: []string{"POST"}},
+			{AppName: "b", Path: "/users", Image: "iron/list", Methods: []string{"HEAD", "GET"}},
+		},
+	)
+	srv := testServer(ds, &mqs.Mock{}, rnr, tasks)
+
+	for i, test := range []struct {
+		path     string
+		expected [][]string
+	}{
+		{"/v1/apps/a/routes?per_page=2", [][]string{{"a/error", "a/hello"}, {"a/hello/world"}}},
+		{"/v1/apps/a/routes?per_page=1&image=iron/hello", [][]string{{"a/hello"}, {"a/hello/world"}, nil}},
+		{"/v1/routes?per_page=2&image=iron/hello", [][]string{{"a/hello", "a/hello/world"}, {"b/hello"}}},
+		{"/v1/apps/b/routes?per_page=2", [][]string{{"b/hello", "b/users HEAD,GET"}, {"b/users POST"}}},
+	} {
+		var pages [][]string
+		path := test.path
+		for len(pages) < 4 {
+			_, rec := routerRequest(t, srv.Router, "GET", path, nil)
+			if rec.Code != http.StatusOK {
+				t.Log(buf.String())
+				t.Fatalf("Test %d: Expected status code to be %d but was %d", i, http.StatusOK, rec.Code)
+			}
+			var resp routesResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			var routes []string
+			for _, route := range resp.Routes {
+				name := route.AppName + route.Path
+				if len(route.Methods) > 0 {
+					name += " " + strings.Join(route.Methods, ",")
+				}
+				routes = append(routes, name)
+			}
+			pages = append(pages, routes)
+			if resp.NextCursor == "" {
+				break
+			}
+			path = test.path + "&cursor=" + resp.NextCursor
+		}
+
+		if !reflect.DeepEqual(pages, test.expected) {
+			t.Log(buf.String())
+			t.Errorf("Test %d: Expected pages %v, got %v", i, test.expected, pages)
+		}
+	}
+}
+
 func TestRouteGet(t *testing.T) {
 	buf := setLogBuffer()
 	tasks := mockTasksConduit()
@@ -246,3 +325,70 @@ func TestRouteUpdate(t *testing.T) {
 		cancel()
 	}
 }
+
+func TestRouteMethods(t *testing.T) {
+	buf := setLogBuffer()
+	tasks := mockTasksConduit()
+	defer close(tasks)
+
+	rnr, cancel := testRunner(t)
+	defer cancel()
+	srv := testServer(datastore.NewMockInit(
+		[]*models.App{{Name: "a"}},
+		[]*models.Route{
+			{AppName: "a", Path: "/users", Image: "iron/list", Methods: []string{"GET", "HEAD"}},
+			{AppName: "a", Path: "/users", Image: "iron/create", Methods: []string{"POST"}},
+		},
+	), &mqs.Mock{}, rnr, tasks)
+
+	// Routes serving different methods share /users, requests about one of
+	// them select it with the method query parameter.
+	for i, test := range []struct {
+		method        string
+		path          string
+		body          string
+		expectedCode  int
+		expectedError error
+		expectedImage string
+	}{
+		{"GET", "/v1/apps/a/routes/users", ``, http.StatusConflict, models.ErrRoutesAmbiguous, ""},
+		{"GET", "/v1/apps/a/routes/users?method=head", ``, http.StatusOK, nil, "iron/list"},
+		{"GET", "/v1/apps/a/routes/users?method=POST", ``, http.StatusOK, nil, "iron/create"},
+		{"GET", "/v1/apps/a/routes/users?method=PUT", ``, http.StatusNotFound, models.ErrRoutesNotFound, ""},
+		{"POST", "/v1/apps/a/routes", `{ "route": { "image": "iron/update", "path": "/users", "methods": [ "GET" ] } }`, http.StatusConflict, models.ErrRoutesMountConflict, ""},
+		{"POST", "/v1/apps/a/routes", `{ "route": { "image": "iron/update", "path": "/users", "methods": [ "PUT" ] } }`, http.StatusOK, nil, "iron/update"},
+		{"PATCH", "/v1/apps/a/routes/users?method=PUT", `{ "route": { "methods": [ "POST" ] } }`, http.StatusConflict, models.ErrRoutesMountConflict, ""},
+		{"PATCH", "/v1/apps/a/routes/users?method=PUT", `{ "route": { "methods": [ "PUT", "PATCH" ] } }`, http.StatusOK, nil, "iron/update"},
+		{"PATCH", "/v1/apps/a/routes/users?method=POST", `{ "route": { "image": "iron/create:2" } }`, http.StatusOK, nil, "iron/create:2"},
+		{"GET", "/v1/apps/a/routes/users?method=GET", ``, http.StatusOK, nil, "iron/list"},
+		{"DELETE", "/v1/apps/a/routes/users?method=PATCH", ``, http.StatusOK, nil, ""},
+		{"GET", "/v1/apps/a/routes/users?method=PUT", ``, http.StatusNotFound, models.ErrRoutesNotFound, ""},
+		{"GET", "/v1/apps/a/routes/users?method=POST", ``, http.StatusOK, nil, "iron/create:2"},
+	} {
+		_, rec := routerRequest(t, srv.Router, test.method, test.path, bytes.NewBufferString(test.body))
+
+		if rec.Code != test.expectedCode {
+			t.Log(buf.String())
+			t.Fatalf("Test %d: Expected status code to be %d but was %d: %s",
+				i, test.expectedCode, rec.Code, rec.Body.String())
+		}
+
+		if test.expectedError != nil {
+			resp := getErrorResponse(t, rec)
+			if !strings.Contains(resp.Error.Message, test.expectedError.Error()) {
+				t.Errorf("Test %d: Expected error message to have `%s`, but it was `%s`",
+					i, test.expectedError, resp.Error.Message)
+			}
+		}
+
+		if test.expectedImage != "" {
+			var resp routeResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Route.Image != test.expectedImage {
+				t.Errorf("Test %d: Expected image `%s`, got `%s`", i, test.expectedImage, resp.Route.Image)
+			}
+		}
+	}
+}
@@ -56,13 +56,34 @@ func (s *Server) handleRouteUpdate(c *gin.Context) {
 		// }
 	}
 
-	route, err := s.Datastore.UpdateRoute(ctx, wroute.Route)
+	before, err := s.route(ctx, wroute.Route.AppName, wroute.Route.Path, c.Query("method"))
 	if err != nil {
 		handleErrorResponse(c, err)
 		return
 	}
+	// the datastore may hand out the stored value itself, keep a copy for
+	// the audit trail before it gets updated.
+	before = before.Clone()
 
-	s.cacherefresh(route)
+	merged := before.Clone()
+	merged.Update(wroute.Route)
+	if err := s.checkMounts(ctx, merged, before); err != nil {
+		handleErrorResponse(c, err)
+		return
+	}
+
+	route, err := s.updateRoute(ctx, before, wroute.Route)
+	if err != nil {
+		handleErrorResponse(c, err)
+		return
+	}
+
+	s.audit(c, models.AuditRouteUpdate, route.AppName, route.Path, before, route)
+	s.cachedelete(ctx, route.AppName)
+	if err := s.revision(ctx, route); err != nil {
+		handleErrorResponse(c, err)
+		return
+	}
 
 	c.JSON(http.StatusOK, routeResponse{"Route successfully updated", route})
 }
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/iron-io/functions/api/models"
+)
+
+// routeTree matches call paths against the paths and aliases of the routes
+// of an app, which may have :param segments and a final *wildcard segment.
+type routeTree struct {
+	root node
+}
+
+// mount lists the routes mounted at the same path, which serve different
+// HTTP methods.
+type mount struct {
+	path   string
+	routes []*models.Route
+}
+
+// newRouteTree compiles the mounts of routes into a tree. Mounts that
+// conflict with the ones already in the tree, such as /users/:id and
+// /users/new, are left out and reported by the error.
+func newRouteTree(routes []*models.Route) (*routeTree, error) {
+	mounts := map[string]*mount{}
+	for _, r := range routes {
+		for _, m := range r.Mounts() {
+			if mounts[m] == nil {
+				mounts[m] = &mount{path: m}
+			}
+			mounts[m].routes = append(mounts[m].routes, r)
+		}
+	}
+
+	paths := make([]string, 0, len(mounts))
+	for p := range mounts {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	t := &routeTree{}
+	var conflict error
+	for _, p := range paths {
+		if err := t.add(p, mounts[p]); err != nil && conflict == nil {
+			conflict = err
+		}
+	}
+	return t, conflict
+}
+
+// add inserts m at path, reporting conflicts with the paths already in the
+// tree as errors.
+func (t *routeTree) add(path string, m *mount) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	t.root.addRoute(path, m)
+	return nil
+}
+
+// lookup returns the mount whose path matches callPath, along with the
+// values of its parameters, or nil if there is none.
+func (t *routeTree) lookup(callPath string) (*mount, Params) {
+	h, params, _ := t.root.getValue(callPath)
+	if h == nil {
+		return nil, nil
+	}
+	return h.(*mount), params
+}
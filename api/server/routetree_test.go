@@ -0,0 +1,193 @@
+// +build server
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iron-io/functions/api/cachebus"
+	"github.com/iron-io/functions/api/datastore"
+	"github.com/iron-io/functions/api/models"
+	"github.com/iron-io/functions/api/mqs"
+)
+
+func TestRouteTree(t *testing.T) {
+	users := &models.Route{AppName: "myapp", Path: "/users/:id", Aliases: []string{"/people/:id"}}
+	files := &models.Route{AppName: "myapp", Path: "/files/*path"}
+	static := &models.Route{AppName: "myapp", Path: "/static"}
+	post := &models.Route{AppName: "myapp", Path: "/create-static", Methods: []string{"POST"}, Aliases: []string{"/static"}}
+
+	tree, err := newRouteTree([]*models.Route{users, files, static, post})
+	if err != nil {
+		t.Fatalf("Unexpected error compiling routes: %v", err)
+	}
+
+	for i, test := range []struct {
+		path           string
+		expectedMount  string
+		expectedRoutes []*models.Route
+		expectedParams Params
+	}{
+		{"/users/1", "/users/:id", []*models.Route{users}, Params{{"id", "1"}}},
+		{"/people/2", "/people/:id", []*models.Route{users}, Params{{"id", "2"}}},
+		{"/files/a/b.txt", "/files/*path", []*models.Route{files}, Params{{"path", "/a/b.txt"}}},
+		{"/static", "/static", []*models.Route{static, post}, nil},
+		{"/users", "", nil, nil},
+		{"/users/1/more", "", nil, nil},
+		{"/other", "", nil, nil},
+	} {
+		var mounted string
+		var routes []*models.Route
+		m, params := tree.lookup(test.path)
+		if m != nil {
+			mounted, routes = m.path, m.routes
+		}
+		if mounted != test.expectedMount {
+			t.Errorf("Test %d: expected %s to match %s, got %s", i, test.path, test.expectedMount, mounted)
+		}
+		if !reflect.DeepEqual(routes, test.expectedRoutes) {
+			t.Errorf("Test %d: expected routes %v for %s, got %v", i, test.expectedRoutes, test.path, routes)
+		}
+		if !reflect.DeepEqual(params, test.expectedParams) {
+			t.Errorf("Test %d: expected params %v for %s, got %v", i, test.expectedParams, test.path, params)
+		}
+	}
+
+	if m, _ := (&routeTree{}).lookup("/users/1"); m != nil {
+		t.Errorf("Expected no routes from an empty tree, got %v", m.routes)
+	}
+
+	for i, conflicting := range [][]string{
+		{"/users/:id", "/users/new"},
+		{"/users/:id", "/users/:uid"},
+		{"/files/*path", "/files/new"},
+	} {
+		var routes []*models.Route
+		for _, p := range conflicting {
+			routes = append(routes, &models.Route{AppName: "myapp", Path: p})
+		}
+		if _, err := newRouteTree(routes); err == nil {
+			t.Errorf("Test %d: expected paths %v to conflict", i, conflicting)
+		}
+	}
+}
+
+func TestRouteTreeCache(t *testing.T) {
+	buf := setLogBuffer()
+	tasks := mockTasksConduit()
+	defer close(tasks)
+
+	rnr, cancel := testRunner(t)
+	defer cancel()
+
+	srv := testServer(datastore.NewMock(), &mqs.Mock{}, rnr, tasks)
+
+	for i, test := range []struct {
+		method            string
+		path              string
+		body              string
+		expectedCode      int
+		expectedCacheSize int
+	}{
+		{"POST", "/v1/apps/myapp/routes", `{ "route": { "image": "iron/hello", "path": "/users/:id", "methods": ["GET"] } }`, http.StatusOK, 0},
+		{"POST", "/v1/apps/myapp/routes", `{ "route": { "image": "iron/hello", "path": "/users/new" } }`, http.StatusConflict, 0},
+		{"POST", "/v1/apps/myapp/routes", `{ "route": { "image": "iron/hello", "path": "/other", "aliases": ["/users/:uid"] } }`, http.StatusConflict, 0},
+		{"PUT", "/r/myapp/users/1", ``, http.StatusMethodNotAllowed, 1},
+		{"PUT", "/r/myapp/users", ``, http.StatusNotFound, 1},
+		{"PATCH", "/v1/apps/myapp/routes/users/:id", `{ "route": { "methods": ["DELETE"] } }`, http.StatusOK, 0},
+		{"PUT", "/r/myapp/users/1", ``, http.StatusMethodNotAllowed, 1},
+		{"DELETE", "/v1/apps/myapp/routes/users/:id", ``, http.StatusOK, 0},
+		{"PUT", "/r/myapp/users/1", ``, http.StatusNotFound, 1},
+	} {
+		_, rec := routerRequest(t, srv.Router, test.method, test.path, bytes.NewBufferString(test.body))
+		if rec.Code != test.expectedCode {
+			t.Log(buf.String())
+			t.Fatalf("Test %d: Expected status code to be %d but was %d", i, test.expectedCode, rec.Code)
+		}
+		if srv.hotroutes.Len() != test.expectedCacheSize {
+			t.Fatalf("Test %d: Expected cache size to be %d but was %d", i, test.expectedCacheSize, srv.hotroutes.Len())
+		}
+	}
+
+	srv.cachedelete(context.Background(), "myapp")
+	_, rec := routerRequest(t, srv.Router, "PUT", "/r/myapp/users/1", &bytes.Buffer{})
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status code to be %d but was %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+func TestRouteTreeCacheBus(t *testing.T) {
+	buf := setLogBuffer()
+	tasks := mockTasksConduit()
+	defer close(tasks)
+
+	rnr, cancel := testRunner(t)
+	defer cancel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// two nodes sharing a datastore and a bus
+	ds, bus := datastore.NewMock(), cachebus.NewMemoryBus()
+	nodes := []*Server{
+		testServer(ds, &mqs.Mock{}, rnr, tasks),
+		testServer(ds, &mqs.Mock{}, rnr, tasks),
+	}
+	for _, srv := range nodes {
+		EnableCacheBus(bus)(srv)
+
+		var once sync.Once
+		subscribed := make(chan struct{})
+		go bus.Subscribe(ctx, func(appName string) {
+			srv.cacheevict(appName)
+			once.Do(func() { close(subscribed) })
+		})
+		<-subscribed
+	}
+
+	for i, test := range []struct {
+		node         int
+		method       string
+		path         string
+		body         string
+		expectedCode int
+	}{
+		{0, "POST", "/v1/apps/myapp/routes", `{ "route": { "image": "iron/hello", "path": "/users/:id", "methods": ["GET"] } }`, http.StatusOK},
+		{0, "PUT", "/r/myapp/users/1", ``, http.StatusMethodNotAllowed},
+		{1, "PUT", "/r/myapp/users/1", ``, http.StatusMethodNotAllowed},
+		{0, "DELETE", "/v1/apps/myapp/routes/users/:id", ``, http.StatusOK},
+		{1, "PUT", "/r/myapp/users/1", ``, http.StatusNotFound},
+	} {
+		_, rec := routerRequest(t, nodes[test.node].Router, test.method, test.path, bytes.NewBufferString(test.body))
+		if rec.Code != test.expectedCode {
+			t.Log(buf.String())
+			t.Fatalf("Test %d: Expected status code to be %d but was %d", i, test.expectedCode, rec.Code)
+		}
+	}
+}
+
+func TestRouteTreeCacheTTL(t *testing.T) {
+	tasks := mockTasksConduit()
+	defer close(tasks)
+
+	rnr, cancel := testRunner(t)
+	defer cancel()
+
+	srv := testServer(datastore.NewMock(), &mqs.Mock{}, rnr, tasks)
+	EnableCacheTTL(time.Millisecond)(srv)
+
+	srv.cacheset("myapp", &cachedApp{app: &models.App{Name: "myapp"}, tree: &routeTree{}}, 0)
+	if _, _, ok := srv.cacheget("myapp"); !ok {
+		t.Fatal("Expected the routing tree to be cached")
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, _, ok := srv.cacheget("myapp"); ok {
+		t.Error("Expected the routing tree to expire")
+	}
+}
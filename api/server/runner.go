@@ -9,12 +9,15 @@ import (
 	"io/ioutil"
 	"net/http"
 	"path"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/gin-gonic/gin"
+	"github.com/go-openapi/strfmt"
 	"github.com/iron-io/functions/api"
+	"github.com/iron-io/functions/api/accesslog"
 	"github.com/iron-io/functions/api/models"
 	"github.com/iron-io/functions/api/runner"
 	"github.com/iron-io/functions/api/runner/task"
@@ -79,20 +82,45 @@ func (s *Server) handleRequest(c *gin.Context, enqueue models.Enqueue) {
 	reqID := uuid.NewV5(uuid.Nil, fmt.Sprintf("%s%s%d", c.Request.RemoteAddr, c.Request.URL.Path, time.Now().Unix())).String()
 	ctx, log := common.LoggerWithFields(ctx, logrus.Fields{"call_id": reqID})
 
+	entry := &accesslog.Entry{
+		Time:       time.Now(),
+		RemoteAddr: c.ClientIP(),
+		Method:     c.Request.Method,
+		URL:        c.Request.URL.RequestURI(),
+		Proto:      c.Request.Proto,
+		Referer:    c.Request.Referer(),
+		UserAgent:  c.Request.UserAgent(),
+		AppName:    c.MustGet(api.AppName).(string),
+		CallID:     reqID,
+	}
+	defer func() {
+		entry.Status = c.Writer.Status()
+		if size := c.Writer.Size(); size > 0 {
+			entry.BytesOut = int64(size)
+		}
+		if err := s.accessLog.Log(entry); err != nil {
+			log.WithError(err).Error("Could not write access log")
+		}
+	}()
+
 	var err error
 	var payload io.Reader
 
-	if c.Request.Method == "POST" {
+	switch c.Request.Method {
+	case "POST", "PUT", "PATCH":
 		payload = c.Request.Body
 		// Load complete body and close
 		defer func() {
 			io.Copy(ioutil.Discard, c.Request.Body)
 			c.Request.Body.Close()
 		}()
-	} else if c.Request.Method == "GET" {
+	case "GET":
 		reqPayload := c.Request.URL.Query().Get("payload")
 		payload = strings.NewReader(reqPayload)
 	}
+	if payload != nil {
+		payload = &countingReader{r: payload, n: &entry.BytesIn}
+	}
 
 	reqRoute := &models.Route{
 		AppName: c.MustGet(api.AppName).(string),
@@ -104,29 +132,32 @@ func (s *Server) handleRequest(c *gin.Context, enqueue models.Enqueue) {
 	appName := reqRoute.AppName
 	path := reqRoute.Path
 
-	app, err := s.Datastore.GetApp(ctx, appName)
-	if err != nil || app == nil {
+	cached, err := s.loadapp(ctx, appName)
+	if err != nil || cached.app == nil {
 		log.WithError(err).Error(models.ErrAppsNotFound)
 		c.JSON(http.StatusNotFound, simpleError(models.ErrAppsNotFound))
 		return
 	}
+	app := cached.app
 
-	log.WithFields(logrus.Fields{"app": appName, "path": path}).Debug("Finding route on datastore")
-	routes, err := s.loadroutes(ctx, models.RouteFilter{AppName: appName, Path: path})
-	if err != nil {
-		log.WithError(err).Error(models.ErrRoutesList)
-		c.JSON(http.StatusInternalServerError, simpleError(models.ErrRoutesList))
+	log.WithFields(logrus.Fields{"app": appName, "path": path}).Debug("Finding route")
+	route, mounted, params, allowed := findroute(cached.tree, path, c.Request.Method)
+
+	if route == nil && len(allowed) > 0 {
+		log.WithField("method", c.Request.Method).Error(models.ErrRunnerMethodNotAllowed)
+		c.Header("Allow", strings.Join(allowed, ", "))
+		c.JSON(http.StatusMethodNotAllowed, simpleError(models.ErrRunnerMethodNotAllowed))
 		return
 	}
 
-	if len(routes) == 0 {
-		log.WithError(err).Error(models.ErrRunnerRouteNotFound)
+	if route == nil {
+		log.Error(models.ErrRunnerRouteNotFound)
 		c.JSON(http.StatusNotFound, simpleError(models.ErrRunnerRouteNotFound))
 		return
 	}
 
-	log.WithField("routes", len(routes)).Debug("Got routes from datastore")
-	route := routes[0]
+	entry.Route = route.Path
+	c.Header(RouteHeader, mounted)
 	log = log.WithFields(logrus.Fields{"app": appName, "path": route.Path, "image": route.Image})
 
 	if err = f_common.AuthJwt(route.JwtKey, c.Request); err != nil {
@@ -136,37 +167,77 @@ func (s *Server) handleRequest(c *gin.Context, enqueue models.Enqueue) {
 		return
 	}
 
-	if s.serve(ctx, c, appName, route, app, path, reqID, payload, enqueue) {
-		s.FireAfterDispatch(ctx, reqRoute)
-		return
-	}
-
-	log.Error(models.ErrRunnerRouteNotFound)
-	c.JSON(http.StatusNotFound, simpleError(models.ErrRunnerRouteNotFound))
+	s.serve(ctx, c, appName, route, app, params, reqID, payload, enqueue, entry)
+	s.FireAfterDispatch(ctx, reqRoute)
 }
 
-func (s *Server) loadroutes(ctx context.Context, filter models.RouteFilter) ([]*models.Route, error) {
-	if route, ok := s.cacheget(filter.AppName, filter.Path); ok {
-		return []*models.Route{route}, nil
+// loadapp returns appName along with the routing tree compiled from its
+// routes, loading them from the datastore if they are not cached. If the app
+// does not exist, the returned app is nil.
+func (s *Server) loadapp(ctx context.Context, appName string) (*cachedApp, error) {
+	cached, gen, ok := s.cacheget(appName)
+	if ok {
+		return cached, nil
 	}
 	resp, err := s.singleflight.do(
-		filter,
+		models.RouteFilter{AppName: appName},
 		func() (interface{}, error) {
-			return s.Datastore.GetRoutesByApp(ctx, filter.AppName, &filter)
+			app, err := s.Datastore.GetApp(ctx, appName)
+			if err == models.ErrAppsNotFound || (err == nil && app == nil) {
+				cached := &cachedApp{tree: &routeTree{}}
+				s.cacheset(appName, cached, gen)
+				return cached, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			routes, err := s.Datastore.GetRoutesByApp(ctx, appName, &models.RouteFilter{AppName: appName})
+			if err != nil {
+				return nil, err
+			}
+			tree, err := newRouteTree(routes)
+			if err != nil {
+				// routes are checked for conflicts when stored, this
+				// one slipped through. Serve the others anyway.
+				common.Logger(ctx).WithError(err).WithField("app", appName).Error("Conflicting route paths")
+			}
+
+			cached := &cachedApp{app: app, tree: tree}
+			s.cacheset(appName, cached, gen)
+			return cached, nil
 		},
 	)
-	return resp.([]*models.Route), err
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*cachedApp), nil
+}
+
+// findroute finds the route of tree that serves calls to routePath made with
+// method, along with the path it is mounted at and the values of the path
+// parameters. If routes are mounted at the path matching routePath but none of
+// them serves method, it returns the methods they serve instead.
+func findroute(tree *routeTree, routePath, method string) (*models.Route, string, Params, []string) {
+	m, params := tree.lookup(routePath)
+	if m == nil {
+		return nil, "", nil, nil
+	}
+	var allowed []string
+	for _, r := range m.routes {
+		if r.AllowsMethod(method) {
+			return r, m.path, params, nil
+		}
+		allowed = append(allowed, r.Methods...)
+	}
+	sort.Strings(allowed)
+	return nil, "", nil, allowed
 }
 
 // TODO: Should remove *gin.Context from these functions, should use only context.Context
-func (s *Server) serve(ctx context.Context, c *gin.Context, appName string, found *models.Route, app *models.App, route, reqID string, payload io.Reader, enqueue models.Enqueue) (ok bool) {
+func (s *Server) serve(ctx context.Context, c *gin.Context, appName string, found *models.Route, app *models.App, params Params, reqID string, payload io.Reader, enqueue models.Enqueue, entry *accesslog.Entry) {
 	ctx, log := common.LoggerWithFields(ctx, logrus.Fields{"app": appName, "route": found.Path, "image": found.Image})
 
-	params, match := matchRoute(found.Path, route)
-	if !match {
-		return false
-	}
-
 	var stdout bytes.Buffer // TODO: should limit the size of this, error if gets too big. akin to: https://golang.org/pkg/io/#LimitReader
 
 	envVars := map[string]string{
@@ -188,6 +259,24 @@ func (s *Server) serve(ctx context.Context, c *gin.Context, appName string, foun
 		envVars[toEnvName("", k)] = v
 	}
 
+	image := found.Image
+	target, sticky := pickTarget(c.Request, found)
+	if target != nil {
+		for k, v := range target.Config {
+			envVars[toEnvName("", k)] = v
+		}
+		if target.Image != "" {
+			image = target.Image
+		}
+		log = log.WithFields(logrus.Fields{"target": target.Name, "image": image})
+
+		c.Header(TargetHeader, target.Name)
+		if !sticky {
+			http.SetCookie(c.Writer, &http.Cookie{Name: targetCookie, Value: target.Name, Path: requestPath(c.Request)})
+		}
+		entry.Target = target.Name
+	}
+
 	// params
 	for _, param := range params {
 		envVars[toEnvName("PARAM", param.Key)] = param.Value
@@ -204,7 +293,7 @@ func (s *Server) serve(ctx context.Context, c *gin.Context, appName string, foun
 		Env:            envVars,
 		Format:         found.Format,
 		ID:             reqID,
-		Image:          found.Image,
+		Image:          image,
 		MaxConcurrency: found.MaxConcurrency,
 		Memory:         found.Memory,
 		Stdin:          payload,
@@ -212,8 +301,13 @@ func (s *Server) serve(ctx context.Context, c *gin.Context, appName string, foun
 		Timeout:        time.Duration(found.Timeout) * time.Second,
 		IdleTimeout:    time.Duration(found.IdleTimeout) * time.Second,
 	}
+	if target != nil {
+		cfg.Target = target.Name
+	}
 
-	s.Runner.Enqueue()
+	if s.runsTasks() {
+		s.Runner.Enqueue()
+	}
 	switch found.Type {
 	case "async":
 		// Read payload
@@ -221,7 +315,7 @@ func (s *Server) serve(ctx context.Context, c *gin.Context, appName string, foun
 		if err != nil {
 			log.WithError(err).Error(models.ErrInvalidPayload)
 			c.JSON(http.StatusBadRequest, simpleError(models.ErrInvalidPayload))
-			return true
+			return
 		}
 
 		// Create Task
@@ -232,17 +326,30 @@ func (s *Server) serve(ctx context.Context, c *gin.Context, appName string, foun
 		task.Path = found.Path
 		task.AppName = cfg.AppName
 		task.Priority = &priority
+		task.Timeout = &found.Timeout
+		task.IdleTimeout = &found.IdleTimeout
 		task.EnvVars = cfg.Env
 		task.Payload = string(pl)
+		task.CreatedAt = strfmt.DateTime(time.Now())
 		// Push to queue
-		enqueue(c, s.MQ, task)
+		if _, err := enqueue(c, s.MQ, task); err == nil {
+			s.queued.notify()
+		}
 		log.Info("Added new task to queue")
 		c.JSON(http.StatusAccepted, map[string]string{"call_id": task.ID})
 
 	default:
-		result, err := runner.RunTask(s.tasks, ctx, cfg)
+		result, info, err := s.run(ctx, cfg)
+		entry.WaitTime = info.WaitTime
+		entry.ExecTime = info.ExecTime
+		entry.Hot = info.Hot
+		entry.ContainerID = info.ContainerID
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, runnerResponse{
+			status := http.StatusInternalServerError
+			if err == ErrNoRunnerNodes || err == runner.ErrFullQueue {
+				status = http.StatusServiceUnavailable
+			}
+			c.JSON(status, runnerResponse{
 				RequestID: cfg.ID,
 				Error: &models.ErrorBody{
 					Message: err.Error(),
@@ -274,19 +381,17 @@ func (s *Server) serve(ctx context.Context, c *gin.Context, appName string, foun
 			})
 		}
 	}
-
-	return true
 }
 
-var fakeHandler = func(http.ResponseWriter, *http.Request, Params) {}
-
-func matchRoute(baseRoute, route string) (Params, bool) {
-	tree := &node{}
-	tree.addRoute(baseRoute, fakeHandler)
-	handler, p, _ := tree.getValue(route)
-	if handler == nil {
-		return nil, false
-	}
+// countingReader counts the bytes read from the request payload, for the
+// access log.
+type countingReader struct {
+	r io.Reader
+	n *int64
+}
 
-	return p, true
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	*c.n += int64(n)
+	return n, err
 }
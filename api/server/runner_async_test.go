@@ -47,9 +47,9 @@ func TestRouteRunnerAsyncExecution(t *testing.T) {
 			{Name: "myapp", Config: map[string]string{"app": "true"}},
 		},
 		[]*models.Route{
-			{Type: "async", Path: "/myroute", AppName: "myapp", Image: "iron/hello", Config: map[string]string{"test": "true"}},
-			{Type: "async", Path: "/myerror", AppName: "myapp", Image: "iron/error", Config: map[string]string{"test": "true"}},
-			{Type: "async", Path: "/myroute/:param", AppName: "myapp", Image: "iron/hello", Config: map[string]string{"test": "true"}},
+			{Type: "async", Path: "/myroute", AppName: "myapp", Image: "iron/hello", Timeout: 60, Config: map[string]string{"test": "true"}},
+			{Type: "async", Path: "/myerror", AppName: "myapp", Image: "iron/error", Timeout: 60, Config: map[string]string{"test": "true"}},
+			{Type: "async", Path: "/myroute/:param", AppName: "myapp", Image: "iron/hello", Timeout: 60, Config: map[string]string{"test": "true"}},
 		},
 	)
 	mq := &mqs.Mock{}
@@ -89,6 +89,11 @@ func TestRouteRunnerAsyncExecution(t *testing.T) {
 				t.Errorf("Test %d: Expected task Payload to be the same as the test body", i)
 			}
 
+			// the reservation of the task lasts as long as the route's timeout
+			if task.Timeout == nil || *task.Timeout != 60 {
+				t.Errorf("Test %d: Expected task Timeout to be the route's", i)
+			}
+
 			if test.expectedEnv != nil {
 				for name, value := range test.expectedEnv {
 					taskName := name
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+	"github.com/iron-io/functions/api/models"
+)
+
+// runnerAuth lets through the requests of the runners presenting the runner
+// token, or a client certificate signed by a runner CA. Without either set
+// up, every request is rejected.
+func (s *Server) runnerAuth(c *gin.Context) {
+	if s.runnerToken != "" {
+		auth := c.Request.Header.Get("Authorization")
+		if strings.HasPrefix(auth, "Bearer ") &&
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(s.runnerToken)) == 1 {
+			c.Next()
+			return
+		}
+	}
+
+	// Client certificates are only verified against the runner CAs.
+	if s.runnerCAs != nil && c.Request.TLS != nil && len(c.Request.TLS.VerifiedChains) > 0 {
+		c.Next()
+		return
+	}
+
+	rejectRunner(c)
+}
+
+func rejectRunner(c *gin.Context) {
+	logrus.WithField("remote_addr", c.Request.RemoteAddr).Warn("Rejected runner request without valid credentials")
+	c.JSON(http.StatusUnauthorized, simpleError(models.ErrRunnerUnauthorized))
+	c.Abort()
+}
+
+// serverTLSConfig loads the certificate the API is served with and, if
+// caFile is set, verifies the client certificates of runners against it.
+func serverTLSConfig(certFile, keyFile, caFile string) (*tls.Config, *x509.CertPool, error) {
+	if certFile == "" && keyFile == "" {
+		if caFile != "" {
+			return nil, nil, errors.New("runner client certificates need the API served over TLS")
+		}
+		return nil, nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	if caFile == "" {
+		return cfg, nil, nil
+	}
+	cas, err := loadCertPool(caFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg.ClientCAs = cas
+	cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	return cfg, cas, nil
+}
+
+// runnerTLSConfig loads the client certificate runners present to the API
+// and, if caFile is set, the CAs the certificate of the API is verified
+// against instead of the system ones.
+func runnerTLSConfig(certFile, keyFile, caFile string) (*tls.Config, error) {
+	if certFile == "" && keyFile == "" && caFile == "" {
+		return nil, nil
+	}
+	cfg := &tls.Config{}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if caFile != "" {
+		cas, err := loadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = cas
+	}
+	return cfg, nil
+}
+
+func loadCertPool(file string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in %s", file)
+	}
+	return pool, nil
+}
@@ -0,0 +1,65 @@
+// +build server
+
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"testing"
+
+	"github.com/iron-io/functions/api/datastore"
+	"github.com/iron-io/functions/api/models"
+	"github.com/iron-io/functions/api/mqs"
+)
+
+func TestRunnerAuth(t *testing.T) {
+	buf := setLogBuffer()
+	tasks := mockTasksConduit()
+	defer close(tasks)
+
+	rnr, cancel := testRunner(t)
+	defer cancel()
+
+	srv := testServer(datastore.NewMock(), mqs.NewMemoryMQ(), rnr, tasks)
+
+	verified := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{}}}}
+	for i, test := range []struct {
+		token        string
+		cas          *x509.CertPool
+		auth         string
+		tls          *tls.ConnectionState
+		expectedCode int
+	}{
+		{"", nil, "", nil, http.StatusUnauthorized},
+		{"", nil, "Bearer ", nil, http.StatusUnauthorized},
+		{"secret", nil, "", nil, http.StatusUnauthorized},
+		{"secret", nil, "Bearer wrong", nil, http.StatusUnauthorized},
+		{"secret", nil, "Bearer secret", nil, http.StatusAccepted},
+		{"", x509.NewCertPool(), "", nil, http.StatusUnauthorized},
+		{"", x509.NewCertPool(), "", &tls.ConnectionState{}, http.StatusUnauthorized},
+		{"", x509.NewCertPool(), "", verified, http.StatusAccepted},
+		{"secret", x509.NewCertPool(), "", verified, http.StatusAccepted},
+	} {
+		srv.runnerToken, srv.runnerCAs = test.token, test.cas
+
+		_, rec := routerRequestWithAuth(t, srv.Router, "GET", "/tasks", nil, func(req *http.Request) {
+			if test.auth != "" {
+				req.Header.Set("Authorization", test.auth)
+			}
+			req.TLS = test.tls
+		})
+
+		if rec.Code != test.expectedCode {
+			t.Log(buf.String())
+			t.Errorf("Test %d: Expected status code to be %d but was %d",
+				i, test.expectedCode, rec.Code)
+		}
+		if rec.Code == http.StatusUnauthorized {
+			if resp := getErrorResponse(t, rec); resp.Error.Message != models.ErrRunnerUnauthorized.Error() {
+				t.Errorf("Test %d: Expected error message `%s` but got `%s`",
+					i, models.ErrRunnerUnauthorized, resp.Error.Message)
+			}
+		}
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"bytes"
 	"context"
 	"net/http"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -16,7 +17,7 @@ import (
 	"github.com/iron-io/functions/api/runner/task"
 )
 
-func testRunner(t *testing.T) (*runner.Runner, context.CancelFunc) {
+func testRunner(t testing.TB) (*runner.Runner, context.CancelFunc) {
 	ctx, cancel := context.WithCancel(context.Background())
 	r, err := runner.New(ctx, runner.NewFuncLogger(), runner.NewMetricLogger())
 	if err != nil {
@@ -113,6 +114,90 @@ func TestRouteRunnerPost(t *testing.T) {
 	}
 }
 
+func TestRouteRunnerMethods(t *testing.T) {
+	buf := setLogBuffer()
+	tasks := mockTasksConduit()
+
+	rnr, cancel := testRunner(t)
+	defer cancel()
+
+	srv := testServer(datastore.NewMockInit(
+		[]*models.App{
+			{Name: "myapp", Config: models.Config{}},
+		},
+		[]*models.Route{
+			{Path: "/users", AppName: "myapp", Image: "iron/hello", Methods: []string{"POST"}},
+			{Path: "/users", AppName: "myapp", Image: "iron/hello", Methods: []string{"GET", "HEAD"}},
+			{Path: "/update-users", AppName: "myapp", Image: "iron/hello", Methods: []string{"PATCH"}, Aliases: []string{"/users"}},
+		},
+	), &mqs.Mock{}, rnr, tasks)
+	srv.hosts = map[string]string{"api.example.com": "myapp"}
+
+	for i, test := range []struct {
+		method        string
+		host          string
+		path          string
+		expectedCode  int
+		expectedAllow string
+	}{
+		{"PUT", "127.0.0.1:8080", "/r/myapp/users", http.StatusMethodNotAllowed, "GET, HEAD, PATCH, POST"},
+		{"DELETE", "127.0.0.1:8080", "/r/myapp/update-users", http.StatusMethodNotAllowed, "PATCH"},
+		{"PUT", "127.0.0.1:8080", "/r/myapp/other", http.StatusNotFound, ""},
+		{"PUT", "API.example.com:8080", "/users", http.StatusMethodNotAllowed, "GET, HEAD, PATCH, POST"},
+		{"PUT", "api.example.com", "/other", http.StatusNotFound, ""},
+		{"PUT", "other.example.com", "/users", http.StatusNotFound, ""},
+	} {
+		req, rec := newRouterRequest(t, test.method, test.path, &bytes.Buffer{})
+		req.Host = test.host
+		srv.ServeHTTP(rec, req)
+
+		if rec.Code != test.expectedCode {
+			t.Log(buf.String())
+			t.Errorf("Test %d: Expected status code to be %d but was %d",
+				i, test.expectedCode, rec.Code)
+		}
+		if allow := rec.Header().Get("Allow"); allow != test.expectedAllow {
+			t.Errorf("Test %d: Expected Allow header to be `%s` but was `%s`",
+				i, test.expectedAllow, allow)
+		}
+	}
+}
+
+func TestRouteRunnerRouteHeader(t *testing.T) {
+	buf := setLogBuffer()
+
+	rnr, cancel := testRunner(t)
+	defer cancel()
+
+	srv := testServer(datastore.NewMockInit(
+		[]*models.App{
+			{Name: "myapp", Config: models.Config{}},
+		},
+		[]*models.Route{
+			{Type: "async", Path: "/users/:id", AppName: "myapp", Image: "iron/hello", Aliases: []string{"/people/:id"}},
+		},
+	), mqs.NewMemoryMQ(), rnr, mockTasksConduit())
+
+	// Calls name the path their route is mounted at, whatever its params.
+	for i, test := range []struct {
+		path          string
+		expectedRoute string
+	}{
+		{"/r/myapp/users/1", "/users/:id"},
+		{"/r/myapp/users/2", "/users/:id"},
+		{"/r/myapp/people/3", "/people/:id"},
+	} {
+		_, rec := routerRequest(t, srv.Router, "POST", test.path, &bytes.Buffer{})
+		if rec.Code != http.StatusAccepted {
+			t.Log(buf.String())
+			t.Errorf("Test %d: Expected status code to be %d but was %d", i, http.StatusAccepted, rec.Code)
+		}
+		if route := rec.Header().Get(RouteHeader); route != test.expectedRoute {
+			t.Errorf("Test %d: Expected %s header to be `%s` but was `%s`", i, RouteHeader, test.expectedRoute, route)
+		}
+	}
+}
+
 func TestRouteRunnerExecution(t *testing.T) {
 	buf := setLogBuffer()
 
@@ -229,24 +314,25 @@ func TestMatchRoute(t *testing.T) {
 	for i, test := range []struct {
 		baseRoute      string
 		route          string
-		expectedParams []Param
+		expectedParams Params
 	}{
 		{"/myroute/", `/myroute/`, nil},
-		{"/myroute/:mybigparam", `/myroute/1`, []Param{{"mybigparam", "1"}}},
-		{"/:param/*test", `/1/2`, []Param{{"param", "1"}, {"test", "/2"}}},
+		{"/myroute/:mybigparam", `/myroute/1`, Params{{"mybigparam", "1"}}},
+		{"/:param/*test", `/1/2`, Params{{"param", "1"}, {"test", "/2"}}},
 	} {
-		if params, match := matchRoute(test.baseRoute, test.route); match {
-			if test.expectedParams != nil {
-				for j, param := range test.expectedParams {
-					if params[j].Key != param.Key || params[j].Value != param.Value {
-						t.Log(buf.String())
-						t.Errorf("Test %d: expected param %d, key = %s, value = %s", i, j, param.Key, param.Value)
-					}
-				}
-			}
-		} else {
+		tree, err := newRouteTree([]*models.Route{{Path: test.baseRoute}})
+		if err != nil {
+			t.Fatalf("Test %d: %v", i, err)
+		}
+		m, params := tree.lookup(test.route)
+		if m == nil {
 			t.Log(buf.String())
 			t.Errorf("Test %d: %s should match %s", i, test.route, test.baseRoute)
+			continue
+		}
+		if !reflect.DeepEqual(params, test.expectedParams) {
+			t.Log(buf.String())
+			t.Errorf("Test %d: expected params %v, got %v", i, test.expectedParams, params)
 		}
 	}
 }
@@ -2,6 +2,8 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -9,11 +11,15 @@ import (
 	"net/http"
 	"os"
 	"path"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/gin-gonic/gin"
 	"github.com/iron-io/functions/api"
+	"github.com/iron-io/functions/api/accesslog"
+	"github.com/iron-io/functions/api/cachebus"
 	"github.com/iron-io/functions/api/datastore"
 	"github.com/iron-io/functions/api/models"
 	"github.com/iron-io/functions/api/mqs"
@@ -31,6 +37,30 @@ const (
 	EnvDBURL    = "db_url"
 	EnvPort     = "port" // be careful, Gin expects this variable to be "port"
 	EnvAPIURL   = "api_url"
+
+	EnvAccessLog       = "access_log"
+	EnvAccessLogFormat = "access_log_format"
+
+	EnvHosts = "hosts"
+
+	EnvCacheBusURL = "cache_bus_url"
+	EnvCacheTTL    = "cache_ttl"
+
+	EnvAsyncConcurrency = "async_concurrency"
+	EnvAsyncBatch       = "async_batch"
+	EnvAsyncWait        = "async_wait"
+	EnvAsyncMaxBackoff  = "async_max_backoff"
+
+	EnvTLSCert     = "tls_cert"
+	EnvTLSKey      = "tls_key"
+	EnvRunnerToken = "runner_token"
+	EnvRunnerCA    = "runner_ca"
+	EnvRunnerCert  = "runner_cert"
+	EnvRunnerKey   = "runner_key"
+	EnvAPICA       = "api_ca"
+
+	EnvNodeMode   = "node_mode"
+	EnvRunnerURLs = "runner_urls"
 )
 
 type Server struct {
@@ -40,23 +70,85 @@ type Server struct {
 	MQ        models.MessageQueue
 	Enqueue   models.Enqueue
 
-	apiURL string
+	apiURL    string
+	mode      NodeMode
+	async     runner.AsyncConfig
+	tlsConfig *tls.Config
+	runnerTLS *tls.Config
+	// runnerToken and runnerCAs authenticate runners to /tasks, and runners
+	// to the API at apiURL.
+	runnerToken string
+	runnerCAs   *x509.CertPool
+	// runnerURLs are the runner nodes API nodes forward sync calls to.
+	runnerURLs []string
+	runners    *runnerPool
+
+	accessLog *accesslog.Logger
+	hosts     map[string]string
+	bus       cachebus.Bus
 
 	specialHandlers []SpecialHandler
 	appListeners    []AppListener
 	middlewares     []Middleware
 	runnerListeners []RunnerListener
 
-	mu           sync.Mutex // protects hotroutes
+	mu           sync.Mutex // protects hotroutes and cachegen
 	hotroutes    *routecache.Cache
+	cachegen     uint64 // bumped by every cacheevict
 	tasks        chan task.Request
+	queued       queueSignal
 	singleflight singleflight // singleflight assists Datastore
 }
 
 const cacheSize = 1024
 
+// notFoundTTL bounds how long a node remembers that an app does not exist,
+// should it be created without the cache being told.
+const notFoundTTL = 10 * time.Second
+
 // NewFromEnv creates a new IronFunctions server based on env vars.
 func NewFromEnv(ctx context.Context) *Server {
+	mode, err := parseNodeMode(viper.GetString(EnvNodeMode))
+	if err != nil {
+		logrus.WithError(err).Fatal("Error initializing node mode.")
+	}
+
+	tlsConfig, runnerCAs, err := serverTLSConfig(viper.GetString(EnvTLSCert), viper.GetString(EnvTLSKey), viper.GetString(EnvRunnerCA))
+	if err != nil {
+		logrus.WithError(err).Fatal("Error initializing TLS.")
+	}
+
+	runnerTLS, err := runnerTLSConfig(viper.GetString(EnvRunnerCert), viper.GetString(EnvRunnerKey), viper.GetString(EnvAPICA))
+	if err != nil {
+		logrus.WithError(err).Fatal("Error initializing runner TLS.")
+	}
+
+	apiURL := viper.GetString(EnvAPIURL)
+	runnerToken := viper.GetString(EnvRunnerToken)
+
+	opts := []ServerOption{
+		EnableNodeMode(mode, strings.Split(viper.GetString(EnvRunnerURLs), ",")),
+		EnableAsyncConfig(runner.AsyncConfig{
+			Concurrency: viper.GetInt(EnvAsyncConcurrency),
+			Batch:       viper.GetInt(EnvAsyncBatch),
+			Wait:        viper.GetDuration(EnvAsyncWait),
+			MaxBackoff:  viper.GetDuration(EnvAsyncMaxBackoff),
+		}),
+		EnableTLS(tlsConfig),
+		EnableRunnerAuth(runnerToken, runnerCAs, runnerTLS),
+	}
+
+	// Runner nodes get everything they run from API nodes.
+	if mode == NodeModeRunner {
+		if apiURL == "" {
+			logrus.Fatal("Runner nodes need API_URL to reserve async tasks from.")
+		}
+		if runnerToken == "" && runnerCAs == nil {
+			logrus.Fatal("Runner nodes need RUNNER_TOKEN or RUNNER_CA to authenticate the API nodes forwarding calls.")
+		}
+		return New(ctx, nil, nil, apiURL, opts...)
+	}
+
 	ds, err := datastore.New(viper.GetString(EnvDBURL))
 	if err != nil {
 		logrus.WithError(err).Fatalln("Error initializing datastore.")
@@ -67,9 +159,27 @@ func NewFromEnv(ctx context.Context) *Server {
 		logrus.WithError(err).Fatal("Error initializing message queue.")
 	}
 
-	apiURL := viper.GetString(EnvAPIURL)
+	accessLog, err := accesslog.New(viper.GetString(EnvAccessLog), viper.GetString(EnvAccessLogFormat))
+	if err != nil {
+		logrus.WithError(err).Fatal("Error initializing access log.")
+	}
 
-	return New(ctx, ds, mq, apiURL)
+	hosts, err := parseHosts(viper.GetString(EnvHosts))
+	if err != nil {
+		logrus.WithError(err).Fatal("Error initializing host routing.")
+	}
+
+	bus, err := cachebus.New(viper.GetString(EnvCacheBusURL))
+	if err != nil {
+		logrus.WithError(err).Fatal("Error initializing cache bus.")
+	}
+
+	return New(ctx, ds, mq, apiURL, append(opts,
+		EnableAccessLog(accessLog),
+		EnableHostRouting(hosts),
+		EnableCacheBus(bus),
+		EnableCacheTTL(viper.GetDuration(EnvCacheTTL)),
+	)...)
 }
 
 // New creates a new IronFunctions server with the passed in datastore, message queue and API URL
@@ -93,22 +203,29 @@ func New(ctx context.Context, ds models.Datastore, mq models.MessageQueue, apiUR
 		tasks:     tasks,
 		Enqueue:   DefaultEnqueue,
 		apiURL:    apiURL,
+		async:     runner.DefaultAsyncConfig,
 	}
 
 	s.Router.Use(prepareMiddleware(ctx))
-	s.bindHandlers(ctx)
-	s.setupMiddlewares()
 
+	// Options come before the handlers, which depend on the node mode.
 	for _, opt := range opts {
 		opt(s)
 	}
+	if s.mode == NodeModeAPI {
+		s.runners = newRunnerPool(s.runnerURLs, s.runnerToken, s.runnerTLS)
+	}
+
+	s.bindHandlers(ctx)
+	s.setupMiddlewares()
 	return s
 }
 
 // todo: remove this or change name
 func prepareMiddleware(ctx context.Context) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		ctx, _ := common.LoggerWithFields(ctx, extractFields(c))
+		fields := extractFields(c)
+		ctx, _ := common.LoggerWithFields(ctx, fields)
 
 		if appName := c.Param(api.CApp); appName != "" {
 			c.Set(api.AppName, appName)
@@ -118,9 +235,12 @@ func prepareMiddleware(ctx context.Context) gin.HandlerFunc {
 			c.Set(api.Path, routePath)
 		}
 
-		// todo: can probably replace the "ctx" value with the Go 1.7 context on the http.Request
+		// The "ctx" value lasts as long as the server, for calls to finish
+		// once their client is gone, while the context of the request is
+		// done along with its client.
 		c.Set("ctx", ctx)
-		c.Request = c.Request.WithContext(ctx)
+		rctx, _ := common.LoggerWithFields(c.Request.Context(), fields)
+		c.Request = c.Request.WithContext(rctx)
 		c.Next()
 	}
 }
@@ -130,26 +250,90 @@ func DefaultEnqueue(ctx context.Context, mq models.MessageQueue, task *models.Ta
 	return mq.Push(ctx, task)
 }
 
-func (s *Server) cacheget(appname, path string) (*models.Route, bool) {
+// cachedApp is what the cache holds for an app: the app itself, nil if it
+// does not exist, and the routing tree compiled from its routes.
+type cachedApp struct {
+	app  *models.App
+	tree *routeTree
+}
+
+// cacheget returns the cached appname, along with the cache generation to
+// pass to cacheset once a missing app is loaded.
+func (s *Server) cacheget(appname string) (*cachedApp, uint64, bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	route, ok := s.hotroutes.Get(appname, path)
+	cached, ok := s.hotroutes.Get(appname)
 	if !ok {
-		return nil, false
+		return nil, s.cachegen, false
 	}
-	return route, ok
+	return cached.(*cachedApp), s.cachegen, ok
 }
 
-func (s *Server) cacherefresh(route *models.Route) {
+// cacheset caches appname, unless apps or routes changed since generation
+// gen, in which case it may be stale. Apps that do not exist are cached for
+// notFoundTTL at most.
+func (s *Server) cacheset(appname string, cached *cachedApp, gen uint64) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.hotroutes.Refresh(route)
+	if s.cachegen != gen {
+		return
+	}
+	if cached.app == nil {
+		ttl := notFoundTTL
+		if s.hotroutes.TTL > 0 && s.hotroutes.TTL < ttl {
+			ttl = s.hotroutes.TTL
+		}
+		s.hotroutes.SetTTL(appname, cached, ttl)
+		return
+	}
+	s.hotroutes.Set(appname, cached)
 }
 
-func (s *Server) cachedelete(appname, path string) {
+// InvalidateCache makes every node load appname and its routes from the
+// datastore again. Extensions changing apps or routes through the Datastore
+// rather than the API must call it.
+func (s *Server) InvalidateCache(ctx context.Context, appname string) {
+	s.cachedelete(ctx, appname)
+}
+
+// cachedelete drops appname and its routing tree on every node, so that they
+// get loaded again from the datastore. It must be called whenever an app or
+// a route changes.
+func (s *Server) cachedelete(ctx context.Context, appname string) {
+	s.cacheevict(appname)
+	if s.bus == nil {
+		return
+	}
+	if err := s.bus.Publish(ctx, appname); err != nil {
+		// the other nodes will catch up once their cache expires
+		common.Logger(ctx).WithError(err).WithField("app", appname).Error("Could not publish cache invalidation")
+	}
+}
+
+// cacheevict drops appname on this node, or every app if appname is empty.
+func (s *Server) cacheevict(appname string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.hotroutes.Delete(appname, path)
+	s.cachegen++
+	if appname == "" {
+		s.hotroutes.Purge()
+		return
+	}
+	s.hotroutes.Delete(appname)
+}
+
+// subscribeCache evicts the apps reported stale through the cache bus by the
+// other nodes, until ctx is done.
+func (s *Server) subscribeCache(ctx context.Context) {
+	err := s.bus.Subscribe(ctx, s.cacheevict)
+	if err != nil && ctx.Err() == nil {
+		logrus.WithError(err).Error("Cache bus subscription failed, retrying")
+		// do not hammer a failing bus, the supervisor restarts us right away
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+		}
+	}
 }
 
 func (s *Server) handleRunnerRequest(c *gin.Context) {
@@ -157,17 +341,23 @@ func (s *Server) handleRunnerRequest(c *gin.Context) {
 }
 
 func (s *Server) handleTaskRequest(c *gin.Context) {
-	ctx, _ := common.LoggerWithFields(c, nil)
+	// Reservations stop waiting once the runner asking for them is gone.
+	ctx := c.Request.Context()
 	switch c.Request.Method {
 	case "GET":
-		task, err := s.MQ.Reserve(ctx)
+		// Runners asking for a batch, or to wait for tasks, get a list.
+		if c.Query("n") != "" || c.Query("wait") != "" {
+			s.handleTaskReserve(ctx, c)
+			return
+		}
+		task, err := s.reserve(ctx)
 		if err != nil {
 			logrus.WithError(err).Error()
 			c.JSON(http.StatusInternalServerError, simpleError(models.ErrRoutesList))
 			return
 		}
 		c.JSON(http.StatusAccepted, task)
-	case "DELETE":
+	case "DELETE", "PATCH":
 		body, err := ioutil.ReadAll(c.Request.Body)
 		if err != nil {
 			logrus.WithError(err).Error()
@@ -181,7 +371,13 @@ func (s *Server) handleTaskRequest(c *gin.Context) {
 			return
 		}
 
-		if err := s.MQ.Delete(ctx, &task); err != nil {
+		// PATCH extends the reservation of a task still running, DELETE
+		// acknowledges a task done.
+		op := s.MQ.Delete
+		if c.Request.Method == "PATCH" {
+			op = s.MQ.Touch
+		}
+		if err := op(ctx, &task); err != nil {
 			logrus.WithError(err).Error()
 			c.JSON(http.StatusInternalServerError, err)
 			return
@@ -190,6 +386,28 @@ func (s *Server) handleTaskRequest(c *gin.Context) {
 	}
 }
 
+// reserve reserves the next queued task, removing the tasks of the apps
+// deleted since they were queued from the queue along the way.
+func (s *Server) reserve(ctx context.Context) (*models.Task, error) {
+	for {
+		task, err := s.MQ.Reserve(ctx)
+		if err != nil || task == nil {
+			return task, err
+		}
+
+		cached, err := s.loadapp(ctx, task.AppName)
+		if err != nil || cached.app != nil {
+			// when in doubt, let the task run
+			return task, nil
+		}
+
+		logrus.WithFields(logrus.Fields{"call_id": task.ID, "app": task.AppName}).Info("Removing task of deleted app")
+		if err := s.MQ.Delete(ctx, task); err != nil {
+			return nil, err
+		}
+	}
+}
+
 func extractFields(c *gin.Context) logrus.Fields {
 	fields := logrus.Fields{"action": path.Base(c.HandlerName())}
 	for _, param := range c.Params {
@@ -202,6 +420,10 @@ func (s *Server) Start(ctx context.Context) {
 	ctx = contextWithSignal(ctx, os.Interrupt)
 	s.startGears(ctx)
 	close(s.tasks)
+
+	if err := s.accessLog.Close(); err != nil {
+		logrus.WithError(err).Error("Could not close the access log")
+	}
 }
 
 func (s *Server) setupMiddlewares() {
@@ -216,7 +438,13 @@ func (s *Server) startGears(ctx context.Context) {
 	if err != nil {
 		logrus.WithError(err).Fatalln("Failed to serve functions API.")
 	}
-	logrus.Infof("Serving Functions API on address `%s`", listen)
+	if s.tlsConfig != nil {
+		listener = tls.NewListener(listener, s.tlsConfig)
+	}
+	logrus.WithField("mode", s.mode).Infof("Serving Functions API on address `%s`", listen)
+	if s.servesAPI() && s.runnerToken == "" && s.runnerCAs == nil {
+		logrus.Warn("Runner authentication is not set up, remote runners cannot reserve tasks at /tasks. Set RUNNER_TOKEN or RUNNER_CA.")
+	}
 
 	svr := &supervisor.Supervisor{
 		MaxRestarts: supervisor.AlwaysRestart,
@@ -227,7 +455,7 @@ func (s *Server) startGears(ctx context.Context) {
 
 	svr.AddFunc(func(ctx context.Context) {
 		go func() {
-			err := http.Serve(listener, s.Router)
+			err := http.Serve(listener, s)
 			if err != nil {
 				logrus.Fatalf("Error serving API: %v", err)
 			}
@@ -235,13 +463,32 @@ func (s *Server) startGears(ctx context.Context) {
 		<-ctx.Done()
 	})
 
-	svr.AddFunc(func(ctx context.Context) {
-		runner.RunAsyncRunner(ctx, s.apiURL, s.tasks, s.Runner)
-	})
+	if s.bus != nil {
+		svr.AddFunc(s.subscribeCache)
+	}
 
-	svr.AddFunc(func(ctx context.Context) {
-		runner.StartWorkers(ctx, s.Runner, s.tasks)
-	})
+	if s.runners != nil {
+		if len(s.runners.nodes) == 0 {
+			logrus.Warn("No runner node to forward sync calls to. Set RUNNER_URLS.")
+		}
+		svr.AddFunc(s.runners.poll)
+	}
+
+	if s.runsTasks() {
+		// Without an API to pull tasks from, the runners get them from the
+		// MQ of this node directly.
+		var queue runner.TaskQueue = localTasks{s}
+		if s.apiURL != "" {
+			queue = runner.NewHTTPTaskQueue(s.apiURL, s.runnerToken, s.runnerTLS)
+		}
+		svr.AddFunc(func(ctx context.Context) {
+			runner.RunAsyncRunner(ctx, queue, s.async, s.tasks, s.Runner)
+		})
+
+		svr.AddFunc(func(ctx context.Context) {
+			runner.StartWorkers(ctx, s.Runner, s.tasks)
+		})
+	}
 
 	svr.Serve(ctx)
 }
@@ -253,6 +500,11 @@ func (s *Server) bindHandlers(ctx context.Context) {
 	engine.GET("/version", handleVersion)
 	engine.GET("/stats", s.handleStats)
 
+	if !s.servesAPI() {
+		engine.POST("/run", s.runnerAuth, s.handleRun)
+		return
+	}
+
 	v1 := engine.Group("/v1")
 	v1.Use(s.middlewareWrapperFunc(ctx))
 	{
@@ -262,21 +514,39 @@ func (s *Server) bindHandlers(ctx context.Context) {
 		v1.GET("/apps/:app", s.handleAppGet)
 		v1.PATCH("/apps/:app", s.handleAppUpdate)
 		v1.DELETE("/apps/:app", s.handleAppDelete)
+		v1.GET("/apps/:app/stats", s.handleAppStats)
+		v1.GET("/apps/:app/queue", s.handleAppQueue)
+		v1.DELETE("/apps/:app/queue", s.handleAppQueuePurge)
+
+		v1.GET("/queue", s.handleQueueStats)
 
 		v1.GET("/routes", s.handleRouteList)
 
+		v1.GET("/audit", s.handleAuditList)
+
 		apps := v1.Group("/apps/:app")
 		{
 			apps.GET("/routes", s.handleRouteList)
 			apps.POST("/routes", s.handleRouteCreate)
 			apps.GET("/routes/*route", s.handleRouteGet)
+			apps.POST("/routes/*route", s.handleRoutePost)
 			apps.PATCH("/routes/*route", s.handleRouteUpdate)
 			apps.DELETE("/routes/*route", s.handleRouteDelete)
+
+			apps.GET("/functions", s.handleFunctionList)
+			apps.GET("/functions/:name", s.handleFunctionGet)
+			apps.PATCH("/functions/:name", s.handleFunctionUpdate)
+			apps.DELETE("/functions/:name", s.handleFunctionDelete)
 		}
 	}
 
-	engine.DELETE("/tasks", s.handleTaskRequest)
-	engine.GET("/tasks", s.handleTaskRequest)
+	tasks := engine.Group("/tasks")
+	tasks.Use(s.runnerAuth)
+	{
+		tasks.DELETE("", s.handleTaskRequest)
+		tasks.GET("", s.handleTaskRequest)
+		tasks.PATCH("", s.handleTaskRequest)
+	}
 	engine.Any("/r/:app/*route", s.handleRunnerRequest)
 
 	// This final route is used for extensions, see Server.Add
@@ -289,8 +559,9 @@ type appResponse struct {
 }
 
 type appsResponse struct {
-	Message string      `json:"message"`
-	Apps    models.Apps `json:"apps"`
+	Message    string      `json:"message"`
+	Apps       models.Apps `json:"apps"`
+	NextCursor string      `json:"next_cursor,omitempty"`
 }
 
 type routeResponse struct {
@@ -299,8 +570,43 @@ type routeResponse struct {
 }
 
 type routesResponse struct {
+	Message    string        `json:"message"`
+	Routes     models.Routes `json:"routes"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+}
+
+type statsResponse struct {
 	Message string        `json:"message"`
-	Routes  models.Routes `json:"routes"`
+	Stats   *models.Stats `json:"stats"`
+}
+
+type queueResponse struct {
+	Message string        `json:"message"`
+	Queue   *models.Queue `json:"queue"`
+}
+
+type queueStatsResponse struct {
+	Message string             `json:"message"`
+	Stats   *models.QueueStats `json:"stats"`
+}
+
+type queuePurgeResponse struct {
+	Message string `json:"message"`
+	Purged  int64  `json:"purged"`
+}
+
+type reservedTasksResponse struct {
+	Tasks []*models.Task `json:"tasks"`
+}
+
+type auditResponse struct {
+	Message string               `json:"message"`
+	Events  []*models.AuditEvent `json:"events"`
+}
+
+type revisionsResponse struct {
+	Message   string                  `json:"message"`
+	Revisions []*models.RouteRevision `json:"revisions"`
 }
 
 type tasksResponse struct {
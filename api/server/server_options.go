@@ -1,6 +1,15 @@
 package server
 
-import "context"
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"time"
+
+	"github.com/iron-io/functions/api/accesslog"
+	"github.com/iron-io/functions/api/cachebus"
+	"github.com/iron-io/functions/api/runner"
+)
 
 type ServerOption func(*Server)
 
@@ -9,3 +18,69 @@ func EnableShutdownEndpoint(halt context.CancelFunc) ServerOption {
 		s.Router.GET("/shutdown", s.handleShutdown(halt))
 	}
 }
+
+// EnableAccessLog writes a line to l for every function call.
+func EnableAccessLog(l *accesslog.Logger) ServerOption {
+	return func(s *Server) {
+		s.accessLog = l
+	}
+}
+
+// EnableHostRouting serves the calls to the routes of an app at the root of
+// the hosts mapped to it, eg. api.example.com/users for /r/myapp/users.
+func EnableHostRouting(hosts map[string]string) ServerOption {
+	return func(s *Server) {
+		s.hosts = hosts
+	}
+}
+
+// EnableCacheBus publishes route changes on bus, and evicts the routes the
+// other nodes of the cluster publish there from the cache.
+func EnableCacheBus(bus cachebus.Bus) ServerOption {
+	return func(s *Server) {
+		s.bus = bus
+	}
+}
+
+// EnableCacheTTL expires cached routes after ttl, bounding how long a node
+// can serve stale routes if it misses a change. Zero disables expiration.
+func EnableCacheTTL(ttl time.Duration) ServerOption {
+	return func(s *Server) {
+		s.hotroutes.TTL = ttl
+	}
+}
+
+// EnableAsyncConfig tunes how the async runners of the node get their tasks.
+func EnableAsyncConfig(cfg runner.AsyncConfig) ServerOption {
+	return func(s *Server) {
+		s.async = cfg
+	}
+}
+
+// EnableTLS serves the API over TLS with cfg, nil serving it in clear.
+func EnableTLS(cfg *tls.Config) ServerOption {
+	return func(s *Server) {
+		s.tlsConfig = cfg
+	}
+}
+
+// EnableRunnerAuth only lets runners presenting token, or a client
+// certificate signed by one of cas, reserve tasks at /tasks. The runners of
+// the node present token and the client certificate of tlsConfig to the API
+// they pull tasks from.
+func EnableRunnerAuth(token string, cas *x509.CertPool, tlsConfig *tls.Config) ServerOption {
+	return func(s *Server) {
+		s.runnerToken = token
+		s.runnerCAs = cas
+		s.runnerTLS = tlsConfig
+	}
+}
+
+// EnableNodeMode sets the parts of IronFunctions the node runs. API nodes
+// forward sync calls to the runner nodes at runnerURLs.
+func EnableNodeMode(mode NodeMode, runnerURLs []string) ServerOption {
+	return func(s *Server) {
+		s.mode = mode
+		s.runnerURLs = runnerURLs
+	}
+}
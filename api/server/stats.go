@@ -1,11 +1,53 @@
 package server
 
 import (
+	"context"
 	"net/http"
+	"path"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/iron-io/functions/api"
+	"github.com/iron-io/functions/api/models"
 )
 
 func (s *Server) handleStats(c *gin.Context) {
 	c.JSON(http.StatusOK, s.Runner.Stats())
 }
+
+func (s *Server) handleAppStats(c *gin.Context) {
+	ctx := c.MustGet("ctx").(context.Context)
+
+	appName := c.MustGet(api.AppName).(string)
+	if _, err := s.Datastore.GetApp(ctx, appName); err != nil {
+		handleErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, statsResponse{"Successfully loaded app stats", s.Runner.AppStats(appName)})
+}
+
+func (s *Server) handleRouteStats(c *gin.Context, routePath string) {
+	ctx := c.MustGet("ctx").(context.Context)
+
+	// Stats are kept per path, whichever of the routes at it served the calls.
+	appName := c.MustGet(api.AppName).(string)
+	if _, err := s.route(ctx, appName, routePath, ""); err != nil && err != models.ErrRoutesAmbiguous {
+		handleErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, statsResponse{"Successfully loaded route stats", s.Runner.RouteStats(appName, routePath)})
+}
+
+// routeSubresource splits a route path such as "/hello/stats" into the route
+// itself ("/hello") and the sub-resource requested ("stats"). gin cannot
+// match anything after a catch-all parameter, so sub-resources of routes
+// must be told apart by hand.
+func routeSubresource(routePath string) (string, string) {
+	i := strings.LastIndex(routePath, "/")
+	if i <= 0 {
+		return routePath, ""
+	}
+	return path.Clean(routePath[:i]), routePath[i+1:]
+}
@@ -0,0 +1,68 @@
+// +build server
+
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/iron-io/functions/api/datastore"
+	"github.com/iron-io/functions/api/models"
+	"github.com/iron-io/functions/api/mqs"
+)
+
+func TestStats(t *testing.T) {
+	buf := setLogBuffer()
+	tasks := mockTasksConduit()
+	defer close(tasks)
+
+	rnr, cancel := testRunner(t)
+	defer cancel()
+
+	ds := datastore.NewMockInit(
+		[]*models.App{{Name: "myapp"}},
+		[]*models.Route{
+			{AppName: "myapp", Path: "/myroute", Image: "iron/hello"},
+			{AppName: "myapp", Path: "/other/stats", Image: "iron/hello"},
+		},
+	)
+	srv := testServer(ds, &mqs.Mock{}, rnr, tasks)
+
+	for i, test := range []struct {
+		path          string
+		expectedCode  int
+		expectedBody  string
+		expectedError error
+	}{
+		{"/v1/apps/myapp/stats", http.StatusOK, `"app_name":"myapp"`, nil},
+		{"/v1/apps/myapp/routes/myroute/stats", http.StatusOK, `"path":"/myroute"`, nil},
+		{"/v1/apps/myapp/routes/other/stats", http.StatusOK, `"route"`, nil},
+		{"/v1/apps/notfound/stats", http.StatusNotFound, "", models.ErrAppsNotFound},
+		{"/v1/apps/myapp/routes/notfound/stats", http.StatusNotFound, "", models.ErrRoutesNotFound},
+	} {
+		_, rec := routerRequest(t, srv.Router, "GET", test.path, nil)
+
+		if rec.Code != test.expectedCode {
+			t.Log(buf.String())
+			t.Errorf("Test %d: Expected status code to be %d but was %d",
+				i, test.expectedCode, rec.Code)
+		}
+
+		if test.expectedBody != "" && !strings.Contains(rec.Body.String(), test.expectedBody) {
+			t.Log(buf.String())
+			t.Errorf("Test %d: Expected body to have `%s` but was `%s`",
+				i, test.expectedBody, rec.Body.String())
+		}
+
+		if test.expectedError != nil {
+			resp := getErrorResponse(t, rec)
+
+			if !strings.Contains(resp.Error.Message, test.expectedError.Error()) {
+				t.Log(buf.String())
+				t.Errorf("Test %d: Expected error message to have `%s`",
+					i, test.expectedError.Error())
+			}
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package server
+
+import (
+	"math/rand"
+	"net/http"
+
+	"github.com/iron-io/functions/api/models"
+)
+
+const (
+	// TargetHeader names the route target that served a call in the
+	// response. Clients can send it back, either as a header or as the
+	// targetCookie cookie, to keep being served by the same target.
+	TargetHeader = "Fn-Target"
+	targetCookie = "fn_target"
+
+	// RouteHeader names the path of the app the route that served a call is
+	// mounted at in the response, such as /users/:id, for load balancers
+	// to send the calls to a route to the same nodes whatever their
+	// parameters.
+	RouteHeader = "Fn-Route"
+)
+
+// pickTarget chooses the target of route that serves req: the one asked for
+// by the request if it exists and has a weight, or else a random one according
+// to the target weights. Targets of weight 0 are thus drained even of the
+// clients sticking to them. sticky tells whether the request asked for the target. It returns
+// nil for routes without targets.
+func pickTarget(req *http.Request, route *models.Route) (target *models.RouteTarget, sticky bool) {
+	if len(route.Targets) == 0 {
+		return nil, false
+	}
+
+	name := req.Header.Get(TargetHeader)
+	if name == "" {
+		if c, err := req.Cookie(targetCookie); err == nil {
+			name = c.Value
+		}
+	}
+	if name != "" {
+		for _, t := range route.Targets {
+			if t.Name == name && t.Weight > 0 {
+				return t, true
+			}
+		}
+	}
+
+	total := 0
+	for _, t := range route.Targets {
+		total += t.Weight
+	}
+	if total <= 0 {
+		return route.Targets[0], false
+	}
+
+	n := rand.Intn(total)
+	for _, t := range route.Targets {
+		if n < t.Weight {
+			return t, false
+		}
+		n -= t.Weight
+	}
+	return route.Targets[len(route.Targets)-1], false
+}
@@ -0,0 +1,102 @@
+// +build server
+
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/iron-io/functions/api/datastore"
+	"github.com/iron-io/functions/api/models"
+	"github.com/iron-io/functions/api/mqs"
+)
+
+func TestPickTarget(t *testing.T) {
+	route := &models.Route{
+		Image: "iron/hello",
+		Targets: []*models.RouteTarget{
+			{Name: "stable", Weight: 1},
+			{Name: "canary", Image: "iron/hello:next", Weight: 0},
+		},
+	}
+
+	req, _ := http.NewRequest("GET", "/r/myapp/hello", nil)
+	for i := 0; i < 100; i++ {
+		if target, sticky := pickTarget(req, route); target.Name != "stable" || sticky {
+			t.Fatalf("Expected weighted pick of the stable target, got %s (sticky %v)", target.Name, sticky)
+		}
+	}
+
+	// Targets of weight 0 are not sticky.
+	req.Header.Set(TargetHeader, "canary")
+	if target, sticky := pickTarget(req, route); target.Name != "stable" || sticky {
+		t.Errorf("Expected the header not to pick the canary target of weight 0, got %s (sticky %v)", target.Name, sticky)
+	}
+
+	route.Targets[1].Weight = 1
+	if target, sticky := pickTarget(req, route); target.Name != "canary" || !sticky {
+		t.Errorf("Expected the header to pick the canary target, got %s (sticky %v)", target.Name, sticky)
+	}
+
+	req, _ = http.NewRequest("GET", "/r/myapp/hello", nil)
+	req.AddCookie(&http.Cookie{Name: targetCookie, Value: "canary"})
+	if target, sticky := pickTarget(req, route); target.Name != "canary" || !sticky {
+		t.Errorf("Expected the cookie to pick the canary target, got %s (sticky %v)", target.Name, sticky)
+	}
+
+	route.Targets[1].Weight = 0
+	req.Header.Set(TargetHeader, "unknown")
+	if target, sticky := pickTarget(req, route); target.Name != "stable" || sticky {
+		t.Errorf("Expected an unknown target to fall back to weights, got %s (sticky %v)", target.Name, sticky)
+	}
+
+	if target, _ := pickTarget(req, &models.Route{Image: "iron/hello"}); target != nil {
+		t.Errorf("Expected no target for a route without targets, got %s", target.Name)
+	}
+}
+
+func TestTargetCookiePath(t *testing.T) {
+	buf := setLogBuffer()
+
+	rnr, cancel := testRunner(t)
+	defer cancel()
+
+	srv := testServer(datastore.NewMockInit(
+		[]*models.App{
+			{Name: "myapp", Config: models.Config{}},
+		},
+		[]*models.Route{
+			{Type: "async", Path: "/hello", AppName: "myapp", Image: "iron/hello", Targets: []*models.RouteTarget{
+				{Name: "stable", Weight: 1},
+			}},
+		},
+	), mqs.NewMemoryMQ(), rnr, mockTasksConduit())
+	srv.hosts = map[string]string{"api.example.com": "myapp"}
+
+	// The cookie is sent back to the path the client called, which is not
+	// the one calls to a host are routed to.
+	for i, test := range []struct {
+		host         string
+		path         string
+		expectedPath string
+	}{
+		{"127.0.0.1:8080", "/r/myapp/hello", "/r/myapp/hello"},
+		{"api.example.com", "/hello", "/hello"},
+	} {
+		req, rec := newRouterRequest(t, "POST", test.path, &bytes.Buffer{})
+		req.Host = test.host
+		srv.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusAccepted {
+			t.Log(buf.String())
+			t.Errorf("Test %d: Expected status code to be %d but was %d", i, http.StatusAccepted, rec.Code)
+			continue
+		}
+		resp := http.Response{Header: rec.Header()}
+		cookies := resp.Cookies()
+		if len(cookies) != 1 || cookies[0].Name != targetCookie || cookies[0].Path != test.expectedPath {
+			t.Errorf("Test %d: Expected the target cookie for path `%s` but got %v", i, test.expectedPath, cookies)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+	"github.com/iron-io/functions/api/models"
+)
+
+const (
+	// maxTaskBatch bounds how many tasks a runner reserves at once.
+	maxTaskBatch = 100
+
+	// maxTaskWait bounds how long a runner waits for tasks to be queued.
+	maxTaskWait = 30 * time.Second
+
+	// taskPollInterval is how often the MQ is polled while waiting, to pick
+	// up the tasks queued by the other nodes and the delayed ones.
+	taskPollInterval = time.Second
+)
+
+// queueSignal wakes the reservations waiting for tasks when this node queues
+// one.
+type queueSignal struct {
+	mu sync.Mutex
+	ch chan struct{}
+}
+
+// wait returns a channel closed once a task is queued.
+func (q *queueSignal) wait() <-chan struct{} {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.ch == nil {
+		q.ch = make(chan struct{})
+	}
+	return q.ch
+}
+
+func (q *queueSignal) notify() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.ch != nil {
+		close(q.ch)
+		q.ch = nil
+	}
+}
+
+// handleTaskReserve reserves a batch of up to n tasks for a runner, waiting
+// up to wait for some to be queued if there are none.
+func (s *Server) handleTaskReserve(ctx context.Context, c *gin.Context) {
+	n := 1
+	if v := c.Query("n"); v != "" {
+		var err error
+		n, err = strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, simpleError(models.ErrTasksInvalidBatch))
+			return
+		}
+		if n > maxTaskBatch {
+			n = maxTaskBatch
+		}
+	}
+	var wait time.Duration
+	if v := c.Query("wait"); v != "" {
+		var err error
+		wait, err = time.ParseDuration(v)
+		if err != nil || wait < 0 {
+			c.JSON(http.StatusBadRequest, simpleError(models.ErrTasksInvalidWait))
+			return
+		}
+		if wait > maxTaskWait {
+			wait = maxTaskWait
+		}
+	}
+
+	tasks, err := s.reserveTasks(ctx, n, wait)
+	if err != nil {
+		logrus.WithError(err).Error()
+		c.JSON(http.StatusInternalServerError, simpleError(models.ErrRoutesList))
+		return
+	}
+	if tasks == nil {
+		tasks = []*models.Task{}
+	}
+	c.JSON(http.StatusAccepted, reservedTasksResponse{tasks})
+}
+
+// reserveTasks reserves up to n queued tasks, waiting up to wait for some to
+// be queued if there are none.
+func (s *Server) reserveTasks(ctx context.Context, n int, wait time.Duration) ([]*models.Task, error) {
+	deadline := time.Now().Add(wait)
+	for {
+		// taken before reserving, not to miss a task queued meanwhile
+		queued := s.queued.wait()
+
+		var tasks []*models.Task
+		for len(tasks) < n {
+			task, err := s.reserve(ctx)
+			if err != nil {
+				if len(tasks) > 0 {
+					// the tasks reserved already are handed out anyway
+					logrus.WithError(err).Error("Cannot reserve task")
+					return tasks, nil
+				}
+				return nil, err
+			}
+			if task == nil {
+				break
+			}
+			tasks = append(tasks, task)
+		}
+
+		left := deadline.Sub(time.Now())
+		if len(tasks) > 0 || left <= 0 {
+			return tasks, nil
+		}
+		if left > taskPollInterval {
+			left = taskPollInterval
+		}
+		t := time.NewTimer(left)
+		select {
+		case <-queued:
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return nil, nil
+		}
+		t.Stop()
+	}
+}
+
+// localTasks hands the async runners of this node their tasks straight from
+// the MQ, the API being served by the same process.
+type localTasks struct {
+	s *Server
+}
+
+func (q localTasks) Reserve(ctx context.Context, n int, wait time.Duration) ([]*models.Task, error) {
+	return q.s.reserveTasks(ctx, n, wait)
+}
+
+func (q localTasks) Delete(ctx context.Context, task *models.Task) error {
+	return q.s.MQ.Delete(ctx, task)
+}
+
+func (q localTasks) Touch(ctx context.Context, task *models.Task) error {
+	return q.s.MQ.Touch(ctx, task)
+}
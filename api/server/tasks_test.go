@@ -0,0 +1,143 @@
+// +build server
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iron-io/functions/api/datastore"
+	"github.com/iron-io/functions/api/models"
+	"github.com/iron-io/functions/api/mqs"
+)
+
+func TestTaskReserve(t *testing.T) {
+	buf := setLogBuffer()
+	tasks := mockTasksConduit()
+	defer close(tasks)
+
+	rnr, cancel := testRunner(t)
+	defer cancel()
+
+	ds := datastore.NewMockInit([]*models.App{{Name: "myapp"}}, nil)
+	mq := mqs.NewMemoryMQ()
+	srv := testServer(ds, mq, rnr, tasks)
+	srv.runnerToken = "secret"
+
+	var priority int32
+	for _, id := range []string{"1", "2", "3"} {
+		task := &models.Task{IDStatus: models.IDStatus{ID: id}, AppName: "myapp", Path: "/myroute"}
+		task.Priority = &priority
+		if _, err := mq.Push(context.Background(), task); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i, test := range []struct {
+		path          string
+		expectedCode  int
+		expectedTasks int
+		expectedError error
+	}{
+		{"/tasks?n=2", http.StatusAccepted, 2, nil},
+		{"/tasks?n=2&wait=10ms", http.StatusAccepted, 1, nil},
+		{"/tasks?n=2&wait=10ms", http.StatusAccepted, 0, nil},
+		{"/tasks?n=0", http.StatusBadRequest, 0, models.ErrTasksInvalidBatch},
+		{"/tasks?wait=soon", http.StatusBadRequest, 0, models.ErrTasksInvalidWait},
+	} {
+		_, rec := routerRequestWithAuth(t, srv.Router, "GET", test.path, nil, setRunnerAuth)
+
+		if rec.Code != test.expectedCode {
+			t.Log(buf.String())
+			t.Errorf("Test %d: Expected status code to be %d but was %d",
+				i, test.expectedCode, rec.Code)
+		}
+
+		if test.expectedError != nil {
+			resp := getErrorResponse(t, rec)
+
+			if !strings.Contains(resp.Error.Message, test.expectedError.Error()) {
+				t.Log(buf.String())
+				t.Errorf("Test %d: Expected error message to have `%s`",
+					i, test.expectedError.Error())
+			}
+			continue
+		}
+
+		var resp reservedTasksResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("Test %d: %v", i, err)
+		}
+		if len(resp.Tasks) != test.expectedTasks {
+			t.Log(buf.String())
+			t.Errorf("Test %d: Expected %d tasks but got %d", i, test.expectedTasks, len(resp.Tasks))
+		}
+	}
+}
+
+func TestTaskReserveWait(t *testing.T) {
+	tasks := mockTasksConduit()
+	defer close(tasks)
+
+	rnr, cancel := testRunner(t)
+	defer cancel()
+
+	ds := datastore.NewMockInit([]*models.App{{Name: "myapp"}}, nil)
+	mq := mqs.NewMemoryMQ()
+	srv := testServer(ds, mq, rnr, tasks)
+
+	// a task queued while waiting wakes the reservation up before the MQ is
+	// polled again
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		var priority int32
+		task := &models.Task{IDStatus: models.IDStatus{ID: "1"}, AppName: "myapp", Path: "/myroute"}
+		task.Priority = &priority
+		mq.Push(context.Background(), task)
+		srv.queued.notify()
+	}()
+
+	start := time.Now()
+	reserved, err := localTasks{srv}.Reserve(context.Background(), 1, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reserved) != 1 || reserved[0].ID != "1" {
+		t.Fatalf("Expected the task queued while waiting, got %v", reserved)
+	}
+	if elapsed := time.Since(start); elapsed >= taskPollInterval {
+		t.Errorf("Expected the reservation to be woken up once the task was queued, took %v", elapsed)
+	}
+}
+
+func TestTaskReserveClientGone(t *testing.T) {
+	tasks := mockTasksConduit()
+	defer close(tasks)
+
+	rnr, cancel := testRunner(t)
+	defer cancel()
+
+	ds := datastore.NewMockInit([]*models.App{{Name: "myapp"}}, nil)
+	srv := testServer(ds, mqs.NewMemoryMQ(), rnr, tasks)
+	srv.runnerToken = "secret"
+
+	// The runner goes away while waiting for tasks.
+	ctx, gone := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, gone)
+	req, rec := newRouterRequest(t, "GET", "/tasks?n=1&wait=10s", nil)
+	setRunnerAuth(req)
+
+	start := time.Now()
+	srv.Router.ServeHTTP(rec, req.WithContext(ctx))
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("Expected the reservation to stop once the runner was gone, took %v", elapsed)
+	}
+}
+
+func setRunnerAuth(req *http.Request) {
+	req.Header.Set("Authorization", "Bearer secret")
+}
@@ -5,13 +5,13 @@
 package server
 
 import (
-	"net/http"
 	"strings"
 	"unicode"
 	"unicode/utf8"
 )
 
-type Handle func(http.ResponseWriter, *http.Request, Params)
+// Handle is the value registered for a path, see routeTree.
+type Handle interface{}
 type Param struct {
 	Key   string
 	Value string
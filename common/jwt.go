@@ -14,10 +14,25 @@ func AuthJwt(signingKey string, req *http.Request) error {
 		return nil
 	}
 
+	_, err := parseJwt(signingKey, req)
+	return err
+}
+
+// JwtSubject returns the subject ("sub" claim) of the token req was
+// authenticated with.
+func JwtSubject(signingKey string, req *http.Request) (string, error) {
+	claims, err := parseJwt(signingKey, req)
+	if err != nil {
+		return "", err
+	}
+	return claims.Subject, nil
+}
+
+func parseJwt(signingKey string, req *http.Request) (*jwt.StandardClaims, error) {
 	extractor := request.AuthorizationHeaderExtractor
 	tokenString, err := extractor.ExtractToken(req)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	token, err := jwt.ParseWithClaims(tokenString, &jwt.StandardClaims{}, func(token *jwt.Token) (interface{}, error) {
@@ -25,15 +40,14 @@ func AuthJwt(signingKey string, req *http.Request) error {
 	})
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if _, ok := token.Claims.(*jwt.StandardClaims); ok && token.Valid {
-		return nil
+	if claims, ok := token.Claims.(*jwt.StandardClaims); ok && token.Valid {
+		return claims, nil
 	}
 
-	return errors.New("Invalid token")
-
+	return nil, errors.New("Invalid token")
 }
 
 func GetJwt(signingKey string, expiration int) (string, error) {
@@ -75,6 +75,7 @@ GLOBAL OPTIONS:
 		commands.InitFn(),
 		commands.Apps(),
 		commands.Routes(),
+		commands.Queue(),
 		commands.Images(),
 		commands.Lambda(),
 		commands.Version(),
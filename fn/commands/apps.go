@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"strings"
 
@@ -88,9 +89,16 @@ func Apps() cli.Command {
 				Action:  a.list,
 			},
 			{
-				Name:   "delete",
-				Usage:  "delete an app",
-				Action: a.delete,
+				Name:      "delete",
+				Usage:     "delete an app",
+				ArgsUsage: "<app>",
+				Action:    a.delete,
+				Flags: []cli.Flag{
+					cli.BoolFlag{
+						Name:  "cascade",
+						Usage: "delete the routes of the app as well",
+					},
+				},
 			},
 		},
 	}
@@ -318,6 +326,15 @@ func (a *appsCmd) delete(c *cli.Context) error {
 		return errors.New("error: deleting an app takes one argument, an app name")
 	}
 
+	if c.Bool("cascade") {
+		err := common.ApiRequest("DELETE", "/apps/"+appName, url.Values{"cascade": {"true"}}, nil)
+		if err != nil {
+			return err
+		}
+		fmt.Println("app", appName, "and its routes deleted")
+		return nil
+	}
+
 	_, err := a.client.Apps.DeleteAppsApp(&apiapps.DeleteAppsAppParams{
 		Context: context.Background(),
 		App:     appName,
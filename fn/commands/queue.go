@@ -0,0 +1,128 @@
+package commands
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/iron-io/functions/fn/common"
+	"github.com/urfave/cli"
+)
+
+type queueCmd struct{}
+
+func Queue() cli.Command {
+	q := queueCmd{}
+
+	return cli.Command{
+		Name:  "queue",
+		Usage: "inspect and manage the queue of async tasks",
+		Subcommands: []cli.Command{
+			{
+				Name:   "stats",
+				Usage:  "count the tasks ready, delayed and reserved of every app",
+				Action: q.stats,
+			},
+			{
+				Name:      "inspect",
+				Aliases:   []string{"i"},
+				Usage:     "list the next tasks ready to run of an app",
+				ArgsUsage: "<app> [n]",
+				Action:    q.inspect,
+			},
+			{
+				Name:      "purge",
+				Usage:     "delete the tasks of an app waiting to run",
+				ArgsUsage: "<app>",
+				Action:    q.purge,
+			},
+		},
+	}
+}
+
+type queueStats struct {
+	Ready     []int64 `json:"ready"`
+	Delayed   int64   `json:"delayed"`
+	Reserved  int64   `json:"reserved"`
+	OldestAge int64   `json:"oldest_age"`
+}
+
+type queuedTask struct {
+	ID        string    `json:"id"`
+	Path      string    `json:"path"`
+	Priority  int32     `json:"priority"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (q *queueCmd) stats(c *cli.Context) error {
+	var resp struct {
+		Stats queueStats `json:"stats"`
+	}
+	if err := common.ApiRequest("GET", "/queue", nil, &resp); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
+	fmt.Fprint(w, "priority", "\t", "ready", "\n")
+	for i, n := range resp.Stats.Ready {
+		fmt.Fprint(w, i, "\t", n, "\n")
+	}
+	w.Flush()
+	fmt.Println("delayed:", resp.Stats.Delayed)
+	fmt.Println("reserved:", resp.Stats.Reserved)
+	fmt.Println("oldest age:", time.Duration(resp.Stats.OldestAge)*time.Second)
+	return nil
+}
+
+func (q *queueCmd) inspect(c *cli.Context) error {
+	appName := c.Args().Get(0)
+	n := "10"
+	if c.Args().Get(1) != "" {
+		n = c.Args().Get(1)
+	}
+	if i, err := strconv.Atoi(n); err != nil || i <= 0 {
+		return fmt.Errorf("invalid number of tasks: %s", n)
+	}
+
+	var resp struct {
+		Queue struct {
+			Depth int64         `json:"depth"`
+			Tasks []*queuedTask `json:"tasks"`
+		} `json:"queue"`
+	}
+	err := common.ApiRequest("GET", path.Join("/apps", appName, "queue"), url.Values{"peek": {n}}, &resp)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(appName, "has", resp.Queue.Depth, "tasks ready to run")
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
+	fmt.Fprint(w, "id", "\t", "path", "\t", "priority", "\t", "created", "\n")
+	for _, task := range resp.Queue.Tasks {
+		created := ""
+		if !task.CreatedAt.IsZero() {
+			created = task.CreatedAt.Local().Format(time.RFC3339)
+		}
+		fmt.Fprint(w, task.ID, "\t", task.Path, "\t", task.Priority, "\t", created, "\n")
+	}
+	w.Flush()
+	return nil
+}
+
+func (q *queueCmd) purge(c *cli.Context) error {
+	appName := c.Args().Get(0)
+
+	var resp struct {
+		Purged int64 `json:"purged"`
+	}
+	if err := common.ApiRequest("DELETE", path.Join("/apps", appName, "queue"), nil, &resp); err != nil {
+		return err
+	}
+
+	fmt.Println(appName, "queue purged of", resp.Purged, "tasks")
+	return nil
+}
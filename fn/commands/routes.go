@@ -13,6 +13,7 @@ import (
 	"strconv"
 	"strings"
 	"text/tabwriter"
+	"time"
 
 	f_common "github.com/iron-io/functions/common"
 	image_commands "github.com/iron-io/functions/fn/commands/images"
@@ -144,6 +145,18 @@ func Routes() cli.Command {
 				ArgsUsage: "<app> </path> [property.[key]]",
 				Action:    r.inspect,
 			},
+			{
+				Name:      "history",
+				Usage:     "list the revisions of a route",
+				ArgsUsage: "<app> </path>",
+				Action:    r.history,
+			},
+			{
+				Name:      "rollback",
+				Usage:     "roll back a route to a previous revision",
+				ArgsUsage: "<app> </path> <revision>",
+				Action:    r.rollback,
+			},
 			{
 				Name:      "token",
 				Aliases:   []string{"t"},
@@ -640,6 +653,58 @@ func (a *routesCmd) delete(c *cli.Context) error {
 	return nil
 }
 
+// routeRevision is a revision as returned by the API, which the generated
+// client does not know about.
+type routeRevision struct {
+	Revision  int64             `json:"revision"`
+	CreatedAt time.Time         `json:"created_at"`
+	Image     string            `json:"image"`
+	Memory    int64             `json:"memory"`
+	Timeout   int32             `json:"timeout"`
+	Format    string            `json:"format"`
+	Config    map[string]string `json:"config"`
+}
+
+func (a *routesCmd) history(c *cli.Context) error {
+	appName := c.Args().Get(0)
+	route := cleanRoutePath(c.Args().Get(1))
+
+	var resp struct {
+		Revisions []*routeRevision `json:"revisions"`
+	}
+	err := common.ApiRequest("GET", path.Join("/apps", appName, "routes", route, "revisions"), nil, &resp)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
+	fmt.Fprint(w, "revision", "\t", "created", "\t", "image", "\t", "memory", "\t", "timeout", "\t", "format", "\t", "config", "\n")
+	for _, rev := range resp.Revisions {
+		fmt.Fprint(w, rev.Revision, "\t", rev.CreatedAt.Local().Format(time.RFC3339), "\t", rev.Image, "\t", rev.Memory, "\t", rev.Timeout, "\t", rev.Format, "\t", len(rev.Config), " keys\n")
+	}
+	w.Flush()
+
+	return nil
+}
+
+func (a *routesCmd) rollback(c *cli.Context) error {
+	appName := c.Args().Get(0)
+	route := cleanRoutePath(c.Args().Get(1))
+	revision := c.Args().Get(2)
+	if _, err := strconv.ParseInt(revision, 10, 64); err != nil {
+		return fmt.Errorf("invalid revision: %s", revision)
+	}
+
+	var resp models.RouteWrapper
+	err := common.ApiRequest("POST", path.Join("/apps", appName, "routes", route, "rollback"), url.Values{"revision": {revision}}, &resp)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(appName, route, "rolled back to revision", revision, "with", resp.Route.Image)
+	return nil
+}
+
 func (a *routesCmd) token(c *cli.Context) error {
 	appName := c.Args().Get(0)
 	route := cleanRoutePath(c.Args().Get(1))
@@ -2,8 +2,10 @@ package common
 
 import (
 	"crypto/tls"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 
 	httptransport "github.com/go-openapi/runtime/client"
 	"github.com/go-openapi/strfmt"
@@ -33,3 +35,57 @@ func ApiClient() *fnclient.Functions {
 
 	return client
 }
+
+// ApiRequest calls an API endpoint that the generated client does not cover
+// yet and decodes the JSON response into out, unless out is nil. p is
+// relative to the API version, e.g. "/apps/myapp/routes/hello/revisions".
+func ApiRequest(method, p string, query url.Values, out interface{}) error {
+	u, err := url.Parse(BASE_PATH)
+	if err != nil {
+		return fmt.Errorf("error parsing API URL: %s", err)
+	}
+	u.Path += p
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(method, u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("unexpected error: %s", err)
+	}
+
+	if JWT_AUTH_KEY != "" {
+		jwtToken, err := f_common.GetJwt(JWT_AUTH_KEY, 60*60)
+		if err != nil {
+			return fmt.Errorf("unexpected error: %s", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+jwtToken)
+	}
+
+	cl := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: SSL_SKIP_VERIFY},
+	}}
+	resp, err := cl.Do(req)
+	if err != nil {
+		return fmt.Errorf("unexpected error: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var e struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&e); err != nil || e.Error.Message == "" {
+			return fmt.Errorf("unexpected error: %s", resp.Status)
+		}
+		return fmt.Errorf("error: %s", e.Error.Message)
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("unexpected error: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package lb
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/iron-io/functions/api/models"
+)
+
+var (
+	ErrAdminUnauthorized = errors.New("Invalid admin token")
+	ErrAdminDisabled     = errors.New("Admin API disabled, fnlb must be started with an admin token")
+	ErrInvalidNode       = errors.New("Invalid node, expected host:port")
+	ErrNodeNotFound      = errors.New("Node not found")
+	ErrMethodNotAllowed  = errors.New("Method not allowed")
+)
+
+type nodesResponse struct {
+	Message string   `json:"message"`
+	Nodes   []string `json:"nodes"`
+}
+
+type nodeRequest struct {
+	Node string `json:"node"`
+}
+
+// NodesHandler answers the admin API of the load balancer at /1/lb/nodes,
+// which lists (GET), adds (POST) and removes (DELETE) the nodes calls are
+// balanced amongst. Requests must carry token as a bearer token, the admin API
+// being disabled if it is empty. Every other request is handed to next.
+func NodesHandler(nodes *Nodes, token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/1/lb/nodes" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !authorize(w, r, token) {
+			return
+		}
+
+		switch r.Method {
+		case "GET":
+			writeJSON(w, http.StatusOK, nodesResponse{"Successfully listed nodes", nodes.List()})
+		case "POST", "DELETE":
+			var req nodeRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeError(w, http.StatusBadRequest, models.ErrInvalidJSON)
+				return
+			}
+			if _, _, err := net.SplitHostPort(req.Node); err != nil {
+				writeError(w, http.StatusBadRequest, ErrInvalidNode)
+				return
+			}
+			if r.Method == "POST" {
+				nodes.Add(req.Node)
+				writeJSON(w, http.StatusOK, nodesResponse{"Node successfully added", nodes.List()})
+				return
+			}
+			if !nodes.Remove(req.Node) {
+				writeError(w, http.StatusNotFound, ErrNodeNotFound)
+				return
+			}
+			writeJSON(w, http.StatusOK, nodesResponse{"Node successfully removed", nodes.List()})
+		default:
+			w.Header().Set("Allow", "GET, POST, DELETE")
+			writeError(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+		}
+	})
+}
+
+// authorize tells whether r carries token as a bearer token, answering it
+// with an error otherwise. Requests are refused when token is empty.
+func authorize(w http.ResponseWriter, r *http.Request, token string) bool {
+	if token == "" {
+		writeError(w, http.StatusForbidden, ErrAdminDisabled)
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+		writeError(w, http.StatusUnauthorized, ErrAdminUnauthorized)
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, models.Error{Error: &models.ErrorBody{Message: err.Error()}})
+}
@@ -7,27 +7,65 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/iron-io/functions/lb"
 )
 
 var (
-	fnodes  string
-	flisten string
+	fnodes      string
+	flisten     string
+	fsrv        string
+	fnodesFile  string
+	finterval   time.Duration
+	fadminToken string
+	fconfig     = lb.DefaultConfig
 )
 
 func init() {
-	flag.StringVar(&fnodes, "nodes", "127.0.0.1:8080", "comma separated list of IronFunction nodes")
+	flag.StringVar(&fnodes, "nodes", "", "comma separated list of IronFunction nodes, 127.0.0.1:8080 if none is given nor discovered")
 	flag.StringVar(&flisten, "listen", "0.0.0.0:8081", "listening port for incoming connections")
+	flag.StringVar(&fsrv, "srv", "", "DNS SRV record to discover IronFunction nodes from, eg. _functions._tcp.example.com")
+	flag.StringVar(&fnodesFile, "nodes-file", "", "file to discover IronFunction nodes from, one host:port per line")
+	flag.DurationVar(&finterval, "discovery-interval", 10*time.Second, "how often nodes are discovered again")
+	flag.StringVar(&fadminToken, "admin-token", "", "bearer token required by the admin API and metrics at /1/lb/, which are disabled without it")
+	flag.StringVar(&fconfig.HealthPath, "health-path", fconfig.HealthPath, "path requested to check the health of nodes")
+	flag.DurationVar(&fconfig.HealthInterval, "health-interval", fconfig.HealthInterval, "how often the health of nodes is checked")
+	flag.DurationVar(&fconfig.HealthTimeout, "health-timeout", fconfig.HealthTimeout, "how long nodes have to answer health checks")
+	flag.DurationVar(&fconfig.DialTimeout, "dial-timeout", fconfig.DialTimeout, "how long connecting to a node may take")
+	flag.DurationVar(&fconfig.Timeout, "timeout", fconfig.Timeout, "how long a call to a node may take, 0 for no limit")
+	flag.IntVar(&fconfig.Retries, "retries", fconfig.Retries, "how many other nodes failed idempotent calls are sent to")
+	flag.Int64Var(&fconfig.MaxBodyBuffer, "max-body-buffer", fconfig.MaxBodyBuffer, "bytes of a call body kept to send it again, larger calls are sent once")
+	flag.DurationVar(&fconfig.BreakerWindow, "breaker-window", fconfig.BreakerWindow, "window the error rate of a node is computed over")
+	flag.IntVar(&fconfig.BreakerMinRequests, "breaker-min-requests", fconfig.BreakerMinRequests, "calls a node gets within a window before its breaker may open")
+	flag.Float64Var(&fconfig.BreakerErrorRate, "breaker-error-rate", fconfig.BreakerErrorRate, "ratio of failed or slow calls opening the breaker of a node")
+	flag.DurationVar(&fconfig.BreakerSlowCall, "breaker-slow-call", fconfig.BreakerSlowCall, "calls slower than this count as failed, 0 to leave latency out")
+	flag.DurationVar(&fconfig.BreakerOpenTime, "breaker-open-time", fconfig.BreakerOpenTime, "how long a breaker stays open before a call tries the node again")
 	flag.Parse()
 }
 
 func main() {
-	nodes := strings.Split(fnodes, ",")
-	p := lb.ConsistentHashReverseProxy(context.Background(), nodes)
-	fmt.Println("forwarding calls to", nodes)
+	ctx := context.Background()
+
+	if fnodes == "" && fsrv == "" && fnodesFile == "" {
+		fnodes = "127.0.0.1:8080"
+	}
+	nodes := lb.NewNodes(strings.Split(fnodes, ","))
+	switch {
+	case fsrv != "" && fnodesFile != "":
+		fmt.Fprintln(os.Stderr, "-srv and -nodes-file cannot be used together")
+		os.Exit(1)
+	case fsrv != "":
+		go lb.Discover(ctx, nodes, finterval, lb.SRVDiscovery(fsrv))
+	case fnodesFile != "":
+		go lb.Discover(ctx, nodes, finterval, lb.FileDiscovery(fnodesFile))
+	}
+
+	metrics := lb.NewMetrics()
+	p := lb.ConsistentHashReverseProxy(ctx, nodes, fconfig, metrics)
+	fmt.Println("forwarding calls to", nodes.List())
 	fmt.Println("listening to", flisten)
-	if err := http.ListenAndServe(flisten, p); err != nil {
+	if err := http.ListenAndServe(flisten, lb.NodesHandler(nodes, fadminToken, lb.MetricsHandler(metrics, fadminToken, lb.StatsHandler(nodes, p)))); err != nil {
 		fmt.Fprintln(os.Stderr, "could not start server. error:", err)
 		os.Exit(1)
 	}
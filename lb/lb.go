@@ -1,15 +1,9 @@
 package lb
 
 import (
-	"bytes"
 	"context"
 	"net/http"
 	"net/http/httputil"
-	"strconv"
-	"sync"
-	"sync/atomic"
-
-	"github.com/golang/groupcache/consistenthash"
 )
 
 // ConsistentHashReverseProxy returns a new ReverseProxy that routes
@@ -17,26 +11,31 @@ import (
 // algorithm. If the target's path is "/base" and the incoming request was for
 // "/dir", the target request will be for /base/dir.
 // ConsistentHashReverseProxy does not rewrite the Host header.
-func ConsistentHashReverseProxy(ctx context.Context, nodes []string) *httputil.ReverseProxy {
-	ch := consistenthash.New(len(nodes), nil)
-	ch.Add(nodes...)
-
-	bufPool := sync.Pool{
-		New: func() interface{} {
-			return new(bytes.Buffer)
-		},
+//
+// Calls to a route are hashed on its app and path, so that they keep reaching
+// the node with hot containers for it whatever their parameters, once the
+// path is learned from the responses of the nodes. The load of the nodes is polled from
+// their /stats though, calls spilling over to the least loaded node while the
+// node of their route is saturated or refuses them for its queue being full.
+// The nodes can change while the proxy runs, only the routes hashed next to
+// the nodes added or removed moving. Calls and the state of the nodes are
+// reported in metrics, if any.
+func ConsistentHashReverseProxy(ctx context.Context, nodes *Nodes, cfg Config, metrics *Metrics) *httputil.ReverseProxy {
+	if metrics == nil {
+		metrics = NewMetrics()
 	}
+	loads := newLoads(nodes)
+	go loads.poll(ctx)
+	routes := newRoutes()
+	rt := NewRoundTripper(ctx, nodes, cfg, metrics)
+	metrics.members, metrics.rt, metrics.loads = nodes, rt, loads
 
-	var i int64
 	director := func(req *http.Request) {
-		buf := bufPool.Get().(*bytes.Buffer)
-		defer bufPool.Put(buf)
-		buf.Reset()
-		buf.WriteString(req.URL.Path)
-		buf.WriteString("??")
-		b := strconv.AppendInt(buf.Bytes(), atomic.AddInt64(&i, 1), 10)
-
-		target := ch.Get(string(b))
+		preferred := nodes.Get(routes.key(req))
+		target := loads.pick(preferred)
+		if target != preferred {
+			metrics.spill(preferred)
+		}
 		req.URL.Scheme = "http"
 		req.URL.Host = target
 		if _, ok := req.Header["User-Agent"]; !ok {
@@ -47,6 +46,55 @@ func ConsistentHashReverseProxy(ctx context.Context, nodes []string) *httputil.R
 
 	return &httputil.ReverseProxy{
 		Director:  director,
-		Transport: NewRoundTripper(ctx, nodes),
+		Transport: &spillRoundTripper{loads: loads, routes: routes, metrics: metrics, maxBody: cfg.MaxBodyBuffer, next: rt},
+	}
+}
+
+// spillRoundTripper sends the calls a node refuses with a 503, for its queue
+// being full, to the least loaded of the other nodes. Calls whose body is
+// larger than maxBody are not spilled, their body being streamed. The body
+// kept otherwise is the one next sends again on its retries. The routes of
+// the calls are learned from the responses.
+type spillRoundTripper struct {
+	loads   *loads
+	routes  *routes
+	metrics *Metrics
+	maxBody int64
+	next    http.RoundTripper
+}
+
+func (s *spillRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := rewindable(req, s.maxBody); err != nil {
+		return nil, err
+	}
+
+	var tried []string
+	for {
+		if len(tried) > 0 {
+			if err := rewind(req); err != nil {
+				return nil, err
+			}
+		}
+		resp, err := s.next.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		s.routes.learn(req, resp)
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			return resp, nil
+		}
+
+		s.loads.full(req.URL.Host)
+		if !resendable(req) {
+			return resp, nil
+		}
+		s.metrics.spill(req.URL.Host)
+		tried = append(tried, req.URL.Host)
+		node := s.loads.spill(tried...)
+		if node == "" {
+			return resp, nil
+		}
+		resp.Body.Close()
+		req.URL.Host = node
 	}
 }
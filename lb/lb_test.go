@@ -0,0 +1,194 @@
+package lb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeNode is a node reporting stats, which answers calls with its name and
+// their body, or a 503 while full, naming route as their route if set.
+type fakeNode struct {
+	name string
+	*httptest.Server
+
+	mu    sync.Mutex
+	stats map[string]interface{}
+	full  bool
+	route string
+}
+
+func newFakeNode(name string) *fakeNode {
+	n := &fakeNode{name: name, stats: map[string]interface{}{
+		"Queue": 0, "Running": 0, "Complete": 0, "Memory": 1024 * 1024 * 1024, "MemoryUsed": 0,
+	}}
+	n.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		if r.URL.Path == "/stats" {
+			json.NewEncoder(w).Encode(n.stats)
+			return
+		}
+		if n.full {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if n.route != "" {
+			w.Header().Set(routeHeader, n.route)
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write([]byte(n.name + ":" + string(body)))
+	}))
+	return n
+}
+
+func (n *fakeNode) addr() string {
+	return strings.TrimPrefix(n.URL, "http://")
+}
+
+func TestConsistentHashReverseProxy(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	nodes := []*fakeNode{newFakeNode("a"), newFakeNode("b"), newFakeNode("c")}
+	var addrs []string
+	for _, n := range nodes {
+		defer n.Close()
+		addrs = append(addrs, n.addr())
+	}
+	proxy := httptest.NewServer(ConsistentHashReverseProxy(ctx, NewNodes(addrs), DefaultConfig, nil))
+	defer proxy.Close()
+
+	call := func() string {
+		resp, err := http.Post(proxy.URL+"/r/myapp/hello", "text/plain", strings.NewReader("payload"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status code 200 but got %d", resp.StatusCode)
+		}
+		return string(body)
+	}
+
+	// Calls to a route keep reaching the same node.
+	first := call()
+	for i := 0; i < 5; i++ {
+		if out := call(); out != first {
+			t.Fatalf("Test %d: Expected the route to stick to `%s` but got `%s`", i, first, out)
+		}
+	}
+	if !strings.HasSuffix(first, ":payload") {
+		t.Fatalf("Expected the body to be forwarded but got `%s`", first)
+	}
+
+	var preferred *fakeNode
+	for _, n := range nodes {
+		if strings.HasPrefix(first, n.name+":") {
+			preferred = n
+		}
+	}
+
+	// They spill over to another node once it refuses them.
+	preferred.mu.Lock()
+	preferred.full = true
+	preferred.mu.Unlock()
+	if out := call(); out == first || !strings.HasSuffix(out, ":payload") {
+		t.Errorf("Expected the call to spill over to another node but got `%s`", out)
+	}
+}
+
+func TestLoadsPick(t *testing.T) {
+	l := newLoads(NewNodes([]string{"a", "b", "c"}))
+	l.loads["a"] = &nodeLoad{known: true, queued: 2, running: 4}
+	l.loads["b"] = &nodeLoad{known: true, running: 3}
+	l.loads["c"] = &nodeLoad{known: true, running: 1}
+
+	if node := l.pick("b"); node != "b" {
+		t.Errorf("Expected the preferred node `b` but got `%s`", node)
+	}
+	if node := l.pick("a"); node != "c" {
+		t.Errorf("Expected saturated `a` to spill over to `c` but got `%s`", node)
+	}
+
+	l.loads["c"].memoryUsed, l.loads["c"].memory = 1024, 1024
+	if node := l.pick("a"); node != "b" {
+		t.Errorf("Expected saturated `a` to spill over to `b` but got `%s`", node)
+	}
+	if node := l.spill("a", "b"); node != "c" {
+		t.Errorf("Expected a refused call to spill over to `c` but got `%s`", node)
+	}
+	if node := l.spill("a", "b", "c"); node != "" {
+		t.Errorf("Expected no node left to spill over to but got `%s`", node)
+	}
+}
+
+func TestConsistentHashDynamicRoutes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The nodes name the route of the calls to /users/:id.
+	nodes := []*fakeNode{newFakeNode("a"), newFakeNode("b"), newFakeNode("c")}
+	var addrs []string
+	for _, n := range nodes {
+		defer n.Close()
+		n.route = "/users/:id"
+		addrs = append(addrs, n.addr())
+	}
+	proxy := httptest.NewServer(ConsistentHashReverseProxy(ctx, NewNodes(addrs), DefaultConfig, nil))
+	defer proxy.Close()
+
+	call := func(path string) string {
+		resp, err := http.Post(proxy.URL+path, "text/plain", strings.NewReader("payload"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return strings.Split(string(body), ":")[0]
+	}
+
+	// Once a call to the route was answered, calls with other ids reach the
+	// same node.
+	call("/r/myapp/users/0")
+	first := call("/r/myapp/users/1")
+	for i := 2; i < 20; i++ {
+		if node := call(fmt.Sprintf("/r/myapp/users/%d", i)); node != first {
+			t.Fatalf("Expected user %d to reach node `%s` like user 1 but it reached `%s`", i, first, node)
+		}
+	}
+}
+
+func TestRoutesKey(t *testing.T) {
+	r := newRoutes()
+	for _, path := range []string{"/users/:id", "/users/new", "/files/*path"} {
+		req := httptest.NewRequest("GET", "/r/myapp"+path, nil)
+		r.learn(req, &http.Response{Header: http.Header{routeHeader: {path}}})
+	}
+
+	for i, test := range []struct {
+		host        string
+		path        string
+		expectedKey string
+	}{
+		{"lb", "/r/myapp/users/1", "/r/myapp/users/:id"},
+		{"lb", "/r/myapp/users/new", "/r/myapp/users/new"},
+		{"lb", "/r/myapp/files/a/b.txt", "/r/myapp/files/*path"},
+		{"lb", "/r/myapp/users/1/more", "/r/myapp/users/1/more"},
+		{"lb", "/r/otherapp/users/1", "/r/otherapp/users/1"},
+		{"api.example.com", "/users/1", "api.example.com/users/1"},
+	} {
+		req := httptest.NewRequest("GET", test.path, nil)
+		req.Host = test.host
+		if key := r.key(req); key != test.expectedKey {
+			t.Errorf("Test %d: Expected %s to be hashed on `%s` but got `%s`", i, test.path, test.expectedKey, key)
+		}
+	}
+}
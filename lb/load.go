@@ -0,0 +1,221 @@
+package lb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// loadInterval is how often the nodes are asked for their load.
+const loadInterval = 1 * time.Second
+
+// minFreeMemory is the memory, in bytes, a node needs free to take a call
+// without queueing it: that of a function with the default memory.
+const minFreeMemory = 128 * 1024 * 1024
+
+// nodeLoad is the load of a node as of its last report, along with the calls
+// sent to it since.
+type nodeLoad struct {
+	known      bool
+	queued     int64
+	running    int64
+	memory     int64
+	memoryUsed int64
+	sent       int64
+
+	// full tells whether the node refused a call for its queue being full
+	// since its last report.
+	full bool
+}
+
+func (n *nodeLoad) saturated() bool {
+	if !n.known {
+		return false
+	}
+	return n.full || n.queued > 0 || (n.memory > 0 && n.memory-n.memoryUsed < minFreeMemory)
+}
+
+func (n *nodeLoad) load() int64 {
+	return n.queued + n.running + n.sent
+}
+
+// runnerStats is the part of the /stats of a node the load is read from. Nodes
+// encode them without JSON tags, hence the Go field names.
+type runnerStats struct {
+	Queue      uint64 `json:"Queue"`
+	Running    uint64 `json:"Running"`
+	Memory     int64  `json:"Memory"`
+	MemoryUsed int64  `json:"MemoryUsed"`
+}
+
+// loads keeps track of the load of the nodes by polling their /stats.
+type loads struct {
+	nodes *Nodes
+
+	mu    sync.Mutex
+	loads map[string]*nodeLoad
+}
+
+func newLoads(nodes *Nodes) *loads {
+	return &loads{nodes: nodes, loads: make(map[string]*nodeLoad)}
+}
+
+// poll updates the load of the nodes until ctx is done.
+func (l *loads) poll(ctx context.Context) {
+	tick := time.NewTicker(loadInterval)
+	defer tick.Stop()
+	for {
+		l.update(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+func (l *loads) update(ctx context.Context) {
+	nodes := l.nodes.List()
+
+	// The load of nodes added since is unknown until they report it.
+	l.mu.Lock()
+	current := make(map[string]*nodeLoad, len(nodes))
+	for _, node := range nodes {
+		if load, ok := l.loads[node]; ok {
+			current[node] = load
+		} else {
+			current[node] = new(nodeLoad)
+		}
+	}
+	l.loads = current
+	l.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, node := range nodes {
+		wg.Add(1)
+		go func(node string) {
+			defer wg.Done()
+			stats, err := fetchLoad(ctx, node)
+
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			load, ok := l.loads[node]
+			if !ok {
+				return // removed since
+			}
+			// Nodes which do not answer are left to FallbackRoundTripper.
+			*load = nodeLoad{known: err == nil}
+			if err == nil {
+				load.queued = int64(stats.Queue)
+				load.running = int64(stats.Running)
+				load.memory = stats.Memory
+				load.memoryUsed = stats.MemoryUsed
+			}
+		}(node)
+	}
+	wg.Wait()
+}
+
+func fetchLoad(ctx context.Context, node string) (*runnerStats, error) {
+	req, err := http.NewRequest("GET", "http://"+node+"/stats", nil)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, loadInterval)
+	defer cancel()
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	var stats runnerStats
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// pick returns preferred, unless it is saturated and another node is less
+// so, counting the call as sent to the node returned.
+func (l *loads) pick(preferred string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	target := preferred
+	if load, ok := l.loads[preferred]; ok && load.saturated() {
+		if node := l.leastLoaded(preferred); node != "" {
+			alt := l.loads[node]
+			if !alt.saturated() || alt.load() < load.load() {
+				target = node
+			}
+		}
+	}
+	if load, ok := l.loads[target]; ok {
+		load.sent++
+	}
+	return target
+}
+
+// spill returns the least loaded node a call refused by the nodes tried can
+// be sent to, counting it as sent there, or "" if there is none.
+func (l *loads) spill(tried ...string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	node := l.leastLoaded(tried...)
+	if node != "" {
+		l.loads[node].sent++
+	}
+	return node
+}
+
+// leastLoaded returns the least loaded node of known load not in except,
+// favoring the ones which are not saturated. l.mu must be held.
+func (l *loads) leastLoaded(except ...string) string {
+	var target string
+	var best *nodeLoad
+nodes:
+	for _, node := range l.nodes.List() {
+		load, ok := l.loads[node]
+		if !ok || !load.known {
+			continue
+		}
+		for _, e := range except {
+			if node == e {
+				continue nodes
+			}
+		}
+		if best == nil || best.saturated() && !load.saturated() ||
+			best.saturated() == load.saturated() && load.load() < best.load() {
+			target, best = node, load
+		}
+	}
+	return target
+}
+
+// status returns whether node is saturated, and its load.
+func (l *loads) status(node string) (bool, int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	load, ok := l.loads[node]
+	if !ok {
+		return false, 0
+	}
+	return load.saturated(), load.load()
+}
+
+// full records that node refused a call for its queue being full.
+func (l *loads) full(node string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if load, ok := l.loads[node]; ok {
+		load.known = true
+		load.full = true
+	}
+}
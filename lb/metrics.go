@@ -0,0 +1,302 @@
+package lb
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the buckets of the
+// latency histogram of every node.
+var latencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+
+// removedNodeTTL is how long the counts of a node are kept once it leaves the
+// set of nodes, for them to be scraped before they are dropped.
+const removedNodeTTL = 15 * time.Minute
+
+// Metrics counts the calls the load balancer sends to every node, and reports
+// them along with the state of the nodes at /1/lb/stats, as JSON, and at
+// /1/lb/metrics, for Prometheus.
+type Metrics struct {
+	mu    sync.Mutex
+	nodes map[string]*nodeMetrics
+	ttl   time.Duration
+
+	// Where the state of the nodes comes from, set by
+	// ConsistentHashReverseProxy.
+	members *Nodes
+	rt      *FallbackRoundTripper
+	loads   *loads
+}
+
+// nodeMetrics are the counts of a node, kept for the TTL of m once it leaves
+// the set of nodes so that they do not go down while it may come back.
+type nodeMetrics struct {
+	requests  uint64
+	failures  uint64
+	fallbacks uint64
+	spills    uint64
+
+	latencyCounts []uint64 // calls per latency bucket, the last one unbounded
+	latencySum    float64  // in seconds
+
+	removedAt time.Time // when the node was found out of the set, if it is
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{nodes: make(map[string]*nodeMetrics), ttl: removedNodeTTL}
+}
+
+// node returns the metrics of node, creating them if needed. m.mu must be
+// held.
+func (m *Metrics) node(node string) *nodeMetrics {
+	n, ok := m.nodes[node]
+	if !ok {
+		n = &nodeMetrics{latencyCounts: make([]uint64, len(latencyBuckets)+1)}
+		m.nodes[node] = n
+	}
+	return n
+}
+
+// call counts a call sent to node.
+func (m *Metrics) call(node string, failed bool, latency time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := m.node(node)
+	n.requests++
+	if failed {
+		n.failures++
+	}
+	seconds := latency.Seconds()
+	i := sort.SearchFloat64s(latencyBuckets, seconds)
+	n.latencyCounts[i]++
+	n.latencySum += seconds
+}
+
+// fallback counts a call meant for node sent to another one, node being
+// unavailable or having failed it.
+func (m *Metrics) fallback(node string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.node(node).fallbacks++
+}
+
+// spill counts a call meant for node spilled over to another one, node being
+// saturated or having refused it.
+func (m *Metrics) spill(node string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.node(node).spills++
+}
+
+// nodeStatus is the state and counts of a node, as of /1/lb/stats.
+type nodeStatus struct {
+	Node string `json:"node"`
+
+	// Member tells whether calls are balanced to the node, which is left
+	// out of the ring once removed.
+	Member    bool   `json:"member"`
+	Healthy   bool   `json:"healthy"`
+	Breaker   string `json:"breaker"`
+	Saturated bool   `json:"saturated"`
+	Load      int64  `json:"load"`
+
+	Requests  uint64 `json:"requests"`
+	Failures  uint64 `json:"failures"`
+	Fallbacks uint64 `json:"fallbacks"`
+	Spills    uint64 `json:"spills"`
+
+	// LatencyMean is in seconds.
+	LatencyMean float64 `json:"latency_mean"`
+
+	latencyCounts []uint64
+	latencySum    float64
+}
+
+// Breaker states
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half-open"
+)
+
+// status returns the state and counts of the nodes which are members or got
+// calls, members first. The counts of the nodes out of the set for longer than
+// the TTL of m are dropped.
+func (m *Metrics) status() []nodeStatus {
+	var members []string
+	if m.members != nil {
+		members = m.members.List()
+	}
+
+	m.mu.Lock()
+	now := time.Now()
+	var others []string
+	for node, n := range m.nodes {
+		switch {
+		case contains(members, node):
+			n.removedAt = time.Time{}
+		case n.removedAt.IsZero():
+			n.removedAt = now
+			others = append(others, node)
+		case now.Sub(n.removedAt) >= m.ttl:
+			delete(m.nodes, node)
+		default:
+			others = append(others, node)
+		}
+	}
+	sort.Strings(others)
+
+	var status []nodeStatus
+	for i, node := range append(append([]string(nil), members...), others...) {
+		s := nodeStatus{Node: node, Member: i < len(members), Healthy: true, Breaker: breakerClosed}
+		if n, ok := m.nodes[node]; ok {
+			s.Requests, s.Failures, s.Fallbacks, s.Spills = n.requests, n.failures, n.fallbacks, n.spills
+			s.latencyCounts = append([]uint64(nil), n.latencyCounts...)
+			s.latencySum = n.latencySum
+			if n.requests > 0 {
+				s.LatencyMean = n.latencySum / float64(n.requests)
+			}
+		}
+		status = append(status, s)
+	}
+	m.mu.Unlock()
+
+	for i := range status {
+		if !status[i].Member {
+			continue
+		}
+		if m.rt != nil {
+			status[i].Healthy, status[i].Breaker = m.rt.status(status[i].Node)
+		}
+		if m.loads != nil {
+			status[i].Saturated, status[i].Load = m.loads.status(status[i].Node)
+		}
+	}
+	return status
+}
+
+type lbStatsResponse struct {
+	Message string       `json:"message"`
+	Nodes   []nodeStatus `json:"nodes"`
+}
+
+// MetricsHandler answers /1/lb/stats and /1/lb/metrics with the metrics of
+// the load balancer, which requests must carry token as a bearer token for,
+// like the admin API. Every other request is handed to next.
+func MetricsHandler(m *Metrics, token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/1/lb/stats" && r.URL.Path != "/1/lb/metrics" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !authorize(w, r, token) {
+			return
+		}
+		if r.Method != "GET" {
+			w.Header().Set("Allow", "GET")
+			writeError(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed)
+			return
+		}
+
+		if r.URL.Path == "/1/lb/stats" {
+			writeJSON(w, http.StatusOK, lbStatsResponse{"Successfully loaded load balancer stats", m.status()})
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		m.writePrometheus(w)
+	})
+}
+
+// writePrometheus writes the metrics in the Prometheus text format.
+func (m *Metrics) writePrometheus(w io.Writer) {
+	status := m.status()
+	var members int
+	for _, s := range status {
+		if s.Member {
+			members++
+		}
+	}
+
+	fmt.Fprintln(w, "# HELP fnlb_nodes Number of nodes calls are balanced amongst.")
+	fmt.Fprintln(w, "# TYPE fnlb_nodes gauge")
+	fmt.Fprintln(w, "fnlb_nodes", members)
+
+	gauges := []struct {
+		name, help string
+		value      func(s *nodeStatus) float64
+	}{
+		{"fnlb_node_healthy", "Whether the node passes health checks.", func(s *nodeStatus) float64 { return boolValue(s.Healthy) }},
+		{"fnlb_node_breaker_open", "Whether the breaker of the node is open, 0.5 while trying the node again.", func(s *nodeStatus) float64 {
+			switch s.Breaker {
+			case breakerOpen:
+				return 1
+			case breakerHalfOpen:
+				return 0.5
+			}
+			return 0
+		}},
+		{"fnlb_node_saturated", "Whether the node is saturated, its calls spilling over to other nodes.", func(s *nodeStatus) float64 { return boolValue(s.Saturated) }},
+		{"fnlb_node_load", "Calls queued and running on the node as of its last report, plus the calls sent since.", func(s *nodeStatus) float64 { return float64(s.Load) }},
+	}
+	for _, g := range gauges {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", g.name, g.help, g.name)
+		for i := range status {
+			if status[i].Member {
+				fmt.Fprintf(w, "%s{node=\"%s\"} %v\n", g.name, labelValue(status[i].Node), g.value(&status[i]))
+			}
+		}
+	}
+
+	counters := []struct {
+		name, help string
+		value      func(s *nodeStatus) uint64
+	}{
+		{"fnlb_node_requests_total", "Calls sent to the node.", func(s *nodeStatus) uint64 { return s.Requests }},
+		{"fnlb_node_failures_total", "Calls sent to the node which failed.", func(s *nodeStatus) uint64 { return s.Failures }},
+		{"fnlb_node_fallbacks_total", "Calls meant for the node sent to another one, the node being unavailable or having failed them.", func(s *nodeStatus) uint64 { return s.Fallbacks }},
+		{"fnlb_node_spills_total", "Calls meant for the node spilled over to another one, the node being saturated or having refused them.", func(s *nodeStatus) uint64 { return s.Spills }},
+	}
+	for _, c := range counters {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+		for i := range status {
+			fmt.Fprintf(w, "%s{node=\"%s\"} %d\n", c.name, labelValue(status[i].Node), c.value(&status[i]))
+		}
+	}
+
+	fmt.Fprintln(w, "# HELP fnlb_node_request_duration_seconds Time the node took to answer calls.")
+	fmt.Fprintln(w, "# TYPE fnlb_node_request_duration_seconds histogram")
+	for _, s := range status {
+		if s.latencyCounts == nil {
+			continue
+		}
+		node := labelValue(s.Node)
+		var cumulative uint64
+		for i, le := range latencyBuckets {
+			cumulative += s.latencyCounts[i]
+			fmt.Fprintf(w, "fnlb_node_request_duration_seconds_bucket{node=\"%s\",le=\"%v\"} %d\n", node, le, cumulative)
+		}
+		cumulative += s.latencyCounts[len(latencyBuckets)]
+		fmt.Fprintf(w, "fnlb_node_request_duration_seconds_bucket{node=\"%s\",le=\"+Inf\"} %d\n", node, cumulative)
+		fmt.Fprintf(w, "fnlb_node_request_duration_seconds_sum{node=\"%s\"} %v\n", node, s.latencySum)
+		fmt.Fprintf(w, "fnlb_node_request_duration_seconds_count{node=\"%s\"} %d\n", node, cumulative)
+	}
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labelValue escapes s to be a label value.
+func labelValue(s string) string {
+	return labelEscaper.Replace(s)
+}
@@ -0,0 +1,118 @@
+package lb
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	a, b := newTestNode("a"), newTestNode("b")
+	defer a.Close()
+	defer b.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := DefaultConfig
+	cfg.HealthInterval = 10 * time.Millisecond
+	nodes := NewNodes([]string{a.addr(), b.addr()})
+	m := NewMetrics()
+	f := NewRoundTripper(ctx, nodes, cfg, m)
+	m.members, m.rt = nodes, f
+
+	// a is bypassed while unhealthy.
+	a.set(func(n *testNode) { n.health = http.StatusInternalServerError })
+	time.Sleep(50 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		if code, body := roundTrip(t, f, "POST", a, "/r/app/route"); code != http.StatusOK || body != "b:payload" {
+			t.Fatalf("Test %d: Expected the call to fall back to b but got %d `%s`", i, code, body)
+		}
+	}
+
+	h := MetricsHandler(m, "secret", http.NotFoundHandler())
+	get := func(path, auth string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := get("/1/lb/stats", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status code 401 without token but got %d", rec.Code)
+	}
+	if rec := get("/r/app/route", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected other requests to be handed over but got %d", rec.Code)
+	}
+
+	rec := get("/1/lb/stats", "Bearer secret")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status code 200 but got %d", rec.Code)
+	}
+	var resp lbStatsResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Could not decode stats: %v", err)
+	}
+	if len(resp.Nodes) != 2 {
+		t.Fatalf("Expected the stats of 2 nodes but got %d", len(resp.Nodes))
+	}
+	sa, sb := resp.Nodes[0], resp.Nodes[1]
+	if sa.Node != a.addr() || sa.Healthy || sa.Requests != 0 || sa.Fallbacks != 3 {
+		t.Errorf("Expected a to be unhealthy with 3 fallbacks and no request but got %+v", sa)
+	}
+	if sb.Node != b.addr() || !sb.Healthy || sb.Requests != 3 || sb.Fallbacks != 0 || sb.Breaker != breakerClosed {
+		t.Errorf("Expected b to be healthy with 3 requests but got %+v", sb)
+	}
+
+	rec = get("/1/lb/metrics", "Bearer secret")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status code 200 but got %d", rec.Code)
+	}
+	metrics := rec.Body.String()
+	for _, line := range []string{
+		"fnlb_nodes 2",
+		`fnlb_node_healthy{node="` + a.addr() + `"} 0`,
+		`fnlb_node_healthy{node="` + b.addr() + `"} 1`,
+		`fnlb_node_requests_total{node="` + b.addr() + `"} 3`,
+		`fnlb_node_fallbacks_total{node="` + a.addr() + `"} 3`,
+		`fnlb_node_request_duration_seconds_count{node="` + b.addr() + `"} 3`,
+		`fnlb_node_request_duration_seconds_bucket{node="` + b.addr() + `",le="+Inf"} 3`,
+	} {
+		if !strings.Contains(metrics, line+"\n") {
+			t.Errorf("Expected metrics to contain `%s`, got:\n%s", line, metrics)
+		}
+	}
+
+	// Removed nodes are no longer members, but keep their counts for the TTL.
+	m.ttl = 50 * time.Millisecond
+	nodes.Remove(a.addr())
+	metrics = get("/1/lb/metrics", "Bearer secret").Body.String()
+	for _, line := range []string{
+		"fnlb_nodes 1",
+		`fnlb_node_fallbacks_total{node="` + a.addr() + `"} 3`,
+	} {
+		if !strings.Contains(metrics, line+"\n") {
+			t.Errorf("Expected metrics to contain `%s`, got:\n%s", line, metrics)
+		}
+	}
+	if strings.Contains(metrics, `fnlb_node_healthy{node="`+a.addr()+`"}`) {
+		t.Errorf("Expected no health for the removed node, got:\n%s", metrics)
+	}
+
+	// They are dropped once the TTL has passed.
+	time.Sleep(60 * time.Millisecond)
+	metrics = get("/1/lb/metrics", "Bearer secret").Body.String()
+	if strings.Contains(metrics, `node="`+a.addr()+`"`) {
+		t.Errorf("Expected the removed node to be dropped after the TTL, got:\n%s", metrics)
+	}
+	if !strings.Contains(metrics, `fnlb_node_requests_total{node="`+b.addr()+`"} 3`+"\n") {
+		t.Errorf("Expected b to keep its counts, got:\n%s", metrics)
+	}
+}
@@ -0,0 +1,223 @@
+package lb
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/golang/groupcache/consistenthash"
+)
+
+// ringReplicas is the number of points of each node on the hash ring. It does
+// not depend on the number of nodes so that adding or removing one only moves
+// the routes hashed next to it.
+const ringReplicas = 64
+
+// Nodes is the set of nodes calls are balanced amongst. Nodes are either added,
+// from the command line or the admin API, or discovered, the discovered ones
+// being replaced as a whole by every discovery.
+type Nodes struct {
+	mu         sync.RWMutex
+	added      []string
+	discovered []string
+	list       []string
+	ring       *consistenthash.Map
+}
+
+// NewNodes creates a set of nodes holding the given ones, blanks left out.
+func NewNodes(nodes []string) *Nodes {
+	n := &Nodes{}
+	for _, node := range nodes {
+		if node = strings.TrimSpace(node); node != "" && !contains(n.added, node) {
+			n.added = append(n.added, node)
+		}
+	}
+	n.rebuild()
+	return n
+}
+
+// List returns the nodes, added ones first.
+func (n *Nodes) List() []string {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.list
+}
+
+// Get returns the node key is hashed to, or "" if there is none.
+func (n *Nodes) Get(key string) string {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.ring.Get(key)
+}
+
+// Add adds node, telling whether it was not in the set already.
+func (n *Nodes) Add(node string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if contains(n.added, node) {
+		return false
+	}
+	added := !contains(n.list, node)
+	n.added = append(n.added, node)
+	n.rebuild()
+	return added
+}
+
+// Remove removes node, telling whether it was in the set. Discovered nodes
+// come back with the next discovery if they are still found.
+func (n *Nodes) Remove(node string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if !contains(n.list, node) {
+		return false
+	}
+	n.added = without(n.added, node)
+	n.discovered = without(n.discovered, node)
+	n.rebuild()
+	return true
+}
+
+// SetDiscovered replaces the discovered nodes.
+func (n *Nodes) SetDiscovered(nodes []string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var discovered []string
+	for _, node := range nodes {
+		if !contains(discovered, node) {
+			discovered = append(discovered, node)
+		}
+	}
+	n.discovered = discovered
+	n.rebuild()
+}
+
+// rebuild computes the list and hash ring of the nodes. n.mu must be held.
+func (n *Nodes) rebuild() {
+	list := append([]string(nil), n.added...)
+	for _, node := range n.discovered {
+		if !contains(list, node) {
+			list = append(list, node)
+		}
+	}
+	if !equal(list, n.list) {
+		logrus.WithField("nodes", list).Info("Balancing calls amongst nodes")
+	}
+
+	// The list and ring are replaced rather than changed in place, as they
+	// are used by readers after the lock is released.
+	n.list = list
+	n.ring = consistenthash.New(ringReplicas, nil)
+	n.ring.Add(list...)
+}
+
+func contains(nodes []string, node string) bool {
+	for _, n := range nodes {
+		if n == node {
+			return true
+		}
+	}
+	return false
+}
+
+func without(nodes []string, node string) []string {
+	var out []string
+	for _, n := range nodes {
+		if n != node {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Discover keeps the discovered nodes of n up to date with the ones found by
+// discover, every interval until ctx is done. The nodes are kept as they are
+// while discover fails.
+func Discover(ctx context.Context, n *Nodes, interval time.Duration, discover func() ([]string, error)) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		if nodes, err := discover(); err != nil {
+			logrus.WithError(err).Error("Could not discover nodes")
+		} else {
+			n.SetDiscovered(nodes)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+// SRVDiscovery discovers the nodes of the DNS SRV record name, eg.
+// _functions._tcp.example.com.
+func SRVDiscovery(name string) func() ([]string, error) {
+	return func() ([]string, error) {
+		_, srvs, err := net.LookupSRV("", "", name)
+		if err != nil {
+			return nil, err
+		}
+		var nodes []string
+		for _, srv := range srvs {
+			host := strings.TrimSuffix(srv.Target, ".")
+			nodes = append(nodes, net.JoinHostPort(host, strconv.Itoa(int(srv.Port))))
+		}
+		return nodes, nil
+	}
+}
+
+// FileDiscovery discovers the nodes listed in the file at path, one per line
+// or comma separated, lines starting with # being left out. The file is only
+// read again once it changes.
+func FileDiscovery(path string) func() ([]string, error) {
+	var modTime time.Time
+	var nodes []string
+	return func() ([]string, error) {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if fi.ModTime().Equal(modTime) {
+			return nodes, nil
+		}
+		buf, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var read []string
+		for _, line := range strings.Split(string(buf), "\n") {
+			if line = strings.TrimSpace(line); strings.HasPrefix(line, "#") {
+				continue
+			}
+			for _, node := range strings.Split(line, ",") {
+				if node = strings.TrimSpace(node); node != "" {
+					if _, _, err := net.SplitHostPort(node); err != nil {
+						return nil, fmt.Errorf("%s: invalid node `%s`: %v", path, node, err)
+					}
+					read = append(read, node)
+				}
+			}
+		}
+		modTime, nodes = fi.ModTime(), read
+		return nodes, nil
+	}
+}
@@ -0,0 +1,152 @@
+package lb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNodes(t *testing.T) {
+	n := NewNodes([]string{"a:1", " ", "b:1", "a:1"})
+	if nodes := n.List(); !reflect.DeepEqual(nodes, []string{"a:1", "b:1"}) {
+		t.Fatalf("Expected nodes [a:1 b:1] but got %v", nodes)
+	}
+
+	keys := make([]string, 100)
+	before := make(map[string]string)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("/r/app/route%d", i)
+		before[keys[i]] = n.Get(keys[i])
+	}
+
+	if !n.Add("c:1") || n.Add("c:1") {
+		t.Error("Expected c:1 to be added once")
+	}
+	n.SetDiscovered([]string{"d:1", "a:1", "d:1"})
+	if nodes := n.List(); !reflect.DeepEqual(nodes, []string{"a:1", "b:1", "c:1", "d:1"}) {
+		t.Fatalf("Expected nodes [a:1 b:1 c:1 d:1] but got %v", nodes)
+	}
+
+	// Routes only move to the nodes added.
+	for _, key := range keys {
+		if node := n.Get(key); node != before[key] && node != "c:1" && node != "d:1" {
+			t.Errorf("Expected %s to stay on %s or move to a new node but it moved to %s", key, before[key], node)
+		}
+	}
+
+	if !n.Remove("d:1") || n.Remove("d:1") {
+		t.Error("Expected d:1 to be removed once")
+	}
+	n.SetDiscovered(nil)
+	if nodes := n.List(); !reflect.DeepEqual(nodes, []string{"a:1", "b:1", "c:1"}) {
+		t.Fatalf("Expected nodes [a:1 b:1 c:1] but got %v", nodes)
+	}
+	n.Remove("c:1")
+	for _, key := range keys {
+		if node := n.Get(key); node != before[key] {
+			t.Errorf("Expected %s to be back on %s but it is on %s", key, before[key], node)
+		}
+	}
+}
+
+func TestFileDiscovery(t *testing.T) {
+	f, err := ioutil.TempFile("", "nodes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	write := func(content string, modTime time.Time) {
+		if err := ioutil.WriteFile(f.Name(), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(f.Name(), modTime, modTime)
+	}
+
+	discover := FileDiscovery(f.Name())
+	write("# nodes\na:1\nb:1, c:1\n\n", time.Now().Add(-time.Minute))
+	if nodes, err := discover(); err != nil || !reflect.DeepEqual(nodes, []string{"a:1", "b:1", "c:1"}) {
+		t.Errorf("Expected nodes [a:1 b:1 c:1] but got %v, %v", nodes, err)
+	}
+
+	write("a:1\nb\n", time.Now())
+	if _, err := discover(); err == nil {
+		t.Error("Expected an error for a node without a port")
+	}
+
+	write("d:1\n", time.Now().Add(time.Minute))
+	if nodes, err := discover(); err != nil || !reflect.DeepEqual(nodes, []string{"d:1"}) {
+		t.Errorf("Expected nodes [d:1] but got %v, %v", nodes, err)
+	}
+}
+
+func TestNodesHandler(t *testing.T) {
+	nodes := NewNodes([]string{"a:1"})
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	h := NodesHandler(nodes, "secret", next)
+
+	for i, test := range []struct {
+		method       string
+		path         string
+		auth         string
+		body         string
+		expectedCode int
+		expected     []string
+	}{
+		{"GET", "/r/app/route", "", "", http.StatusTeapot, nil},
+		{"GET", "/1/lb/nodes", "", "", http.StatusUnauthorized, nil},
+		{"GET", "/1/lb/nodes", "Bearer wrong", "", http.StatusUnauthorized, nil},
+		{"GET", "/1/lb/nodes", "Bearer secret", "", http.StatusOK, []string{"a:1"}},
+		{"POST", "/1/lb/nodes", "Bearer secret", `{"node":"b:1"}`, http.StatusOK, []string{"a:1", "b:1"}},
+		{"POST", "/1/lb/nodes", "Bearer secret", `{"node":"b"}`, http.StatusBadRequest, nil},
+		{"POST", "/1/lb/nodes", "Bearer secret", `{`, http.StatusBadRequest, nil},
+		{"DELETE", "/1/lb/nodes", "Bearer secret", `{"node":"a:1"}`, http.StatusOK, []string{"b:1"}},
+		{"DELETE", "/1/lb/nodes", "Bearer secret", `{"node":"a:1"}`, http.StatusNotFound, nil},
+		{"PUT", "/1/lb/nodes", "Bearer secret", "", http.StatusMethodNotAllowed, nil},
+	} {
+		req := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+		if test.auth != "" {
+			req.Header.Set("Authorization", test.auth)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != test.expectedCode {
+			t.Errorf("Test %d: Expected status code to be %d but was %d", i, test.expectedCode, rec.Code)
+			continue
+		}
+		if test.expected != nil {
+			var resp nodesResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Errorf("Test %d: Could not decode response: %v", i, err)
+			}
+			if !reflect.DeepEqual(resp.Nodes, test.expected) {
+				t.Errorf("Test %d: Expected nodes %v but got %v", i, test.expected, resp.Nodes)
+			}
+		}
+	}
+
+	// The admin API is disabled without a token.
+	h = NodesHandler(nodes, "", next)
+	for _, auth := range []string{"", "Bearer "} {
+		req := httptest.NewRequest("POST", "/1/lb/nodes", strings.NewReader(`{"node":"c:1"}`))
+		req.Header.Set("Authorization", auth)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("Expected status code 403 without an admin token but got %d", rec.Code)
+		}
+	}
+	if nodes := nodes.List(); !reflect.DeepEqual(nodes, []string{"b:1"}) {
+		t.Errorf("Expected nodes [b:1] but got %v", nodes)
+	}
+}
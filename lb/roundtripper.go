@@ -1,157 +1,444 @@
 package lb
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
-
-	"github.com/golang/groupcache/singleflight"
 )
 
 // ErrNoFallbackNodeFound happens when the fallback routine does not manage to
-// find a TCP reachable node in alternative to the chosen one.
+// find an available node in alternative to the chosen one.
 var ErrNoFallbackNodeFound = errors.New("no fallback node found - whole cluster seems offline")
 
+// Config tells how FallbackRoundTripper checks nodes and calls them.
+type Config struct {
+	// HealthPath is requested from every node each HealthInterval, nodes
+	// being healthy while they answer it with a 200 within HealthTimeout.
+	HealthPath     string
+	HealthInterval time.Duration
+	HealthTimeout  time.Duration
+
+	// DialTimeout bounds connecting to a node, Timeout a whole call to it.
+	// Timeout is 0 by default, as functions may run for long.
+	DialTimeout time.Duration
+	Timeout     time.Duration
+
+	// Retries is how many other nodes a failed call is sent to. Calls are
+	// only sent again if their method is idempotent or if they could not
+	// reach the node.
+	Retries int
+
+	// MaxBodyBuffer is how many bytes of a call body are kept in memory for
+	// the call to be sent again, to another node or after a spill. Calls with
+	// larger bodies are streamed to their node and only sent once.
+	MaxBodyBuffer int64
+
+	// The breaker of a node opens once, out of the BreakerMinRequests calls
+	// or more made to the node within a BreakerWindow, the ratio of failed
+	// calls or calls slower than BreakerSlowCall reaches BreakerErrorRate.
+	// BreakerSlowCall is 0 by default, leaving latency out. Calls go to other
+	// nodes while the breaker is open, until one is let through to try the
+	// node again every BreakerOpenTime.
+	BreakerWindow      time.Duration
+	BreakerMinRequests int
+	BreakerErrorRate   float64
+	BreakerSlowCall    time.Duration
+	BreakerOpenTime    time.Duration
+}
+
+// DefaultConfig is the Config of fnlb unless told otherwise.
+var DefaultConfig = Config{
+	HealthPath:         "/version",
+	HealthInterval:     1 * time.Second,
+	HealthTimeout:      2 * time.Second,
+	DialTimeout:        5 * time.Second,
+	Retries:            2,
+	MaxBodyBuffer:      1 << 20,
+	BreakerWindow:      10 * time.Second,
+	BreakerMinRequests: 10,
+	BreakerErrorRate:   0.5,
+	BreakerOpenTime:    30 * time.Second,
+}
+
 // FallbackRoundTripper implements http.RoundTripper in a way that when an
 // outgoing request does not manage to succeed with its original target host,
-// it fallsback to a list of alternative hosts. Internally it keeps a list of
-// dead hosts, and pings them until they are back online, diverting traffic
-// back to them. This is meant to be used by ConsistentHashReverseProxy().
+// it fallsback to a list of alternative hosts. Internally it checks the health
+// of every host over HTTP and keeps a circuit breaker for each, diverting
+// traffic from the hosts which are unhealthy or fail too many calls until
+// they are back. This is meant to be used by ConsistentHashReverseProxy().
 type FallbackRoundTripper struct {
-	nodes []string
-	sf    singleflight.Group
+	nodes     *Nodes
+	cfg       Config
+	metrics   *Metrics
+	transport *http.Transport
 
-	mu sync.Mutex
-	// a list of offline servers that must be rechecked to see when they
-	// get back online. If a server is in this list, it must have a fallback
-	// available to which requests are sent.
-	fallback map[string]string
+	mu     sync.Mutex
+	states map[string]*nodeState
+}
+
+// nodeState is what FallbackRoundTripper knows of the health of a node.
+type nodeState struct {
+	// healthy as of the last health check, nodes being healthy until
+	// checked.
+	healthy bool
+
+	// open tells whether the breaker is open since openedAt, trial whether
+	// a call was let through to try the node again since.
+	open     bool
+	openedAt time.Time
+	trial    bool
+
+	// The calls and failed calls of the window started at windowStart.
+	windowStart time.Time
+	calls       int
+	failures    int
 }
 
 // NewRoundTripper creates a new FallbackRoundTripper and triggers the internal
-// host TCP health checks.
-func NewRoundTripper(ctx context.Context, nodes []string) *FallbackRoundTripper {
-	frt := &FallbackRoundTripper{
-		nodes:    nodes,
-		fallback: make(map[string]string),
+// host HTTP health checks. The calls it makes are counted in metrics, if any.
+func NewRoundTripper(ctx context.Context, nodes *Nodes, cfg Config, metrics *Metrics) *FallbackRoundTripper {
+	if metrics == nil {
+		metrics = NewMetrics()
+	}
+	f := &FallbackRoundTripper{
+		nodes:   nodes,
+		cfg:     cfg,
+		metrics: metrics,
+		transport: &http.Transport{
+			DialContext: (&net.Dialer{
+				Timeout:   cfg.DialTimeout,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			MaxIdleConnsPerHost: 64,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		states: make(map[string]*nodeState),
 	}
-	go frt.checkHealth(ctx)
-	return frt
+	go f.checkHealth(ctx)
+	return f
 }
 
 func (f *FallbackRoundTripper) checkHealth(ctx context.Context) {
-	tick := time.NewTicker(1 * time.Second)
+	tick := time.NewTicker(f.cfg.HealthInterval)
 	defer tick.Stop()
 	for {
+		nodes := f.nodes.List()
+		healthy := make([]bool, len(nodes))
+		var wg sync.WaitGroup
+		for i, node := range nodes {
+			wg.Add(1)
+			go func(i int, node string) {
+				defer wg.Done()
+				healthy[i] = f.check(ctx, node)
+			}(i, node)
+		}
+		wg.Wait()
+
+		// Nodes removed from the set are forgotten.
+		f.mu.Lock()
+		states := make(map[string]*nodeState, len(nodes))
+		for i, node := range nodes {
+			state := f.state(node)
+			state.healthy = healthy[i]
+			states[node] = state
+		}
+		f.states = states
+		f.mu.Unlock()
+
 		select {
 		case <-ctx.Done():
 			return
 		case <-tick.C:
-			f.mu.Lock()
-			if len(f.fallback) == 0 {
-				f.mu.Unlock()
-				continue
-			}
-			fallback := make(map[string]string)
-			for k, v := range f.fallback {
-				fallback[k] = v
-			}
-			f.mu.Unlock()
-
-			updatedlist := make(map[string]string)
-			for host, target := range fallback {
-				if !f.ping(host) {
-					updatedlist[host] = target
-				}
-			}
-
-			f.mu.Lock()
-			f.fallback = make(map[string]string)
-			for k, v := range updatedlist {
-				f.fallback[k] = v
-			}
-			f.mu.Unlock()
 		}
 	}
 }
 
-func (f *FallbackRoundTripper) ping(host string) bool {
-	conn, err := net.Dial("tcp", host)
+func (f *FallbackRoundTripper) check(ctx context.Context, node string) bool {
+	req, err := http.NewRequest("GET", "http://"+node+f.cfg.HealthPath, nil)
+	if err != nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(ctx, f.cfg.HealthTimeout)
+	defer cancel()
+	resp, err := f.transport.RoundTrip(req.WithContext(ctx))
 	if err != nil {
 		return false
 	}
-	conn.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+// state returns the state of node, creating it if needed. f.mu must be held.
+func (f *FallbackRoundTripper) state(node string) *nodeState {
+	state, ok := f.states[node]
+	if !ok {
+		state = &nodeState{healthy: true}
+		f.states[node] = state
+	}
+	return state
+}
+
+// allow tells whether a call can be sent to node, counting it as the call
+// trying the node again if its breaker has been open long enough.
+func (f *FallbackRoundTripper) allow(node string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	state := f.state(node)
+	if !state.healthy {
+		return false
+	}
+	if !state.open {
+		return true
+	}
+	if state.trial || time.Since(state.openedAt) < f.cfg.BreakerOpenTime {
+		return false
+	}
+	state.trial = true
 	return true
 }
 
-func (f *FallbackRoundTripper) fallbackHost(targetHost, failedFallback string) string {
-	detected, err := f.sf.Do(targetHost, func() (interface{}, error) {
-		for _, node := range f.nodes {
-			if node != targetHost && node != failedFallback && f.ping(node) {
-				f.mu.Lock()
-				f.fallback[targetHost] = node
-				f.mu.Unlock()
-				return node, nil
-			}
+// status returns whether node is healthy and the state of its breaker.
+func (f *FallbackRoundTripper) status(node string) (bool, string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	state, ok := f.states[node]
+	switch {
+	case !ok:
+		return true, breakerClosed
+	case !state.open:
+		return state.healthy, breakerClosed
+	case state.trial || time.Since(state.openedAt) >= f.cfg.BreakerOpenTime:
+		return state.healthy, breakerHalfOpen
+	}
+	return state.healthy, breakerOpen
+}
+
+// record counts a call to node in its breaker and metrics.
+func (f *FallbackRoundTripper) record(node string, failed bool, latency time.Duration) {
+	f.metrics.call(node, failed, latency)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	state := f.state(node)
+	if f.cfg.BreakerSlowCall > 0 && latency > f.cfg.BreakerSlowCall {
+		failed = true
+	}
+
+	now := time.Now()
+	if state.open {
+		// Only the call trying the node again tells whether it is back.
+		if !state.trial {
+			return
+		}
+		state.trial = false
+		if failed {
+			state.openedAt = now
+			return
 		}
-		return "", ErrNoFallbackNodeFound
-	})
+		state.open = false
+		state.windowStart, state.calls, state.failures = now, 0, 0
+		return
+	}
 
-	if err != nil {
-		return ""
+	if now.Sub(state.windowStart) >= f.cfg.BreakerWindow {
+		state.windowStart, state.calls, state.failures = now, 0, 0
+	}
+	state.calls++
+	if failed {
+		state.failures++
 	}
-	return detected.(string)
+	if state.calls >= f.cfg.BreakerMinRequests &&
+		float64(state.failures) >= f.cfg.BreakerErrorRate*float64(state.calls) {
+		state.open, state.openedAt = true, now
+	}
+}
 
+// fallbackHost returns the first node available after targetHost in the list
+// of nodes, leaving out the ones tried already, or "" if there is none. Nodes
+// falling back start at different places so that their load is spread.
+func (f *FallbackRoundTripper) fallbackHost(targetHost string, tried []string) string {
+	nodes := f.nodes.List()
+	start := 0
+	for i, node := range nodes {
+		if node == targetHost {
+			start = i + 1
+		}
+	}
+	for i := range nodes {
+		node := nodes[(start+i)%len(nodes)]
+		if node != targetHost && !contains(tried, node) && f.allow(node) {
+			return node
+		}
+	}
+	return ""
 }
 
-// RoundTrip implements http.RoundTrip. It tried to fullfil an *http.Request to
-// its original target host, falling back to a list of nodes in case of failure.
-// After the first failure, it consistently delivers traffic to the fallback
-// host, until original host is back online. If no fallback node is available,
-// it fails with ErrNoFallbackNodeFound. In case of cascaded failure, that is,
-// the fallback node is also offline, it will look for another online host.
+// RoundTrip implements http.RoundTrip. It tries to fullfil an *http.Request to
+// its original target host, falling back to other nodes while the target is
+// unhealthy or its breaker open. Failed calls are sent again to up to
+// cfg.Retries other nodes if they are idempotent or could not reach their
+// node, and if their body is no larger than cfg.MaxBodyBuffer. If no node is
+// available, it fails with ErrNoFallbackNodeFound.
 func (f *FallbackRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if f.cfg.Retries > 0 {
+		if err := rewindable(req, f.cfg.MaxBodyBuffer); err != nil {
+			return nil, err
+		}
+	}
 	targetHost := req.URL.Host
 
-	f.mu.Lock()
-	fallback, ok := f.fallback[targetHost]
-	f.mu.Unlock()
-	if ok {
-		req.URL.Host = fallback
+	node := targetHost
+	if !f.allow(node) {
+		f.metrics.fallback(targetHost)
+		node = f.fallbackHost(targetHost, nil)
+	}
+	if node == "" {
+		return nil, ErrNoFallbackNodeFound
+	}
+
+	var tried []string
+	for {
+		req.URL.Host = node
+		tried = append(tried, node)
+		if len(tried) > 1 {
+			if err := rewind(req); err != nil {
+				return nil, err
+			}
+		}
+
+		start := time.Now()
 		resp, err := f.callNode(req)
-		if err == nil {
+		failed := failedCall(req, resp, err)
+		f.record(node, failed, time.Since(start))
+		if !failed || len(tried) > f.cfg.Retries || !(idempotent(req.Method) || dialFailed(err)) || !resendable(req) {
 			return resp, err
 		}
-		fallback := f.fallbackHost(targetHost, fallback)
-		if fallback == "" {
-			return nil, ErrNoFallbackNodeFound
+
+		if node = f.fallbackHost(targetHost, tried); node == "" {
+			return resp, err
+		}
+		if len(tried) == 1 && tried[0] == targetHost {
+			f.metrics.fallback(targetHost)
+		}
+		if resp != nil {
+			resp.Body.Close()
 		}
-		req.URL.Host = fallback
-		return f.callNode(req)
 	}
+}
 
-	resp, err := f.callNode(req)
-	if err == nil {
-		return resp, err
+func (f *FallbackRoundTripper) callNode(req *http.Request) (*http.Response, error) {
+	if f.cfg.Timeout <= 0 {
+		return f.transport.RoundTrip(req)
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), f.cfg.Timeout)
+	resp, err := f.transport.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
 	}
+	resp.Body = &cancelBody{resp.Body, cancel}
+	return resp, nil
+}
 
-	fallback = f.fallbackHost(targetHost, "")
-	if fallback == "" {
-		return nil, ErrNoFallbackNodeFound
+// cancelBody releases the context of a call once its response is read.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// failedCall tells whether a call failed for its node rather than for the
+// request: it did not get an answer, or a 502, or a 500 outside of the
+// function calls of /r/, which answer 500 when the function fails.
+func failedCall(req *http.Request, resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway:
+		return true
+	case http.StatusInternalServerError:
+		return !strings.HasPrefix(req.URL.Path, "/r/")
 	}
-	req.URL.Host = fallback
-	return f.callNode(req)
+	return false
 }
 
-func (f *FallbackRoundTripper) callNode(req *http.Request) (*http.Response, error) {
-	requestURI := req.RequestURI
-	req.RequestURI = ""
-	resp, err := http.DefaultClient.Do(req)
-	if err == nil {
-		resp.Request.RequestURI = requestURI
+func idempotent(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
+
+// dialFailed tells whether err happened connecting to a node, before the
+// request was sent.
+func dialFailed(err error) bool {
+	op, ok := err.(*net.OpError)
+	return ok && op.Op == "dial"
+}
+
+// rewindable makes sure the body of req can be sent again, keeping it in
+// memory if req.GetBody is not set. Bodies larger than max are left streamed
+// and cannot be sent again.
+func rewindable(req *http.Request, max int64) error {
+	if req.Body == nil || req.GetBody != nil {
+		return nil
+	}
+	if _, ok := req.Body.(*streamedBody); ok {
+		return nil
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(req.Body, max+1))
+	if err != nil {
+		req.Body.Close()
+		return err
+	}
+	if int64(len(body)) > max {
+		req.Body = &streamedBody{io.MultiReader(bytes.NewReader(body), req.Body), req.Body}
+		return nil
+	}
+	req.Body.Close()
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+	req.Body, _ = req.GetBody()
+	return nil
+}
+
+// streamedBody is a body too large to be kept in memory, which the part read
+// to find it out is put back in front of.
+type streamedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// resendable tells whether req can be sent again.
+func resendable(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// rewind sets the body of a rewindable req to be sent again.
+func rewind(req *http.Request) error {
+	if req.GetBody == nil {
+		return nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return err
 	}
-	return resp, err
+	req.Body = body
+	return nil
 }
@@ -0,0 +1,225 @@
+package lb
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testNode is a node answering health checks with health, and calls with its
+// name, their body, and status.
+type testNode struct {
+	name string
+	*httptest.Server
+
+	mu     sync.Mutex
+	health int
+	status int
+	delay  time.Duration
+	calls  int
+}
+
+func newTestNode(name string) *testNode {
+	n := &testNode{name: name, health: http.StatusOK, status: http.StatusOK}
+	n.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n.mu.Lock()
+		health, status, delay := n.health, n.status, n.delay
+		if r.URL.Path != "/version" {
+			n.calls++
+		}
+		n.mu.Unlock()
+
+		if r.URL.Path == "/version" {
+			w.WriteHeader(health)
+			return
+		}
+		time.Sleep(delay)
+		body, _ := ioutil.ReadAll(r.Body)
+		w.WriteHeader(status)
+		w.Write([]byte(n.name + ":" + string(body)))
+	}))
+	return n
+}
+
+func (n *testNode) addr() string {
+	return strings.TrimPrefix(n.URL, "http://")
+}
+
+func (n *testNode) set(f func(n *testNode)) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	f(n)
+}
+
+func (n *testNode) callCount() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.calls
+}
+
+func testRoundTripper(cfg Config, nodes ...*testNode) (*FallbackRoundTripper, func()) {
+	var addrs []string
+	for _, n := range nodes {
+		addrs = append(addrs, n.addr())
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return NewRoundTripper(ctx, NewNodes(addrs), cfg, nil), cancel
+}
+
+func roundTrip(t *testing.T, f *FallbackRoundTripper, method string, node *testNode, path string) (int, string) {
+	req, err := http.NewRequest(method, "http://"+node.addr()+path, strings.NewReader("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := f.RoundTrip(req)
+	if err != nil {
+		return 0, err.Error()
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestRoundTripperHealth(t *testing.T) {
+	a, b := newTestNode("a"), newTestNode("b")
+	defer a.Close()
+	defer b.Close()
+
+	cfg := DefaultConfig
+	cfg.HealthInterval = 10 * time.Millisecond
+	f, cancel := testRoundTripper(cfg, a, b)
+	defer cancel()
+
+	// a accepts connections but is not healthy.
+	a.set(func(n *testNode) { n.health = http.StatusInternalServerError })
+	time.Sleep(50 * time.Millisecond)
+	if code, body := roundTrip(t, f, "POST", a, "/r/app/route"); code != http.StatusOK || body != "b:payload" {
+		t.Errorf("Expected the call to fall back to b but got %d `%s`", code, body)
+	}
+
+	a.set(func(n *testNode) { n.health = http.StatusOK })
+	time.Sleep(50 * time.Millisecond)
+	if code, body := roundTrip(t, f, "POST", a, "/r/app/route"); code != http.StatusOK || body != "a:payload" {
+		t.Errorf("Expected the call to be back on a but got %d `%s`", code, body)
+	}
+
+	b.set(func(n *testNode) { n.health = http.StatusInternalServerError })
+	a.set(func(n *testNode) { n.health = http.StatusInternalServerError })
+	time.Sleep(50 * time.Millisecond)
+	if _, body := roundTrip(t, f, "POST", a, "/r/app/route"); body != ErrNoFallbackNodeFound.Error() {
+		t.Errorf("Expected error `%v` but got `%s`", ErrNoFallbackNodeFound, body)
+	}
+}
+
+func TestRoundTripperBreaker(t *testing.T) {
+	a, b := newTestNode("a"), newTestNode("b")
+	defer a.Close()
+	defer b.Close()
+
+	cfg := DefaultConfig
+	cfg.BreakerMinRequests = 2
+	cfg.BreakerOpenTime = 50 * time.Millisecond
+	cfg.Retries = 0
+	f, cancel := testRoundTripper(cfg, a, b)
+	defer cancel()
+
+	a.set(func(n *testNode) { n.status = http.StatusBadGateway })
+	for i := 0; i < 2; i++ {
+		if code, _ := roundTrip(t, f, "GET", a, "/v1/apps"); code != http.StatusBadGateway {
+			t.Errorf("Test %d: Expected status code 502 from a but got %d", i, code)
+		}
+	}
+
+	// The breaker of a is open, its calls go to b.
+	if code, body := roundTrip(t, f, "GET", a, "/v1/apps"); code != http.StatusOK || body != "b:payload" {
+		t.Errorf("Expected the call to go to b while the breaker of a is open but got %d `%s`", code, body)
+	}
+	if calls := a.callCount(); calls != 2 {
+		t.Errorf("Expected a to get 2 calls but it got %d", calls)
+	}
+
+	// A call tries a again once the breaker has been open long enough.
+	a.set(func(n *testNode) { n.status = http.StatusOK })
+	time.Sleep(60 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if code, body := roundTrip(t, f, "GET", a, "/v1/apps"); code != http.StatusOK || body != "a:payload" {
+			t.Errorf("Test %d: Expected the call to be back on a but got %d `%s`", i, code, body)
+		}
+	}
+}
+
+func TestRoundTripperRetries(t *testing.T) {
+	a, b := newTestNode("a"), newTestNode("b")
+	defer a.Close()
+	defer b.Close()
+
+	cfg := DefaultConfig
+	cfg.Timeout = 50 * time.Millisecond
+	f, cancel := testRoundTripper(cfg, a, b)
+	defer cancel()
+
+	// Calls are only sent again if idempotent.
+	a.set(func(n *testNode) { n.status = http.StatusBadGateway })
+	if code, body := roundTrip(t, f, "GET", a, "/v1/apps"); code != http.StatusOK || body != "b:payload" {
+		t.Errorf("Expected GET to be retried on b but got %d `%s`", code, body)
+	}
+	if code, body := roundTrip(t, f, "POST", a, "/v1/apps"); code != http.StatusBadGateway || body != "a:payload" {
+		t.Errorf("Expected POST not to be retried but got %d `%s`", code, body)
+	}
+
+	// Calls taking too long time out.
+	a.set(func(n *testNode) { n.status, n.delay = http.StatusOK, time.Second })
+	if code, body := roundTrip(t, f, "GET", a, "/v1/apps"); code != http.StatusOK || body != "b:payload" {
+		t.Errorf("Expected GET to time out on a and be retried on b but got %d `%s`", code, body)
+	}
+
+	// Calls which could not reach their node are sent again whatever their
+	// method.
+	a.Close()
+	if code, body := roundTrip(t, f, "POST", a, "/r/app/route"); code != http.StatusOK || body != "b:payload" {
+		t.Errorf("Expected POST to be retried on b but got %d `%s`", code, body)
+	}
+}
+
+func TestRoundTripperLargeBody(t *testing.T) {
+	a, b := newTestNode("a"), newTestNode("b")
+	defer a.Close()
+	defer b.Close()
+	a.set(func(n *testNode) { n.status = http.StatusBadGateway })
+
+	// Bodies are read as a proxy gets them, without GetBody, and are only
+	// sent again up to MaxBodyBuffer.
+	call := func(f *FallbackRoundTripper) (int, string) {
+		req, err := http.NewRequest("GET", "http://"+a.addr()+"/v1/apps", ioutil.NopCloser(strings.NewReader("payload")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := f.RoundTrip(req)
+		if err != nil {
+			return 0, err.Error()
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	cfg := DefaultConfig
+	cfg.MaxBodyBuffer = 7
+	f, cancel := testRoundTripper(cfg, a, b)
+	defer cancel()
+	if code, body := call(f); code != http.StatusOK || body != "b:payload" {
+		t.Errorf("Expected GET with a body of MaxBodyBuffer to be retried on b but got %d `%s`", code, body)
+	}
+
+	cfg.MaxBodyBuffer = 4
+	f, cancel = testRoundTripper(cfg, a, b)
+	defer cancel()
+	if code, body := call(f); code != http.StatusBadGateway || body != "a:payload" {
+		t.Errorf("Expected GET with a larger body to be streamed and not retried but got %d `%s`", code, body)
+	}
+}
@@ -0,0 +1,95 @@
+package lb
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// routeHeader names, in the responses of the nodes, the path of the app the
+// route that served a call is mounted at, such as /users/:id.
+const routeHeader = "Fn-Route"
+
+// maxRoutes bounds the route paths learned for every app.
+const maxRoutes = 1024
+
+// routes learns the paths the routes of the apps are mounted at from the
+// responses to their calls, for the calls to a route to be hashed on its path
+// rather than on their own, which differ with the route parameters.
+type routes struct {
+	mu    sync.RWMutex
+	paths map[string][]string // by app, see routeApp
+}
+
+func newRoutes() *routes {
+	return &routes{paths: make(map[string][]string)}
+}
+
+// routeApp splits the path of req into the app it calls and the path of the
+// call within the app: /r/:app calls, or the calls to an app served at a
+// custom host, which the host stands for.
+func routeApp(req *http.Request) (app, path string) {
+	if !strings.HasPrefix(req.URL.Path, "/r/") {
+		return req.Host, req.URL.Path
+	}
+	rest := req.URL.Path[len("/r/"):]
+	if i := strings.IndexByte(rest, '/'); i >= 0 {
+		return "/r/" + rest[:i], rest[i:]
+	}
+	return "/r/" + rest, ""
+}
+
+// learn records the route path a node answered req with.
+func (r *routes) learn(req *http.Request, resp *http.Response) {
+	path := resp.Header.Get(routeHeader)
+	if path == "" {
+		return
+	}
+	app, _ := routeApp(req)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if paths := r.paths[app]; !contains(paths, path) && len(paths) < maxRoutes {
+		r.paths[app] = append(paths, path)
+	}
+}
+
+// key returns what req is hashed on: its app and the path of the route it
+// calls if learned already, or else its own path.
+func (r *routes) key(req *http.Request) string {
+	app, path := routeApp(req)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if paths := r.paths[app]; !contains(paths, path) {
+		for _, p := range paths {
+			if matchPath(p, path) {
+				return app + p
+			}
+		}
+	}
+	return app + path
+}
+
+// matchPath tells whether path matches the route path p, the :param segments
+// of which match any segment and the final *wildcard segment the rest of the
+// path.
+func matchPath(p, path string) bool {
+	ps, segments := strings.Split(p, "/"), strings.Split(path, "/")
+	for i, s := range ps {
+		if strings.HasPrefix(s, "*") {
+			return i < len(segments)
+		}
+		if i >= len(segments) {
+			return false
+		}
+		if strings.HasPrefix(s, ":") {
+			if segments[i] == "" {
+				return false
+			}
+			continue
+		}
+		if s != segments[i] {
+			return false
+		}
+	}
+	return len(ps) == len(segments)
+}
@@ -0,0 +1,114 @@
+package lb
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iron-io/functions/api/models"
+)
+
+// statsTimeout bounds fetching the stats of a node, so that a node which
+// does not answer does not hold up the stats of the others.
+const statsTimeout = 5 * time.Second
+
+type statsResponse struct {
+	Message string        `json:"message"`
+	Stats   *models.Stats `json:"stats"`
+}
+
+// StatsHandler answers app and route stats requests
+// (/v1/apps/:app/stats and /v1/apps/:app/routes/*route/stats) by querying all
+// nodes and merging their stats. Every other request is handed to next.
+func StatsHandler(nodes *Nodes, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" || !strings.HasPrefix(r.URL.Path, "/v1/apps/") || !strings.HasSuffix(r.URL.Path, "/stats") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		aggregateStats(w, r, nodes.List())
+	})
+}
+
+type nodeStats struct {
+	code int
+	body []byte
+	resp statsResponse
+	err  error
+}
+
+func aggregateStats(w http.ResponseWriter, r *http.Request, nodes []string) {
+	results := make([]nodeStats, len(nodes))
+	var wg sync.WaitGroup
+	for i, node := range nodes {
+		wg.Add(1)
+		go func(i int, node string) {
+			defer wg.Done()
+			results[i] = fetchStats(r, node)
+		}(i, node)
+	}
+	wg.Wait()
+
+	var merged *models.Stats
+	for _, res := range results {
+		if res.err != nil {
+			continue
+		}
+		if res.code != http.StatusOK {
+			// Nodes share the same datastore, so a non-OK answer such
+			// as a 404 is the same everywhere: pass it on as is.
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(res.code)
+			w.Write(res.body)
+			return
+		}
+		if res.resp.Stats == nil {
+			continue
+		}
+		if merged == nil {
+			merged = res.resp.Stats
+			continue
+		}
+		merged.Merge(res.resp.Stats)
+	}
+
+	if merged == nil {
+		writeError(w, http.StatusBadGateway, ErrNoFallbackNodeFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, statsResponse{"Successfully loaded stats", merged})
+}
+
+func fetchStats(r *http.Request, node string) nodeStats {
+	u := *r.URL
+	u.Scheme = "http"
+	u.Host = node
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nodeStats{err: err}
+	}
+	req.Header = r.Header
+
+	ctx, cancel := context.WithTimeout(r.Context(), statsTimeout)
+	defer cancel()
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nodeStats{err: err}
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nodeStats{err: err}
+	}
+	res := nodeStats{code: resp.StatusCode, body: body}
+	if resp.StatusCode == http.StatusOK {
+		res.err = json.Unmarshal(body, &res.resp)
+	}
+	return res
+}